@@ -0,0 +1,144 @@
+package remotewrite
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// latencyWeight is the weight of the last observation in the moving average of the Store latency.
+const latencyWeight = 0.3
+
+// flushPeriod adapts the flush period to the latency of the endpoint: when
+// flushing takes more than half of the period, which leads to overlapping
+// flushes and dropped samples, the period is stretched so that each flush sends
+// more samples in fewer requests; once the endpoint is fast again, it shrinks
+// back. The period stays within min and max. It is safe for concurrent use.
+type flushPeriod struct {
+	mu       sync.Mutex
+	min, max time.Duration
+	period   time.Duration
+	// latency is the moving average of the Store latency.
+	latency time.Duration
+}
+
+func newFlushPeriod(period, min, max time.Duration) (*flushPeriod, error) {
+	if min <= 0 || max < min {
+		return nil, fmt.Errorf("invalid adaptive flush period bounds %s and %s", min, max)
+	}
+	fp := &flushPeriod{min: min, max: max}
+	fp.period = fp.clamp(period)
+	return fp, nil
+}
+
+// observe records the latency of a request to the endpoint. It's a no-op on a nil receiver.
+func (fp *flushPeriod) observe(latency time.Duration) {
+	if fp == nil {
+		return
+	}
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	if fp.latency == 0 {
+		fp.latency = latency
+		return
+	}
+	fp.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(fp.latency))
+}
+
+// next returns the period before the next flush given the duration of the last
+// one, and whether it changed.
+func (fp *flushPeriod) next(flushDuration time.Duration) (time.Duration, bool) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	load := flushDuration
+	if fp.latency > load {
+		load = fp.latency
+	}
+
+	period := fp.period
+	switch {
+	case load > period/2:
+		period = fp.clamp(2 * load)
+	case load < period/4:
+		period = fp.clamp(period * 3 / 4)
+	}
+
+	changed := period != fp.period
+	fp.period = period
+	return period, changed
+}
+
+// current returns the period before the next flush.
+func (fp *flushPeriod) current() time.Duration {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return fp.period
+}
+
+func (fp *flushPeriod) clamp(d time.Duration) time.Duration {
+	if d < fp.min {
+		return fp.min
+	}
+	if d > fp.max {
+		return fp.max
+	}
+	return d
+}
+
+// adaptiveFlusher works as output.PeriodicFlusher, flushing one last time when
+// stopped, but waits the period given by flushPeriod between flushes.
+type adaptiveFlusher struct {
+	period  *flushPeriod
+	flush   func()
+	logger  logrus.FieldLogger
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func newAdaptiveFlusher(period *flushPeriod, flush func(), logger logrus.FieldLogger) *adaptiveFlusher {
+	f := &adaptiveFlusher{
+		period:  period,
+		flush:   flush,
+		logger:  logger,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go f.run()
+	return f
+}
+
+func (f *adaptiveFlusher) run() {
+	timer := time.NewTimer(f.period.current())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			start := time.Now()
+			f.flush()
+			period, changed := f.period.next(time.Since(start))
+			if changed {
+				f.logger.WithField("flush_period", period.String()).
+					Info("Prometheus: adapting the flush period to the endpoint latency")
+			}
+			timer.Reset(period)
+		case <-f.stop:
+			f.flush()
+			close(f.stopped)
+			return
+		}
+	}
+}
+
+// Stop waits for the last flush. It can be called several times.
+func (f *adaptiveFlusher) Stop() {
+	f.once.Do(func() {
+		close(f.stop)
+	})
+	<-f.stopped
+}
@@ -0,0 +1,68 @@
+package remotewrite
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlushPeriod(t *testing.T) {
+	t.Parallel()
+
+	fp, err := newFlushPeriod(time.Second, 500*time.Millisecond, 10*time.Second)
+	require.NoError(t, err)
+
+	// fast enough, unchanged
+	period, changed := fp.next(400 * time.Millisecond)
+	assert.Equal(t, time.Second, period)
+	assert.False(t, changed)
+
+	// slow endpoint, stretched to twice the latency
+	fp.observe(2 * time.Second)
+	period, changed = fp.next(100 * time.Millisecond)
+	assert.Equal(t, 4*time.Second, period)
+	assert.True(t, changed)
+
+	// within the bounds
+	period, _ = fp.next(time.Minute)
+	assert.Equal(t, 10*time.Second, period)
+
+	// shrinks back as the latency decreases
+	for i := 0; i < 50; i++ {
+		fp.observe(10 * time.Millisecond)
+		period, _ = fp.next(10 * time.Millisecond)
+	}
+	assert.Equal(t, 500*time.Millisecond, period)
+	assert.Equal(t, period, fp.current())
+
+	_, err = newFlushPeriod(time.Second, 0, time.Second)
+	assert.Error(t, err)
+	_, err = newFlushPeriod(time.Second, time.Second, time.Millisecond)
+	assert.Error(t, err)
+
+	// nil-safe
+	var empty *flushPeriod
+	empty.observe(time.Second)
+}
+
+func TestAdaptiveFlusher(t *testing.T) {
+	t.Parallel()
+
+	fp, err := newFlushPeriod(10*time.Millisecond, 10*time.Millisecond, time.Second)
+	require.NoError(t, err)
+
+	var flushes int32
+	f := newAdaptiveFlusher(fp, func() { atomic.AddInt32(&flushes, 1) }, logrus.New())
+	time.Sleep(50 * time.Millisecond)
+	f.Stop()
+	f.Stop()
+
+	n := atomic.LoadInt32(&flushes)
+	assert.Greater(t, n, int32(1))
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, n, atomic.LoadInt32(&flushes), "no flush after Stop")
+}
@@ -0,0 +1,85 @@
+package remotewrite
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// oldSampleAction is what happens to the samples older than MaxSampleAge.
+type oldSampleAction string
+
+const (
+	oldSampleDrop    oldSampleAction = "drop"
+	oldSampleRewrite oldSampleAction = "rewrite"
+)
+
+func parseOldSampleAction(action string) (oldSampleAction, error) {
+	switch a := oldSampleAction(action); a {
+	case oldSampleDrop, oldSampleRewrite:
+		return a, nil
+	default:
+		return "", fmt.Errorf("invalid oldSampleAction %q, it must be drop or rewrite", action)
+	}
+}
+
+// limitSampleAge removes the samples older than maxAge from the series, as
+// endpoints reject samples out of their out-of-order window, e.g. when flushing
+// falls behind. With rewrite, the latest of the old samples of a series is
+// kept with the timestamp of now instead, unless the series has newer samples:
+// since the values of the series are cumulative, it then supersedes them.
+// It returns the remaining series with the number of dropped and adjusted samples.
+func limitSampleAge(
+	series []prompb.TimeSeries, now time.Time, maxAge time.Duration, action oldSampleAction,
+) ([]prompb.TimeSeries, int, int) {
+	if maxAge <= 0 {
+		return series, 0, 0
+	}
+
+	var (
+		cutoff   = timestamp.FromTime(now.Add(-maxAge))
+		ts       = timestamp.FromTime(now)
+		dropped  int
+		adjusted int
+		result   = series[:0]
+	)
+	for _, s := range series {
+		// samples are ordered by time
+		old := 0
+		for old < len(s.Samples) && s.Samples[old].Timestamp < cutoff {
+			old++
+		}
+		oldHistograms := 0
+		for oldHistograms < len(s.Histograms) && s.Histograms[oldHistograms].Timestamp < cutoff {
+			oldHistograms++
+		}
+
+		if action == oldSampleRewrite && old == len(s.Samples) && old > 0 {
+			s.Samples = []prompb.Sample{{Value: s.Samples[old-1].Value, Timestamp: ts}}
+			dropped += old - 1
+			adjusted++
+		} else {
+			s.Samples = s.Samples[old:]
+			dropped += old
+		}
+
+		if action == oldSampleRewrite && oldHistograms == len(s.Histograms) && oldHistograms > 0 {
+			h := s.Histograms[oldHistograms-1]
+			h.Timestamp = ts
+			s.Histograms = []prompb.Histogram{h}
+			dropped += oldHistograms - 1
+			adjusted++
+		} else {
+			s.Histograms = s.Histograms[oldHistograms:]
+			dropped += oldHistograms
+		}
+
+		if len(s.Samples) == 0 && len(s.Histograms) == 0 {
+			continue
+		}
+		result = append(result, s)
+	}
+	return result, dropped, adjusted
+}
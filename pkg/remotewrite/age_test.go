@@ -0,0 +1,58 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitSampleAge(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	at := func(ago time.Duration) int64 {
+		return timestamp.FromTime(now.Add(-ago))
+	}
+	newSeries := func() []prompb.TimeSeries {
+		return []prompb.TimeSeries{
+			{
+				Labels:  []prompb.Label{{Name: "__name__", Value: "old"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: at(20 * time.Minute)}, {Value: 2, Timestamp: at(15 * time.Minute)}},
+			},
+			{
+				Labels:  []prompb.Label{{Name: "__name__", Value: "mixed"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: at(15 * time.Minute)}, {Value: 2, Timestamp: at(time.Minute)}},
+			},
+			{
+				Labels:     []prompb.Label{{Name: "__name__", Value: "histogram"}},
+				Histograms: []prompb.Histogram{{Sum: 5, Timestamp: at(time.Hour)}},
+			},
+		}
+	}
+
+	series, dropped, adjusted := limitSampleAge(newSeries(), now, 0, oldSampleDrop)
+	assert.Equal(t, newSeries(), series)
+	assert.Zero(t, dropped)
+	assert.Zero(t, adjusted)
+
+	series, dropped, adjusted = limitSampleAge(newSeries(), now, 10*time.Minute, oldSampleDrop)
+	require.Len(t, series, 1)
+	assert.Equal(t, []prompb.Sample{{Value: 2, Timestamp: at(time.Minute)}}, series[0].Samples)
+	assert.Equal(t, 4, dropped)
+	assert.Zero(t, adjusted)
+
+	series, dropped, adjusted = limitSampleAge(newSeries(), now, 10*time.Minute, oldSampleRewrite)
+	require.Len(t, series, 3)
+	assert.Equal(t, []prompb.Sample{{Value: 2, Timestamp: timestamp.FromTime(now)}}, series[0].Samples)
+	assert.Equal(t, []prompb.Sample{{Value: 2, Timestamp: at(time.Minute)}}, series[1].Samples)
+	assert.Equal(t, []prompb.Histogram{{Sum: 5, Timestamp: timestamp.FromTime(now)}}, series[2].Histograms)
+	assert.Equal(t, 2, dropped)
+	assert.Equal(t, 2, adjusted)
+
+	_, err := parseOldSampleAction("keep")
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+package remotewrite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// azureAuthMode is how the Azure AD (Entra ID) tokens of Azure Monitor are obtained.
+type azureAuthMode string
+
+const (
+	azureAuthNone azureAuthMode = ""
+	// azureAuthClientSecret uses the client credentials of an app registration
+	azureAuthClientSecret azureAuthMode = "client-secret"
+	// azureAuthManagedIdentity asks the instance metadata service, with the client
+	// ID of a user-assigned identity or else the system-assigned one
+	azureAuthManagedIdentity azureAuthMode = "managed-identity"
+)
+
+const (
+	defaultAzureAudience      = "https://monitor.azure.com"
+	defaultAzureAuthorityHost = "https://login.microsoftonline.com"
+
+	// azureIMDSEndpoint is the token endpoint of the Azure instance metadata service.
+	azureIMDSEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	azureIMDSVersion  = "2018-02-01"
+
+	// maxTokenRefreshMargin is how long before they expire, at most, tokens are refreshed.
+	maxTokenRefreshMargin = 5 * time.Minute
+)
+
+func parseAzureAuthMode(m string) (azureAuthMode, error) {
+	switch mm := azureAuthMode(m); mm {
+	case azureAuthNone, azureAuthClientSecret, azureAuthManagedIdentity:
+		return mm, nil
+	default:
+		return "", fmt.Errorf("invalid azureAuth %q, it must be client-secret or managed-identity", m)
+	}
+}
+
+// azureTokenSource returns the source of the tokens of the configured Azure
+// authentication, nil without it. The tokens of the client credentials are
+// fetched with the client, those of the managed identity never go through a proxy.
+func (conf Config) azureTokenSource() func(client *http.Client) oauth2.TokenSource {
+	audience := strings.TrimSuffix(conf.AzureAudience.String, "/")
+	switch azureAuthMode(conf.AzureAuth.String) {
+	case azureAuthClientSecret:
+		ccConfig := &clientcredentials.Config{
+			ClientID:     conf.AzureClientID.String,
+			ClientSecret: conf.AzureClientSecret.String,
+			TokenURL: fmt.Sprintf("%s/%s/oauth2/v2.0/token",
+				strings.TrimSuffix(conf.AzureAuthorityHost.String, "/"), url.PathEscape(conf.AzureTenantID.String)),
+			Scopes: []string{audience + "/.default"},
+		}
+		return func(client *http.Client) oauth2.TokenSource {
+			ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+			return refreshingTokenSource(func() (*oauth2.Token, error) {
+				return ccConfig.Token(ctx)
+			})
+		}
+	case azureAuthManagedIdentity:
+		identity := &azureManagedIdentity{
+			client:   &http.Client{Transport: &http.Transport{Proxy: nil}, Timeout: 30 * time.Second},
+			endpoint: azureIMDSEndpoint,
+			resource: audience,
+			clientID: conf.AzureClientID.String,
+		}
+		return func(*http.Client) oauth2.TokenSource {
+			return refreshingTokenSource(identity.token)
+		}
+	default:
+		return nil
+	}
+}
+
+// azureManagedIdentity gets the tokens of a managed identity from the instance metadata service.
+type azureManagedIdentity struct {
+	client   *http.Client
+	endpoint string
+	resource string
+	// clientID selects a user-assigned identity, the system-assigned one is used if empty
+	clientID string
+}
+
+func (m *azureManagedIdentity) token() (*oauth2.Token, error) {
+	query := url.Values{}
+	query.Set("api-version", azureIMDSVersion)
+	query.Set("resource", m.resource)
+	if m.clientID != "" {
+		query.Set("client_id", m.clientID)
+	}
+	req, err := http.NewRequest(http.MethodGet, m.endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the managed identity token: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the managed identity token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get the managed identity token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		// the number of seconds since the epoch, as a string
+		ExpiresOn string `json:"expires_on"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("invalid managed identity token: %w", err)
+	}
+	expiresOn, err := strconv.ParseInt(token.ExpiresOn, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expiry of the managed identity token %q: %w", token.ExpiresOn, err)
+	}
+	return &oauth2.Token{
+		AccessToken: token.AccessToken,
+		TokenType:   token.TokenType,
+		Expiry:      time.Unix(expiresOn, 0),
+	}, nil
+}
+
+// tokenSourceFunc fetches a new token on every call.
+type tokenSourceFunc func() (*oauth2.Token, error)
+
+func (f tokenSourceFunc) Token() (*oauth2.Token, error) {
+	return f()
+}
+
+// refreshingTokenSource caches the tokens of fetch, and fetches a new one before
+// the current one expires: a fifth of its lifetime before, up to maxTokenRefreshMargin,
+// so that no request is sent with a token that expires on the way.
+func refreshingTokenSource(fetch func() (*oauth2.Token, error)) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, tokenSourceFunc(func() (*oauth2.Token, error) {
+		token, err := fetch()
+		if err != nil || token.Expiry.IsZero() {
+			return token, err
+		}
+		margin := time.Until(token.Expiry) / 5
+		if margin > maxTokenRefreshMargin {
+			margin = maxTokenRefreshMargin
+		}
+		early := *token
+		early.Expiry = token.Expiry.Add(-margin)
+		return &early, nil
+	}))
+}
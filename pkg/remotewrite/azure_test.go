@@ -0,0 +1,139 @@
+package remotewrite
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestHTTPClientAzureClientSecret(t *testing.T) {
+	t.Parallel()
+
+	var tokenRequests int
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		user, password, _ := r.BasicAuth()
+		if r.URL.Path != "/tenant/oauth2/v2.0/token" || user != "app" || password != "secret" ||
+			r.FormValue("scope") != "https://monitor.azure.com/.default" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"aad-token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+	config.AzureAuth = null.StringFrom("client-secret")
+	config.AzureTenantID = null.StringFrom("tenant")
+	config.AzureClientID = null.StringFrom("app")
+	config.AzureClientSecret = null.StringFrom("secret")
+	config.AzureAuthorityHost = null.StringFrom(tokenServer.URL + "/")
+	require.NoError(t, config.Validate())
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	require.NoError(t, client.Store(context.Background(), []byte("payload")))
+	require.NoError(t, client.Store(context.Background(), []byte("payload")))
+	assert.Equal(t, "Bearer aad-token", authorization)
+	assert.Equal(t, 1, tokenRequests)
+}
+
+func TestAzureManagedIdentityToken(t *testing.T) {
+	t.Parallel()
+
+	expiresOn := time.Now().Add(time.Hour).Truncate(time.Second)
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.FormValue("resource") != "https://monitor.azure.com" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_request"}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"access_token":"mi-token-%s","token_type":"Bearer","expires_on":"%d"}`,
+			r.FormValue("client_id"), expiresOn.Unix())
+	}))
+	defer imds.Close()
+
+	identity := &azureManagedIdentity{
+		client:   imds.Client(),
+		endpoint: imds.URL,
+		resource: "https://monitor.azure.com",
+		clientID: "user-assigned",
+	}
+	token, err := identity.token()
+	require.NoError(t, err)
+	assert.Equal(t, "mi-token-user-assigned", token.AccessToken)
+	assert.Equal(t, expiresOn, token.Expiry)
+
+	identity.resource = "https://other.example.com"
+	_, err = identity.token()
+	assert.ErrorContains(t, err, "400 Bad Request")
+}
+
+func TestRefreshingTokenSource(t *testing.T) {
+	t.Parallel()
+
+	var fetched int
+	lifetime := time.Hour
+	source := refreshingTokenSource(func() (*oauth2.Token, error) {
+		fetched++
+		return &oauth2.Token{AccessToken: fmt.Sprint(fetched), Expiry: time.Now().Add(lifetime)}, nil
+	})
+
+	token, err := source.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "1", token.AccessToken)
+	// refreshed 5 minutes before the expiry
+	assert.WithinDuration(t, time.Now().Add(lifetime-maxTokenRefreshMargin), token.Expiry, time.Second)
+
+	_, err = source.Token()
+	require.NoError(t, err)
+	assert.Equal(t, 1, fetched)
+
+	// a fifth of the lifetime of the short-lived ones
+	lifetime = 10 * time.Second
+	source = refreshingTokenSource(func() (*oauth2.Token, error) {
+		return &oauth2.Token{AccessToken: "short", Expiry: time.Now().Add(lifetime)}, nil
+	})
+	token, err = source.Token()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(8*time.Second), token.Expiry, time.Second)
+}
+
+func TestValidateAzureAuth(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.AzureAuth = null.StringFrom("client-secret")
+	config.AzureClientID = null.StringFrom("app")
+	assert.ErrorContains(t, config.Validate(), "K6_PROMETHEUS_AZURE_TENANT_ID")
+
+	config.AzureAuth = null.StringFrom("managed-identity")
+	require.NoError(t, config.Validate())
+
+	config.BearerToken = null.StringFrom("token")
+	assert.ErrorContains(t, config.Validate(), "only one authentication method")
+
+	config = NewConfig()
+	config.AzureAuth = null.StringFrom("workload-identity")
+	assert.ErrorContains(t, config.Validate(), "invalid azureAuth")
+}
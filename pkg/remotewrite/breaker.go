@@ -0,0 +1,162 @@
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/sirupsen/logrus"
+)
+
+// errCircuitOpen is the error of the requests not sent because the circuit breaker is open.
+var errCircuitOpen = errors.New("circuit breaker is open, the request was not sent")
+
+// circuitState is the state of a circuit breaker, sent as the value of its self-metric.
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitHalfOpen
+	circuitOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitHalfOpen:
+		return "half-open"
+	case circuitOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// breakerClient stops sending requests to an endpoint that is down: after threshold
+// consecutive recoverable errors, the circuit opens and requests fail right away
+// with errCircuitOpen. Once open for cooldown, a single request at a time is sent
+// as a probe: the circuit closes if it succeeds and opens again otherwise.
+type breakerClient struct {
+	client remote.WriteClient
+	// label tells the breakers of the failover and mirror endpoints apart in the self-metrics
+	label     string
+	threshold int
+	cooldown  time.Duration
+	logger    logrus.FieldLogger
+	self      *selfMetrics
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+var _ remote.WriteClient = &breakerClient{}
+
+// withCircuitBreaker returns client wrapped in a circuit breaker if BreakerThreshold is set,
+// its state being reported with the label.
+func withCircuitBreaker(
+	client remote.WriteClient, label string, config Config, logger logrus.FieldLogger, self *selfMetrics,
+) remote.WriteClient {
+	if config.BreakerThreshold.Int64 <= 0 {
+		return client
+	}
+	c := &breakerClient{
+		client:    client,
+		label:     label,
+		threshold: int(config.BreakerThreshold.Int64),
+		cooldown:  time.Duration(config.BreakerCooldown.Duration),
+		logger:    logger,
+		self:      self,
+		now:       time.Now,
+	}
+	self.setCircuitState(label, circuitClosed)
+	return c
+}
+
+func (c *breakerClient) Name() string {
+	return c.client.Name()
+}
+
+func (c *breakerClient) Endpoint() string {
+	return c.client.Endpoint()
+}
+
+// Store returns errCircuitOpen as a recoverable error while the circuit is open,
+// so that the request is kept in the WAL if it's enabled.
+func (c *breakerClient) Store(ctx context.Context, req []byte) error {
+	if !c.allow() {
+		return recoverableError{err: errCircuitOpen}
+	}
+	err := c.client.Store(ctx, req)
+	c.observe(err)
+	return err
+}
+
+// allow returns true if the request can be sent: always while the circuit is
+// closed and, once it has been open for cooldown, for one probe at a time.
+func (c *breakerClient) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case circuitClosed:
+		return true
+	case circuitOpen:
+		if c.now().Sub(c.openedAt) < c.cooldown {
+			return false
+		}
+		c.setState(circuitHalfOpen)
+		return true
+	default:
+		// a probe is already being sent
+		return false
+	}
+}
+
+// observe counts the consecutive recoverable errors and opens the circuit when
+// they reach the threshold or when a probe fails. Non-recoverable errors are
+// about the request, not the endpoint, so they close it as a success does.
+func (c *breakerClient) observe(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil || !isRecoverable(err) {
+		c.failures = 0
+		if c.state != circuitClosed {
+			c.logger.WithField("url", c.client.Endpoint()).Info("Prometheus: endpoint available again, closing the circuit breaker")
+			c.setState(circuitClosed)
+		}
+		return
+	}
+
+	c.failures++
+	switch {
+	case c.state == circuitHalfOpen:
+		// the endpoint is still down, it was already logged when the circuit opened
+		c.logger.WithError(err).Debug("Prometheus: circuit breaker probe failed")
+	case c.state == circuitClosed && c.failures >= c.threshold:
+		c.logger.WithError(err).WithFields(logrus.Fields{"url": c.client.Endpoint(), "cooldown": c.cooldown}).
+			Warn("Prometheus: endpoint failed too many times, opening the circuit breaker")
+	default:
+		return
+	}
+	c.openedAt = c.now()
+	c.setState(circuitOpen)
+}
+
+// Close closes the wrapped client if it keeps connections open, e.g. to Kafka.
+func (c *breakerClient) Close() error {
+	if closer, ok := c.client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (c *breakerClient) setState(state circuitState) {
+	c.state = state
+	c.self.setCircuitState(c.label, state)
+}
@@ -0,0 +1,140 @@
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+func newTestBreaker(t *testing.T, client remote.WriteClient, self *selfMetrics) (*breakerClient, *time.Time) {
+	t.Helper()
+	config := NewConfig()
+	config.BreakerThreshold = null.IntFrom(2)
+	config.BreakerCooldown = types.NullDurationFrom(time.Minute)
+
+	c, ok := withCircuitBreaker(client, "fake", config, logrus.New(), self).(*breakerClient)
+	require.True(t, ok)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestBreakerClient(t *testing.T) {
+	t.Parallel()
+
+	down := recoverableError{err: errors.New("503 Service Unavailable")}
+	endpoint := &fakeWriteClient{url: "endpoint", err: down}
+	self := newSelfMetrics()
+	c, now := newTestBreaker(t, endpoint, self)
+
+	ctx := context.Background()
+	assert.Equal(t, down, c.Store(ctx, nil))
+	assert.Equal(t, down, c.Store(ctx, nil))
+	assert.Equal(t, circuitOpen, c.state)
+
+	// while open, requests fail without reaching the endpoint
+	err := c.Store(ctx, nil)
+	assert.ErrorIs(t, err, errCircuitOpen)
+	assert.True(t, isRecoverable(err))
+	assert.Equal(t, errorClassCircuitOpen, classifyError(err))
+	assert.Equal(t, 2, endpoint.calls)
+
+	// a failed probe opens the circuit again right away
+	*now = now.Add(time.Minute)
+	assert.Equal(t, down, c.Store(ctx, nil))
+	assert.Equal(t, 3, endpoint.calls)
+	assert.ErrorIs(t, c.Store(ctx, nil), errCircuitOpen)
+	assert.Equal(t, 3, endpoint.calls)
+
+	endpoint.setErr(nil)
+	*now = now.Add(time.Minute)
+	require.NoError(t, c.Store(ctx, nil))
+	require.NoError(t, c.Store(ctx, nil))
+	assert.Equal(t, 5, endpoint.calls)
+	assert.Equal(t, circuitClosed, c.state)
+
+	fields := self.fields()
+	assert.Equal(t, map[string]string{"fake": "closed"}, fields["circuit_breakers"])
+	assert.Equal(t, uint64(2), self.circuitOpens["fake"])
+}
+
+func TestBreakerClientHalfOpen(t *testing.T) {
+	t.Parallel()
+
+	endpoint := &fakeWriteClient{url: "endpoint", err: recoverableError{err: errors.New("connection refused")}}
+	c, now := newTestBreaker(t, endpoint, nil)
+
+	ctx := context.Background()
+	assert.Error(t, c.Store(ctx, nil))
+	assert.Error(t, c.Store(ctx, nil))
+
+	// only one probe is sent at a time
+	*now = now.Add(time.Minute)
+	assert.True(t, c.allow())
+	assert.Equal(t, circuitHalfOpen, c.state)
+	assert.False(t, c.allow())
+}
+
+func TestBreakerClientNonRecoverable(t *testing.T) {
+	t.Parallel()
+
+	endpoint := &fakeWriteClient{url: "endpoint", err: errors.New("400 Bad Request")}
+	c, _ := newTestBreaker(t, endpoint, nil)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		assert.Error(t, c.Store(ctx, nil))
+	}
+	assert.Equal(t, circuitClosed, c.state)
+	assert.Equal(t, 3, endpoint.calls)
+}
+
+func TestNewClientCircuitBreakerPerEndpoint(t *testing.T) {
+	t.Parallel()
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer primary.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mirror.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(primary.URL)
+	config.MirrorUrls = []string{mirror.URL}
+	config.BreakerThreshold = null.IntFrom(1)
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	self := newSelfMetrics()
+	client, err := newClient("prometheus", remoteConfig, protocolV1, config, logrus.New(), self)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_ = client.Store(context.Background(), nil)
+	}
+
+	// the dead mirror doesn't open the circuit of the primary endpoint
+	assert.Equal(t, map[string]string{
+		"prometheus": "closed",
+		mirror.URL:   "open",
+	}, self.fields()["circuit_breakers"])
+}
+
+func TestWithCircuitBreakerDisabled(t *testing.T) {
+	t.Parallel()
+
+	endpoint := &fakeWriteClient{url: "endpoint"}
+	assert.Same(t, endpoint, withCircuitBreaker(endpoint, "fake", NewConfig(), logrus.New(), nil))
+}
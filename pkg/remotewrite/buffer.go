@@ -0,0 +1,308 @@
+package remotewrite
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"go.k6.io/k6/metrics"
+)
+
+// bufferPolicy is what happens to the samples received while the buffer is full.
+type bufferPolicy string
+
+const (
+	bufferDropOldest bufferPolicy = "drop-oldest"
+	bufferDropNewest bufferPolicy = "drop-newest"
+	bufferBlock      bufferPolicy = "block"
+)
+
+func parseBufferPolicy(policy string) (bufferPolicy, error) {
+	switch p := bufferPolicy(policy); p {
+	case bufferDropOldest, bufferDropNewest, bufferBlock:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid bufferPolicy %q, it must be drop-oldest, drop-newest or block", policy)
+	}
+}
+
+// sampleBuffer holds the samples received from k6 until the next flush, up to
+// capacity samples. When a flush falls behind because the endpoint is slow,
+// the samples received meanwhile are dropped, the oldest or the newest ones,
+// or k6 is slowed down until the flush takes them. Samples are dropped per
+// container, as received from k6. With a memory limit, the capacity is lowered
+// to the samples fitting in it or, with spill, the samples beyond it are
+// written to disk until they are taken. It is safe for concurrent use.
+type sampleBuffer struct {
+	mu      sync.Mutex
+	notFull *sync.Cond
+
+	capacity int
+	policy   bufferPolicy
+
+	containers []metrics.SampleContainer
+	samples    int
+	// dropped counts the samples dropped since the last take.
+	dropped int
+	closed  bool
+
+	// spill writes the samples to disk beyond memorySamples samples in memory
+	spill         *sampleSpill
+	memorySamples int
+	files         []spillFile
+	spilled       int
+	// spillErr is the first error of the spill since the last take.
+	spillErr error
+	self     *selfMetrics
+}
+
+// newSampleBuffer returns a buffer without limit if capacity is not positive.
+func newSampleBuffer(capacity int, policy bufferPolicy) *sampleBuffer {
+	b := &sampleBuffer{
+		capacity: capacity,
+		policy:   policy,
+	}
+	b.notFull = sync.NewCond(&b.mu)
+	return b
+}
+
+// limitMemory keeps the samples within about limit bytes of memory: those beyond it
+// are written to disk with spill, or handled according to the policy without it.
+func (b *sampleBuffer) limitMemory(limit int, spill *sampleSpill, self *selfMetrics) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	samples := limit / estimatedSampleSize
+	if samples < 1 {
+		samples = 1
+	}
+	if spill == nil {
+		if b.capacity <= 0 || samples < b.capacity {
+			b.capacity = samples
+		}
+		return
+	}
+	b.spill, b.memorySamples, b.self = spill, samples, self
+}
+
+// add buffers the containers and returns the number of samples dropped to stay within capacity.
+func (b *sampleBuffer) add(containers []metrics.SampleContainer) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dropped := b.addLocked(containers) + b.spillLocked()
+	b.dropped += dropped
+	return dropped
+}
+
+func (b *sampleBuffer) addLocked(containers []metrics.SampleContainer) int {
+	n := countContainerSamples(containers)
+	if b.capacity <= 0 {
+		b.append(containers, n)
+		return 0
+	}
+
+	if b.policy == bufferBlock {
+		// more than capacity is accepted at once by an empty buffer, it would block forever otherwise
+		for !b.closed && b.buffered() > 0 && b.buffered()+n > b.capacity {
+			b.notFull.Wait()
+		}
+		if b.closed {
+			return n
+		}
+		b.append(containers, n)
+		return 0
+	}
+
+	var dropped int
+	if b.policy == bufferDropNewest {
+		for _, container := range containers {
+			size := len(container.GetSamples())
+			if b.buffered()+size > b.capacity {
+				dropped += size
+				continue
+			}
+			b.append([]metrics.SampleContainer{container}, size)
+		}
+		return dropped
+	}
+
+	b.append(containers, n)
+	// the spilled samples are the oldest ones
+	for b.buffered() > b.capacity && len(b.files) > 0 {
+		dropped += b.files[0].samples
+		b.spilled -= b.files[0].samples
+		_ = os.Remove(b.files[0].name)
+		b.files = b.files[1:]
+	}
+	var oldest int
+	for b.buffered() > b.capacity && oldest < len(b.containers)-1 {
+		size := len(b.containers[oldest].GetSamples())
+		b.samples -= size
+		dropped += size
+		oldest++
+	}
+	b.containers = b.containers[oldest:]
+	return dropped
+}
+
+// spillLocked writes the containers in memory to disk once they exceed the memory
+// limit. If it fails, the newest ones beyond the limit are dropped and it returns their samples.
+func (b *sampleBuffer) spillLocked() int {
+	if b.spill == nil || b.samples <= b.memorySamples {
+		return 0
+	}
+	f, err := b.spill.write(b.containers)
+	if err == nil {
+		b.files = append(b.files, f)
+		b.spilled += f.samples
+		b.self.addSamplesSpilled(f.samples)
+		b.containers, b.samples = nil, 0
+		return 0
+	}
+
+	if b.spillErr == nil {
+		b.spillErr = err
+	}
+	var dropped int
+	for b.samples > b.memorySamples && len(b.containers) > 0 {
+		size := len(b.containers[len(b.containers)-1].GetSamples())
+		b.containers = b.containers[:len(b.containers)-1]
+		b.samples -= size
+		dropped += size
+	}
+	return dropped
+}
+
+// buffered returns the number of samples buffered, in memory and on disk.
+func (b *sampleBuffer) buffered() int {
+	return b.samples + b.spilled
+}
+
+func (b *sampleBuffer) append(containers []metrics.SampleContainer, n int) {
+	b.containers = append(b.containers, containers...)
+	b.samples += n
+}
+
+// take empties the buffer and returns its containers with the number of
+// samples dropped since the previous call and the first error of the spill, if any.
+// The spilled samples are taken first, the oldest files up to the memory limit,
+// so that the buffer is only emptied once all of them are taken.
+func (b *sampleBuffer) take() ([]metrics.SampleContainer, int, error) {
+	b.mu.Lock()
+	var (
+		files []spillFile
+		n     int
+	)
+	for len(b.files) > 0 && (len(files) == 0 || n+b.files[0].samples <= b.memorySamples) {
+		files = append(files, b.files[0])
+		n += b.files[0].samples
+		b.files = b.files[1:]
+	}
+	b.spilled -= n
+
+	var containers []metrics.SampleContainer
+	if len(b.files) == 0 {
+		containers = b.containers
+		b.containers, b.samples = nil, 0
+	}
+	dropped, err := b.dropped, b.spillErr
+	b.dropped, b.spillErr = 0, nil
+	b.notFull.Broadcast()
+	b.mu.Unlock()
+
+	// the files are read without holding the lock, not to block k6 meanwhile
+	spilled := make([]metrics.SampleContainer, 0, len(files))
+	for _, f := range files {
+		read, readErr := b.spill.read(f)
+		spilled = append(spilled, read...)
+		if readErr != nil {
+			// the samples not read back are lost
+			lost := f.samples - countContainerSamples(read)
+			b.self.addSamplesDropped(lost)
+			dropped += lost
+			if err == nil {
+				err = readErr
+			}
+		}
+	}
+	if len(spilled) == 0 {
+		return containers, dropped, err
+	}
+	return append(spilled, containers...), dropped, err
+}
+
+// bufferStats are the samples waiting in the buffer, as served by the debug listener.
+type bufferStats struct {
+	Samples    int          `json:"samples"`
+	Spilled    int          `json:"spilled"`
+	SpillFiles int          `json:"spillFiles"`
+	Dropped    int          `json:"dropped"`
+	Capacity   int          `json:"capacity"`
+	Policy     bufferPolicy `json:"policy"`
+}
+
+// stats returns the samples buffered, in memory and on disk, and those dropped since the last take.
+func (b *sampleBuffer) stats() bufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bufferStats{
+		Samples:    b.samples,
+		Spilled:    b.spilled,
+		SpillFiles: len(b.files),
+		Dropped:    b.dropped,
+		Capacity:   b.capacity,
+		Policy:     b.policy,
+	}
+}
+
+// empty reports whether there are no samples to flush.
+func (b *sampleBuffer) empty() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.containers) == 0 && len(b.files) == 0
+}
+
+// close unblocks the pending and following adds, whose samples are then dropped,
+// and removes the spill directory.
+func (b *sampleBuffer) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.notFull.Broadcast()
+	if b.spill == nil {
+		return nil
+	}
+	b.files, b.spilled = nil, 0
+	return b.spill.close()
+}
+
+// truncateContainers returns the oldest containers holding up to maxSamples samples,
+// at least one, with the number of samples and containers left out. A container is
+// never split, as the samples of a container are taken at the same time.
+func truncateContainers(
+	containers []metrics.SampleContainer, maxSamples int,
+) (kept []metrics.SampleContainer, droppedSamples, droppedContainers int) {
+	if maxSamples <= 0 {
+		return containers, 0, 0
+	}
+	var samples, i int
+	for ; i < len(containers); i++ {
+		size := len(containers[i].GetSamples())
+		if i > 0 && samples+size > maxSamples {
+			break
+		}
+		samples += size
+	}
+	dropped := containers[i:]
+	return containers[:i], countContainerSamples(dropped), len(dropped)
+}
+
+func countContainerSamples(containers []metrics.SampleContainer) int {
+	var n int
+	for _, container := range containers {
+		n += len(container.GetSamples())
+	}
+	return n
+}
@@ -0,0 +1,299 @@
+package remotewrite
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestSampleBuffer(t *testing.T) {
+	t.Parallel()
+
+	metric := &metrics.Metric{Name: "vus", Type: metrics.Gauge}
+	container := func(values ...float64) metrics.SampleContainer {
+		samples := make(metrics.Samples, 0, len(values))
+		for _, v := range values {
+			samples = append(samples, metrics.Sample{Metric: metric, Value: v})
+		}
+		return samples
+	}
+	first, second, third := container(1, 2), container(3, 4), container(5)
+
+	testCases := map[bufferPolicy]struct {
+		kept    []metrics.SampleContainer
+		dropped int
+	}{
+		bufferDropOldest: {[]metrics.SampleContainer{second, third}, 2},
+		bufferDropNewest: {[]metrics.SampleContainer{first, second}, 1},
+	}
+	for policy, tc := range testCases {
+		b := newSampleBuffer(4, policy)
+		assert.Zero(t, b.add([]metrics.SampleContainer{first, second}), policy)
+		assert.Equal(t, tc.dropped, b.add([]metrics.SampleContainer{third}), policy)
+
+		kept, dropped, _ := b.take()
+		assert.Equal(t, tc.kept, kept, policy)
+		assert.Equal(t, tc.dropped, dropped, policy)
+
+		kept, dropped, _ = b.take()
+		assert.Empty(t, kept, policy)
+		assert.Zero(t, dropped, policy)
+	}
+
+	unlimited := newSampleBuffer(0, bufferDropNewest)
+	for i := 0; i < 10; i++ {
+		assert.Zero(t, unlimited.add([]metrics.SampleContainer{first}))
+	}
+	kept, _, _ := unlimited.take()
+	assert.Len(t, kept, 10)
+}
+
+func TestSampleBufferBlock(t *testing.T) {
+	t.Parallel()
+
+	metric := &metrics.Metric{Name: "vus", Type: metrics.Gauge}
+	container := metrics.Samples{{Metric: metric, Value: 1}, {Metric: metric, Value: 2}}
+
+	b := newSampleBuffer(3, bufferBlock)
+	// accepted by the empty buffer even if bigger than capacity
+	assert.Zero(t, b.add([]metrics.SampleContainer{container, container}))
+
+	added := make(chan int)
+	go func() {
+		added <- b.add([]metrics.SampleContainer{container})
+	}()
+
+	select {
+	case <-added:
+		t.Fatal("add did not block on a full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	kept, _, _ := b.take()
+	assert.Len(t, kept, 2)
+	require.Zero(t, <-added)
+	kept, _, _ = b.take()
+	assert.Len(t, kept, 1)
+
+	// closed, nothing blocks anymore
+	assert.Zero(t, b.add([]metrics.SampleContainer{container, container}))
+	go func() {
+		added <- b.add([]metrics.SampleContainer{container})
+	}()
+	b.close()
+	assert.Equal(t, 2, <-added)
+
+	_, err := parseBufferPolicy("drop")
+	assert.Error(t, err)
+}
+
+func TestSampleBufferMemoryLimit(t *testing.T) {
+	t.Parallel()
+
+	metric := &metrics.Metric{Name: "vus", Type: metrics.Gauge}
+	container := metrics.Samples{{Metric: metric, Value: 1}, {Metric: metric, Value: 2}}
+
+	// without spill, the capacity is lowered to the samples fitting in the memory limit
+	b := newSampleBuffer(1000, bufferDropNewest)
+	b.limitMemory(3*estimatedSampleSize, nil, nil)
+	assert.Equal(t, 3, b.capacity)
+	assert.Zero(t, b.add([]metrics.SampleContainer{container}))
+	assert.Equal(t, 2, b.add([]metrics.SampleContainer{container}))
+	kept, dropped, err := b.take()
+	require.NoError(t, err)
+	assert.Len(t, kept, 1)
+	assert.Equal(t, 2, dropped)
+}
+
+func TestSampleBufferSpill(t *testing.T) {
+	t.Parallel()
+
+	metric := &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}
+	tags := metrics.NewSampleTags(map[string]string{"status": "200"})
+	now := time.Unix(1_700_000_000, 123)
+	container := func(v float64) metrics.SampleContainer {
+		return metrics.Samples{{Metric: metric, Tags: tags, Time: now, Value: v}}
+	}
+
+	dir := t.TempDir()
+	spill, err := newSampleSpill(dir)
+	require.NoError(t, err)
+	self := newSelfMetrics()
+	b := newSampleBuffer(0, bufferDropNewest)
+	b.limitMemory(2*estimatedSampleSize, spill, self)
+
+	for i := 1; i <= 5; i++ {
+		assert.Zero(t, b.add([]metrics.SampleContainer{container(float64(i))}))
+	}
+	// the first 3 samples were spilled when the third was added, the last 2 are in memory
+	assert.Len(t, b.files, 1)
+	assert.Equal(t, uint64(3), self.fields()["samples_spilled"])
+	assert.False(t, b.empty())
+
+	// the spilled samples are taken first, then those in memory
+	kept, dropped, err := b.take()
+	require.NoError(t, err)
+	assert.Zero(t, dropped)
+	require.Len(t, kept, 5)
+	for i, c := range kept {
+		sample := c.GetSamples()[0]
+		assert.Same(t, metric, sample.Metric)
+		assert.Equal(t, float64(i+1), sample.Value)
+		assert.True(t, now.Equal(sample.Time))
+		assert.Equal(t, tags.CloneTags(), sample.Tags.CloneTags())
+	}
+	assert.True(t, b.empty())
+
+	// the files beyond the memory limit are taken by the following calls
+	for i := 1; i <= 6; i++ {
+		b.add([]metrics.SampleContainer{container(float64(i))})
+	}
+	assert.Len(t, b.files, 2)
+	kept, _, err = b.take()
+	require.NoError(t, err)
+	assert.Len(t, kept, 3)
+	kept, _, err = b.take()
+	require.NoError(t, err)
+	assert.Len(t, kept, 3)
+	assert.True(t, b.empty())
+
+	b.add([]metrics.SampleContainer{container(1), container(2), container(3)})
+	require.NoError(t, b.close())
+	assert.True(t, b.empty())
+	_, err = os.Stat(spill.dir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOutputFlushSkipped(t *testing.T) {
+	t.Parallel()
+
+	o := &Output{
+		config: NewConfig(),
+		buffer: newSampleBuffer(0, bufferDropNewest),
+		self:   newSelfMetrics(),
+		logger: logrus.New(),
+	}
+	metric := &metrics.Metric{Name: "vus", Type: metrics.Gauge}
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Sample{Metric: metric, Value: 1}})
+
+	// a flush is still running
+	o.flushMu.Lock()
+	o.flush()
+	o.flushMu.Unlock()
+
+	assert.Equal(t, uint64(1), o.self.fields()["flushes_skipped"])
+	assert.False(t, o.buffer.empty(), "the samples are left for the next flush")
+}
+
+func TestOutputsFlushIndependently(t *testing.T) {
+	t.Parallel()
+
+	newOutput := func(capacity int) (*Output, *fakeWriteClient) {
+		config := NewConfig()
+		client := &fakeWriteClient{}
+		return &Output{
+			config:   config,
+			client:   client,
+			retry:    newRetryPolicy(config),
+			buffer:   newSampleBuffer(capacity, bufferDropNewest),
+			self:     newSelfMetrics(),
+			logger:   logrus.New(),
+			metrics:  newMetricsStorage(),
+			mapping:  NewMapping(config),
+			interner: newStringInterner(),
+		}, client
+	}
+	// e.g. two endpoints, the first one being slow
+	slow, _ := newOutput(10)
+	fast, fastClient := newOutput(1000)
+
+	for _, samples := range benchmarkSamples(100) {
+		slow.AddMetricSamples([]metrics.SampleContainer{samples})
+		fast.AddMetricSamples([]metrics.SampleContainer{samples})
+	}
+	slow.flushMu.Lock()
+	slow.flush()
+	fast.flush()
+	slow.flushMu.Unlock()
+
+	// the flush and the drops of the slow output don't affect the fast one
+	assert.Equal(t, uint64(1), slow.self.fields()["flushes_skipped"])
+	assert.Equal(t, uint64(90), slow.self.fields()["samples_dropped"])
+	assert.Equal(t, uint64(0), fast.self.fields()["flushes_skipped"])
+	assert.Equal(t, uint64(0), fast.self.fields()["samples_dropped"])
+	assert.Equal(t, 1, fastClient.calls)
+	assert.True(t, fast.buffer.empty())
+	assert.False(t, slow.buffer.empty())
+}
+
+func BenchmarkFlush(b *testing.B) {
+	for _, tc := range []struct {
+		name   string
+		stream bool
+	}{{"buffered", false}, {"streamed", true}} {
+		stream := tc.stream
+		b.Run(tc.name, func(b *testing.B) {
+			config := NewConfig()
+			config.MaxSamplesPerRequest = null.IntFrom(10000)
+			config.StreamFlush = null.BoolFrom(stream)
+			o := &Output{
+				config:   config,
+				client:   &fakeWriteClient{},
+				retry:    newRetryPolicy(config),
+				buffer:   newSampleBuffer(0, bufferDropNewest),
+				self:     newSelfMetrics(),
+				logger:   logrus.New(),
+				metrics:  newMetricsStorage(),
+				mapping:  NewMapping(config),
+				interner: newStringInterner(),
+			}
+			samples := benchmarkSamples(100000)
+			containers := make([]metrics.SampleContainer, len(samples))
+			for i, sample := range samples {
+				containers[i] = sample
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				o.AddMetricSamples(containers)
+				o.flush()
+			}
+		})
+	}
+}
+
+func TestTruncateContainers(t *testing.T) {
+	t.Parallel()
+
+	container := func(n int) metrics.SampleContainer {
+		return make(metrics.Samples, n)
+	}
+	first, second, third := container(3), container(2), container(4)
+	containers := []metrics.SampleContainer{first, second, third}
+
+	testCases := []struct {
+		max              int
+		kept             []metrics.SampleContainer
+		samples, dropped int
+	}{
+		{0, containers, 0, 0},
+		{9, containers, 0, 0},
+		{6, []metrics.SampleContainer{first, second}, 4, 1},
+		{4, []metrics.SampleContainer{first}, 6, 2},
+		// the first container is kept even if it's over the limit
+		{1, []metrics.SampleContainer{first}, 6, 2},
+	}
+	for _, tc := range testCases {
+		kept, samples, dropped := truncateContainers(containers, tc.max)
+		assert.Equal(t, tc.kept, kept, tc.max)
+		assert.Equal(t, tc.samples, samples, tc.max)
+		assert.Equal(t, tc.dropped, dropped, tc.max)
+	}
+}
@@ -0,0 +1,161 @@
+package remotewrite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// seriesLimitAction is what happens to the samples of new series once the limit is reached.
+type seriesLimitAction string
+
+const (
+	seriesLimitDrop      seriesLimitAction = "drop"
+	seriesLimitAggregate seriesLimitAction = "aggregate"
+	seriesLimitAbort     seriesLimitAction = "abort"
+
+	// overflowValue replaces the values of the tag labels of aggregated series.
+	overflowValue = "other"
+
+	// topLabelsLogged is the number of label names logged when the limit is reached.
+	topLabelsLogged = 5
+)
+
+func parseSeriesLimitAction(action string) (seriesLimitAction, error) {
+	switch a := seriesLimitAction(action); a {
+	case seriesLimitDrop, seriesLimitAggregate, seriesLimitAbort:
+		return a, nil
+	default:
+		return "", fmt.Errorf("invalid maxSeriesAction %q, it must be drop, aggregate or abort", action)
+	}
+}
+
+// seriesLimiter guards against cardinality explosions by limiting the number of
+// distinct series, i.e. k6 metric and label set, that are sent during the test.
+// Each of them may give several Prometheus series depending on the mapping.
+type seriesLimiter struct {
+	max    int
+	action seriesLimitAction
+	// static are the names of the labels set for every series and of the
+	// scenario and group ones, never aggregated.
+	static map[string]struct{}
+
+	series map[string]struct{}
+	// values holds the distinct values of each label name, to find out the
+	// labels responsible for the cardinality. The sets are capped to max.
+	values   map[string]map[string]struct{}
+	rejected int
+}
+
+// newSeriesLimiter returns nil if there is no limit.
+func newSeriesLimiter(conf Config) (*seriesLimiter, error) {
+	if conf.MaxSeries.Int64 <= 0 {
+		return nil, nil
+	}
+
+	action, err := parseSeriesLimitAction(conf.MaxSeriesAction.String)
+	if err != nil {
+		return nil, err
+	}
+
+	static := map[string]struct{}{testRunIDLabel: {}}
+	// low cardinality, kept to still split the results by scenario and group
+	if conf.ScenarioLabel.Bool {
+		static[scenarioTag] = struct{}{}
+	}
+	if conf.GroupLabel.Bool {
+		static[groupTag] = struct{}{}
+	}
+	for name := range conf.Labels {
+		static[name] = struct{}{}
+	}
+
+	return &seriesLimiter{
+		max:    int(conf.MaxSeries.Int64),
+		action: action,
+		static: static,
+		series: make(map[string]struct{}),
+		values: make(map[string]map[string]struct{}),
+	}, nil
+}
+
+// admit returns the labels to use for the sample of the metric and whether it
+// has to be sent. Once the limit is reached, the samples of new series are
+// dropped or, when aggregating, sent with the value of the tag labels replaced
+// by "other". The first return value reports whether the limit was hit for the
+// first time. It's a no-op on a nil receiver.
+func (l *seriesLimiter) admit(metric string, labels []prompb.Label) ([]prompb.Label, bool, bool) {
+	if l == nil {
+		return labels, true, false
+	}
+
+	key := metric + "\xff" + labelsKey(labels)
+	if _, ok := l.series[key]; ok {
+		return labels, true, false
+	}
+
+	l.observe(labels)
+	if len(l.series) < l.max {
+		l.series[key] = struct{}{}
+		return labels, true, false
+	}
+
+	first := l.rejected == 0
+	l.rejected++
+	if l.action != seriesLimitAggregate {
+		return nil, false, first
+	}
+
+	aggregated := make([]prompb.Label, len(labels))
+	for i, label := range labels {
+		if _, ok := l.static[label.Name]; !ok {
+			label.Value = overflowValue
+		}
+		aggregated[i] = label
+	}
+	// the aggregated series don't count against the limit
+	l.series[metric+"\xff"+labelsKey(aggregated)] = struct{}{}
+	return aggregated, true, first
+}
+
+func (l *seriesLimiter) observe(labels []prompb.Label) {
+	for _, label := range labels {
+		if _, ok := l.static[label.Name]; ok {
+			continue
+		}
+		values, ok := l.values[label.Name]
+		if !ok {
+			values = make(map[string]struct{})
+			l.values[label.Name] = values
+		}
+		if len(values) < l.max {
+			values[label.Value] = struct{}{}
+		}
+	}
+}
+
+// topLabels returns the label names with the most distinct values, formatted
+// as name=count, e.g. "url=9500,name=120".
+func (l *seriesLimiter) topLabels() string {
+	names := make([]string, 0, len(l.values))
+	for name := range l.values {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(l.values[names[i]]) != len(l.values[names[j]]) {
+			return len(l.values[names[i]]) > len(l.values[names[j]])
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > topLabelsLogged {
+		names = names[:topLabelsLogged]
+	}
+
+	top := make([]string, len(names))
+	for i, name := range names {
+		top[i] = fmt.Sprintf("%s=%d", name, len(l.values[name]))
+	}
+	return strings.Join(top, ",")
+}
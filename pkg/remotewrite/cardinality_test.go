@@ -0,0 +1,114 @@
+package remotewrite
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestSeriesLimiter(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.MaxSeries = null.IntFrom(2)
+	config.TestRunID = null.StringFrom("run")
+
+	l, err := newSeriesLimiter(config)
+	require.NoError(t, err)
+
+	series := func(url string) []prompb.Label {
+		return []prompb.Label{{Name: "url", Value: url}, {Name: "method", Value: "GET"}, {Name: "test_run_id", Value: "run"}}
+	}
+
+	for _, url := range []string{"/a", "/b", "/a"} {
+		labels, keep, reached := l.admit("http_reqs", series(url))
+		assert.True(t, keep, url)
+		assert.False(t, reached, url)
+		assert.Equal(t, series(url), labels)
+	}
+
+	_, keep, reached := l.admit("http_reqs", series("/c"))
+	assert.False(t, keep)
+	assert.True(t, reached)
+	_, keep, reached = l.admit("http_reqs", series("/d"))
+	assert.False(t, keep)
+	assert.False(t, reached)
+	assert.Equal(t, 2, l.rejected)
+	assert.Equal(t, "url=2,method=1", l.topLabels())
+
+	l.action = seriesLimitAggregate
+	labels, keep, _ := l.admit("http_reqs", series("/e"))
+	assert.True(t, keep)
+	assert.Equal(t, []prompb.Label{
+		{Name: "url", Value: "other"}, {Name: "method", Value: "other"}, {Name: "test_run_id", Value: "run"},
+	}, labels)
+
+	// the results can still be split by scenario
+	labels, keep, _ = l.admit("http_reqs", append(series("/f"), prompb.Label{Name: "scenario", Value: "login"}))
+	assert.True(t, keep)
+	assert.Equal(t, prompb.Label{Name: "scenario", Value: "login"}, labels[3])
+
+	config.MaxSeries = null.IntFrom(0)
+	l, err = newSeriesLimiter(config)
+	require.NoError(t, err)
+	assert.Nil(t, l)
+	labels, keep, reached = l.admit("http_reqs", series("/a"))
+	assert.Equal(t, series("/a"), labels)
+	assert.True(t, keep)
+	assert.False(t, reached)
+
+	config.MaxSeries = null.IntFrom(10)
+	config.MaxSeriesAction = null.StringFrom("ignore")
+	_, err = newSeriesLimiter(config)
+	assert.Error(t, err)
+}
+
+func TestConvertToTimeSeriesSeriesLimit(t *testing.T) {
+	t.Parallel()
+
+	metric := &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}
+	samples := make(metrics.Samples, 0, 10)
+	for i := 0; i < 10; i++ {
+		samples = append(samples, metrics.Sample{
+			Metric: metric,
+			Tags:   metrics.NewSampleTags(map[string]string{"url": fmt.Sprintf("/items/%d", i)}),
+			Time:   time.Now(),
+			Value:  1,
+		})
+	}
+
+	for action, expected := range map[seriesLimitAction]int{
+		seriesLimitDrop:      3,
+		seriesLimitAggregate: 4,
+		seriesLimitAbort:     3,
+	} {
+		config := NewConfig()
+		config.KeepTags = null.BoolFrom(true)
+		config.KeepUrlTag = null.BoolFrom(true)
+		config.MaxSeries = null.IntFrom(3)
+		config.MaxSeriesAction = null.StringFrom(string(action))
+		seriesLimit, err := newSeriesLimiter(config)
+		require.NoError(t, err)
+
+		var stopped error
+		o := &Output{
+			config:      config,
+			metrics:     newMetricsStorage(),
+			mapping:     NewMapping(config),
+			seriesLimit: seriesLimit,
+			stopTest:    func(err error) { stopped = err },
+			logger:      logrus.New(),
+		}
+
+		ts := o.convertToTimeSeries([]metrics.SampleContainer{samples})
+		assert.Len(t, ts, expected, action)
+		assert.Equal(t, action == seriesLimitAbort, stopped != nil, action)
+	}
+}
@@ -0,0 +1,98 @@
+package remotewrite
+
+import (
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"go.k6.io/k6/metrics"
+)
+
+// checksMetric is the k6 Rate metric of the check results.
+const checksMetric = "checks"
+
+// checkCounters counts the passed and failed checks per series, so that the
+// pass rate of each check can be computed over time with rate() instead of
+// only the aggregate of all the checks given by the checks Rate metric.
+type checkCounters struct {
+	counts map[string]*checkCount
+}
+
+type checkCount struct {
+	passed float64
+	failed float64
+}
+
+func newCheckCounters() *checkCounters {
+	return &checkCounters{
+		counts: make(map[string]*checkCount),
+	}
+}
+
+// reset starts the counts from zero again. It's a no-op on a nil receiver.
+func (c *checkCounters) reset() {
+	if c == nil {
+		return
+	}
+	c.counts = make(map[string]*checkCount)
+}
+
+// add counts the result of the check sample and returns the checks_passed_total
+// and checks_failed_total series for its labels. The series are always labeled
+// with the check name and group, even if their tags are not sent as labels.
+// It's a no-op on a nil receiver.
+func (c *checkCounters) add(sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+	if c == nil {
+		return nil
+	}
+
+	for _, tag := range []string{"check", "group"} {
+		if hasLabel(labels, tag) {
+			continue
+		}
+		var value string
+		if sample.Tags != nil {
+			value, _ = sample.Tags.Get(tag)
+		}
+		labels = append(labels, prompb.Label{Name: tag, Value: value})
+	}
+	labels = labels[:len(labels):len(labels)]
+
+	key := labelsKey(labels)
+	count, ok := c.counts[key]
+	if !ok {
+		count = &checkCount{}
+		c.counts[key] = count
+	}
+	if sample.Value != 0 {
+		count.passed++
+	} else {
+		count.failed++
+	}
+
+	ts := timestamp.FromTime(sample.Time)
+	return []prompb.TimeSeries{
+		{
+			Labels: append(labels, prompb.Label{
+				Name:  "__name__",
+				Value: "checks_passed_total",
+			}),
+			Samples: []prompb.Sample{
+				{
+					Value:     count.passed,
+					Timestamp: ts,
+				},
+			},
+		},
+		{
+			Labels: append(labels, prompb.Label{
+				Name:  "__name__",
+				Value: "checks_failed_total",
+			}),
+			Samples: []prompb.Sample{
+				{
+					Value:     count.failed,
+					Timestamp: ts,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,77 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"go.k6.io/k6/metrics"
+)
+
+func TestOutputCheckCounters(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	o := &Output{
+		config:  config,
+		metrics: newMetricsStorage(),
+		checks:  newCheckCounters(),
+		mapping: NewMapping(config),
+		logger:  logrus.New(),
+	}
+
+	checks := &metrics.Metric{Name: "checks", Type: metrics.Rate}
+	status := metrics.NewSampleTags(map[string]string{"check": "status is 200", "group": "::login"})
+	body := metrics.NewSampleTags(map[string]string{"check": "body is valid", "group": "::login"})
+
+	now := time.Now()
+	ts := o.convertToTimeSeries([]metrics.SampleContainer{
+		metrics.Samples{
+			{Metric: checks, Tags: status, Time: now, Value: 1},
+			{Metric: checks, Tags: status, Time: now.Add(time.Millisecond), Value: 0},
+			{Metric: checks, Tags: status, Time: now.Add(2 * time.Millisecond), Value: 1},
+			{Metric: checks, Tags: body, Time: now, Value: 0},
+		},
+	})
+
+	latest := func(name, check string) float64 {
+		for _, series := range ts {
+			if hasLabelValue(series.Labels, "__name__", name) && hasLabelValue(series.Labels, "check", check) {
+				assert.True(t, hasLabelValue(series.Labels, "group", "::login"))
+				return series.Samples[len(series.Samples)-1].Value
+			}
+		}
+		t.Fatalf("no %s series for check %q", name, check)
+		return 0
+	}
+
+	assert.Equal(t, 2.0, latest("k6_checks_passed_total", "status is 200"))
+	assert.Equal(t, 1.0, latest("k6_checks_failed_total", "status is 200"))
+	assert.Equal(t, 0.0, latest("k6_checks_passed_total", "body is valid"))
+	assert.Equal(t, 1.0, latest("k6_checks_failed_total", "body is valid"))
+}
+
+func TestCheckCountersLabels(t *testing.T) {
+	t.Parallel()
+
+	c := newCheckCounters()
+	sample := metrics.Sample{
+		Metric: &metrics.Metric{Name: "checks", Type: metrics.Rate},
+		Tags:   metrics.NewSampleTags(map[string]string{"check": "ok", "group": "::g"}),
+		Time:   time.Now(),
+		Value:  1,
+	}
+
+	// the check and group tags are not sent as labels, e.g. due to TagsAsLabels
+	ts := c.add(sample, []prompb.Label{{Name: "test_run_id", Value: "abc"}})
+	assert.Len(t, ts, 2)
+	for _, series := range ts {
+		assert.True(t, hasLabelValue(series.Labels, "check", "ok"))
+		assert.True(t, hasLabelValue(series.Labels, "group", "::g"))
+		assert.True(t, hasLabelValue(series.Labels, "test_run_id", "abc"))
+	}
+
+	assert.Nil(t, (*checkCounters)(nil).add(sample, nil))
+}
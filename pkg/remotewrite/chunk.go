@@ -0,0 +1,90 @@
+package remotewrite
+
+import (
+	"encoding/binary"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// chunkTimeSeries splits the series in chunks small enough to be sent in one
+// request each: a chunk holds at most maxSamples samples (histograms included)
+// and its marshaled WriteRequest is at most maxBytes long. A zero value disables
+// the corresponding limit. Series with more than maxSamples samples are split
+// into several series with the same labels; a single series bigger than maxBytes
+// is sent alone in its own chunk as it can't be split any further.
+func chunkTimeSeries(series []prompb.TimeSeries, maxSamples, maxBytes int) [][]prompb.TimeSeries {
+	if maxSamples <= 0 && maxBytes <= 0 {
+		return [][]prompb.TimeSeries{series}
+	}
+
+	var (
+		chunks       [][]prompb.TimeSeries
+		chunk        []prompb.TimeSeries
+		chunkSamples int
+		chunkBytes   int
+	)
+	for _, ts := range series {
+		for _, piece := range splitSamples(ts, maxSamples) {
+			samples := len(piece.Samples) + len(piece.Histograms)
+			size := requestEntrySize(piece.Size())
+
+			overSamples := maxSamples > 0 && chunkSamples+samples > maxSamples
+			overBytes := maxBytes > 0 && chunkBytes+size > maxBytes
+			if len(chunk) > 0 && (overSamples || overBytes) {
+				chunks = append(chunks, chunk)
+				chunk, chunkSamples, chunkBytes = nil, 0, 0
+			}
+
+			chunk = append(chunk, piece)
+			chunkSamples += samples
+			chunkBytes += size
+		}
+	}
+	if len(chunk) > 0 || len(chunks) == 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// countSamples returns the number of samples, histograms included, of the series.
+func countSamples(series []prompb.TimeSeries) int {
+	var n int
+	for _, ts := range series {
+		n += len(ts.Samples) + len(ts.Histograms)
+	}
+	return n
+}
+
+// splitSamples splits a series with more than maxSamples samples
+// (or histograms) in several series with the same labels.
+func splitSamples(ts prompb.TimeSeries, maxSamples int) []prompb.TimeSeries {
+	if maxSamples <= 0 || len(ts.Samples)+len(ts.Histograms) <= maxSamples {
+		return []prompb.TimeSeries{ts}
+	}
+
+	var pieces []prompb.TimeSeries
+	for start := 0; start < len(ts.Samples); start += maxSamples {
+		end := start + maxSamples
+		if end > len(ts.Samples) {
+			end = len(ts.Samples)
+		}
+		pieces = append(pieces, prompb.TimeSeries{Labels: ts.Labels, Samples: ts.Samples[start:end]})
+	}
+	for start := 0; start < len(ts.Histograms); start += maxSamples {
+		end := start + maxSamples
+		if end > len(ts.Histograms) {
+			end = len(ts.Histograms)
+		}
+		pieces = append(pieces, prompb.TimeSeries{Labels: ts.Labels, Histograms: ts.Histograms[start:end]})
+	}
+	pieces[0].Exemplars = ts.Exemplars
+	return pieces
+}
+
+// requestEntrySize returns the size taken by a marshaled TimeSeries of the given
+// size in a WriteRequest: the field tag, the length prefix and the message itself.
+func requestEntrySize(size int) int {
+	var buf [binary.MaxVarintLen64]byte
+	return 1 + binary.PutUvarint(buf[:], uint64(size)) + size
+}
@@ -0,0 +1,130 @@
+package remotewrite
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestChunkTimeSeries(t *testing.T) {
+	t.Parallel()
+
+	series := make([]prompb.TimeSeries, 0, 10)
+	for i := 0; i < 10; i++ {
+		series = append(series, prompb.TimeSeries{
+			Labels:  []prompb.Label{{Name: "__name__", Value: fmt.Sprintf("metric_%d", i)}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}, {Value: 2, Timestamp: 2}},
+		})
+	}
+
+	t.Run("no-limits", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, [][]prompb.TimeSeries{series}, chunkTimeSeries(series, 0, 0))
+	})
+
+	t.Run("max-samples", func(t *testing.T) {
+		t.Parallel()
+		chunks := chunkTimeSeries(series, 5, 0)
+		require.Len(t, chunks, 5)
+		for _, chunk := range chunks {
+			assert.Len(t, chunk, 2)
+		}
+	})
+
+	t.Run("max-bytes", func(t *testing.T) {
+		t.Parallel()
+		req := prompb.WriteRequest{Timeseries: series[:3]}
+		maxBytes := req.Size()
+
+		chunks := chunkTimeSeries(series, 0, maxBytes)
+		require.Len(t, chunks, 4)
+		for _, chunk := range chunks {
+			req := prompb.WriteRequest{Timeseries: chunk}
+			assert.LessOrEqual(t, req.Size(), maxBytes)
+		}
+	})
+
+	t.Run("split-series", func(t *testing.T) {
+		t.Parallel()
+		big := prompb.TimeSeries{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "big"}},
+			Samples: []prompb.Sample{{Timestamp: 1}, {Timestamp: 2}, {Timestamp: 3}},
+		}
+
+		chunks := chunkTimeSeries([]prompb.TimeSeries{big}, 2, 0)
+		require.Len(t, chunks, 2)
+		assert.Equal(t, big.Samples[:2], chunks[0][0].Samples)
+		assert.Equal(t, big.Samples[2:], chunks[1][0].Samples)
+		assert.Equal(t, big.Labels, chunks[1][0].Labels)
+	})
+}
+
+func TestConvertInChunks(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	o := &Output{
+		config:  config,
+		metrics: newMetricsStorage(),
+		mapping: NewMapping(config),
+		logger:  logrus.New(),
+	}
+	metric := &metrics.Metric{Name: "vus", Type: metrics.Gauge}
+	container := func(ms ...int64) metrics.SampleContainer {
+		samples := make(metrics.Samples, 0, len(ms))
+		for _, m := range ms {
+			samples = append(samples, metrics.Sample{Metric: metric, Time: time.UnixMilli(m), Value: float64(m)})
+		}
+		return samples
+	}
+
+	var chunks [][]int64
+	o.convertInChunks([]metrics.SampleContainer{
+		container(1, 2), container(3), container(3), container(4), container(5),
+	}, time.Now(), 2, func(series []prompb.TimeSeries, last bool) {
+		require.Len(t, series, 1)
+		var timestamps []int64
+		for _, s := range series[0].Samples {
+			timestamps = append(timestamps, s.Timestamp)
+		}
+		chunks = append(chunks, timestamps)
+		assert.Equal(t, len(chunks) == 3, last)
+	})
+	// the chunk isn't ended between the samples at the same time, deduplicated
+	assert.Equal(t, [][]int64{{1, 2}, {3}, {4, 5}}, chunks)
+}
+
+func TestOutputStreamFlush(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.StreamFlush = null.BoolFrom(true)
+	config.MaxSamplesPerRequest = null.IntFrom(100)
+	client := &fakeWriteClient{}
+	o := &Output{
+		config:   config,
+		client:   client,
+		retry:    newRetryPolicy(config),
+		buffer:   newSampleBuffer(0, bufferDropNewest),
+		self:     newSelfMetrics(),
+		logger:   logrus.New(),
+		metrics:  newMetricsStorage(),
+		mapping:  NewMapping(config),
+		interner: newStringInterner(),
+	}
+	for _, samples := range benchmarkSamples(1000) {
+		o.AddMetricSamples([]metrics.SampleContainer{samples})
+	}
+	o.flush()
+
+	// a request per chunk of 100 samples, each one with the 5 series
+	assert.Equal(t, 10, client.calls)
+	assert.Equal(t, uint64(50), o.self.fields()["series_sent"])
+}
@@ -0,0 +1,268 @@
+package remotewrite
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	promConfig "github.com/prometheus/common/config"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/sirupsen/logrus"
+)
+
+// maxErrMsgLen is the maximum length of the response body reported in errors.
+const maxErrMsgLen = 1024
+
+// writeClient sends encoded requests to the remote endpoint with the headers
+// of their protocol. Unlike the remote write client of Prometheus it doesn't
+// assume a snappy-compressed remote write body, so it also works for OTLP.
+type writeClient struct {
+	name             string
+	url              string
+	client           *http.Client
+	timeout          time.Duration
+	headers          map[string]string
+	retryOnRateLimit bool
+}
+
+var _ remote.WriteClient = &writeClient{}
+
+// newWriteClient returns a client for the given protocol and compression. The headers
+// configured by the user are sent after those of the protocol, so they can override them.
+func newWriteClient(
+	name string, conf *remote.ClientConfig, p protocol, c compression, tc transportConfig,
+) (*writeClient, error) {
+	httpClient, err := newHTTPClient(conf.HTTPClientConfig, tc)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string, len(conf.Headers)+4)
+	for k, v := range p.headers(c) {
+		headers[k] = v
+	}
+	for k, v := range conf.Headers {
+		headers[k] = v
+	}
+
+	return &writeClient{
+		name:             name,
+		url:              conf.URL.String(),
+		client:           httpClient,
+		timeout:          time.Duration(conf.Timeout),
+		headers:          headers,
+		retryOnRateLimit: conf.RetryOnRateLimit,
+	}, nil
+}
+
+// newClient returns the client for the protocol, with failover to the configured
+// secondary endpoints and mirroring to the configured mirror endpoints, if there are any.
+// Each endpoint has a circuit breaker of its own, so that one that is down doesn't
+// stop the requests to the others; those of the secondary endpoints are labeled with their URL.
+func newClient(
+	name string, conf *remote.ClientConfig, p protocol, config Config, logger logrus.FieldLogger, self *selfMetrics,
+) (remote.WriteClient, error) {
+	// the compression is validated by New
+	c := compression(config.Compression.String)
+	if len(config.KafkaBrokers) > 0 {
+		kafka, err := newKafkaClient(name, conf, p, c, config)
+		if err != nil {
+			return nil, err
+		}
+		return withCircuitBreaker(kafka, name, config, logger, self), nil
+	}
+
+	primary, err := newWriteClientForURL(name, conf, p, c, config.transportConfig(), conf.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	client := withCircuitBreaker(primary, name, config, logger, self)
+
+	if len(config.FailoverUrls) > 0 {
+		clients := []remote.WriteClient{client}
+		for _, u := range config.FailoverUrls {
+			secondary, err := newWriteClientForURL(name, conf, p, c, config.transportConfig(), u)
+			if err != nil {
+				return nil, err
+			}
+			clients = append(clients, withCircuitBreaker(secondary, secondary.Endpoint(), config, logger, self))
+		}
+		client = newFailoverClient(clients, int(config.FailoverThreshold.Int64),
+			time.Duration(config.FailbackInterval.Duration), logger)
+	}
+
+	if len(config.MirrorUrls) > 0 {
+		clients := []remote.WriteClient{client}
+		for _, u := range config.MirrorUrls {
+			mirror, err := newWriteClientForURL(name, conf, p, c, config.transportConfig(), u)
+			if err != nil {
+				return nil, err
+			}
+			clients = append(clients, withCircuitBreaker(mirror, mirror.Endpoint(), config, logger, self))
+		}
+		client = &mirrorClient{clients: clients, logger: logger, self: self}
+	}
+
+	return client, nil
+}
+
+// closeClients closes the clients keeping connections open, e.g. over gRPC,
+// and returns the first error if any of them failed to close.
+func closeClients(clients []remote.WriteClient) error {
+	var (
+		failed   int
+		firstErr error
+	)
+	for _, client := range clients {
+		closer, ok := client.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", client.Endpoint(), err)
+			}
+			failed++
+		}
+	}
+	if failed > 1 {
+		return fmt.Errorf("%d clients failed to close, %w", failed, firstErr)
+	}
+	return firstErr
+}
+
+// newWriteClientForURL returns a client configured as the primary one but sending to rawURL,
+// over gRPC if it's a grpc:// or grpcs:// URL.
+func newWriteClientForURL(
+	name string, conf *remote.ClientConfig, p protocol, c compression, tc transportConfig, rawURL string,
+) (remote.WriteClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	urlConf := *conf
+	urlConf.URL = &promConfig.URL{URL: u}
+	if isGRPCURL(rawURL) {
+		return newGRPCClient(name, &urlConf, c)
+	}
+	if isGraphiteURL(rawURL) {
+		return newGraphiteClient(name, &urlConf), nil
+	}
+	return newWriteClient(name, &urlConf, p, c, tc)
+}
+
+func (c *writeClient) Name() string {
+	return c.name
+}
+
+// Endpoint returns the URL of the endpoint without the credentials it may embed,
+// as it's used in logs and labels.
+func (c *writeClient) Endpoint() string {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return c.url
+	}
+	return u.Redacted()
+}
+
+// Store sends the encoded request. Network errors, 5xx responses and, if enabled,
+// 429 responses are returned as recoverable errors, with the delay requested by
+// the Retry-After header of the response, if any.
+// Other 4xx responses mean that the request is invalid and must not be sent again.
+func (c *writeClient) Store(ctx context.Context, req []byte) error {
+	httpReq, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(req))
+	if err != nil {
+		// errors from NewRequest are from unparsable URLs, so they are not recoverable
+		return err
+	}
+
+	httpReq.Header.Set("User-Agent", remote.UserAgent)
+	for k, v := range c.headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	httpResp, err := c.client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return recoverableError{err: err}
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, httpResp.Body)
+		_ = httpResp.Body.Close()
+	}()
+
+	if httpResp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(io.LimitReader(httpResp.Body, maxErrMsgLen))
+	line := ""
+	if scanner.Scan() {
+		line = scanner.Text()
+	}
+	err = &statusError{code: httpResp.StatusCode, status: httpResp.Status, body: line}
+
+	if httpResp.StatusCode/100 == 5 ||
+		(c.retryOnRateLimit && httpResp.StatusCode == http.StatusTooManyRequests) {
+		return recoverableError{err: err, retryAfter: parseRetryAfter(httpResp.Header.Get("Retry-After"))}
+	}
+	return err
+}
+
+// parseRetryAfter returns the delay of a Retry-After header, given either in
+// seconds or as an HTTP date, and 0 if it's missing or invalid.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// statusError is returned when the endpoint responds with a non-2xx status.
+type statusError struct {
+	code   int
+	status string
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("server returned HTTP status %s: %s", e.status, e.body)
+}
+
+// recoverableError is an error for which the request may succeed if sent again later.
+type recoverableError struct {
+	err error
+	// retryAfter is the delay requested by the endpoint before sending the request again.
+	retryAfter time.Duration
+}
+
+func (e recoverableError) Error() string {
+	return e.err.Error()
+}
+
+func (e recoverableError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,95 @@
+package remotewrite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestWriteClientStore(t *testing.T) {
+	t.Parallel()
+
+	var (
+		status  int
+		headers http.Header
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+	config.Headers = map[string]string{"X-Custom": "custom"}
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolOTLP, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	status = http.StatusOK
+	require.NoError(t, client.Store(context.Background(), []byte("payload")))
+	assert.Equal(t, "application/x-protobuf", headers.Get("Content-Type"))
+	assert.Empty(t, headers.Get("Content-Encoding"))
+	assert.Equal(t, "custom", headers.Get("X-Custom"))
+
+	testCases := map[int]struct {
+		recoverable bool
+		class       errorClass
+	}{
+		http.StatusBadRequest:           {false, errorClassClient},
+		http.StatusUnsupportedMediaType: {false, errorClassClient},
+		http.StatusTooManyRequests:      {true, errorClassRateLimited},
+		http.StatusServiceUnavailable:   {true, errorClassServer},
+	}
+	for code, tc := range testCases {
+		status = code
+		err := client.Store(context.Background(), []byte("payload"))
+		require.Error(t, err)
+		assert.Equal(t, tc.recoverable, isRecoverable(err), code)
+		assert.Equal(t, tc.class, classifyError(err), code)
+		assert.Equal(t, code == http.StatusUnsupportedMediaType, isUnsupportedProtocol(err), code)
+	}
+
+	server.Close()
+	err = client.Store(context.Background(), []byte("payload"))
+	assert.True(t, isRecoverable(err))
+	assert.Equal(t, errorClassNetwork, classifyError(err))
+}
+
+func TestWriteClientRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	err = client.Store(context.Background(), []byte("payload"))
+	var recoverable recoverableError
+	require.ErrorAs(t, err, &recoverable)
+	assert.Equal(t, 7*time.Second, recoverable.retryAfter)
+
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)))
+	d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.Greater(t, d, 58*time.Second)
+	assert.LessOrEqual(t, d, time.Minute)
+}
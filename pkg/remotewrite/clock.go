@@ -0,0 +1,81 @@
+package remotewrite
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// clockSyncProbes is the number of requests measuring the clock offset,
+	// the one with the shortest round trip gives the most accurate offset.
+	clockSyncProbes = 3
+	// minClockOffset is the smallest offset corrected: the Date header is
+	// truncated to the second, smaller offsets can't be told apart from it.
+	minClockOffset = time.Second
+)
+
+// measureClockOffset returns how far the clock of the endpoint is ahead of the
+// local one, from the Date header of its responses to HEAD requests: whatever
+// the status, e.g. 405, servers send it with every response.
+func measureClockOffset(client *http.Client, url string) (time.Duration, error) {
+	var (
+		offset  time.Duration
+		bestRTT time.Duration = -1
+	)
+	for i := 0; i < clockSyncProbes; i++ {
+		req, err := http.NewRequest(http.MethodHead, url, nil)
+		if err != nil {
+			return 0, err
+		}
+		sent := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, fmt.Errorf("failed to reach the endpoint to measure the clock offset: %w", err)
+		}
+		received := time.Now()
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		date, err := http.ParseTime(resp.Header.Get("Date"))
+		if err != nil {
+			return 0, fmt.Errorf("the endpoint sent no valid Date header to measure the clock offset: %w", err)
+		}
+		rtt := received.Sub(sent)
+		if bestRTT >= 0 && rtt >= bestRTT {
+			continue
+		}
+		bestRTT = rtt
+		// the date was truncated to the second, and taken about halfway through the round trip
+		offset = date.Add(500 * time.Millisecond).Sub(sent.Add(rtt / 2))
+	}
+	if offset > -minClockOffset && offset < minClockOffset {
+		return 0, nil
+	}
+	return offset.Round(time.Millisecond), nil
+}
+
+// syncClock returns the clock offset of the endpoint, 0 if it can't be measured:
+// the test goes on with the local clock rather than failing.
+func syncClock(remoteConfig *remote.ClientConfig, config Config, logger logrus.FieldLogger) time.Duration {
+	var offset time.Duration
+	client, err := newHTTPClient(remoteConfig.HTTPClientConfig, config.transportConfig())
+	if err == nil {
+		offset, err = measureClockOffset(client, remoteConfig.URL.String())
+	}
+	if err != nil {
+		logger.WithError(err).Warn("Prometheus: failed to measure the clock offset of the endpoint, the local clock is used")
+		return 0
+	}
+	logger.WithField("offset", offset).Info("Prometheus: measured the clock offset of the endpoint")
+	return offset
+}
+
+// now returns the current time corrected with the clock offset of the endpoint.
+func (o *Output) now() time.Time {
+	return time.Now().Add(o.clockOffset)
+}
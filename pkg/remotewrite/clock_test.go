@@ -0,0 +1,81 @@
+package remotewrite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestMeasureClockOffset(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		skew     time.Duration
+		expected time.Duration
+	}{
+		"ahead":  {skew: time.Hour, expected: time.Hour},
+		"behind": {skew: -10 * time.Minute, expected: -10 * time.Minute},
+		// within the precision of the Date header
+		"in-sync": {skew: 0, expected: 0},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodHead, r.Method)
+				w.Header().Set("Date", time.Now().Add(tc.skew).UTC().Format(http.TimeFormat))
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}))
+			defer server.Close()
+
+			offset, err := measureClockOffset(server.Client(), server.URL)
+			require.NoError(t, err)
+			assert.InDelta(t, tc.expected, offset, float64(time.Second))
+		})
+	}
+}
+
+func TestMeasureClockOffsetWithoutDate(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Date"] = nil
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer server.Close()
+
+	_, err := measureClockOffset(server.Client(), server.URL)
+	assert.ErrorContains(t, err, "no valid Date header")
+}
+
+func TestConvertToTimeSeriesClockOffset(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.Mapping = null.StringFrom("raw")
+	o := &Output{
+		config:      config,
+		metrics:     newMetricsStorage(),
+		mapping:     NewMapping(config),
+		logger:      logrus.New(),
+		clockOffset: -2 * time.Second,
+	}
+
+	metric := &metrics.Metric{Name: "vus", Type: metrics.Gauge}
+	sampleTime := time.UnixMilli(1_700_000_010_000)
+	ts := o.convertToTimeSeries([]metrics.SampleContainer{metrics.Samples{
+		{Metric: metric, Tags: metrics.NewSampleTags(nil), Time: sampleTime, Value: 1},
+	}})
+	require.Len(t, ts, 1)
+	assert.Equal(t, []prompb.Sample{{Value: 1, Timestamp: 1_700_000_008_000}}, ts[0].Samples)
+}
@@ -0,0 +1,81 @@
+package remotewrite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compression is the algorithm the request bodies are compressed with.
+type compression string
+
+const (
+	// compressionDefault is snappy for remote write, as required by its
+	// specification, none for OTLP and gzip for the VictoriaMetrics import API and InfluxDB.
+	compressionDefault compression = ""
+	compressionSnappy  compression = "snappy"
+	compressionZstd    compression = "zstd"
+	compressionGzip    compression = "gzip"
+	compressionNone    compression = "none"
+)
+
+// zstdEncoder is safe for concurrent use with EncodeAll, as zstdDecoder with DecodeAll.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+func parseCompression(name string) (compression, error) {
+	switch c := compression(name); c {
+	case compressionDefault, compressionSnappy, compressionZstd, compressionGzip, compressionNone:
+		return c, nil
+	default:
+		return "", fmt.Errorf("invalid compression %q, it must be snappy, zstd, gzip or none", name)
+	}
+}
+
+// resolve returns the compression used with the protocol.
+func (c compression) resolve(p protocol) compression {
+	if c != compressionDefault {
+		return c
+	}
+	switch p {
+	case protocolOTLP, protocolGraphite, protocolGraphiteTagged:
+		return compressionNone
+	case protocolVictoriaMetrics, protocolInfluxDB, protocolDatadog, protocolDatadogDistributions:
+		return compressionGzip
+	default:
+		return compressionSnappy
+	}
+}
+
+// contentEncoding returns the Content-Encoding header of the compressed body,
+// empty if it isn't compressed.
+func (c compression) contentEncoding() string {
+	if c == compressionNone {
+		return ""
+	}
+	return string(c)
+}
+
+// decompressBody returns the body compressed with c, which must be resolved.
+func decompressBody(c compression, body []byte) ([]byte, error) {
+	switch c {
+	case compressionNone:
+		return body, nil
+	case compressionZstd:
+		return zstdDecoder.DecodeAll(body, nil)
+	case compressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	default:
+		return snappy.Decode(nil, body)
+	}
+}
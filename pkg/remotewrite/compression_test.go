@@ -0,0 +1,108 @@
+package remotewrite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func decompress(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+
+	switch encoding {
+	case "snappy":
+		decoded, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		return decoded
+	case "zstd":
+		decoder, err := zstd.NewReader(nil)
+		require.NoError(t, err)
+		defer decoder.Close()
+		decoded, err := decoder.DecodeAll(body, nil)
+		require.NoError(t, err)
+		return decoded
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		decoded, err := io.ReadAll(r)
+		require.NoError(t, err)
+		return decoded
+	default:
+		return body
+	}
+}
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	payload := bytes.Repeat([]byte("k6_http_reqs_total"), 100)
+	for _, c := range []compression{compressionSnappy, compressionZstd, compressionGzip, compressionNone} {
+		compressed, err := new(encodeBuffers).compress(c, payload)
+		require.NoError(t, err)
+		assert.Equal(t, payload, decompress(t, c.contentEncoding(), compressed), c)
+	}
+
+	assert.Equal(t, compressionSnappy, compressionDefault.resolve(protocolV1))
+	assert.Equal(t, compressionSnappy, compressionDefault.resolve(protocolV2))
+	assert.Equal(t, compressionNone, compressionDefault.resolve(protocolOTLP))
+	assert.Equal(t, compressionGzip, compressionGzip.resolve(protocolOTLP))
+
+	assert.Equal(t, "snappy", protocolV1.headers(compressionDefault)["Content-Encoding"])
+	assert.Equal(t, "zstd", protocolV2.headers(compressionZstd)["Content-Encoding"])
+	assert.NotContains(t, protocolV1.headers(compressionNone), "Content-Encoding")
+	assert.NotContains(t, protocolOTLP.headers(compressionDefault), "Content-Encoding")
+
+	_, err := parseCompression("lz4")
+	assert.Error(t, err)
+}
+
+func TestOutputCompression(t *testing.T) {
+	t.Parallel()
+
+	var (
+		encoding string
+		body     []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+
+	series := []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_http_reqs"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		},
+	}
+	for _, c := range []compression{compressionZstd, compressionGzip, compressionNone} {
+		client, err := newWriteClient("test", remoteConfig, protocolV1, c, config.transportConfig())
+		require.NoError(t, err)
+
+		encoded, err := new(encodeBuffers).encode(series, protocolV1, c)
+		require.NoError(t, err)
+		require.NoError(t, client.Store(context.Background(), encoded))
+
+		assert.Equal(t, c.contentEncoding(), encoding)
+		uncompressed, err := new(encodeBuffers).encode(series, protocolV1, compressionNone)
+		require.NoError(t, err)
+		assert.Equal(t, uncompressed, decompress(t, encoding, body), c)
+	}
+}
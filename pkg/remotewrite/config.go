@@ -2,6 +2,7 @@ package remotewrite
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
@@ -18,47 +19,560 @@ import (
 const (
 	defaultPrometheusTimeout = time.Minute
 	defaultFlushPeriod       = time.Second
+	defaultFlushPeriodMax    = 30 * time.Second
+	defaultShutdownTimeout   = 30 * time.Second
+	defaultShards            = 1
+	defaultRetryMaxAttempts  = 3
+	defaultRetryBackoff      = 100 * time.Millisecond
+	defaultRetryMaxBackoff   = time.Second
+	defaultWALMaxSize        = 256 << 20 // 256MiB
+	defaultWALMaxAge         = time.Hour
 	defaultMetricPrefix      = "k6_"
+	defaultFailoverThreshold = 3
+	defaultFailbackInterval  = time.Minute
+	defaultBreakerCooldown   = 30 * time.Second
+	defaultMaxIdleConns      = 100
+	defaultIdleConnTimeout   = 5 * time.Minute
+	defaultDryRunDir         = "k6-prometheus-dry-run"
+	defaultBufferCapacity    = 1000000
+	defaultJob               = "k6"
+	// defaultMaxLabelValueLength is the default limit of Mimir and Cortex.
+	defaultMaxLabelValueLength = 2048
+
+	tenantHeader = "X-Scope-OrgID"
 )
 
 type Config struct {
 	Mapping null.String `json:"mapping" envconfig:"K6_PROMETHEUS_MAPPING"`
 
+	// MetricPrefix is prepended to the name of every exported metric.
+	MetricPrefix null.String `json:"metricPrefix" envconfig:"K6_PROMETHEUS_METRIC_PREFIX"`
+
+	// Preset sets the defaults for a kind of receiver: mimir, thanos, victoria,
+	// promagent, grafana-cloud or amp. The options set explicitly take precedence.
+	Preset null.String `json:"preset" envconfig:"K6_PROMETHEUS_PRESET"`
+
 	Url null.String `json:"url" envconfig:"K6_PROMETHEUS_REMOTE_URL"` // here, in the name of env variable, we assume that we won't need to distinguish between remote write URL vs remote read URL
 
 	Headers map[string]string `json:"headers" envconfig:"K6_PROMETHEUS_HEADERS"`
+	// HeaderFiles are headers whose values are read from files, by header name,
+	// e.g. secrets mounted by Kubernetes. They are read when the test starts.
+	HeaderFiles map[string]string `json:"headerFiles" envconfig:"K6_PROMETHEUS_HEADER_FILES"`
+
+	// Protocol is either prometheus (remote write), otlp (OTLP over HTTP/protobuf),
+	// victoriametrics (VictoriaMetrics import API, in JSON lines), influxdb
+	// (InfluxDB 2.x write API, in line protocol) or datadog (Datadog metrics API,
+	// with the trends as distributions).
+	Protocol null.String `json:"protocol" envconfig:"K6_PROMETHEUS_PROTOCOL"`
+
+	// ImportQueryArgs are added to the URL with the victoriametrics protocol,
+	// e.g. extra_label=env=staging&extra_label=team=perf.
+	ImportQueryArgs null.String `json:"importQueryArgs" envconfig:"K6_PROMETHEUS_IMPORT_QUERY_ARGS"`
+
+	// InfluxOrg and InfluxBucket are where the points are written with the influxdb
+	// protocol, authenticated with the InfluxToken API token.
+	InfluxOrg    null.String `json:"influxOrg" envconfig:"K6_PROMETHEUS_INFLUX_ORG"`
+	InfluxBucket null.String `json:"influxBucket" envconfig:"K6_PROMETHEUS_INFLUX_BUCKET"`
+	InfluxToken  null.String `json:"influxToken" envconfig:"K6_PROMETHEUS_INFLUX_TOKEN"`
+
+	// GraphiteTags sends the labels as tags to graphite:// URLs, instead of as nodes of dotted paths.
+	GraphiteTags null.Bool `json:"graphiteTags" envconfig:"K6_PROMETHEUS_GRAPHITE_TAGS"`
+
+	// DatadogAPIKey authenticates the requests of the datadog protocol.
+	DatadogAPIKey null.String `json:"datadogAPIKey" envconfig:"K6_PROMETHEUS_DATADOG_API_KEY"`
+
+	// ProtocolVersion of remote write: 1.0 or 2.0. With 2.0, the output falls back
+	// to 1.0 if the endpoint doesn't support it.
+	ProtocolVersion null.String `json:"protocolVersion" envconfig:"K6_PROMETHEUS_PROTOCOL_VERSION"`
+
+	// Compression of the requests: snappy, zstd, gzip or none. By default, snappy
+	// for remote write, as required by its specification, none for OTLP and
+	// gzip for the VictoriaMetrics import API.
+	Compression null.String `json:"compression" envconfig:"K6_PROMETHEUS_COMPRESSION"`
+
+	// TenantID is sent as X-Scope-OrgID header, as required by multi-tenant Cortex, Mimir or Loki.
+	TenantID null.String `json:"tenantID" envconfig:"K6_PROMETHEUS_TENANT_ID"`
+	// TenantIDFile is the file TenantID is read from instead, when the test starts.
+	TenantIDFile null.String `json:"tenantIDFile" envconfig:"K6_PROMETHEUS_TENANT_ID_FILE"`
+	// CredentialsRefresh is how often TenantIDFile and HeaderFiles are read
+	// again, so that the secrets rotated during long tests are used. Zero disables it.
+	CredentialsRefresh types.NullDuration `json:"credentialsRefresh" envconfig:"K6_PROMETHEUS_CREDENTIALS_REFRESH"`
+
+	// TenantTag is the tag, sent as label, whose value selects one of the TenantRoutes.
+	// The series without a matching route are sent to TenantID.
+	TenantTag    null.String   `json:"tenantTag" envconfig:"K6_PROMETHEUS_TENANT_TAG"`
+	TenantRoutes []TenantRoute `json:"tenantRoutes" envconfig:"K6_PROMETHEUS_TENANT_ROUTES"`
+
+	// MetricRoutes send the series whose name matches one of them to its endpoint instead,
+	// the first matching one is used. They take precedence over TenantRoutes.
+	MetricRoutes []MetricRoute `json:"metricRoutes" envconfig:"K6_PROMETHEUS_METRIC_ROUTES"`
 
 	InsecureSkipTLSVerify null.Bool   `json:"insecureSkipTLSVerify" envconfig:"K6_PROMETHEUS_INSECURE_SKIP_TLS_VERIFY"`
-	CACert                null.String `json:"caCertFile" envconfig:"K6_CA_CERT_FILE"`
+	CACert                null.String `json:"caCertFile" envconfig:"K6_PROMETHEUS_CA_CERT_FILE"`
+
+	// TLSCertFile and TLSKeyFile are the client certificate used for mutual TLS.
+	TLSCertFile   null.String `json:"tlsCertFile" envconfig:"K6_PROMETHEUS_TLS_CERT_FILE"`
+	TLSKeyFile    null.String `json:"tlsKeyFile" envconfig:"K6_PROMETHEUS_TLS_KEY_FILE"`
+	TLSServerName null.String `json:"tlsServerName" envconfig:"K6_PROMETHEUS_TLS_SERVER_NAME"`
 
 	User     null.String `json:"user" envconfig:"K6_PROMETHEUS_USER"`
 	Password null.String `json:"password" envconfig:"K6_PROMETHEUS_PASSWORD"`
+	// PasswordFile is the file the password is read from instead, with every request,
+	// so that it can be rotated, as the token of BearerTokenFile.
+	PasswordFile null.String `json:"passwordFile" envconfig:"K6_PROMETHEUS_PASSWORD_FILE"`
+
+	// GrafanaCloudStack is the slug of a Grafana Cloud stack, e.g. mystack for
+	// mystack.grafana.net. The push URL and the user are looked up with
+	// GrafanaCloudAPIKey when the test starts, the key being the password.
+	GrafanaCloudStack  null.String `json:"grafanaCloudStack" envconfig:"K6_PROMETHEUS_GRAFANA_CLOUD_STACK"`
+	GrafanaCloudAPIKey null.String `json:"grafanaCloudAPIKey" envconfig:"K6_PROMETHEUS_GRAFANA_CLOUD_API_KEY"`
+
+	BearerToken     null.String `json:"bearerToken" envconfig:"K6_PROMETHEUS_BEARER_TOKEN"`
+	BearerTokenFile null.String `json:"bearerTokenFile" envconfig:"K6_PROMETHEUS_BEARER_TOKEN_FILE"`
+
+	// OAuth2 client credentials flow: the token is fetched from OAuth2TokenURL
+	// and refreshed automatically when it expires.
+	OAuth2TokenURL     null.String `json:"oauth2TokenURL" envconfig:"K6_PROMETHEUS_OAUTH2_TOKEN_URL"`
+	OAuth2ClientID     null.String `json:"oauth2ClientID" envconfig:"K6_PROMETHEUS_OAUTH2_CLIENT_ID"`
+	OAuth2ClientSecret null.String `json:"oauth2ClientSecret" envconfig:"K6_PROMETHEUS_OAUTH2_CLIENT_SECRET"`
+	OAuth2Scopes       []string    `json:"oauth2Scopes" envconfig:"K6_PROMETHEUS_OAUTH2_SCOPES"`
+
+	// AzureAuth authenticates with Azure AD (Entra ID) tokens for AzureAudience, e.g.
+	// for Azure Monitor managed Prometheus, either client-secret, with the tenant, client
+	// ID and secret of an app registration, or managed-identity, with the client ID of
+	// a user-assigned identity or else the system-assigned one.
+	AzureAuth          null.String `json:"azureAuth" envconfig:"K6_PROMETHEUS_AZURE_AUTH"`
+	AzureTenantID      null.String `json:"azureTenantID" envconfig:"K6_PROMETHEUS_AZURE_TENANT_ID"`
+	AzureClientID      null.String `json:"azureClientID" envconfig:"K6_PROMETHEUS_AZURE_CLIENT_ID"`
+	AzureClientSecret  null.String `json:"azureClientSecret" envconfig:"K6_PROMETHEUS_AZURE_CLIENT_SECRET"`
+	AzureAudience      null.String `json:"azureAudience" envconfig:"K6_PROMETHEUS_AZURE_AUDIENCE"`
+	AzureAuthorityHost null.String `json:"azureAuthorityHost" envconfig:"K6_PROMETHEUS_AZURE_AUTHORITY_HOST"`
+
+	// GoogleAuth authenticates with the tokens of the Google application default
+	// credentials, e.g. for Google Cloud Managed Service for Prometheus.
+	GoogleAuth null.Bool `json:"googleAuth" envconfig:"K6_PROMETHEUS_GOOGLE_AUTH"`
+
+	// ProxyURL is the proxy requests are sent through, otherwise the one in the
+	// HTTP_PROXY or HTTPS_PROXY environment variable is used. The hosts in
+	// NO_PROXY are always reached directly. Credentials can be set in the URL.
+	ProxyURL null.String `json:"proxyURL" envconfig:"K6_PROMETHEUS_PROXY_URL"`
+
+	// Timeout of each request to the remote endpoint.
+	Timeout types.NullDuration `json:"timeout" envconfig:"K6_PROMETHEUS_TIMEOUT"`
+
+	// EnableHTTP2 allows HTTP/2 to be negotiated with HTTPS endpoints.
+	EnableHTTP2 null.Bool `json:"enableHTTP2" envconfig:"K6_PROMETHEUS_ENABLE_HTTP2"`
+
+	// KeepAlive enables reusing connections between requests: up to MaxIdleConns
+	// idle connections are kept open for IdleConnTimeout.
+	KeepAlive       null.Bool          `json:"keepAlive" envconfig:"K6_PROMETHEUS_KEEP_ALIVE"`
+	MaxIdleConns    null.Int           `json:"maxIdleConns" envconfig:"K6_PROMETHEUS_MAX_IDLE_CONNS"`
+	IdleConnTimeout types.NullDuration `json:"idleConnTimeout" envconfig:"K6_PROMETHEUS_IDLE_CONN_TIMEOUT"`
 
 	FlushPeriod types.NullDuration `json:"flushPeriod" envconfig:"K6_PROMETHEUS_FLUSH_PERIOD"`
 
-	KeepTags    null.Bool `json:"keepTags" envconfig:"K6_KEEP_TAGS"`
-	KeepNameTag null.Bool `json:"keepNameTag" envconfig:"K6_KEEP_NAME_TAG"`
-	KeepUrlTag  null.Bool `json:"keepUrlTag" envconfig:"K6_KEEP_URL_TAG"`
+	// AdaptiveFlush enables stretching and shrinking the flush period, starting
+	// from FlushPeriod, within FlushPeriodMin and FlushPeriodMax according to
+	// the latency of the endpoint.
+	AdaptiveFlush  null.Bool          `json:"adaptiveFlush" envconfig:"K6_PROMETHEUS_ADAPTIVE_FLUSH"`
+	FlushPeriodMin types.NullDuration `json:"flushPeriodMin" envconfig:"K6_PROMETHEUS_FLUSH_PERIOD_MIN"`
+	FlushPeriodMax types.NullDuration `json:"flushPeriodMax" envconfig:"K6_PROMETHEUS_FLUSH_PERIOD_MAX"`
+
+	// BufferCapacity is the maximum number of samples buffered between flushes,
+	// zero means no limit. Once reached, samples are handled according to
+	// BufferPolicy: drop-oldest, drop-newest or block k6 until the next flush.
+	BufferCapacity null.Int    `json:"bufferCapacity" envconfig:"K6_PROMETHEUS_BUFFER_CAPACITY"`
+	BufferPolicy   null.String `json:"bufferPolicy" envconfig:"K6_PROMETHEUS_BUFFER_POLICY"`
+
+	// BufferMemoryLimit caps the memory of the buffered samples, in bytes, zero
+	// means no limit. The samples beyond it are written to temporary files in
+	// BufferSpillDir until they are flushed if it's set, and handled according
+	// to BufferPolicy otherwise, as if the capacity were reached.
+	BufferMemoryLimit null.Int    `json:"bufferMemoryLimit" envconfig:"K6_PROMETHEUS_BUFFER_MEMORY_LIMIT"`
+	BufferSpillDir    null.String `json:"bufferSpillDir" envconfig:"K6_PROMETHEUS_BUFFER_SPILL_DIR"`
+
+	// MaxSamplesPerFlush caps the samples sent by a flush, zero means no limit.
+	// The oldest samples are sent and the others are dropped.
+	MaxSamplesPerFlush null.Int `json:"maxSamplesPerFlush" envconfig:"K6_PROMETHEUS_MAX_SAMPLES_PER_FLUSH"`
+
+	// StreamFlush converts the samples of a flush in chunks of MaxSamplesPerRequest
+	// samples, each one being sent while the next one is converted, so that the
+	// series of the whole flush are never held in memory at once.
+	StreamFlush null.Bool `json:"streamFlush" envconfig:"K6_PROMETHEUS_STREAM_FLUSH"`
+
+	// MaxSampleAge is the maximum age of the samples when they are sent, zero
+	// means no limit. Older samples are handled according to OldSampleAction:
+	// drop, or rewrite to send them with the current time.
+	MaxSampleAge    types.NullDuration `json:"maxSampleAge" envconfig:"K6_PROMETHEUS_MAX_SAMPLE_AGE"`
+	OldSampleAction null.String        `json:"oldSampleAction" envconfig:"K6_PROMETHEUS_OLD_SAMPLE_ACTION"`
+
+	// TimestampPrecision truncates the timestamps of the samples to a multiple
+	// of it since the Unix epoch, e.g. 1s, zero keeps the milliseconds. With
+	// FlushTimestamps, the samples of the mappings other than raw and raw-all are sent with
+	// the time of the flush instead of theirs.
+	TimestampPrecision types.NullDuration `json:"timestampPrecision" envconfig:"K6_PROMETHEUS_TIMESTAMP_PRECISION"`
+	FlushTimestamps    null.Bool          `json:"flushTimestamps" envconfig:"K6_PROMETHEUS_FLUSH_TIMESTAMPS"`
+
+	// ClockSync measures, at startup, the offset of the local clock with the
+	// one of the endpoint and corrects the timestamps with it.
+	ClockSync null.Bool `json:"clockSync" envconfig:"K6_PROMETHEUS_CLOCK_SYNC"`
+
+	// Temporality sets whether Counter and Rate metrics are sent as running
+	// totals since the start of the test, cumulative, or per-flush increments, delta.
+	Temporality null.String `json:"temporality" envconfig:"K6_PROMETHEUS_TEMPORALITY"`
+
+	// AggregationWindow, if positive, is the resolution of the series: only the latest
+	// value of each series within a window is sent, once the window is over, and the
+	// stats of the trends are computed over each window.
+	AggregationWindow types.NullDuration `json:"aggregationWindow" envconfig:"K6_PROMETHEUS_AGGREGATION_WINDOW"`
+
+	// ShutdownTimeout is how long the output keeps retrying to deliver the
+	// remaining samples when the test ends, regardless of RetryMaxAttempts.
+	ShutdownTimeout types.NullDuration `json:"shutdownTimeout" envconfig:"K6_PROMETHEUS_SHUTDOWN_TIMEOUT"`
+
+	// StaleMarkers enables sending Prometheus stale markers for all series when the test ends.
+	StaleMarkers null.Bool `json:"staleMarkers" envconfig:"K6_PROMETHEUS_STALE_MARKERS"`
+
+	// Exemplars enables attaching the trace_id tag of Trend samples as an exemplar
+	// to the series derived from them, instead of sending it as a label.
+	Exemplars null.Bool `json:"exemplars" envconfig:"K6_PROMETHEUS_EXEMPLARS"`
+
+	// SelfMetrics enables sending metrics about the output itself as k6_output_prw_* series.
+	SelfMetrics null.Bool `json:"selfMetrics" envconfig:"K6_PROMETHEUS_SELF_METRICS"`
+
+	// ExecutionMetrics sends the latest values of the vus, vus_max, iterations and
+	// dropped_iterations series with every flush, even without samples for them.
+	ExecutionMetrics null.Bool `json:"executionMetrics" envconfig:"K6_PROMETHEUS_EXECUTION_METRICS"`
+
+	// Heartbeat sends a k6_up series with every flush, 1 while the test runs and 0
+	// once it ends, labeled with Instance, the hostname by default, and the hostname.
+	Heartbeat null.Bool   `json:"heartbeat" envconfig:"K6_PROMETHEUS_HEARTBEAT"`
+	Instance  null.String `json:"instance" envconfig:"K6_PROMETHEUS_INSTANCE"`
+
+	// TestMarkers sends a k6_test_info series with value 1 when the test starts and
+	// when it ends, labeled with the phase, start or end, and the script.
+	TestMarkers null.Bool `json:"testMarkers" envconfig:"K6_PROMETHEUS_TEST_MARKERS"`
+	// TestInfo sends the k6_test_info series of the start of the test, with the
+	// versions of k6 and of the extension, the VUs, the duration and the stages as
+	// labels. With TestMarkers, these are added to the labels of both markers.
+	TestInfo null.Bool `json:"testInfo" envconfig:"K6_PROMETHEUS_TEST_INFO"`
+
+	// Summary prints the stats of the output, e.g. the series and bytes sent, when the test ends.
+	Summary null.Bool `json:"summary" envconfig:"K6_PROMETHEUS_SUMMARY"`
+
+	// ScenarioLabel and GroupLabel set whether the scenario and group tags are
+	// sent as labels of every series, regardless of the other tag options.
+	ScenarioLabel null.Bool `json:"scenarioLabel" envconfig:"K6_PROMETHEUS_SCENARIO_LABEL"`
+	GroupLabel    null.Bool `json:"groupLabel" envconfig:"K6_PROMETHEUS_GROUP_LABEL"`
+	// PhaseLabel adds the phase label to every series, setup, teardown or default,
+	// so that the samples of setup() and teardown() can be excluded from the queries.
+	PhaseLabel null.Bool `json:"phaseLabel" envconfig:"K6_PROMETHEUS_PHASE_LABEL"`
+
+	// SendMetadata enables sending the type, help and unit of the metrics
+	// the first time they are seen, with remote write 1.0 only.
+	SendMetadata null.Bool `json:"sendMetadata" envconfig:"K6_PROMETHEUS_SEND_METADATA"`
+
+	// ThresholdMetrics enables sending the results of the thresholds of the test
+	// as k6_threshold and k6_threshold_value series.
+	ThresholdMetrics null.Bool `json:"thresholdMetrics" envconfig:"K6_PROMETHEUS_THRESHOLD_METRICS"`
+
+	KeepTags    null.Bool `json:"keepTags" envconfig:"K6_PROMETHEUS_KEEP_TAGS"`
+	KeepNameTag null.Bool `json:"keepNameTag" envconfig:"K6_PROMETHEUS_KEEP_NAME_TAG"`
+	KeepUrlTag  null.Bool `json:"keepUrlTag" envconfig:"K6_PROMETHEUS_KEEP_URL_TAG"`
+
+	// TagsAsLabels, if not empty, are the only sample tags sent as labels;
+	// TagsExclude are never sent as labels. With FoldTags the remaining tags
+	// are sent all together in the k6_tags label instead of being dropped.
+	TagsAsLabels []string  `json:"tagsAsLabels" envconfig:"K6_PROMETHEUS_TAGS_AS_LABELS"`
+	TagsExclude  []string  `json:"tagsExclude" envconfig:"K6_PROMETHEUS_TAGS_EXCLUDE"`
+	FoldTags     null.Bool `json:"foldTags" envconfig:"K6_PROMETHEUS_FOLD_TAGS"`
+
+	// MaxLabelValueLength is the maximum length in bytes of the label values
+	// set from tags, longer ones are truncated. Zero means no limit.
+	MaxLabelValueLength null.Int `json:"maxLabelValueLength" envconfig:"K6_PROMETHEUS_MAX_LABEL_VALUE_LENGTH"`
+
+	// StrictNames drops, with an error, the samples whose metric or tag names are
+	// not valid Prometheus names instead of rewriting the names.
+	StrictNames null.Bool `json:"strictNames" envconfig:"K6_PROMETHEUS_STRICT_NAMES"`
+
+	// MaxSeries limits the number of distinct series sent during the test, zero
+	// means no limit. Beyond it, the samples of new series are handled according
+	// to MaxSeriesAction: drop, aggregate or abort.
+	MaxSeries       null.Int    `json:"maxSeries" envconfig:"K6_PROMETHEUS_MAX_SERIES"`
+	MaxSeriesAction null.String `json:"maxSeriesAction" envconfig:"K6_PROMETHEUS_MAX_SERIES_ACTION"`
+
+	// StopTestOnError aborts the test after this number of consecutive flushes
+	// failing to send the series, zero means the test is never aborted.
+	StopTestOnError null.Int `json:"stopTestOnError" envconfig:"K6_PROMETHEUS_STOP_TEST_ON_ERROR"`
+
+	// MetricsInclude and MetricsExclude are regular expressions matched against
+	// k6 metric names: only the included metrics that are not excluded are sent.
+	MetricsInclude []string `json:"metricsInclude" envconfig:"K6_PROMETHEUS_METRICS_INCLUDE"`
+	MetricsExclude []string `json:"metricsExclude" envconfig:"K6_PROMETHEUS_METRICS_EXCLUDE"`
+
+	// TestRunID is added as test_run_id label to every series. A random UUID is
+	// generated if it's not configured, an empty value disables the label.
+	TestRunID null.String `json:"testRunID" envconfig:"K6_PROMETHEUS_TEST_RUN_ID"`
+
+	// RelabelConfigs are applied to the labels of every series, in order, before sending it.
+	RelabelConfigs []RelabelConfig `json:"relabelConfigs" envconfig:"K6_PROMETHEUS_RELABEL_CONFIGS"`
+
+	// GroupURLs replaces the IDs in the url and name tags with placeholders, e.g.
+	// /users/123 with /users/:id, and URLGroups are rules doing the same with
+	// regular expressions. The rules are applied first, then the builtin grouping.
+	GroupURLs null.Bool  `json:"groupURLs" envconfig:"K6_PROMETHEUS_GROUP_URLS"`
+	URLGroups []URLGroup `json:"urlGroups" envconfig:"K6_PROMETHEUS_URL_GROUPS"`
+
+	// Labels are static labels added to every series.
+	Labels map[string]string `json:"labels" envconfig:"K6_PROMETHEUS_EXTRA_LABELS"`
+	// LabelConflict resolves the labels set more than once on a series, e.g. a
+	// sample tag with the name of a static label: first-wins keeps the tag,
+	// last-wins the static label and prefix keeps both, the tag being renamed
+	// with the exported_ prefix.
+	LabelConflict null.String `json:"labelConflict" envconfig:"K6_PROMETHEUS_LABEL_CONFLICT"`
+
+	// InstanceLabel adds an instance label to every series, with Instance or the
+	// hostname, so that the series of distributed load generators don't collide.
+	InstanceLabel null.Bool `json:"instanceLabel" envconfig:"K6_PROMETHEUS_INSTANCE_LABEL"`
+	// JobLabel adds a job label to every series, with Job, k6 by default, as
+	// Prometheus does for the series it scrapes.
+	JobLabel null.Bool   `json:"jobLabel" envconfig:"K6_PROMETHEUS_JOB_LABEL"`
+	Job      null.String `json:"job" envconfig:"K6_PROMETHEUS_JOB"`
+	// HonorLabels leaves the sample tags named job or instance that collide with
+	// the static labels to LabelConflict, the tags being kept by default. Disabled,
+	// as with honor_labels: false in Prometheus, the tags are kept renamed with
+	// the exported_ prefix, e.g. exported_job.
+	HonorLabels null.Bool `json:"honorLabels" envconfig:"K6_PROMETHEUS_HONOR_LABELS"`
+	// LabelsFromEnv adds labels to every series with the values of environment
+	// variables, by label name, e.g. pod=POD_NAME as set by the Kubernetes downward API.
+	LabelsFromEnv map[string]string `json:"labelsFromEnv" envconfig:"K6_PROMETHEUS_LABELS_FROM_ENV"`
+	// Kubernetes adds the pod, namespace and node labels to every series, read from
+	// the downward API, either downward-api or k6-operator, which also adds the index
+	// of the runner pod. KubernetesMetadataDir is where the downward API volume is mounted.
+	Kubernetes            null.String `json:"kubernetes" envconfig:"K6_PROMETHEUS_KUBERNETES"`
+	KubernetesMetadataDir null.String `json:"kubernetesMetadataDir" envconfig:"K6_PROMETHEUS_KUBERNETES_METADATA_DIR"`
+
+	// ReloadConfig reloads the metrics filters, the relabeling rules and the static
+	// labels from the config file on SIGHUP, without restarting the test.
+	ReloadConfig null.Bool `json:"reloadConfig" envconfig:"K6_PROMETHEUS_RELOAD_CONFIG"`
+
+	// TrendStats are the stats sent for each Trend metric with the prometheus mapping,
+	// as in k6's summaryTrendStats. Defaults to min, max, avg, med, p(90) and p(95).
+	TrendStats []string `json:"trendStats" envconfig:"K6_PROMETHEUS_TREND_STATS"`
+
+	// RateCounters enables sending each Rate metric as the <name>_total and
+	// <name>_success_total counters of all and non-zero samples instead of
+	// the ratio, with the prometheus and histogram mappings.
+	RateCounters null.Bool `json:"rateCounters" envconfig:"K6_PROMETHEUS_RATE_COUNTERS"`
+
+	// TrendBuckets holds the bucket boundaries per Trend metric name for histogram mapping.
+	TrendBuckets map[string][]float64 `json:"trendBuckets" envconfig:"K6_PROMETHEUS_TREND_BUCKETS"`
+
+	// Shards is the number of concurrent requests each flush is split into.
+	Shards null.Int `json:"shards" envconfig:"K6_PROMETHEUS_SHARDS"`
+
+	// MaxSamplesPerRequest and MaxRequestBodyBytes (uncompressed) limit the size of
+	// each request, bigger ones are split. Zero means no limit.
+	MaxSamplesPerRequest null.Int `json:"maxSamplesPerRequest" envconfig:"K6_PROMETHEUS_MAX_SAMPLES_PER_REQUEST"`
+	MaxRequestBodyBytes  null.Int `json:"maxRequestBodyBytes" envconfig:"K6_PROMETHEUS_MAX_REQUEST_BODY_BYTES"`
+
+	// RateLimitSamples and RateLimitRequests limit the samples and requests sent
+	// per second, requests are delayed to stay within them. Zero means no limit.
+	RateLimitSamples  null.Int `json:"rateLimitSamples" envconfig:"K6_PROMETHEUS_RATE_LIMIT_SAMPLES"`
+	RateLimitRequests null.Int `json:"rateLimitRequests" envconfig:"K6_PROMETHEUS_RATE_LIMIT_REQUESTS"`
+
+	RetryMaxAttempts    null.Int           `json:"retryMaxAttempts" envconfig:"K6_PROMETHEUS_RETRY_MAX_ATTEMPTS"`
+	RetryInitialBackoff types.NullDuration `json:"retryInitialBackoff" envconfig:"K6_PROMETHEUS_RETRY_INITIAL_BACKOFF"`
+	RetryMaxBackoff     types.NullDuration `json:"retryMaxBackoff" envconfig:"K6_PROMETHEUS_RETRY_MAX_BACKOFF"`
+	RetryJitter         null.Bool          `json:"retryJitter" envconfig:"K6_PROMETHEUS_RETRY_JITTER"`
+
+	// WALDir enables the on-disk buffer of requests that couldn't be delivered.
+	WALDir     null.String        `json:"walDir" envconfig:"K6_PROMETHEUS_WAL_DIR"`
+	WALMaxSize null.Int           `json:"walMaxSize" envconfig:"K6_PROMETHEUS_WAL_MAX_SIZE"`
+	WALMaxAge  types.NullDuration `json:"walMaxAge" envconfig:"K6_PROMETHEUS_WAL_MAX_AGE"`
+
+	// DeadLetterDir enables writing the requests that failed after all the
+	// retries to files, to send them again with ReplayDeadLetters.
+	DeadLetterDir null.String `json:"deadLetterDir" envconfig:"K6_PROMETHEUS_DEAD_LETTER_DIR"`
+
+	// DryRun writes the requests to files in DryRunDir instead of sending them.
+	DryRun    null.Bool   `json:"dryRun" envconfig:"K6_PROMETHEUS_DRY_RUN"`
+	DryRunDir null.String `json:"dryRunDir" envconfig:"K6_PROMETHEUS_DRY_RUN_DIR"`
+
+	// ListenAddr enables an HTTP listener exposing the latest value of every
+	// series on /metrics, in the OpenMetrics text format. With Push disabled,
+	// the series are only exposed, not sent to the remote-write endpoint.
+	ListenAddr null.String `json:"listenAddr" envconfig:"K6_PROMETHEUS_LISTEN_ADDR"`
+	Push       null.Bool   `json:"push" envconfig:"K6_PROMETHEUS_PUSH"`
+
+	// DebugAddr enables an HTTP listener on a loopback address, e.g. localhost:6060,
+	// serving pprof, the samples waiting in the buffer, the stats of the last flush
+	// and the effective config with its secrets redacted, for diagnosing slow flushes.
+	DebugAddr null.String `json:"debugAddr" envconfig:"K6_PROMETHEUS_DEBUG_ADDR"`
+
+	// FailoverUrls are the endpoints used, in order, when the previous one fails
+	// FailoverThreshold consecutive times. The primary endpoint (Url) is probed
+	// again every FailbackInterval.
+	FailoverUrls      []string           `json:"failoverUrls" envconfig:"K6_PROMETHEUS_FAILOVER_URLS"`
+	FailoverThreshold null.Int           `json:"failoverThreshold" envconfig:"K6_PROMETHEUS_FAILOVER_THRESHOLD"`
+	FailbackInterval  types.NullDuration `json:"failbackInterval" envconfig:"K6_PROMETHEUS_FAILBACK_INTERVAL"`
+
+	// BreakerThreshold enables a circuit breaker: after as many consecutive
+	// recoverable errors, no request is sent to the endpoint for BreakerCooldown,
+	// then a single one is sent as a probe to check if it's available again.
+	BreakerThreshold null.Int           `json:"breakerThreshold" envconfig:"K6_PROMETHEUS_BREAKER_THRESHOLD"`
+	BreakerCooldown  types.NullDuration `json:"breakerCooldown" envconfig:"K6_PROMETHEUS_BREAKER_COOLDOWN"`
+
+	// MirrorUrls are endpoints receiving a copy of every request, concurrently.
+	MirrorUrls []string `json:"mirrorUrls" envconfig:"K6_PROMETHEUS_MIRROR_URLS"`
+
+	// KafkaBrokers enables publishing the requests to KafkaTopic instead of sending
+	// them to Url, compressed by Kafka with KafkaCompression. The brokers are
+	// authenticated with KafkaSASLMechanism (plain, scram-sha-256 or scram-sha-512)
+	// and reached over TLS, configured as for Url, if KafkaTLS is enabled.
+	KafkaBrokers       []string    `json:"kafkaBrokers" envconfig:"K6_PROMETHEUS_KAFKA_BROKERS"`
+	KafkaTopic         null.String `json:"kafkaTopic" envconfig:"K6_PROMETHEUS_KAFKA_TOPIC"`
+	KafkaCompression   null.String `json:"kafkaCompression" envconfig:"K6_PROMETHEUS_KAFKA_COMPRESSION"`
+	KafkaSASLMechanism null.String `json:"kafkaSASLMechanism" envconfig:"K6_PROMETHEUS_KAFKA_SASL_MECHANISM"`
+	KafkaUser          null.String `json:"kafkaUser" envconfig:"K6_PROMETHEUS_KAFKA_USER"`
+	KafkaPassword      null.String `json:"kafkaPassword" envconfig:"K6_PROMETHEUS_KAFKA_PASSWORD"`
+	KafkaTLS           null.Bool   `json:"kafkaTLS" envconfig:"K6_PROMETHEUS_KAFKA_TLS"`
 }
 
 func NewConfig() Config {
 	return Config{
 		Mapping:               null.StringFrom("prometheus"),
+		MetricPrefix:          null.StringFrom(defaultMetricPrefix),
 		Url:                   null.StringFrom("http://localhost:9090/api/v1/write"),
+		Protocol:              null.StringFrom("prometheus"),
+		InfluxOrg:             null.NewString("", false),
+		InfluxBucket:          null.NewString("", false),
+		InfluxToken:           null.NewString("", false),
+		GraphiteTags:          null.BoolFrom(true),
+		DatadogAPIKey:         null.NewString("", false),
+		ProtocolVersion:       null.StringFrom(string(protocolV1)),
+		Compression:           null.NewString("", false),
 		InsecureSkipTLSVerify: null.BoolFrom(true),
 		CACert:                null.NewString("", false),
+		TLSCertFile:           null.NewString("", false),
+		TLSKeyFile:            null.NewString("", false),
+		TLSServerName:         null.NewString("", false),
 		User:                  null.NewString("", false),
 		Password:              null.NewString("", false),
+		GrafanaCloudStack:     null.NewString("", false),
+		GrafanaCloudAPIKey:    null.NewString("", false),
+		BearerToken:           null.NewString("", false),
+		BearerTokenFile:       null.NewString("", false),
+		OAuth2TokenURL:        null.NewString("", false),
+		OAuth2ClientID:        null.NewString("", false),
+		OAuth2ClientSecret:    null.NewString("", false),
+		AzureAuth:             null.StringFrom(""),
+		AzureTenantID:         null.NewString("", false),
+		AzureClientID:         null.NewString("", false),
+		AzureClientSecret:     null.NewString("", false),
+		AzureAudience:         null.StringFrom(defaultAzureAudience),
+		AzureAuthorityHost:    null.StringFrom(defaultAzureAuthorityHost),
+		GoogleAuth:            null.BoolFrom(false),
+		ProxyURL:              null.NewString("", false),
+		Timeout:               types.NullDurationFrom(defaultPrometheusTimeout),
+		EnableHTTP2:           null.BoolFrom(true),
+		KeepAlive:             null.BoolFrom(true),
+		MaxIdleConns:          null.IntFrom(defaultMaxIdleConns),
+		IdleConnTimeout:       types.NullDurationFrom(defaultIdleConnTimeout),
 		FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
+		AdaptiveFlush:         null.BoolFrom(false),
+		FlushPeriodMin:        types.NullDurationFrom(defaultFlushPeriod),
+		FlushPeriodMax:        types.NullDurationFrom(defaultFlushPeriodMax),
+		ShutdownTimeout:       types.NullDurationFrom(defaultShutdownTimeout),
+		MaxSampleAge:          types.NullDurationFrom(0),
+		OldSampleAction:       null.StringFrom(string(oldSampleDrop)),
+		TimestampPrecision:    types.NullDurationFrom(0),
+		FlushTimestamps:       null.BoolFrom(false),
+		ClockSync:             null.BoolFrom(false),
+		BufferCapacity:        null.IntFrom(defaultBufferCapacity),
+		BufferPolicy:          null.StringFrom(string(bufferDropNewest)),
+		BufferMemoryLimit:     null.IntFrom(0),
+		BufferSpillDir:        null.NewString("", false),
+		MaxSamplesPerFlush:    null.IntFrom(0),
+		StreamFlush:           null.BoolFrom(false),
+		Temporality:           null.StringFrom(string(temporalityCumulative)),
+		AggregationWindow:     types.NullDurationFrom(0),
+		StaleMarkers:          null.BoolFrom(false),
+		GroupURLs:             null.BoolFrom(false),
+		ReloadConfig:          null.BoolFrom(false),
+		Exemplars:             null.BoolFrom(false),
+		SelfMetrics:           null.BoolFrom(false),
+		Summary:               null.BoolFrom(true),
+		ExecutionMetrics:      null.BoolFrom(false),
+		Heartbeat:             null.BoolFrom(false),
+		Instance:              null.StringFrom(""),
+		TestMarkers:           null.BoolFrom(false),
+		TestInfo:              null.BoolFrom(false),
+		RateCounters:          null.BoolFrom(false),
+		SendMetadata:          null.BoolFrom(true),
+		ScenarioLabel:         null.BoolFrom(true),
+		GroupLabel:            null.BoolFrom(true),
+		PhaseLabel:            null.BoolFrom(false),
+		ThresholdMetrics:      null.BoolFrom(false),
 		KeepTags:              null.BoolFrom(true),
 		KeepNameTag:           null.BoolFrom(false),
 		KeepUrlTag:            null.BoolFrom(true),
+		FoldTags:              null.BoolFrom(false),
+		MaxLabelValueLength:   null.IntFrom(defaultMaxLabelValueLength),
+		StrictNames:           null.BoolFrom(false),
+		MaxSeries:             null.IntFrom(0),
+		StopTestOnError:       null.IntFrom(0),
+		MaxSeriesAction:       null.StringFrom(string(seriesLimitDrop)),
 		Headers:               make(map[string]string),
+		HeaderFiles:           make(map[string]string),
+		CredentialsRefresh:    types.NullDurationFrom(0),
+		TenantID:              null.NewString("", false),
+		TenantTag:             null.NewString("", false),
+		TrendBuckets:          make(map[string][]float64),
+		Labels:                make(map[string]string),
+		LabelConflict:         null.StringFrom(string(labelConflictFirstWins)),
+		InstanceLabel:         null.BoolFrom(false),
+		JobLabel:              null.BoolFrom(false),
+		Job:                   null.StringFrom(defaultJob),
+		HonorLabels:           null.BoolFrom(true),
+		LabelsFromEnv:         make(map[string]string),
+		Kubernetes:            null.StringFrom(""),
+		KubernetesMetadataDir: null.StringFrom("/etc/podinfo"),
+		TestRunID:             null.NewString("", false),
+		Shards:                null.IntFrom(defaultShards),
+		MaxSamplesPerRequest:  null.IntFrom(0),
+		MaxRequestBodyBytes:   null.IntFrom(0),
+		RateLimitSamples:      null.IntFrom(0),
+		RateLimitRequests:     null.IntFrom(0),
+		RetryMaxAttempts:      null.IntFrom(defaultRetryMaxAttempts),
+		RetryInitialBackoff:   types.NullDurationFrom(defaultRetryBackoff),
+		RetryMaxBackoff:       types.NullDurationFrom(defaultRetryMaxBackoff),
+		RetryJitter:           null.BoolFrom(true),
+		WALDir:                null.NewString("", false),
+		DeadLetterDir:         null.NewString("", false),
+		DryRun:                null.BoolFrom(false),
+		DryRunDir:             null.StringFrom(defaultDryRunDir),
+		ListenAddr:            null.NewString("", false),
+		Push:                  null.BoolFrom(true),
+		DebugAddr:             null.NewString("", false),
+		WALMaxSize:            null.IntFrom(defaultWALMaxSize),
+		WALMaxAge:             types.NullDurationFrom(defaultWALMaxAge),
+		FailoverThreshold:     null.IntFrom(defaultFailoverThreshold),
+		FailbackInterval:      types.NullDurationFrom(defaultFailbackInterval),
+		BreakerThreshold:      null.IntFrom(0),
+		BreakerCooldown:       types.NullDurationFrom(defaultBreakerCooldown),
+		KafkaTopic:            null.NewString("", false),
+		KafkaCompression:      null.NewString("", false),
+		KafkaSASLMechanism:    null.NewString("", false),
+		KafkaUser:             null.NewString("", false),
+		KafkaPassword:         null.NewString("", false),
+		KafkaTLS:              null.BoolFrom(false),
 	}
 }
 
 func (conf Config) ConstructRemoteConfig() (*remote.ClientConfig, error) {
 	httpConfig := promConfig.DefaultHTTPClientConfig
+	httpConfig.EnableHTTP2 = conf.EnableHTTP2.Bool
 
 	httpConfig.TLSConfig = promConfig.TLSConfig{
 		InsecureSkipVerify: conf.InsecureSkipTLSVerify.Bool,
@@ -69,27 +583,121 @@ func (conf Config) ConstructRemoteConfig() (*remote.ClientConfig, error) {
 		httpConfig.TLSConfig.CAFile = conf.CACert.String
 	}
 
+	if conf.TLSCertFile.Valid != conf.TLSKeyFile.Valid {
+		return nil, fmt.Errorf("both tlsCertFile and tlsKeyFile must be configured for mutual TLS")
+	}
+	httpConfig.TLSConfig.CertFile = conf.TLSCertFile.String
+	httpConfig.TLSConfig.KeyFile = conf.TLSKeyFile.String
+	httpConfig.TLSConfig.ServerName = conf.TLSServerName.String
+
 	// if at least valid user was configured, use basic auth
 	if conf.User.Valid {
 		httpConfig.BasicAuth = &promConfig.BasicAuth{
-			Username: conf.User.String,
-			Password: promConfig.Secret(conf.Password.String),
+			Username:     conf.User.String,
+			Password:     promConfig.Secret(conf.Password.String),
+			PasswordFile: conf.PasswordFile.String,
+		}
+	}
+
+	if conf.BearerToken.Valid {
+		httpConfig.BearerToken = promConfig.Secret(conf.BearerToken.String)
+	}
+
+	if conf.BearerTokenFile.Valid {
+		httpConfig.BearerTokenFile = conf.BearerTokenFile.String
+	}
+
+	if conf.Protocol.String == string(protocolInfluxDB) && conf.InfluxToken.Valid {
+		httpConfig.Authorization = &promConfig.Authorization{
+			Type:        influxTokenScheme,
+			Credentials: promConfig.Secret(conf.InfluxToken.String),
+		}
+	}
+
+	if conf.OAuth2TokenURL.Valid || conf.OAuth2ClientID.Valid {
+		httpConfig.OAuth2 = &promConfig.OAuth2{
+			TokenURL:     conf.OAuth2TokenURL.String,
+			ClientID:     conf.OAuth2ClientID.String,
+			ClientSecret: promConfig.Secret(conf.OAuth2ClientSecret.String),
+			Scopes:       conf.OAuth2Scopes,
+			// the token endpoint is usually behind the same gateway
+			TLSConfig: httpConfig.TLSConfig,
+		}
+	}
+
+	if conf.ProxyURL.Valid {
+		proxyURL, err := url.Parse(conf.ProxyURL.String)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxyURL: %w", err)
 		}
+		httpConfig.ProxyURL = promConfig.URL{URL: proxyURL}
 	}
+
 	// TODO: consider if the auth logic should be enforced here
 	// (e.g. if insecureSkipTLSVerify is switched off, then check for non-empty certificate file and auth, etc.)
+	if err := httpConfig.Validate(); err != nil {
+		return nil, err
+	}
 
 	u, err := url.Parse(conf.Url.String)
 	if err != nil {
 		return nil, err
 	}
 
+	if conf.Protocol.String == string(protocolVictoriaMetrics) && conf.ImportQueryArgs.String != "" {
+		args, err := url.ParseQuery(conf.ImportQueryArgs.String)
+		if err != nil {
+			return nil, fmt.Errorf("invalid importQueryArgs: %w", err)
+		}
+		query := u.Query()
+		for name, values := range args {
+			for _, v := range values {
+				query.Add(name, v)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	if conf.Protocol.String == string(protocolInfluxDB) {
+		query := u.Query()
+		query.Set("org", conf.InfluxOrg.String)
+		query.Set("bucket", conf.InfluxBucket.String)
+		query.Set("precision", "ms")
+		u.RawQuery = query.Encode()
+	}
+
+	headers := conf.Headers
+	fileHeaders, err := conf.fileHeaders()
+	if err != nil {
+		return nil, err
+	}
+	if conf.TenantID.Valid || len(fileHeaders) > 0 {
+		headers = make(map[string]string, len(conf.Headers)+len(fileHeaders)+1)
+		for k, v := range conf.Headers {
+			headers[k] = v
+		}
+		for k, v := range fileHeaders {
+			headers[k] = v
+		}
+		if conf.TenantID.Valid {
+			headers[tenantHeader] = conf.TenantID.String
+		}
+	}
+	if conf.Protocol.String == string(protocolDatadog) && conf.DatadogAPIKey.Valid {
+		withKey := make(map[string]string, len(headers)+1)
+		for k, v := range headers {
+			withKey[k] = v
+		}
+		withKey[datadogAPIKeyHeader] = conf.DatadogAPIKey.String
+		headers = withKey
+	}
+
 	remoteConfig := remote.ClientConfig{
 		URL:              &promConfig.URL{URL: u},
-		Timeout:          model.Duration(defaultPrometheusTimeout),
+		Timeout:          model.Duration(conf.Timeout.Duration),
 		HTTPClientConfig: httpConfig,
 		RetryOnRateLimit: true,
-		Headers:          conf.Headers,
+		Headers:          headers,
 	}
 	return &remoteConfig, nil
 }
@@ -101,10 +709,54 @@ func (base Config) Apply(applied Config) Config {
 		base.Mapping = applied.Mapping
 	}
 
+	if applied.MetricPrefix.Valid {
+		base.MetricPrefix = applied.MetricPrefix
+	}
+
+	if applied.Preset.Valid {
+		base.Preset = applied.Preset
+	}
+
 	if applied.Url.Valid {
 		base.Url = applied.Url
 	}
 
+	if applied.Protocol.Valid {
+		base.Protocol = applied.Protocol
+	}
+
+	if applied.ProtocolVersion.Valid {
+		base.ProtocolVersion = applied.ProtocolVersion
+	}
+
+	if applied.ImportQueryArgs.Valid {
+		base.ImportQueryArgs = applied.ImportQueryArgs
+	}
+
+	if applied.InfluxOrg.Valid {
+		base.InfluxOrg = applied.InfluxOrg
+	}
+
+	if applied.InfluxBucket.Valid {
+		base.InfluxBucket = applied.InfluxBucket
+	}
+
+	if applied.InfluxToken.Valid {
+		base.InfluxToken = applied.InfluxToken
+	}
+
+	if applied.GraphiteTags.Valid {
+		base.GraphiteTags = applied.GraphiteTags
+	}
+
+	if applied.DatadogAPIKey.Valid {
+		base.DatadogAPIKey = applied.DatadogAPIKey
+	}
+
+	if applied.Compression.Valid {
+		base.Compression = applied.Compression
+	}
+
 	if applied.InsecureSkipTLSVerify.Valid {
 		base.InsecureSkipTLSVerify = applied.InsecureSkipTLSVerify
 	}
@@ -113,6 +765,18 @@ func (base Config) Apply(applied Config) Config {
 		base.CACert = applied.CACert
 	}
 
+	if applied.TLSCertFile.Valid {
+		base.TLSCertFile = applied.TLSCertFile
+	}
+
+	if applied.TLSKeyFile.Valid {
+		base.TLSKeyFile = applied.TLSKeyFile
+	}
+
+	if applied.TLSServerName.Valid {
+		base.TLSServerName = applied.TLSServerName
+	}
+
 	if applied.User.Valid {
 		base.User = applied.User
 	}
@@ -121,190 +785,2133 @@ func (base Config) Apply(applied Config) Config {
 		base.Password = applied.Password
 	}
 
-	if applied.FlushPeriod.Valid {
-		base.FlushPeriod = applied.FlushPeriod
+	if applied.PasswordFile.Valid {
+		base.PasswordFile = applied.PasswordFile
 	}
 
-	if applied.KeepTags.Valid {
-		base.KeepTags = applied.KeepTags
+	if applied.GrafanaCloudStack.Valid {
+		base.GrafanaCloudStack = applied.GrafanaCloudStack
 	}
 
-	if applied.KeepNameTag.Valid {
-		base.KeepNameTag = applied.KeepNameTag
+	if applied.GrafanaCloudAPIKey.Valid {
+		base.GrafanaCloudAPIKey = applied.GrafanaCloudAPIKey
 	}
 
-	if applied.KeepUrlTag.Valid {
-		base.KeepUrlTag = applied.KeepUrlTag
+	if applied.BearerToken.Valid {
+		base.BearerToken = applied.BearerToken
 	}
 
-	if len(applied.Headers) > 0 {
-		for k, v := range applied.Headers {
-			base.Headers[k] = v
-		}
+	if applied.BearerTokenFile.Valid {
+		base.BearerTokenFile = applied.BearerTokenFile
 	}
 
-	return base
-}
+	if applied.OAuth2TokenURL.Valid {
+		base.OAuth2TokenURL = applied.OAuth2TokenURL
+	}
 
-// ParseArg takes an arg string and converts it to a config
-func ParseArg(arg string) (Config, error) {
-	var c Config
-	params, err := strvals.Parse(arg)
-	if err != nil {
-		return c, err
+	if applied.OAuth2ClientID.Valid {
+		base.OAuth2ClientID = applied.OAuth2ClientID
 	}
 
-	if v, ok := params["mapping"].(string); ok {
-		c.Mapping = null.StringFrom(v)
+	if applied.OAuth2ClientSecret.Valid {
+		base.OAuth2ClientSecret = applied.OAuth2ClientSecret
 	}
 
-	if v, ok := params["url"].(string); ok {
-		c.Url = null.StringFrom(v)
+	if applied.OAuth2Scopes != nil {
+		base.OAuth2Scopes = applied.OAuth2Scopes
 	}
 
-	if v, ok := params["insecureSkipTLSVerify"].(bool); ok {
-		c.InsecureSkipTLSVerify = null.BoolFrom(v)
+	if applied.AzureAuth.Valid {
+		base.AzureAuth = applied.AzureAuth
 	}
 
-	if v, ok := params["caCertFile"].(string); ok {
-		c.CACert = null.StringFrom(v)
+	if applied.AzureTenantID.Valid {
+		base.AzureTenantID = applied.AzureTenantID
 	}
 
-	if v, ok := params["user"].(string); ok {
-		c.User = null.StringFrom(v)
+	if applied.AzureClientID.Valid {
+		base.AzureClientID = applied.AzureClientID
 	}
 
-	if v, ok := params["password"].(string); ok {
-		c.Password = null.StringFrom(v)
+	if applied.AzureClientSecret.Valid {
+		base.AzureClientSecret = applied.AzureClientSecret
 	}
 
-	if v, ok := params["flushPeriod"].(string); ok {
-		if err := c.FlushPeriod.UnmarshalText([]byte(v)); err != nil {
-			return c, err
-		}
+	if applied.AzureAudience.Valid {
+		base.AzureAudience = applied.AzureAudience
 	}
 
-	if v, ok := params["keepTags"].(bool); ok {
-		c.KeepTags = null.BoolFrom(v)
+	if applied.AzureAuthorityHost.Valid {
+		base.AzureAuthorityHost = applied.AzureAuthorityHost
 	}
 
-	if v, ok := params["keepNameTag"].(bool); ok {
-		c.KeepNameTag = null.BoolFrom(v)
+	if applied.GoogleAuth.Valid {
+		base.GoogleAuth = applied.GoogleAuth
 	}
 
-	if v, ok := params["keepUrlTag"].(bool); ok {
-		c.KeepUrlTag = null.BoolFrom(v)
+	if applied.ProxyURL.Valid {
+		base.ProxyURL = applied.ProxyURL
 	}
 
-	c.Headers = make(map[string]string)
-	if v, ok := params["headers"].(map[string]interface{}); ok {
-		for k, v := range v {
-			if v, ok := v.(string); ok {
-				c.Headers[k] = v
-			}
-		}
+	if applied.Timeout.Valid {
+		base.Timeout = applied.Timeout
 	}
 
-	return c, nil
-}
+	if applied.EnableHTTP2.Valid {
+		base.EnableHTTP2 = applied.EnableHTTP2
+	}
 
-// GetConsolidatedConfig combines {default config values + JSON config +
-// environment vars + arg config values}, and returns the final result.
-func GetConsolidatedConfig(jsonRawConf json.RawMessage, env map[string]string, arg string) (Config, error) {
-	result := NewConfig()
-	if jsonRawConf != nil {
-		jsonConf := Config{}
-		if err := json.Unmarshal(jsonRawConf, &jsonConf); err != nil {
-			return result, err
-		}
-		result = result.Apply(jsonConf)
+	if applied.KeepAlive.Valid {
+		base.KeepAlive = applied.KeepAlive
 	}
 
-	getEnvBool := func(env map[string]string, name string) (null.Bool, error) {
-		if v, vDefined := env[name]; vDefined {
-			if b, err := strconv.ParseBool(v); err != nil {
-				return null.NewBool(false, false), err
-			} else {
-				return null.BoolFrom(b), nil
-			}
-		}
-		return null.NewBool(false, false), nil
+	if applied.MaxIdleConns.Valid {
+		base.MaxIdleConns = applied.MaxIdleConns
 	}
 
-	getEnvMap := func(env map[string]string, prefix string) map[string]string {
-		result := make(map[string]string)
-		for ek, ev := range env {
-			if strings.HasPrefix(ek, prefix) {
-				k := strings.TrimPrefix(ek, prefix)
-				result[k] = ev
-			}
-		}
-		return result
+	if applied.IdleConnTimeout.Valid {
+		base.IdleConnTimeout = applied.IdleConnTimeout
 	}
 
-	// envconfig is not processing some undefined vars (at least duration) so apply them manually
-	if flushPeriod, flushPeriodDefined := env["K6_PROMETHEUS_FLUSH_PERIOD"]; flushPeriodDefined {
-		if err := result.FlushPeriod.UnmarshalText([]byte(flushPeriod)); err != nil {
-			return result, err
-		}
+	if applied.FlushPeriod.Valid {
+		base.FlushPeriod = applied.FlushPeriod
 	}
 
-	if mapping, mappingDefined := env["K6_PROMETHEUS_MAPPING"]; mappingDefined {
-		result.Mapping = null.StringFrom(mapping)
+	if applied.AdaptiveFlush.Valid {
+		base.AdaptiveFlush = applied.AdaptiveFlush
 	}
 
-	if url, urlDefined := env["K6_PROMETHEUS_REMOTE_URL"]; urlDefined {
-		result.Url = null.StringFrom(url)
+	if applied.FlushPeriodMin.Valid {
+		base.FlushPeriodMin = applied.FlushPeriodMin
 	}
 
-	if b, err := getEnvBool(env, "K6_PROMETHEUS_INSECURE_SKIP_TLS_VERIFY"); err != nil {
-		return result, err
-	} else {
-		if b.Valid {
-			// apply only if valid, to keep default option otherwise
-			result.InsecureSkipTLSVerify = b
-		}
+	if applied.FlushPeriodMax.Valid {
+		base.FlushPeriodMax = applied.FlushPeriodMax
 	}
 
-	if ca, caDefined := env["K6_CA_CERT_FILE"]; caDefined {
-		result.CACert = null.StringFrom(ca)
+	if applied.ShutdownTimeout.Valid {
+		base.ShutdownTimeout = applied.ShutdownTimeout
 	}
 
-	if user, userDefined := env["K6_PROMETHEUS_USER"]; userDefined {
-		result.User = null.StringFrom(user)
+	if applied.MaxSampleAge.Valid {
+		base.MaxSampleAge = applied.MaxSampleAge
 	}
 
-	if password, passwordDefined := env["K6_PROMETHEUS_PASSWORD"]; passwordDefined {
-		result.Password = null.StringFrom(password)
+	if applied.OldSampleAction.Valid {
+		base.OldSampleAction = applied.OldSampleAction
 	}
 
-	if b, err := getEnvBool(env, "K6_KEEP_TAGS"); err != nil {
-		return result, err
-	} else {
-		if b.Valid {
-			result.KeepTags = b
-		}
+	if applied.TimestampPrecision.Valid {
+		base.TimestampPrecision = applied.TimestampPrecision
 	}
 
-	if b, err := getEnvBool(env, "K6_KEEP_NAME_TAG"); err != nil {
-		return result, err
-	} else {
-		if b.Valid {
-			result.KeepNameTag = b
-		}
+	if applied.FlushTimestamps.Valid {
+		base.FlushTimestamps = applied.FlushTimestamps
 	}
 
-	if b, err := getEnvBool(env, "K6_KEEP_URL_TAG"); err != nil {
-		return result, err
-	} else {
-		if b.Valid {
-			result.KeepUrlTag = b
-		}
+	if applied.ClockSync.Valid {
+		base.ClockSync = applied.ClockSync
 	}
 
-	envHeaders := getEnvMap(env, "K6_PROMETHEUS_HEADERS_")
-	for k, v := range envHeaders {
-		result.Headers[k] = v
+	if applied.Temporality.Valid {
+		base.Temporality = applied.Temporality
+	}
+
+	if applied.AggregationWindow.Valid {
+		base.AggregationWindow = applied.AggregationWindow
+	}
+
+	if applied.StaleMarkers.Valid {
+		base.StaleMarkers = applied.StaleMarkers
+	}
+
+	if applied.ReloadConfig.Valid {
+		base.ReloadConfig = applied.ReloadConfig
+	}
+
+	if applied.Exemplars.Valid {
+		base.Exemplars = applied.Exemplars
+	}
+
+	if applied.SelfMetrics.Valid {
+		base.SelfMetrics = applied.SelfMetrics
+	}
+
+	if applied.Summary.Valid {
+		base.Summary = applied.Summary
+	}
+
+	if applied.ExecutionMetrics.Valid {
+		base.ExecutionMetrics = applied.ExecutionMetrics
+	}
+
+	if applied.Heartbeat.Valid {
+		base.Heartbeat = applied.Heartbeat
+	}
+
+	if applied.TestMarkers.Valid {
+		base.TestMarkers = applied.TestMarkers
+	}
+
+	if applied.TestInfo.Valid {
+		base.TestInfo = applied.TestInfo
+	}
+
+	if applied.Instance.Valid {
+		base.Instance = applied.Instance
+	}
+
+	if applied.ScenarioLabel.Valid {
+		base.ScenarioLabel = applied.ScenarioLabel
+	}
+
+	if applied.GroupLabel.Valid {
+		base.GroupLabel = applied.GroupLabel
+	}
+
+	if applied.PhaseLabel.Valid {
+		base.PhaseLabel = applied.PhaseLabel
+	}
+
+	if applied.SendMetadata.Valid {
+		base.SendMetadata = applied.SendMetadata
+	}
+
+	if applied.ThresholdMetrics.Valid {
+		base.ThresholdMetrics = applied.ThresholdMetrics
+	}
+
+	if applied.KeepTags.Valid {
+		base.KeepTags = applied.KeepTags
+	}
+
+	if applied.KeepNameTag.Valid {
+		base.KeepNameTag = applied.KeepNameTag
+	}
+
+	if applied.KeepUrlTag.Valid {
+		base.KeepUrlTag = applied.KeepUrlTag
+	}
+
+	if applied.TagsAsLabels != nil {
+		base.TagsAsLabels = applied.TagsAsLabels
+	}
+
+	if applied.TagsExclude != nil {
+		base.TagsExclude = applied.TagsExclude
+	}
+
+	if applied.FoldTags.Valid {
+		base.FoldTags = applied.FoldTags
+	}
+
+	if applied.MaxLabelValueLength.Valid {
+		base.MaxLabelValueLength = applied.MaxLabelValueLength
+	}
+
+	if applied.StrictNames.Valid {
+		base.StrictNames = applied.StrictNames
+	}
+
+	if applied.BufferCapacity.Valid {
+		base.BufferCapacity = applied.BufferCapacity
+	}
+
+	if applied.BufferPolicy.Valid {
+		base.BufferPolicy = applied.BufferPolicy
+	}
+
+	if applied.BufferMemoryLimit.Valid {
+		base.BufferMemoryLimit = applied.BufferMemoryLimit
+	}
+
+	if applied.BufferSpillDir.Valid {
+		base.BufferSpillDir = applied.BufferSpillDir
+	}
+
+	if applied.MaxSamplesPerFlush.Valid {
+		base.MaxSamplesPerFlush = applied.MaxSamplesPerFlush
+	}
+
+	if applied.StreamFlush.Valid {
+		base.StreamFlush = applied.StreamFlush
+	}
+
+	if applied.MaxSeries.Valid {
+		base.MaxSeries = applied.MaxSeries
+	}
+
+	if applied.MaxSeriesAction.Valid {
+		base.MaxSeriesAction = applied.MaxSeriesAction
+	}
+
+	if applied.StopTestOnError.Valid {
+		base.StopTestOnError = applied.StopTestOnError
+	}
+
+	if len(applied.Headers) > 0 {
+		for k, v := range applied.Headers {
+			base.Headers[k] = v
+		}
+	}
+
+	if len(applied.HeaderFiles) > 0 {
+		for k, v := range applied.HeaderFiles {
+			base.HeaderFiles[k] = v
+		}
+	}
+
+	if applied.TenantID.Valid {
+		base.TenantID = applied.TenantID
+	}
+
+	if applied.TenantIDFile.Valid {
+		base.TenantIDFile = applied.TenantIDFile
+	}
+
+	if applied.CredentialsRefresh.Valid {
+		base.CredentialsRefresh = applied.CredentialsRefresh
+	}
+
+	if applied.TenantTag.Valid {
+		base.TenantTag = applied.TenantTag
+	}
+
+	if applied.TenantRoutes != nil {
+		base.TenantRoutes = applied.TenantRoutes
+	}
+
+	if applied.MetricRoutes != nil {
+		base.MetricRoutes = applied.MetricRoutes
+	}
+
+	if applied.MetricsInclude != nil {
+		base.MetricsInclude = applied.MetricsInclude
+	}
+
+	if applied.MetricsExclude != nil {
+		base.MetricsExclude = applied.MetricsExclude
+	}
+
+	if applied.TestRunID.Valid {
+		base.TestRunID = applied.TestRunID
+	}
+
+	if applied.RelabelConfigs != nil {
+		base.RelabelConfigs = applied.RelabelConfigs
+	}
+
+	if applied.GroupURLs.Valid {
+		base.GroupURLs = applied.GroupURLs
+	}
+
+	if applied.URLGroups != nil {
+		base.URLGroups = applied.URLGroups
+	}
+
+	if len(applied.Labels) > 0 {
+		for k, v := range applied.Labels {
+			base.Labels[k] = v
+		}
+	}
+
+	if applied.LabelConflict.Valid {
+		base.LabelConflict = applied.LabelConflict
+	}
+
+	if applied.InstanceLabel.Valid {
+		base.InstanceLabel = applied.InstanceLabel
+	}
+
+	if applied.JobLabel.Valid {
+		base.JobLabel = applied.JobLabel
+	}
+
+	if applied.Job.Valid {
+		base.Job = applied.Job
+	}
+
+	if applied.HonorLabels.Valid {
+		base.HonorLabels = applied.HonorLabels
+	}
+
+	if len(applied.LabelsFromEnv) > 0 {
+		for k, v := range applied.LabelsFromEnv {
+			base.LabelsFromEnv[k] = v
+		}
+	}
+
+	if applied.Kubernetes.Valid {
+		base.Kubernetes = applied.Kubernetes
+	}
+
+	if applied.KubernetesMetadataDir.Valid {
+		base.KubernetesMetadataDir = applied.KubernetesMetadataDir
+	}
+
+	if applied.TrendStats != nil {
+		base.TrendStats = applied.TrendStats
+	}
+
+	if applied.RateCounters.Valid {
+		base.RateCounters = applied.RateCounters
+	}
+
+	if len(applied.TrendBuckets) > 0 {
+		for k, v := range applied.TrendBuckets {
+			base.TrendBuckets[k] = v
+		}
+	}
+
+	if applied.Shards.Valid {
+		base.Shards = applied.Shards
+	}
+
+	if applied.MaxSamplesPerRequest.Valid {
+		base.MaxSamplesPerRequest = applied.MaxSamplesPerRequest
+	}
+
+	if applied.MaxRequestBodyBytes.Valid {
+		base.MaxRequestBodyBytes = applied.MaxRequestBodyBytes
+	}
+
+	if applied.RateLimitSamples.Valid {
+		base.RateLimitSamples = applied.RateLimitSamples
+	}
+
+	if applied.RateLimitRequests.Valid {
+		base.RateLimitRequests = applied.RateLimitRequests
+	}
+
+	if applied.RetryMaxAttempts.Valid {
+		base.RetryMaxAttempts = applied.RetryMaxAttempts
+	}
+
+	if applied.RetryInitialBackoff.Valid {
+		base.RetryInitialBackoff = applied.RetryInitialBackoff
+	}
+
+	if applied.RetryMaxBackoff.Valid {
+		base.RetryMaxBackoff = applied.RetryMaxBackoff
+	}
+
+	if applied.RetryJitter.Valid {
+		base.RetryJitter = applied.RetryJitter
+	}
+
+	if applied.WALDir.Valid {
+		base.WALDir = applied.WALDir
+	}
+
+	if applied.DeadLetterDir.Valid {
+		base.DeadLetterDir = applied.DeadLetterDir
+	}
+
+	if applied.WALMaxSize.Valid {
+		base.WALMaxSize = applied.WALMaxSize
+	}
+
+	if applied.WALMaxAge.Valid {
+		base.WALMaxAge = applied.WALMaxAge
+	}
+
+	if applied.DryRun.Valid {
+		base.DryRun = applied.DryRun
+	}
+
+	if applied.DryRunDir.Valid {
+		base.DryRunDir = applied.DryRunDir
+	}
+
+	if applied.ListenAddr.Valid {
+		base.ListenAddr = applied.ListenAddr
+	}
+
+	if applied.Push.Valid {
+		base.Push = applied.Push
+	}
+
+	if applied.DebugAddr.Valid {
+		base.DebugAddr = applied.DebugAddr
+	}
+
+	if applied.FailoverUrls != nil {
+		base.FailoverUrls = applied.FailoverUrls
+	}
+
+	if applied.FailoverThreshold.Valid {
+		base.FailoverThreshold = applied.FailoverThreshold
+	}
+
+	if applied.FailbackInterval.Valid {
+		base.FailbackInterval = applied.FailbackInterval
+	}
+
+	if applied.BreakerThreshold.Valid {
+		base.BreakerThreshold = applied.BreakerThreshold
+	}
+
+	if applied.BreakerCooldown.Valid {
+		base.BreakerCooldown = applied.BreakerCooldown
+	}
+
+	if applied.MirrorUrls != nil {
+		base.MirrorUrls = applied.MirrorUrls
+	}
+
+	if applied.KafkaBrokers != nil {
+		base.KafkaBrokers = applied.KafkaBrokers
+	}
+
+	if applied.KafkaTopic.Valid {
+		base.KafkaTopic = applied.KafkaTopic
+	}
+
+	if applied.KafkaCompression.Valid {
+		base.KafkaCompression = applied.KafkaCompression
+	}
+
+	if applied.KafkaSASLMechanism.Valid {
+		base.KafkaSASLMechanism = applied.KafkaSASLMechanism
+	}
+
+	if applied.KafkaUser.Valid {
+		base.KafkaUser = applied.KafkaUser
+	}
+
+	if applied.KafkaPassword.Valid {
+		base.KafkaPassword = applied.KafkaPassword
+	}
+
+	if applied.KafkaTLS.Valid {
+		base.KafkaTLS = applied.KafkaTLS
+	}
+
+	return base
+}
+
+// ParseArg takes an arg string and converts it to a config
+func ParseArg(arg string) (Config, error) {
+	var c Config
+	params, err := strvals.Parse(arg)
+	if err != nil {
+		return c, err
+	}
+
+	if v, ok := params["mapping"].(string); ok {
+		c.Mapping = null.StringFrom(v)
+	}
+
+	if v, ok := params["metricPrefix"].(string); ok {
+		c.MetricPrefix = null.StringFrom(v)
+	}
+
+	if v, ok := params["preset"].(string); ok {
+		c.Preset = null.StringFrom(v)
+	}
+
+	if v, ok := params["url"].(string); ok {
+		c.Url = null.StringFrom(v)
+	}
+
+	if v, ok := params["protocol"].(string); ok {
+		c.Protocol = null.StringFrom(v)
+	}
+
+	if v, ok := params["protocolVersion"]; ok {
+		c.ProtocolVersion = null.StringFrom(fmt.Sprint(v))
+	}
+
+	if v, ok := params["importQueryArgs"].(string); ok {
+		c.ImportQueryArgs = null.StringFrom(v)
+	}
+
+	if v, ok := params["influxOrg"].(string); ok {
+		c.InfluxOrg = null.StringFrom(v)
+	}
+
+	if v, ok := params["influxBucket"].(string); ok {
+		c.InfluxBucket = null.StringFrom(v)
+	}
+
+	if v, ok := params["influxToken"].(string); ok {
+		c.InfluxToken = null.StringFrom(v)
+	}
+
+	if v, ok := params["graphiteTags"].(bool); ok {
+		c.GraphiteTags = null.BoolFrom(v)
+	}
+
+	if v, ok := params["datadogAPIKey"].(string); ok {
+		c.DatadogAPIKey = null.StringFrom(v)
+	}
+
+	if v, ok := params["compression"].(string); ok {
+		c.Compression = null.StringFrom(v)
+	}
+
+	if v, ok := params["insecureSkipTLSVerify"].(bool); ok {
+		c.InsecureSkipTLSVerify = null.BoolFrom(v)
+	}
+
+	if v, ok := params["caCertFile"].(string); ok {
+		c.CACert = null.StringFrom(v)
+	}
+
+	if v, ok := params["tlsCertFile"].(string); ok {
+		c.TLSCertFile = null.StringFrom(v)
+	}
+
+	if v, ok := params["tlsKeyFile"].(string); ok {
+		c.TLSKeyFile = null.StringFrom(v)
+	}
+
+	if v, ok := params["tlsServerName"].(string); ok {
+		c.TLSServerName = null.StringFrom(v)
+	}
+
+	if v, ok := params["user"].(string); ok {
+		c.User = null.StringFrom(v)
+	}
+
+	if v, ok := params["password"].(string); ok {
+		c.Password = null.StringFrom(v)
+	}
+
+	if v, ok := params["passwordFile"].(string); ok {
+		c.PasswordFile = null.StringFrom(v)
+	}
+
+	if v, ok := params["grafanaCloudStack"].(string); ok {
+		c.GrafanaCloudStack = null.StringFrom(v)
+	}
+
+	if v, ok := params["grafanaCloudAPIKey"].(string); ok {
+		c.GrafanaCloudAPIKey = null.StringFrom(v)
+	}
+
+	if v, ok := params["bearerToken"].(string); ok {
+		c.BearerToken = null.StringFrom(v)
+	}
+
+	if v, ok := params["bearerTokenFile"].(string); ok {
+		c.BearerTokenFile = null.StringFrom(v)
+	}
+
+	if v, ok := params["oauth2TokenURL"].(string); ok {
+		c.OAuth2TokenURL = null.StringFrom(v)
+	}
+
+	if v, ok := params["oauth2ClientID"].(string); ok {
+		c.OAuth2ClientID = null.StringFrom(v)
+	}
+
+	if v, ok := params["oauth2ClientSecret"].(string); ok {
+		c.OAuth2ClientSecret = null.StringFrom(v)
+	}
+
+	if v, ok := params["oauth2Scopes"]; ok {
+		c.OAuth2Scopes = parseList(v)
+	}
+
+	if v, ok := params["azureAuth"].(string); ok {
+		c.AzureAuth = null.StringFrom(v)
+	}
+
+	if v, ok := params["azureTenantID"].(string); ok {
+		c.AzureTenantID = null.StringFrom(v)
+	}
+
+	if v, ok := params["azureClientID"].(string); ok {
+		c.AzureClientID = null.StringFrom(v)
+	}
+
+	if v, ok := params["azureClientSecret"].(string); ok {
+		c.AzureClientSecret = null.StringFrom(v)
+	}
+
+	if v, ok := params["azureAudience"].(string); ok {
+		c.AzureAudience = null.StringFrom(v)
+	}
+
+	if v, ok := params["azureAuthorityHost"].(string); ok {
+		c.AzureAuthorityHost = null.StringFrom(v)
+	}
+
+	if v, ok := params["googleAuth"].(bool); ok {
+		c.GoogleAuth = null.BoolFrom(v)
+	}
+
+	if v, ok := params["proxyURL"].(string); ok {
+		c.ProxyURL = null.StringFrom(v)
+	}
+
+	if v, ok := params["timeout"].(string); ok {
+		if err := c.Timeout.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["enableHTTP2"].(bool); ok {
+		c.EnableHTTP2 = null.BoolFrom(v)
+	}
+
+	if v, ok := params["keepAlive"].(bool); ok {
+		c.KeepAlive = null.BoolFrom(v)
+	}
+
+	if v, ok := params["maxIdleConns"].(int64); ok {
+		c.MaxIdleConns = null.IntFrom(v)
+	}
+
+	if v, ok := params["idleConnTimeout"].(string); ok {
+		if err := c.IdleConnTimeout.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["flushPeriod"].(string); ok {
+		if err := c.FlushPeriod.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["adaptiveFlush"].(bool); ok {
+		c.AdaptiveFlush = null.BoolFrom(v)
+	}
+
+	if v, ok := params["flushPeriodMin"].(string); ok {
+		if err := c.FlushPeriodMin.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["flushPeriodMax"].(string); ok {
+		if err := c.FlushPeriodMax.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["shutdownTimeout"].(string); ok {
+		if err := c.ShutdownTimeout.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["maxSampleAge"].(string); ok {
+		if err := c.MaxSampleAge.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["oldSampleAction"].(string); ok {
+		c.OldSampleAction = null.StringFrom(v)
+	}
+
+	if v, ok := params["timestampPrecision"].(string); ok {
+		if err := c.TimestampPrecision.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["flushTimestamps"].(bool); ok {
+		c.FlushTimestamps = null.BoolFrom(v)
+	}
+
+	if v, ok := params["clockSync"].(bool); ok {
+		c.ClockSync = null.BoolFrom(v)
+	}
+
+	if v, ok := params["temporality"].(string); ok {
+		c.Temporality = null.StringFrom(v)
+	}
+
+	if v, ok := params["aggregationWindow"].(string); ok {
+		if err := c.AggregationWindow.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["staleMarkers"].(bool); ok {
+		c.StaleMarkers = null.BoolFrom(v)
+	}
+
+	if v, ok := params["groupURLs"].(bool); ok {
+		c.GroupURLs = null.BoolFrom(v)
+	}
+
+	if v, ok := params["reloadConfig"].(bool); ok {
+		c.ReloadConfig = null.BoolFrom(v)
+	}
+
+	if v, ok := params["exemplars"].(bool); ok {
+		c.Exemplars = null.BoolFrom(v)
+	}
+
+	if v, ok := params["selfMetrics"].(bool); ok {
+		c.SelfMetrics = null.BoolFrom(v)
+	}
+
+	if v, ok := params["summary"].(bool); ok {
+		c.Summary = null.BoolFrom(v)
+	}
+
+	if v, ok := params["testMarkers"].(bool); ok {
+		c.TestMarkers = null.BoolFrom(v)
+	}
+
+	if v, ok := params["testInfo"].(bool); ok {
+		c.TestInfo = null.BoolFrom(v)
+	}
+
+	if v, ok := params["executionMetrics"].(bool); ok {
+		c.ExecutionMetrics = null.BoolFrom(v)
+	}
+
+	if v, ok := params["heartbeat"].(bool); ok {
+		c.Heartbeat = null.BoolFrom(v)
+	}
+
+	if v, ok := params["instance"].(string); ok {
+		c.Instance = null.StringFrom(v)
+	}
+
+	if v, ok := params["scenarioLabel"].(bool); ok {
+		c.ScenarioLabel = null.BoolFrom(v)
+	}
+
+	if v, ok := params["groupLabel"].(bool); ok {
+		c.GroupLabel = null.BoolFrom(v)
+	}
+
+	if v, ok := params["phaseLabel"].(bool); ok {
+		c.PhaseLabel = null.BoolFrom(v)
+	}
+
+	if v, ok := params["sendMetadata"].(bool); ok {
+		c.SendMetadata = null.BoolFrom(v)
+	}
+
+	if v, ok := params["thresholdMetrics"].(bool); ok {
+		c.ThresholdMetrics = null.BoolFrom(v)
+	}
+
+	if v, ok := params["keepTags"].(bool); ok {
+		c.KeepTags = null.BoolFrom(v)
+	}
+
+	if v, ok := params["keepNameTag"].(bool); ok {
+		c.KeepNameTag = null.BoolFrom(v)
+	}
+
+	if v, ok := params["keepUrlTag"].(bool); ok {
+		c.KeepUrlTag = null.BoolFrom(v)
+	}
+
+	if v, ok := params["tagsAsLabels"]; ok {
+		c.TagsAsLabels = parseList(v)
+	}
+
+	if v, ok := params["tagsExclude"]; ok {
+		c.TagsExclude = parseList(v)
+	}
+
+	if v, ok := params["foldTags"].(bool); ok {
+		c.FoldTags = null.BoolFrom(v)
+	}
+
+	if v, ok := params["maxLabelValueLength"].(int64); ok {
+		c.MaxLabelValueLength = null.IntFrom(v)
+	}
+
+	if v, ok := params["strictNames"].(bool); ok {
+		c.StrictNames = null.BoolFrom(v)
+	}
+
+	if v, ok := params["bufferCapacity"].(int64); ok {
+		c.BufferCapacity = null.IntFrom(v)
+	}
+
+	if v, ok := params["maxSamplesPerFlush"].(int64); ok {
+		c.MaxSamplesPerFlush = null.IntFrom(v)
+	}
+
+	if v, ok := params["streamFlush"].(bool); ok {
+		c.StreamFlush = null.BoolFrom(v)
+	}
+
+	if v, ok := params["bufferPolicy"].(string); ok {
+		c.BufferPolicy = null.StringFrom(v)
+	}
+
+	if v, ok := params["bufferMemoryLimit"].(int64); ok {
+		c.BufferMemoryLimit = null.IntFrom(v)
+	}
+
+	if v, ok := params["bufferSpillDir"].(string); ok {
+		c.BufferSpillDir = null.StringFrom(v)
+	}
+
+	if v, ok := params["maxSeries"].(int64); ok {
+		c.MaxSeries = null.IntFrom(v)
+	}
+
+	if v, ok := params["maxSeriesAction"].(string); ok {
+		c.MaxSeriesAction = null.StringFrom(v)
+	}
+
+	if v, ok := params["stopTestOnError"].(int64); ok {
+		c.StopTestOnError = null.IntFrom(v)
+	}
+
+	c.Headers = make(map[string]string)
+	if v, ok := params["headers"].(map[string]interface{}); ok {
+		for k, v := range v {
+			if v, ok := v.(string); ok {
+				c.Headers[k] = v
+			}
+		}
+	}
+
+	c.HeaderFiles = make(map[string]string)
+	if v, ok := params["headerFiles"].(map[string]interface{}); ok {
+		for k, v := range v {
+			if v, ok := v.(string); ok {
+				c.HeaderFiles[k] = v
+			}
+		}
+	}
+
+	if v, ok := params["tenantID"].(string); ok {
+		c.TenantID = null.StringFrom(v)
+	}
+
+	if v, ok := params["tenantIDFile"].(string); ok {
+		c.TenantIDFile = null.StringFrom(v)
+	}
+
+	if v, ok := params["credentialsRefresh"].(string); ok {
+		if err := c.CredentialsRefresh.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["tenantTag"].(string); ok {
+		c.TenantTag = null.StringFrom(v)
+	}
+
+	if v, ok := params["metricsInclude"]; ok {
+		c.MetricsInclude = parseList(v)
+	}
+
+	if v, ok := params["metricsExclude"]; ok {
+		c.MetricsExclude = parseList(v)
+	}
+
+	if v, ok := params["testRunID"]; ok {
+		c.TestRunID = null.StringFrom(fmt.Sprint(v))
+	}
+
+	c.Labels = make(map[string]string)
+	if v, ok := params["labels"].(map[string]interface{}); ok {
+		for k, v := range v {
+			c.Labels[k] = fmt.Sprint(v)
+		}
+	}
+
+	if v, ok := params["labelConflict"].(string); ok {
+		c.LabelConflict = null.StringFrom(v)
+	}
+
+	if v, ok := params["instanceLabel"].(bool); ok {
+		c.InstanceLabel = null.BoolFrom(v)
+	}
+
+	if v, ok := params["jobLabel"].(bool); ok {
+		c.JobLabel = null.BoolFrom(v)
+	}
+
+	if v, ok := params["job"].(string); ok {
+		c.Job = null.StringFrom(v)
+	}
+
+	if v, ok := params["honorLabels"].(bool); ok {
+		c.HonorLabels = null.BoolFrom(v)
+	}
+
+	c.LabelsFromEnv = make(map[string]string)
+	if v, ok := params["labelsFromEnv"].(map[string]interface{}); ok {
+		for k, v := range v {
+			c.LabelsFromEnv[k] = fmt.Sprint(v)
+		}
+	}
+
+	if v, ok := params["kubernetes"].(string); ok {
+		c.Kubernetes = null.StringFrom(v)
+	}
+
+	if v, ok := params["kubernetesMetadataDir"].(string); ok {
+		c.KubernetesMetadataDir = null.StringFrom(v)
+	}
+
+	c.TrendBuckets = make(map[string][]float64)
+	if v, ok := params["trendStats"]; ok {
+		c.TrendStats = parseList(v)
+	}
+
+	if v, ok := params["rateCounters"].(bool); ok {
+		c.RateCounters = null.BoolFrom(v)
+	}
+
+	if v, ok := params["trendBuckets"].(map[string]interface{}); ok {
+		for k, v := range v {
+			buckets, err := parseBuckets(v)
+			if err != nil {
+				return c, err
+			}
+			c.TrendBuckets[k] = buckets
+		}
+	}
+
+	if v, ok := params["shards"].(int64); ok {
+		c.Shards = null.IntFrom(v)
+	}
+
+	if v, ok := params["maxSamplesPerRequest"].(int64); ok {
+		c.MaxSamplesPerRequest = null.IntFrom(v)
+	}
+
+	if v, ok := params["maxRequestBodyBytes"].(int64); ok {
+		c.MaxRequestBodyBytes = null.IntFrom(v)
+	}
+
+	if v, ok := params["rateLimitSamples"].(int64); ok {
+		c.RateLimitSamples = null.IntFrom(v)
+	}
+
+	if v, ok := params["rateLimitRequests"].(int64); ok {
+		c.RateLimitRequests = null.IntFrom(v)
+	}
+
+	if v, ok := params["retryMaxAttempts"].(int64); ok {
+		c.RetryMaxAttempts = null.IntFrom(v)
+	}
+
+	if v, ok := params["retryInitialBackoff"].(string); ok {
+		if err := c.RetryInitialBackoff.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["retryMaxBackoff"].(string); ok {
+		if err := c.RetryMaxBackoff.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["retryJitter"].(bool); ok {
+		c.RetryJitter = null.BoolFrom(v)
+	}
+
+	if v, ok := params["walDir"].(string); ok {
+		c.WALDir = null.StringFrom(v)
+	}
+
+	if v, ok := params["deadLetterDir"].(string); ok {
+		c.DeadLetterDir = null.StringFrom(v)
+	}
+
+	if v, ok := params["walMaxSize"].(int64); ok {
+		c.WALMaxSize = null.IntFrom(v)
+	}
+
+	if v, ok := params["walMaxAge"].(string); ok {
+		if err := c.WALMaxAge.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["dryRun"].(bool); ok {
+		c.DryRun = null.BoolFrom(v)
+	}
+
+	if v, ok := params["dryRunDir"].(string); ok {
+		c.DryRunDir = null.StringFrom(v)
+	}
+
+	if v, ok := params["listenAddr"].(string); ok {
+		c.ListenAddr = null.StringFrom(v)
+	}
+
+	if v, ok := params["push"].(bool); ok {
+		c.Push = null.BoolFrom(v)
+	}
+
+	if v, ok := params["debugAddr"].(string); ok {
+		c.DebugAddr = null.StringFrom(v)
+	}
+
+	if v, ok := params["failoverUrls"]; ok {
+		c.FailoverUrls = parseList(v)
+	}
+
+	if v, ok := params["failoverThreshold"].(int64); ok {
+		c.FailoverThreshold = null.IntFrom(v)
+	}
+
+	if v, ok := params["failbackInterval"].(string); ok {
+		if err := c.FailbackInterval.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["breakerThreshold"].(int64); ok {
+		c.BreakerThreshold = null.IntFrom(v)
+	}
+
+	if v, ok := params["breakerCooldown"].(string); ok {
+		if err := c.BreakerCooldown.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["mirrorUrls"]; ok {
+		c.MirrorUrls = parseList(v)
+	}
+
+	if v, ok := params["kafkaBrokers"]; ok {
+		c.KafkaBrokers = parseList(v)
+	}
+
+	if v, ok := params["kafkaTopic"].(string); ok {
+		c.KafkaTopic = null.StringFrom(v)
+	}
+
+	if v, ok := params["kafkaCompression"].(string); ok {
+		c.KafkaCompression = null.StringFrom(v)
+	}
+
+	if v, ok := params["kafkaSASLMechanism"].(string); ok {
+		c.KafkaSASLMechanism = null.StringFrom(v)
+	}
+
+	if v, ok := params["kafkaUser"].(string); ok {
+		c.KafkaUser = null.StringFrom(v)
+	}
+
+	if v, ok := params["kafkaPassword"].(string); ok {
+		c.KafkaPassword = null.StringFrom(v)
+	}
+
+	if v, ok := params["kafkaTLS"].(bool); ok {
+		c.KafkaTLS = null.BoolFrom(v)
+	}
+
+	return c, nil
+}
+
+// parseList converts a list given either as a comma-separated string
+// (env var) or as a list (arg, e.g. `metricsExclude={data_.*,vus_max}`).
+func parseList(v interface{}) []string {
+	var values []interface{}
+	switch v := v.(type) {
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			values = append(values, s)
+		}
+	case []interface{}:
+		values = v
+	default:
+		values = []interface{}{v}
+	}
+
+	list := make([]string, 0, len(values))
+	for _, value := range values {
+		if s := strings.TrimSpace(fmt.Sprint(value)); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// parseLabels converts a `key=value,key=value` string to a map.
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", pair)
+		}
+		labels[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return labels, nil
+}
+
+// parseBuckets converts bucket boundaries given either as a comma-separated string
+// (env var) or as a list (arg, e.g. `trendBuckets.http_req_duration={50,100,250}`).
+func parseBuckets(v interface{}) ([]float64, error) {
+	var values []interface{}
+	switch v := v.(type) {
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			values = append(values, s)
+		}
+	case []interface{}:
+		values = v
+	default:
+		values = []interface{}{v}
+	}
+
+	buckets := make([]float64, 0, len(values))
+	for _, value := range values {
+		switch value := value.(type) {
+		case int64:
+			buckets = append(buckets, float64(value))
+		case string:
+			b, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bucket boundary %q: %w", value, err)
+			}
+			buckets = append(buckets, b)
+		default:
+			return nil, fmt.Errorf("invalid bucket boundary %v", value)
+		}
+	}
+
+	return buckets, nil
+}
+
+// GetConsolidatedConfig combines {default config values + preset + config file +
+// JSON config + environment vars + arg config values}, and returns the final result.
+// The config file is set with K6_PROMETHEUS_CONFIG.
+func GetConsolidatedConfig(jsonRawConf json.RawMessage, env map[string]string, arg string) (Config, error) {
+	result, err := consolidateConfig(NewConfig(), jsonRawConf, env, arg)
+	if err != nil {
+		return result, err
+	}
+	name := result.Preset.String
+	if name == "" && result.GrafanaCloudStack.String != "" {
+		name = "grafana-cloud"
+	}
+	if name == "" {
+		return result, nil
+	}
+
+	// the preset can be set by any of them, and the options set explicitly take precedence
+	p, err := parsePreset(name)
+	if err != nil {
+		return result, err
+	}
+	result, err = consolidateConfig(NewConfig().Apply(p.options), jsonRawConf, env, arg)
+	if err != nil {
+		return result, err
+	}
+	result.Preset = null.StringFrom(name)
+	result.Url = null.StringFrom(p.withPath(result.Url.String))
+	return result, nil
+}
+
+func consolidateConfig(result Config, jsonRawConf json.RawMessage, env map[string]string, arg string) (Config, error) {
+	// the variables of the upstream extension and the deprecated ones are read under their current names
+	env, _ = resolveEnvAliases(env)
+
+	if path := env["K6_PROMETHEUS_CONFIG"]; path != "" {
+		fileConf, err := loadConfigFile(path)
+		if err != nil {
+			return result, err
+		}
+		result = result.Apply(fileConf)
+	}
+
+	if jsonRawConf != nil {
+		jsonConf := Config{}
+		if err := json.Unmarshal(jsonRawConf, &jsonConf); err != nil {
+			return result, err
+		}
+		result = result.Apply(jsonConf)
+	}
+
+	getEnvBool := func(env map[string]string, name string) (null.Bool, error) {
+		if v, vDefined := env[name]; vDefined {
+			if b, err := strconv.ParseBool(v); err != nil {
+				return null.NewBool(false, false), err
+			} else {
+				return null.BoolFrom(b), nil
+			}
+		}
+		return null.NewBool(false, false), nil
+	}
+
+	getEnvInt := func(env map[string]string, name string) (null.Int, error) {
+		if v, vDefined := env[name]; vDefined {
+			if i, err := strconv.ParseInt(v, 10, 64); err != nil {
+				return null.NewInt(0, false), err
+			} else {
+				return null.IntFrom(i), nil
+			}
+		}
+		return null.NewInt(0, false), nil
+	}
+
+	getEnvMap := func(env map[string]string, prefix string) map[string]string {
+		result := make(map[string]string)
+		for ek, ev := range env {
+			if strings.HasPrefix(ek, prefix) {
+				k := strings.TrimPrefix(ek, prefix)
+				result[k] = ev
+			}
+		}
+		return result
+	}
+
+	// envconfig is not processing some undefined vars (at least duration) so apply them manually
+	if flushPeriod, flushPeriodDefined := env["K6_PROMETHEUS_FLUSH_PERIOD"]; flushPeriodDefined {
+		if err := result.FlushPeriod.UnmarshalText([]byte(flushPeriod)); err != nil {
+			return result, err
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_ADAPTIVE_FLUSH"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.AdaptiveFlush = b
+		}
+	}
+
+	if period, periodDefined := env["K6_PROMETHEUS_FLUSH_PERIOD_MIN"]; periodDefined {
+		if err := result.FlushPeriodMin.UnmarshalText([]byte(period)); err != nil {
+			return result, err
+		}
+	}
+
+	if period, periodDefined := env["K6_PROMETHEUS_FLUSH_PERIOD_MAX"]; periodDefined {
+		if err := result.FlushPeriodMax.UnmarshalText([]byte(period)); err != nil {
+			return result, err
+		}
+	}
+
+	if timeout, timeoutDefined := env["K6_PROMETHEUS_SHUTDOWN_TIMEOUT"]; timeoutDefined {
+		if err := result.ShutdownTimeout.UnmarshalText([]byte(timeout)); err != nil {
+			return result, err
+		}
+	}
+
+	if age, ageDefined := env["K6_PROMETHEUS_MAX_SAMPLE_AGE"]; ageDefined {
+		if err := result.MaxSampleAge.UnmarshalText([]byte(age)); err != nil {
+			return result, err
+		}
+	}
+
+	if action, actionDefined := env["K6_PROMETHEUS_OLD_SAMPLE_ACTION"]; actionDefined {
+		result.OldSampleAction = null.StringFrom(action)
+	}
+
+	if precision, precisionDefined := env["K6_PROMETHEUS_TIMESTAMP_PRECISION"]; precisionDefined {
+		if err := result.TimestampPrecision.UnmarshalText([]byte(precision)); err != nil {
+			return result, err
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_FLUSH_TIMESTAMPS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.FlushTimestamps = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_CLOCK_SYNC"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.ClockSync = b
+		}
+	}
+
+	if t, temporalityDefined := env["K6_PROMETHEUS_TEMPORALITY"]; temporalityDefined {
+		result.Temporality = null.StringFrom(t)
+	}
+
+	if window, windowDefined := env["K6_PROMETHEUS_AGGREGATION_WINDOW"]; windowDefined {
+		if err := result.AggregationWindow.UnmarshalText([]byte(window)); err != nil {
+			return result, err
+		}
+	}
+
+	if mapping, mappingDefined := env["K6_PROMETHEUS_MAPPING"]; mappingDefined {
+		result.Mapping = null.StringFrom(mapping)
+	}
+
+	if prefix, prefixDefined := env["K6_PROMETHEUS_METRIC_PREFIX"]; prefixDefined {
+		result.MetricPrefix = null.StringFrom(prefix)
+	}
+
+	if preset, presetDefined := env["K6_PROMETHEUS_PRESET"]; presetDefined {
+		result.Preset = null.StringFrom(preset)
+	}
+
+	if url, urlDefined := env["K6_PROMETHEUS_REMOTE_URL"]; urlDefined {
+		result.Url = null.StringFrom(url)
+	}
+
+	if protocol, protocolDefined := env["K6_PROMETHEUS_PROTOCOL"]; protocolDefined {
+		result.Protocol = null.StringFrom(protocol)
+	}
+
+	if version, versionDefined := env["K6_PROMETHEUS_PROTOCOL_VERSION"]; versionDefined {
+		result.ProtocolVersion = null.StringFrom(version)
+	}
+
+	if args, argsDefined := env["K6_PROMETHEUS_IMPORT_QUERY_ARGS"]; argsDefined {
+		result.ImportQueryArgs = null.StringFrom(args)
+	}
+
+	if org, orgDefined := env["K6_PROMETHEUS_INFLUX_ORG"]; orgDefined {
+		result.InfluxOrg = null.StringFrom(org)
+	}
+
+	if bucket, bucketDefined := env["K6_PROMETHEUS_INFLUX_BUCKET"]; bucketDefined {
+		result.InfluxBucket = null.StringFrom(bucket)
+	}
+
+	if token, tokenDefined := env["K6_PROMETHEUS_INFLUX_TOKEN"]; tokenDefined {
+		result.InfluxToken = null.StringFrom(token)
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_GRAPHITE_TAGS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.GraphiteTags = b
+		}
+	}
+
+	if key, keyDefined := env["K6_PROMETHEUS_DATADOG_API_KEY"]; keyDefined {
+		result.DatadogAPIKey = null.StringFrom(key)
+	}
+
+	if compression, compressionDefined := env["K6_PROMETHEUS_COMPRESSION"]; compressionDefined {
+		result.Compression = null.StringFrom(compression)
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_INSECURE_SKIP_TLS_VERIFY"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			// apply only if valid, to keep default option otherwise
+			result.InsecureSkipTLSVerify = b
+		}
+	}
+
+	if ca, caDefined := env["K6_PROMETHEUS_CA_CERT_FILE"]; caDefined {
+		result.CACert = null.StringFrom(ca)
+	}
+
+	if cert, certDefined := env["K6_PROMETHEUS_TLS_CERT_FILE"]; certDefined {
+		result.TLSCertFile = null.StringFrom(cert)
+	}
+
+	if key, keyDefined := env["K6_PROMETHEUS_TLS_KEY_FILE"]; keyDefined {
+		result.TLSKeyFile = null.StringFrom(key)
+	}
+
+	if serverName, serverNameDefined := env["K6_PROMETHEUS_TLS_SERVER_NAME"]; serverNameDefined {
+		result.TLSServerName = null.StringFrom(serverName)
+	}
+
+	if user, userDefined := env["K6_PROMETHEUS_USER"]; userDefined {
+		result.User = null.StringFrom(user)
+	}
+
+	if password, passwordDefined := env["K6_PROMETHEUS_PASSWORD"]; passwordDefined {
+		result.Password = null.StringFrom(password)
+	}
+
+	if passwordFile, passwordFileDefined := env["K6_PROMETHEUS_PASSWORD_FILE"]; passwordFileDefined {
+		result.PasswordFile = null.StringFrom(passwordFile)
+	}
+
+	if stack, stackDefined := env["K6_PROMETHEUS_GRAFANA_CLOUD_STACK"]; stackDefined {
+		result.GrafanaCloudStack = null.StringFrom(stack)
+	}
+
+	if apiKey, apiKeyDefined := env["K6_PROMETHEUS_GRAFANA_CLOUD_API_KEY"]; apiKeyDefined {
+		result.GrafanaCloudAPIKey = null.StringFrom(apiKey)
+	}
+
+	if token, tokenDefined := env["K6_PROMETHEUS_BEARER_TOKEN"]; tokenDefined {
+		result.BearerToken = null.StringFrom(token)
+	}
+
+	if tokenFile, tokenFileDefined := env["K6_PROMETHEUS_BEARER_TOKEN_FILE"]; tokenFileDefined {
+		result.BearerTokenFile = null.StringFrom(tokenFile)
+	}
+
+	if tokenURL, tokenURLDefined := env["K6_PROMETHEUS_OAUTH2_TOKEN_URL"]; tokenURLDefined {
+		result.OAuth2TokenURL = null.StringFrom(tokenURL)
+	}
+
+	if clientID, clientIDDefined := env["K6_PROMETHEUS_OAUTH2_CLIENT_ID"]; clientIDDefined {
+		result.OAuth2ClientID = null.StringFrom(clientID)
+	}
+
+	if clientSecret, clientSecretDefined := env["K6_PROMETHEUS_OAUTH2_CLIENT_SECRET"]; clientSecretDefined {
+		result.OAuth2ClientSecret = null.StringFrom(clientSecret)
+	}
+
+	if scopes, scopesDefined := env["K6_PROMETHEUS_OAUTH2_SCOPES"]; scopesDefined {
+		result.OAuth2Scopes = parseList(scopes)
+	}
+
+	if azureAuth, azureAuthDefined := env["K6_PROMETHEUS_AZURE_AUTH"]; azureAuthDefined {
+		result.AzureAuth = null.StringFrom(azureAuth)
+	}
+
+	if tenantID, tenantIDDefined := env["K6_PROMETHEUS_AZURE_TENANT_ID"]; tenantIDDefined {
+		result.AzureTenantID = null.StringFrom(tenantID)
+	}
+
+	if clientID, clientIDDefined := env["K6_PROMETHEUS_AZURE_CLIENT_ID"]; clientIDDefined {
+		result.AzureClientID = null.StringFrom(clientID)
+	}
+
+	if clientSecret, clientSecretDefined := env["K6_PROMETHEUS_AZURE_CLIENT_SECRET"]; clientSecretDefined {
+		result.AzureClientSecret = null.StringFrom(clientSecret)
+	}
+
+	if audience, audienceDefined := env["K6_PROMETHEUS_AZURE_AUDIENCE"]; audienceDefined {
+		result.AzureAudience = null.StringFrom(audience)
+	}
+
+	if authorityHost, authorityHostDefined := env["K6_PROMETHEUS_AZURE_AUTHORITY_HOST"]; authorityHostDefined {
+		result.AzureAuthorityHost = null.StringFrom(authorityHost)
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_GOOGLE_AUTH"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.GoogleAuth = b
+		}
+	}
+
+	if proxyURL, proxyURLDefined := env["K6_PROMETHEUS_PROXY_URL"]; proxyURLDefined {
+		result.ProxyURL = null.StringFrom(proxyURL)
+	}
+
+	if timeout, timeoutDefined := env["K6_PROMETHEUS_TIMEOUT"]; timeoutDefined {
+		if err := result.Timeout.UnmarshalText([]byte(timeout)); err != nil {
+			return result, err
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_ENABLE_HTTP2"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.EnableHTTP2 = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_KEEP_ALIVE"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.KeepAlive = b
+		}
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_MAX_IDLE_CONNS"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.MaxIdleConns = i
+		}
+	}
+
+	if timeout, timeoutDefined := env["K6_PROMETHEUS_IDLE_CONN_TIMEOUT"]; timeoutDefined {
+		if err := result.IdleConnTimeout.UnmarshalText([]byte(timeout)); err != nil {
+			return result, err
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_STALE_MARKERS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.StaleMarkers = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_RELOAD_CONFIG"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.ReloadConfig = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_EXEMPLARS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.Exemplars = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_SELF_METRICS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.SelfMetrics = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_SUMMARY"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.Summary = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_TEST_MARKERS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.TestMarkers = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_TEST_INFO"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.TestInfo = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_EXECUTION_METRICS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.ExecutionMetrics = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_HEARTBEAT"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.Heartbeat = b
+		}
+	}
+
+	if instance, instanceDefined := env["K6_PROMETHEUS_INSTANCE"]; instanceDefined {
+		result.Instance = null.StringFrom(instance)
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_SCENARIO_LABEL"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.ScenarioLabel = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_GROUP_LABEL"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.GroupLabel = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_PHASE_LABEL"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.PhaseLabel = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_SEND_METADATA"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.SendMetadata = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_THRESHOLD_METRICS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.ThresholdMetrics = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_KEEP_TAGS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.KeepTags = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_KEEP_NAME_TAG"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.KeepNameTag = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_KEEP_URL_TAG"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.KeepUrlTag = b
+		}
+	}
+
+	if tags, tagsDefined := env["K6_PROMETHEUS_TAGS_AS_LABELS"]; tagsDefined {
+		result.TagsAsLabels = parseList(tags)
+	}
+
+	if tags, tagsDefined := env["K6_PROMETHEUS_TAGS_EXCLUDE"]; tagsDefined {
+		result.TagsExclude = parseList(tags)
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_FOLD_TAGS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.FoldTags = b
+		}
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_MAX_LABEL_VALUE_LENGTH"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.MaxLabelValueLength = i
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_STRICT_NAMES"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.StrictNames = b
+		}
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_BUFFER_CAPACITY"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.BufferCapacity = i
+		}
+	}
+
+	if policy, policyDefined := env["K6_PROMETHEUS_BUFFER_POLICY"]; policyDefined {
+		result.BufferPolicy = null.StringFrom(policy)
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_BUFFER_MEMORY_LIMIT"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.BufferMemoryLimit = i
+		}
+	}
+
+	if dir, dirDefined := env["K6_PROMETHEUS_BUFFER_SPILL_DIR"]; dirDefined {
+		result.BufferSpillDir = null.StringFrom(dir)
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_MAX_SAMPLES_PER_FLUSH"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.MaxSamplesPerFlush = i
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_STREAM_FLUSH"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.StreamFlush = b
+		}
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_MAX_SERIES"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.MaxSeries = i
+		}
+	}
+
+	if action, actionDefined := env["K6_PROMETHEUS_MAX_SERIES_ACTION"]; actionDefined {
+		result.MaxSeriesAction = null.StringFrom(action)
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_STOP_TEST_ON_ERROR"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.StopTestOnError = i
+		}
+	}
+
+	envHeaders := getEnvMap(env, "K6_PROMETHEUS_HEADERS_")
+	for k, v := range envHeaders {
+		result.Headers[k] = v
+	}
+
+	envHeaderFiles := getEnvMap(env, "K6_PROMETHEUS_HEADER_FILES_")
+	for k, v := range envHeaderFiles {
+		result.HeaderFiles[k] = v
+	}
+
+	if tenantID, tenantIDDefined := env["K6_PROMETHEUS_TENANT_ID"]; tenantIDDefined {
+		result.TenantID = null.StringFrom(tenantID)
+	}
+
+	if tenantIDFile, tenantIDFileDefined := env["K6_PROMETHEUS_TENANT_ID_FILE"]; tenantIDFileDefined {
+		result.TenantIDFile = null.StringFrom(tenantIDFile)
+	}
+
+	if interval, intervalDefined := env["K6_PROMETHEUS_CREDENTIALS_REFRESH"]; intervalDefined {
+		if err := result.CredentialsRefresh.UnmarshalText([]byte(interval)); err != nil {
+			return result, err
+		}
+	}
+
+	if tenantTag, tenantTagDefined := env["K6_PROMETHEUS_TENANT_TAG"]; tenantTagDefined {
+		result.TenantTag = null.StringFrom(tenantTag)
+	}
+
+	// tenant routes are only supported as JSON, also in the environment
+	if tenantRoutes, tenantRoutesDefined := env["K6_PROMETHEUS_TENANT_ROUTES"]; tenantRoutesDefined {
+		if err := json.Unmarshal([]byte(tenantRoutes), &result.TenantRoutes); err != nil {
+			return result, fmt.Errorf("invalid K6_PROMETHEUS_TENANT_ROUTES: %w", err)
+		}
+	}
+
+	// so are metric routes
+	if metricRoutes, metricRoutesDefined := env["K6_PROMETHEUS_METRIC_ROUTES"]; metricRoutesDefined {
+		if err := json.Unmarshal([]byte(metricRoutes), &result.MetricRoutes); err != nil {
+			return result, fmt.Errorf("invalid K6_PROMETHEUS_METRIC_ROUTES: %w", err)
+		}
+	}
+
+	if include, includeDefined := env["K6_PROMETHEUS_METRICS_INCLUDE"]; includeDefined {
+		result.MetricsInclude = parseList(include)
+	}
+
+	if exclude, excludeDefined := env["K6_PROMETHEUS_METRICS_EXCLUDE"]; excludeDefined {
+		result.MetricsExclude = parseList(exclude)
+	}
+
+	if testRunID, testRunIDDefined := env["K6_PROMETHEUS_TEST_RUN_ID"]; testRunIDDefined {
+		result.TestRunID = null.StringFrom(testRunID)
+	}
+
+	// relabel configs are only supported as JSON, also in the environment
+	if relabelConfigs, relabelConfigsDefined := env["K6_PROMETHEUS_RELABEL_CONFIGS"]; relabelConfigsDefined {
+		if err := json.Unmarshal([]byte(relabelConfigs), &result.RelabelConfigs); err != nil {
+			return result, fmt.Errorf("invalid K6_PROMETHEUS_RELABEL_CONFIGS: %w", err)
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_GROUP_URLS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.GroupURLs = b
+		}
+	}
+
+	// url groups are only supported as JSON, also in the environment
+	if urlGroups, urlGroupsDefined := env["K6_PROMETHEUS_URL_GROUPS"]; urlGroupsDefined {
+		if err := json.Unmarshal([]byte(urlGroups), &result.URLGroups); err != nil {
+			return result, fmt.Errorf("invalid K6_PROMETHEUS_URL_GROUPS: %w", err)
+		}
+	}
+
+	if labels, labelsDefined := env["K6_PROMETHEUS_EXTRA_LABELS"]; labelsDefined {
+		extraLabels, err := parseLabels(labels)
+		if err != nil {
+			return result, err
+		}
+		for k, v := range extraLabels {
+			result.Labels[k] = v
+		}
+	}
+
+	if policy, policyDefined := env["K6_PROMETHEUS_LABEL_CONFLICT"]; policyDefined {
+		result.LabelConflict = null.StringFrom(policy)
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_INSTANCE_LABEL"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.InstanceLabel = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_JOB_LABEL"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.JobLabel = b
+		}
+	}
+
+	if job, jobDefined := env["K6_PROMETHEUS_JOB"]; jobDefined {
+		result.Job = null.StringFrom(job)
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_HONOR_LABELS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.HonorLabels = b
+		}
+	}
+
+	if labels, labelsDefined := env["K6_PROMETHEUS_LABELS_FROM_ENV"]; labelsDefined {
+		envLabels, err := parseLabels(labels)
+		if err != nil {
+			return result, err
+		}
+		for k, v := range envLabels {
+			result.LabelsFromEnv[k] = v
+		}
+	}
+
+	if kubernetes, kubernetesDefined := env["K6_PROMETHEUS_KUBERNETES"]; kubernetesDefined {
+		result.Kubernetes = null.StringFrom(kubernetes)
+	}
+
+	if dir, dirDefined := env["K6_PROMETHEUS_KUBERNETES_METADATA_DIR"]; dirDefined {
+		result.KubernetesMetadataDir = null.StringFrom(dir)
+	}
+
+	if stats, statsDefined := env["K6_PROMETHEUS_TREND_STATS"]; statsDefined {
+		result.TrendStats = parseList(stats)
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_RATE_COUNTERS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.RateCounters = b
+		}
+	}
+
+	envBuckets := getEnvMap(env, "K6_PROMETHEUS_TREND_BUCKETS_")
+	for k, v := range envBuckets {
+		buckets, err := parseBuckets(v)
+		if err != nil {
+			return result, err
+		}
+		result.TrendBuckets[k] = buckets
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_SHARDS"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.Shards = i
+		}
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_MAX_SAMPLES_PER_REQUEST"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.MaxSamplesPerRequest = i
+		}
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_MAX_REQUEST_BODY_BYTES"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.MaxRequestBodyBytes = i
+		}
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_RATE_LIMIT_SAMPLES"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.RateLimitSamples = i
+		}
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_RATE_LIMIT_REQUESTS"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.RateLimitRequests = i
+		}
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_RETRY_MAX_ATTEMPTS"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.RetryMaxAttempts = i
+		}
+	}
+
+	if backoff, backoffDefined := env["K6_PROMETHEUS_RETRY_INITIAL_BACKOFF"]; backoffDefined {
+		if err := result.RetryInitialBackoff.UnmarshalText([]byte(backoff)); err != nil {
+			return result, err
+		}
+	}
+
+	if backoff, backoffDefined := env["K6_PROMETHEUS_RETRY_MAX_BACKOFF"]; backoffDefined {
+		if err := result.RetryMaxBackoff.UnmarshalText([]byte(backoff)); err != nil {
+			return result, err
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_RETRY_JITTER"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.RetryJitter = b
+		}
+	}
+
+	if walDir, walDirDefined := env["K6_PROMETHEUS_WAL_DIR"]; walDirDefined {
+		result.WALDir = null.StringFrom(walDir)
+	}
+
+	if dir, dirDefined := env["K6_PROMETHEUS_DEAD_LETTER_DIR"]; dirDefined {
+		result.DeadLetterDir = null.StringFrom(dir)
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_WAL_MAX_SIZE"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.WALMaxSize = i
+		}
+	}
+
+	if walMaxAge, walMaxAgeDefined := env["K6_PROMETHEUS_WAL_MAX_AGE"]; walMaxAgeDefined {
+		if err := result.WALMaxAge.UnmarshalText([]byte(walMaxAge)); err != nil {
+			return result, err
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_DRY_RUN"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.DryRun = b
+		}
+	}
+
+	if dryRunDir, dryRunDirDefined := env["K6_PROMETHEUS_DRY_RUN_DIR"]; dryRunDirDefined {
+		result.DryRunDir = null.StringFrom(dryRunDir)
+	}
+
+	if addr, addrDefined := env["K6_PROMETHEUS_LISTEN_ADDR"]; addrDefined {
+		result.ListenAddr = null.StringFrom(addr)
+	}
+
+	if addr, addrDefined := env["K6_PROMETHEUS_DEBUG_ADDR"]; addrDefined {
+		result.DebugAddr = null.StringFrom(addr)
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_PUSH"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.Push = b
+		}
+	}
+
+	if urls, urlsDefined := env["K6_PROMETHEUS_FAILOVER_URLS"]; urlsDefined {
+		result.FailoverUrls = parseList(urls)
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_FAILOVER_THRESHOLD"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.FailoverThreshold = i
+		}
+	}
+
+	if interval, intervalDefined := env["K6_PROMETHEUS_FAILBACK_INTERVAL"]; intervalDefined {
+		if err := result.FailbackInterval.UnmarshalText([]byte(interval)); err != nil {
+			return result, err
+		}
+	}
+
+	if i, err := getEnvInt(env, "K6_PROMETHEUS_BREAKER_THRESHOLD"); err != nil {
+		return result, err
+	} else {
+		if i.Valid {
+			result.BreakerThreshold = i
+		}
+	}
+
+	if cooldown, cooldownDefined := env["K6_PROMETHEUS_BREAKER_COOLDOWN"]; cooldownDefined {
+		if err := result.BreakerCooldown.UnmarshalText([]byte(cooldown)); err != nil {
+			return result, err
+		}
+	}
+
+	if urls, urlsDefined := env["K6_PROMETHEUS_MIRROR_URLS"]; urlsDefined {
+		result.MirrorUrls = parseList(urls)
+	}
+
+	if brokers, brokersDefined := env["K6_PROMETHEUS_KAFKA_BROKERS"]; brokersDefined {
+		result.KafkaBrokers = parseList(brokers)
+	}
+
+	if topic, topicDefined := env["K6_PROMETHEUS_KAFKA_TOPIC"]; topicDefined {
+		result.KafkaTopic = null.StringFrom(topic)
+	}
+
+	if c, cDefined := env["K6_PROMETHEUS_KAFKA_COMPRESSION"]; cDefined {
+		result.KafkaCompression = null.StringFrom(c)
+	}
+
+	if mechanism, mechanismDefined := env["K6_PROMETHEUS_KAFKA_SASL_MECHANISM"]; mechanismDefined {
+		result.KafkaSASLMechanism = null.StringFrom(mechanism)
+	}
+
+	if user, userDefined := env["K6_PROMETHEUS_KAFKA_USER"]; userDefined {
+		result.KafkaUser = null.StringFrom(user)
+	}
+
+	if password, passwordDefined := env["K6_PROMETHEUS_KAFKA_PASSWORD"]; passwordDefined {
+		result.KafkaPassword = null.StringFrom(password)
+	}
+
+	if b, err := getEnvBool(env, "K6_PROMETHEUS_KAFKA_TLS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.KafkaTLS = b
+		}
 	}
 
 	if arg != "" {
@@ -87,6 +87,22 @@ func TestConfigParseArg(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, null.StringFrom("http://prometheus.remote:3412/write"), c.Url)
 	assert.Equal(t, map[string]string{"X-Header": "value"}, c.Headers)
+
+	c, err = ParseArg("trendBuckets.http_req_duration={50,100,250.5}")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]float64{"http_req_duration": {50, 100, 250.5}}, c.TrendBuckets)
+
+	c, err = ParseArg("metricsInclude={http_req_.*,vus},metricsExclude=data_sent")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http_req_.*", "vus"}, c.MetricsInclude)
+	assert.Equal(t, []string{"data_sent"}, c.MetricsExclude)
+
+	c, err = ParseArg("retryMaxAttempts=5,retryInitialBackoff=50ms,retryMaxBackoff=5s,retryJitter=false")
+	assert.Nil(t, err)
+	assert.Equal(t, null.IntFrom(5), c.RetryMaxAttempts)
+	assert.Equal(t, types.NullDurationFrom(50*time.Millisecond), c.RetryInitialBackoff)
+	assert.Equal(t, types.NullDurationFrom(5*time.Second), c.RetryMaxBackoff)
+	assert.Equal(t, null.BoolFrom(false), c.RetryJitter)
 }
 
 // testing both GetConsolidatedConfig and ConstructRemoteConfig here until it's future config refactor takes shape (k6 #883)
@@ -335,3 +351,237 @@ func assertRemoteConfig(t *testing.T, actual, expected *remote.ClientConfig) {
 		assert.Equal(t, expected.HTTPClientConfig.BasicAuth.Password, actual.HTTPClientConfig.BasicAuth.Password)
 	}
 }
+
+func TestConsolidatedConfigTrendBuckets(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(
+		json.RawMessage(`{"trendBuckets":{"iteration_duration":[1000,5000]}}`),
+		map[string]string{"K6_PROMETHEUS_TREND_BUCKETS_http_req_duration": "50, 100,250"},
+		"",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]float64{
+		"iteration_duration": {1000, 5000},
+		"http_req_duration":  {50, 100, 250},
+	}, c.TrendBuckets)
+
+	_, err = GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_TREND_BUCKETS_http_req_duration": "50,a"}, "")
+	assert.Contains(t, err.Error(), "invalid bucket boundary")
+}
+
+func TestConsolidatedConfigLabels(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(
+		json.RawMessage(`{"labels":{"team":"payments"}}`),
+		map[string]string{"K6_PROMETHEUS_EXTRA_LABELS": "env=staging, region=eu-west-1"},
+		"labels.env=prod",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"team":   "payments",
+		"env":    "prod",
+		"region": "eu-west-1",
+	}, c.Labels)
+
+	_, err = GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_EXTRA_LABELS": "env"}, "")
+	assert.Contains(t, err.Error(), "expected key=value")
+}
+
+func TestConstructRemoteConfigTenantID(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(
+		json.RawMessage(`{"headers":{"X-Header":"value"}}`),
+		map[string]string{"K6_PROMETHEUS_TENANT_ID": "tenant-1"},
+		"",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, null.StringFrom("tenant-1"), c.TenantID)
+
+	remoteConfig, err := c.ConstructRemoteConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"X-Header":      "value",
+		"X-Scope-OrgID": "tenant-1",
+	}, remoteConfig.Headers)
+	assert.Equal(t, map[string]string{"X-Header": "value"}, c.Headers)
+
+	c, err = ParseArg("tenantID=tenant-2")
+	assert.NoError(t, err)
+	assert.Equal(t, null.StringFrom("tenant-2"), c.TenantID)
+}
+
+func TestConstructRemoteConfigMutualTLS(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(nil, map[string]string{
+		"K6_PROMETHEUS_INSECURE_SKIP_TLS_VERIFY": "false",
+		"K6_CA_CERT_FILE":                        "ca.crt",
+		"K6_PROMETHEUS_TLS_CERT_FILE":            "client.crt",
+		"K6_PROMETHEUS_TLS_KEY_FILE":             "client.key",
+	}, "tlsServerName=prometheus.internal")
+	assert.NoError(t, err)
+
+	remoteConfig, err := c.ConstructRemoteConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, promConfig.TLSConfig{
+		CAFile:     "ca.crt",
+		CertFile:   "client.crt",
+		KeyFile:    "client.key",
+		ServerName: "prometheus.internal",
+	}, remoteConfig.HTTPClientConfig.TLSConfig)
+
+	c, err = GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_TLS_CERT_FILE": "client.crt"}, "")
+	assert.NoError(t, err)
+	_, err = c.ConstructRemoteConfig()
+	assert.Contains(t, err.Error(), "tlsKeyFile")
+}
+
+func TestConsolidatedConfigRelabelConfigs(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(nil, map[string]string{
+		"K6_PROMETHEUS_RELABEL_CONFIGS": `[{"source_labels":["status"],"target_label":"code"},{"regex":"url","action":"labeldrop"}]`,
+	}, "")
+	assert.NoError(t, err)
+	if assert.Len(t, c.RelabelConfigs, 2) {
+		assert.Equal(t, []string{"status"}, c.RelabelConfigs[0].SourceLabels)
+		assert.Equal(t, "code", c.RelabelConfigs[0].TargetLabel)
+		assert.Equal(t, "labeldrop", c.RelabelConfigs[1].Action)
+	}
+
+	c, err = GetConsolidatedConfig(
+		json.RawMessage(`{"relabelConfigs":[{"source_labels":["status"],"target_label":"code"}]}`), nil, "")
+	assert.NoError(t, err)
+	assert.Len(t, c.RelabelConfigs, 1)
+
+	_, err = GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_RELABEL_CONFIGS": "not json"}, "")
+	assert.Error(t, err)
+}
+
+func TestConstructRemoteConfigOAuth2(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(nil, map[string]string{
+		"K6_PROMETHEUS_OAUTH2_TOKEN_URL":     "https://auth.example.com/token",
+		"K6_PROMETHEUS_OAUTH2_CLIENT_ID":     "k6",
+		"K6_PROMETHEUS_OAUTH2_CLIENT_SECRET": "secret",
+		"K6_PROMETHEUS_OAUTH2_SCOPES":        "write,read",
+	}, "")
+	assert.NoError(t, err)
+
+	remoteConfig, err := c.ConstructRemoteConfig()
+	assert.NoError(t, err)
+	if assert.NotNil(t, remoteConfig.HTTPClientConfig.OAuth2) {
+		assert.Equal(t, "https://auth.example.com/token", remoteConfig.HTTPClientConfig.OAuth2.TokenURL)
+		assert.Equal(t, "k6", remoteConfig.HTTPClientConfig.OAuth2.ClientID)
+		assert.Equal(t, promConfig.Secret("secret"), remoteConfig.HTTPClientConfig.OAuth2.ClientSecret)
+		assert.Equal(t, []string{"write", "read"}, remoteConfig.HTTPClientConfig.OAuth2.Scopes)
+	}
+
+	// the token URL is required
+	c, err = GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_OAUTH2_CLIENT_ID": "k6"}, "")
+	assert.NoError(t, err)
+	_, err = c.ConstructRemoteConfig()
+	assert.Error(t, err)
+
+	// basic auth and OAuth2 are mutually exclusive
+	c, err = GetConsolidatedConfig(nil, map[string]string{
+		"K6_PROMETHEUS_OAUTH2_TOKEN_URL": "https://auth.example.com/token",
+		"K6_PROMETHEUS_OAUTH2_CLIENT_ID": "k6",
+	}, "user=user")
+	assert.NoError(t, err)
+	_, err = c.ConstructRemoteConfig()
+	assert.Error(t, err)
+}
+
+func TestConstructRemoteConfigBearerToken(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_BEARER_TOKEN": "token"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, null.StringFrom("token"), c.BearerToken)
+
+	remoteConfig, err := c.ConstructRemoteConfig()
+	assert.NoError(t, err)
+	if assert.NotNil(t, remoteConfig.HTTPClientConfig.Authorization) {
+		assert.Equal(t, "Bearer", remoteConfig.HTTPClientConfig.Authorization.Type)
+		assert.Equal(t, promConfig.Secret("token"), remoteConfig.HTTPClientConfig.Authorization.Credentials)
+	}
+
+	c, err = GetConsolidatedConfig(nil, nil, "bearerTokenFile=/run/secrets/token")
+	assert.NoError(t, err)
+	remoteConfig, err = c.ConstructRemoteConfig()
+	assert.NoError(t, err)
+	if assert.NotNil(t, remoteConfig.HTTPClientConfig.Authorization) {
+		assert.Equal(t, "/run/secrets/token", remoteConfig.HTTPClientConfig.Authorization.CredentialsFile)
+	}
+
+	// basic auth and bearer token are mutually exclusive
+	c, err = GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_BEARER_TOKEN": "token"}, "user=user")
+	assert.NoError(t, err)
+	_, err = c.ConstructRemoteConfig()
+	assert.Error(t, err)
+}
+
+func TestConsolidatedConfigTransport(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(nil, map[string]string{
+		"K6_PROMETHEUS_TIMEOUT":           "10s",
+		"K6_PROMETHEUS_ENABLE_HTTP2":      "false",
+		"K6_PROMETHEUS_KEEP_ALIVE":        "false",
+		"K6_PROMETHEUS_MAX_IDLE_CONNS":    "10",
+		"K6_PROMETHEUS_IDLE_CONN_TIMEOUT": "30s",
+	}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, types.NullDurationFrom(10*time.Second), c.Timeout)
+	assert.Equal(t, null.BoolFrom(false), c.EnableHTTP2)
+	assert.Equal(t, transportConfig{
+		disableKeepAlives: true,
+		maxIdleConns:      10,
+		idleConnTimeout:   30 * time.Second,
+	}, c.transportConfig())
+
+	remoteConfig, err := c.ConstructRemoteConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, model.Duration(10*time.Second), remoteConfig.Timeout)
+	assert.False(t, remoteConfig.HTTPClientConfig.EnableHTTP2)
+
+	c, err = GetConsolidatedConfig(nil, nil, "timeout=5s,keepAlive=false,maxIdleConns=2")
+	assert.NoError(t, err)
+	assert.Equal(t, types.NullDurationFrom(5*time.Second), c.Timeout)
+	assert.Equal(t, null.BoolFrom(false), c.KeepAlive)
+	assert.Equal(t, null.IntFrom(2), c.MaxIdleConns)
+}
+
+func TestConsolidatedConfigTrendStats(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_TREND_STATS": "p(99),count"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"p(99)", "count"}, c.TrendStats)
+
+	c, err = GetConsolidatedConfig(nil, nil, "trendStats={p(99.9),max}")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"p(99.9)", "max"}, c.TrendStats)
+}
+
+func TestConsolidatedConfigRateLimit(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(nil, map[string]string{
+		"K6_PROMETHEUS_RATE_LIMIT_SAMPLES":  "10000",
+		"K6_PROMETHEUS_RATE_LIMIT_REQUESTS": "5",
+	}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, null.IntFrom(10000), c.RateLimitSamples)
+	assert.Equal(t, null.IntFrom(5), c.RateLimitRequests)
+
+	c, err = GetConsolidatedConfig(nil, nil, "rateLimitSamples=500")
+	assert.NoError(t, err)
+	assert.Equal(t, null.IntFrom(500), c.RateLimitSamples)
+	assert.Equal(t, null.IntFrom(0), c.RateLimitRequests)
+}
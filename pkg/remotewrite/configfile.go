@@ -0,0 +1,59 @@
+package remotewrite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// loadConfigFile reads the options of the output from a YAML or JSON file,
+// with the same names as in the JSON config, e.g. url or trendBuckets.
+// Unknown options are rejected so that typos don't go unnoticed.
+func loadConfigFile(path string) (Config, error) {
+	b, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// JSON is valid YAML, so both are parsed as YAML and then decoded as
+	// JSON to reuse the JSON unmarshaling of the options, e.g. for durations
+	var raw interface{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	b, err = json.Marshal(yamlToJSON(raw))
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	var c Config
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return Config{}, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// yamlToJSON converts the maps decoded from YAML, which can have keys
+// of any type, to maps with string keys that can be marshaled as JSON.
+func yamlToJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = yamlToJSON(val)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = yamlToJSON(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
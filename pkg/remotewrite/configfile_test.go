@@ -0,0 +1,66 @@
+package remotewrite
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestConsolidatedConfigFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prometheus.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+url: http://prometheus:9090/api/v1/write
+flushPeriod: 5s
+shards: 2
+staleMarkers: true
+labels:
+  team: payments
+trendBuckets:
+  http_req_duration: [50, 100, 250]
+relabelConfigs:
+  - source_labels: [url]
+    regex: "/items/[0-9]+"
+    target_label: url
+    replacement: "/items/:id"
+`), 0o600))
+
+	c, err := GetConsolidatedConfig(
+		json.RawMessage(`{"shards":3}`),
+		map[string]string{"K6_PROMETHEUS_CONFIG": path, "K6_PROMETHEUS_FLUSH_PERIOD": "2s"},
+		"labels.env=prod",
+	)
+	require.NoError(t, err)
+	assert.Equal(t, null.StringFrom("http://prometheus:9090/api/v1/write"), c.Url)
+	// overridden by the JSON config, the environment and the argument, in this order
+	assert.Equal(t, null.IntFrom(3), c.Shards)
+	assert.Equal(t, types.NullDurationFrom(2*time.Second), c.FlushPeriod)
+	assert.Equal(t, map[string]string{"team": "payments", "env": "prod"}, c.Labels)
+	assert.True(t, c.StaleMarkers.Bool)
+	assert.Equal(t, []float64{50, 100, 250}, c.TrendBuckets["http_req_duration"])
+	require.Len(t, c.RelabelConfigs, 1)
+	assert.Equal(t, "url", c.RelabelConfigs[0].TargetLabel)
+
+	jsonPath := filepath.Join(dir, "prometheus.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"url":"http://mimir/api/v1/push","maxSeries":100}`), 0o600))
+	c, err = GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_CONFIG": jsonPath}, "")
+	require.NoError(t, err)
+	assert.Equal(t, null.StringFrom("http://mimir/api/v1/push"), c.Url)
+	assert.Equal(t, null.IntFrom(100), c.MaxSeries)
+
+	require.NoError(t, os.WriteFile(path, []byte("flushPeriodd: 5s\n"), 0o600))
+	_, err = GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_CONFIG": path}, "")
+	assert.ErrorContains(t, err, `unknown field "flushPeriodd"`)
+
+	_, err = GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_CONFIG": filepath.Join(dir, "missing.yaml")}, "")
+	assert.Error(t, err)
+}
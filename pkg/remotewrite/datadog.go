@@ -0,0 +1,228 @@
+package remotewrite
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	// datadogAPIKeyHeader authenticates the requests to the Datadog API.
+	datadogAPIKeyHeader = "DD-API-KEY"
+	// datadogDistributionsPath is the endpoint of the distribution points, on the same host as the series one.
+	datadogDistributionsPath = "/api/v1/distribution_points"
+	// datadogGauge is the type of the series in the metrics v2 intake API.
+	datadogGauge = 3
+)
+
+type datadogPoint struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+type datadogSeries struct {
+	Metric string         `json:"metric"`
+	Type   int            `json:"type"`
+	Points []datadogPoint `json:"points"`
+	Tags   []string       `json:"tags,omitempty"`
+}
+
+type datadogDistribution struct {
+	Metric string `json:"metric"`
+	Type   string `json:"type"`
+	// Points are [timestamp, [values...]] pairs.
+	Points [][2]interface{} `json:"points"`
+	Tags   []string         `json:"tags,omitempty"`
+}
+
+// datadogTags returns the metric name and the other labels as name:value tags.
+func datadogTags(labels []prompb.Label) (string, []string) {
+	var (
+		name string
+		tags = make([]string, 0, len(labels))
+	)
+	for _, l := range labels {
+		if l.Name == "__name__" {
+			name = l.Value
+			continue
+		}
+		tags = append(tags, l.Name+":"+l.Value)
+	}
+	sort.Strings(tags)
+	return name, tags
+}
+
+// marshalDatadogSeries marshals the time series as a request of the Datadog metrics
+// v2 intake API (https://docs.datadoghq.com/api/latest/metrics/#submit-metrics),
+// all as gauges with timestamps in seconds:
+//
+//	{"series":[{"metric":"k6_vus","type":3,"points":[{"timestamp":1700000000,"value":10}],"tags":["scenario:default"]}]}
+//
+// Native histograms and exemplars are not supported by the API, and the samples
+// that are not finite, stale markers included, can't be represented in JSON.
+func marshalDatadogSeries(series []prompb.TimeSeries) ([]byte, error) {
+	req := struct {
+		Series []datadogSeries `json:"series"`
+	}{
+		Series: make([]datadogSeries, 0, len(series)),
+	}
+	for _, ts := range series {
+		var points []datadogPoint
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			points = append(points, datadogPoint{Timestamp: s.Timestamp / 1000, Value: s.Value})
+		}
+		if len(points) == 0 {
+			continue
+		}
+		name, tags := datadogTags(ts.Labels)
+		req.Series = append(req.Series, datadogSeries{Metric: name, Type: datadogGauge, Points: points, Tags: tags})
+	}
+	return json.Marshal(req)
+}
+
+// marshalDatadogDistributions marshals the raw values of the series as distribution points
+// (https://docs.datadoghq.com/api/latest/metrics/#submit-distribution-points), grouped by second:
+//
+//	{"series":[{"metric":"k6_http_req_duration","type":"distribution","points":[[1700000000,[12.5,30.1]]]}]}
+func marshalDatadogDistributions(series []prompb.TimeSeries) ([]byte, error) {
+	req := struct {
+		Series []datadogDistribution `json:"series"`
+	}{
+		Series: make([]datadogDistribution, 0, len(series)),
+	}
+	for _, ts := range series {
+		var (
+			points [][2]interface{}
+			values []float64
+			second int64
+		)
+		// samples are ordered by time
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			if len(values) > 0 && s.Timestamp/1000 != second {
+				points = append(points, [2]interface{}{second, values})
+				values = nil
+			}
+			second = s.Timestamp / 1000
+			values = append(values, s.Value)
+		}
+		if len(values) > 0 {
+			points = append(points, [2]interface{}{second, values})
+		}
+		if len(points) == 0 {
+			continue
+		}
+		name, tags := datadogTags(ts.Labels)
+		req.Series = append(req.Series, datadogDistribution{Metric: name, Type: "distribution", Points: points, Tags: tags})
+	}
+	return json.Marshal(req)
+}
+
+// datadogDistributionsURL returns the URL of the distribution points endpoint
+// of the Datadog site the series are sent to.
+func datadogDistributionsURL(seriesURL *url.URL) *url.URL {
+	return &url.URL{Scheme: seriesURL.Scheme, Host: seriesURL.Host, Path: datadogDistributionsPath}
+}
+
+// distributionAggregator groups the raw values of the Trend samples per series.
+// Unlike the other series, all the values are kept, even those with the same timestamp.
+type distributionAggregator struct {
+	series *seriesAggregator
+}
+
+func newDistributionAggregator() *distributionAggregator {
+	return &distributionAggregator{series: newSeriesAggregator()}
+}
+
+// add adds the value of the sample to the series named after its metric.
+func (a *distributionAggregator) add(sample metrics.Sample, labels []prompb.Label, prefix string) {
+	seriesLabels := make([]prompb.Label, 0, len(labels)+1)
+	seriesLabels = append(seriesLabels, labels...)
+	seriesLabels = append(seriesLabels, prompb.Label{Name: "__name__", Value: prefix + sample.Metric.Name})
+
+	a.series.add(prompb.TimeSeries{
+		Labels:  seriesLabels,
+		Samples: []prompb.Sample{{Value: sample.Value, Timestamp: timestamp.FromTime(sample.Time)}},
+	})
+}
+
+// take returns the series added since the previous call, with their samples ordered by time.
+func (a *distributionAggregator) take() []prompb.TimeSeries {
+	if a == nil {
+		return nil
+	}
+	series := a.series.series
+	for i := range series {
+		samples := series[i].Samples
+		sort.SliceStable(samples, func(j, k int) bool {
+			return samples[j].Timestamp < samples[k].Timestamp
+		})
+	}
+	a.series = newSeriesAggregator()
+	return series
+}
+
+// writeDistributions sends the values of the trends in requests of their own,
+// within the configured request size limits.
+func (o *Output) writeDistributions(series []prompb.TimeSeries) error {
+	if len(series) == 0 {
+		return nil
+	}
+
+	var (
+		failed   int
+		firstErr error
+	)
+	chunks := chunkTimeSeries(series, int(o.config.MaxSamplesPerRequest.Int64), int(o.config.MaxRequestBodyBytes.Int64))
+	for _, chunk := range chunks {
+		if err := o.writeDistributionsRequest(chunk); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+	if failed > 0 && len(chunks) > 1 {
+		return fmt.Errorf("%d of %d distribution requests failed: %w", failed, len(chunks), firstErr)
+	}
+	return firstErr
+}
+
+func (o *Output) writeDistributionsRequest(series []prompb.TimeSeries) error {
+	if o.dryRun == nil {
+		if err := o.limiter.waitSamples(o.lifetime(), countSamples(series)); err != nil {
+			return err
+		}
+	}
+
+	buffers := o.getEncodeBuffers()
+	defer putEncodeBuffers(buffers)
+
+	encoded, err := buffers.encode(series, protocolDatadogDistributions, o.compression)
+	if err != nil {
+		return err
+	}
+
+	if o.dryRun != nil {
+		err = o.dryRun.write(prompb.WriteRequest{Timeseries: series}, encoded, protocolDatadogDistributions, o.compression)
+	} else {
+		err = o.send(nil, encoded, protocolDatadogDistributions)
+	}
+	if err != nil {
+		o.self.addSamplesFailed(countSamples(series))
+		return err
+	}
+	o.self.addSeriesSent(len(series))
+	return nil
+}
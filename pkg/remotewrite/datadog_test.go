@@ -0,0 +1,141 @@
+package remotewrite
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestMarshalDatadogSeries(t *testing.T) {
+	t.Parallel()
+
+	buf, err := marshalDatadogSeries([]prompb.TimeSeries{
+		{
+			Labels: []prompb.Label{
+				{Name: "scenario", Value: "default"},
+				{Name: "__name__", Value: "k6_vus"},
+				{Name: "method", Value: "GET"},
+			},
+			Samples: []prompb.Sample{{Value: 10, Timestamp: 1000}, {Value: 0.5, Timestamp: 2500}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_stale"}},
+			Samples: []prompb.Sample{{Value: math.Float64frombits(value.StaleNaN), Timestamp: 3000}},
+		},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"series":[{
+		"metric":"k6_vus","type":3,
+		"points":[{"timestamp":1,"value":10},{"timestamp":2,"value":0.5}],
+		"tags":["method:GET","scenario:default"]
+	}]}`, string(buf))
+}
+
+func TestMarshalDatadogDistributions(t *testing.T) {
+	t.Parallel()
+
+	buf, err := marshalDatadogDistributions([]prompb.TimeSeries{{
+		Labels: []prompb.Label{{Name: "__name__", Value: "k6_http_req_duration"}},
+		Samples: []prompb.Sample{
+			{Value: 12.5, Timestamp: 1000}, {Value: 30, Timestamp: 1999},
+			{Value: math.Inf(1), Timestamp: 2000}, {Value: 7, Timestamp: 3000},
+		},
+	}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"series":[{
+		"metric":"k6_http_req_duration","type":"distribution",
+		"points":[[1,[12.5,30]],[3,[7]]]
+	}]}`, string(buf))
+}
+
+func TestOutputDatadog(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu     sync.Mutex
+		bodies = map[string][]byte{}
+		keys   []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		bodies[r.URL.Path] = decompress(t, r.Header.Get("Content-Encoding"), body)
+		keys = append(keys, r.Header.Get(datadogAPIKeyHeader))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL + "/api/v2/series")
+	config.Protocol = null.StringFrom("datadog")
+	config.DatadogAPIKey = null.StringFrom("secret")
+	config.TestRunID = null.StringFrom("")
+	require.NoError(t, config.Validate())
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolDatadog, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+	distributionsClient, err := newWriteClientForURL("test", remoteConfig, protocolDatadogDistributions,
+		compressionDefault, config.transportConfig(), datadogDistributionsURL(remoteConfig.URL.URL).String())
+	require.NoError(t, err)
+
+	o := &Output{
+		config:              config,
+		client:              client,
+		protocol:            protocolDatadog,
+		distributions:       newDistributionAggregator(),
+		distributionsClient: distributionsClient,
+		metrics:             newMetricsStorage(),
+		checks:              newCheckCounters(),
+		mapping:             NewMapping(config),
+		retry:               newRetryPolicy(config),
+		self:                newSelfMetrics(),
+		logger:              logrus.New(),
+	}
+
+	now := time.Unix(100, 0)
+	tags := metrics.NewSampleTags(map[string]string{"method": "GET"})
+	duration := &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend}
+	series := o.convertToTimeSeries([]metrics.SampleContainer{metrics.Samples{
+		{Metric: &metrics.Metric{Name: "vus", Type: metrics.Gauge}, Tags: tags, Time: now, Value: 3},
+		{Metric: duration, Tags: tags, Time: now, Value: 20},
+		{Metric: duration, Tags: tags, Time: now, Value: 10},
+	}})
+	for _, ts := range series {
+		assert.False(t, hasLabelValue(ts.Labels, "__name__", "k6_http_req_duration"), "trends are sent as distributions")
+	}
+
+	require.NoError(t, o.write(series))
+	require.NoError(t, o.writeDistributions(o.distributions.take()))
+
+	assert.Equal(t, []string{"secret", "secret"}, keys)
+	assert.JSONEq(t, `{"series":[{"metric":"k6_vus","type":3,"points":[{"timestamp":100,"value":3}],"tags":["method:GET"]}]}`,
+		string(bodies["/api/v2/series"]))
+	assert.JSONEq(t, `{"series":[{"metric":"k6_http_req_duration","type":"distribution","points":[[100,[20,10]]],"tags":["method:GET"]}]}`,
+		string(bodies[datadogDistributionsPath]))
+	assert.Empty(t, o.distributions.take())
+
+	config.DatadogAPIKey = null.NewString("", false)
+	config.MirrorUrls = []string{"http://localhost:9090/api/v1/write"}
+	var validationErr *ValidationError
+	require.ErrorAs(t, config.Validate(), &validationErr)
+	assert.Equal(t, []string{
+		"the datadog protocol needs an API key: set K6_PROMETHEUS_DATADOG_API_KEY",
+		"failoverUrls, mirrorUrls and kafkaBrokers can't be used with the datadog protocol, " +
+			"the trends are sent to the same site as the series",
+	}, validationErr.Problems)
+}
@@ -0,0 +1,230 @@
+package remotewrite
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	// ddSketchRelativeAccuracy is the maximum relative error of the quantiles
+	// computed from the sketch: a p(99) of 500ms is between 495ms and 505ms.
+	ddSketchRelativeAccuracy = 0.01
+
+	// ddSketchMaxBuckets bounds the memory used by the sketch of each label set.
+	// With 1% accuracy, it covers values over 17 orders of magnitude before the
+	// lowest buckets are collapsed, which only affects the accuracy of the low quantiles.
+	ddSketchMaxBuckets = 2048
+
+	// ddSketchMinValue is the smallest absolute value with its own bucket,
+	// the values closer to zero are counted as zeros.
+	ddSketchMinValue = 1e-9
+)
+
+// DDSketchMapping works as PrometheusMapping except that the stats of Trend
+// metrics are computed from a DDSketch instead of all the values: the memory used
+// for each label set is bounded, whatever the duration of the test, while the
+// quantiles keep a relative accuracy of 1%, tail ones included.
+//
+// See https://arxiv.org/abs/1908.10693.
+type DDSketchMapping struct {
+	PrometheusMapping
+}
+
+func (dm *DDSketchMapping) MapTrend(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+	metric := ms.UpdateWithSink(sample, labels, func(metrics.MetricType) metrics.Sink {
+		return newDDSketchSink(ddSketchRelativeAccuracy, ddSketchMaxBuckets)
+	}, nil)
+	ts := ms.Timestamp(sample, labels)
+
+	s := metric.Sink.(*ddSketchSink)
+
+	stats := dm.trendStats
+	if len(stats) == 0 {
+		stats = defaultTrendStats
+	}
+
+	series := make([]prompb.TimeSeries, 0, len(stats))
+	for _, stat := range stats {
+		series = append(series, prompb.TimeSeries{
+			Labels: append(labels, prompb.Label{
+				Name:  "__name__",
+				Value: fmt.Sprintf("%s_%s", sample.Metric.Name, stat.suffix),
+			}),
+			Samples: []prompb.Sample{
+				{
+					Value:     stat.sketch(s),
+					Timestamp: ts,
+				},
+			},
+		})
+	}
+	return series
+}
+
+// ddSketchSink is a metrics.Sink counting values in logarithmic buckets:
+// bucket i holds the absolute values in (gamma^(i-1), gamma^i], so that any
+// value of the bucket is within the relative accuracy of its middle.
+type ddSketchSink struct {
+	gamma      float64
+	logGamma   float64
+	maxBuckets int
+
+	count     uint64
+	sum       float64
+	min       float64
+	max       float64
+	zeroCount uint64
+	positive  ddSketchStore
+	negative  ddSketchStore
+}
+
+var _ metrics.Sink = &ddSketchSink{}
+
+func newDDSketchSink(relativeAccuracy float64, maxBuckets int) *ddSketchSink {
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &ddSketchSink{
+		gamma:      gamma,
+		logGamma:   math.Log(gamma),
+		maxBuckets: maxBuckets,
+	}
+}
+
+func (s *ddSketchSink) Add(sample metrics.Sample) {
+	v := sample.Value
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count++
+	s.sum += v
+
+	switch {
+	case math.Abs(v) <= ddSketchMinValue:
+		s.zeroCount++
+	case v > 0:
+		s.positive.add(s.bucketIndex(v), s.maxBuckets)
+	default:
+		s.negative.add(s.bucketIndex(-v), s.maxBuckets)
+	}
+}
+
+func (s *ddSketchSink) Calc() {}
+
+// Format returns the same stats as the k6 TrendSink.
+func (s *ddSketchSink) Format(time.Duration) map[string]float64 {
+	return map[string]float64{
+		"min":   s.min,
+		"max":   s.max,
+		"avg":   s.avg(),
+		"med":   s.quantile(0.5),
+		"p(90)": s.quantile(0.9),
+		"p(95)": s.quantile(0.95),
+	}
+}
+
+func (s *ddSketchSink) bucketIndex(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// bucketValue returns the value of bucket i with the lowest relative error
+// to all the values of the bucket.
+func (s *ddSketchSink) bucketValue(i int) float64 {
+	return 2 * math.Pow(s.gamma, float64(i)) / (s.gamma + 1)
+}
+
+func (s *ddSketchSink) avg() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	return s.sum / float64(s.count)
+}
+
+// quantile returns the value at the q quantile, with 0 <= q <= 1,
+// using the same rank as the percentiles of the k6 TrendSink.
+func (s *ddSketchSink) quantile(q float64) float64 {
+	switch {
+	case s.count == 0:
+		return 0
+	case q <= 0:
+		return s.min
+	case q >= 1:
+		return s.max
+	}
+
+	rank := uint64(q * float64(s.count-1))
+	var value float64
+	switch {
+	case rank < s.negative.total:
+		// the negative buckets from the highest absolute value
+		value = -s.bucketValue(s.negative.indexAt(s.negative.total - 1 - rank))
+	case rank < s.negative.total+s.zeroCount:
+		value = 0
+	default:
+		value = s.bucketValue(s.positive.indexAt(rank - s.negative.total - s.zeroCount))
+	}
+	return math.Max(s.min, math.Min(s.max, value))
+}
+
+// ddSketchStore holds the counts of consecutive buckets, from the offset one.
+type ddSketchStore struct {
+	offset int
+	counts []uint64
+	total  uint64
+}
+
+// add counts a value in bucket i. Once more than maxBuckets buckets would be needed,
+// the lowest ones are collapsed into the lowest one kept.
+func (st *ddSketchStore) add(i, maxBuckets int) {
+	switch {
+	case len(st.counts) == 0:
+		st.offset = i
+		st.counts = append(st.counts, 0)
+	case i < st.offset:
+		lowest := st.offset + len(st.counts) - maxBuckets
+		if i < lowest {
+			i = lowest
+		}
+		if i < st.offset {
+			grown := make([]uint64, st.offset-i+len(st.counts))
+			copy(grown[st.offset-i:], st.counts)
+			st.counts = grown
+			st.offset = i
+		}
+	case i >= st.offset+len(st.counts):
+		for i >= st.offset+len(st.counts) {
+			st.counts = append(st.counts, 0)
+		}
+		if excess := len(st.counts) - maxBuckets; excess > 0 {
+			for _, c := range st.counts[:excess] {
+				st.counts[excess] += c
+			}
+			st.counts = append(st.counts[:0], st.counts[excess:]...)
+			st.offset += excess
+		}
+	}
+	st.counts[i-st.offset]++
+	st.total++
+}
+
+// indexAt returns the index of the bucket holding the value of the given rank,
+// from the lowest value of the store.
+func (st *ddSketchStore) indexAt(rank uint64) int {
+	var cumulative uint64
+	for n, c := range st.counts {
+		cumulative += c
+		if cumulative > rank {
+			return st.offset + n
+		}
+	}
+	return st.offset + len(st.counts) - 1
+}
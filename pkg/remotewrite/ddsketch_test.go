@@ -0,0 +1,98 @@
+package remotewrite
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestDDSketchSinkQuantiles(t *testing.T) {
+	t.Parallel()
+
+	s := newDDSketchSink(ddSketchRelativeAccuracy, ddSketchMaxBuckets)
+	r := rand.New(rand.NewSource(1)) //nolint:gosec
+
+	// a long tail, as for the durations of requests
+	values := make([]float64, 100000)
+	for i := range values {
+		values[i] = math.Exp(r.NormFloat64()) * 100
+		s.Add(metrics.Sample{Value: values[i]})
+	}
+	sort.Float64s(values)
+
+	for _, q := range []float64{0.5, 0.9, 0.95, 0.99, 0.999} {
+		exact := values[int(q*float64(len(values)-1))]
+		assert.InEpsilon(t, exact, s.quantile(q), ddSketchRelativeAccuracy, "quantile %v", q)
+	}
+	assert.Equal(t, values[0], s.quantile(0))
+	assert.Equal(t, values[len(values)-1], s.quantile(1))
+	assert.Equal(t, uint64(len(values)), s.count)
+}
+
+func TestDDSketchSinkNegativeAndZero(t *testing.T) {
+	t.Parallel()
+
+	s := newDDSketchSink(ddSketchRelativeAccuracy, ddSketchMaxBuckets)
+	for _, v := range []float64{-100, -10, 0, 10, 100, math.NaN()} {
+		s.Add(metrics.Sample{Value: v})
+	}
+
+	assert.Equal(t, uint64(5), s.count)
+	assert.InEpsilon(t, -100, s.quantile(0.1), ddSketchRelativeAccuracy)
+	assert.InEpsilon(t, -10, s.quantile(0.25), ddSketchRelativeAccuracy)
+	assert.Equal(t, float64(0), s.quantile(0.5))
+	assert.InEpsilon(t, 10, s.quantile(0.75), ddSketchRelativeAccuracy)
+	assert.Equal(t, float64(0), s.avg())
+}
+
+func TestDDSketchSinkMaxBuckets(t *testing.T) {
+	t.Parallel()
+
+	s := newDDSketchSink(ddSketchRelativeAccuracy, 64)
+	for v := 1.0; v < 1e9; v *= 1.01 {
+		s.Add(metrics.Sample{Value: v})
+	}
+	// the lowest values were added first and collapsed as the highest came
+	for v := 1.0; v < 10; v *= 1.01 {
+		s.Add(metrics.Sample{Value: v})
+	}
+
+	assert.LessOrEqual(t, len(s.positive.counts), 64)
+	assert.Equal(t, s.count, s.positive.total)
+	// the tail is still accurate
+	assert.InEpsilon(t, 1e9, s.quantile(0.9999), 0.02)
+}
+
+func TestDDSketchMappingTrend(t *testing.T) {
+	t.Parallel()
+
+	ms := newMetricsStorage()
+	mapping := NewMapping(Config{
+		Mapping:    null.StringFrom("ddsketch"),
+		TrendStats: []string{"count", "max", "p(99)"},
+	})
+	metric := &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend}
+	now := time.Now()
+
+	var ts []prompb.TimeSeries
+	for v := 1; v <= 1000; v++ {
+		ts = mapping.MapTrend(ms, metrics.Sample{Metric: metric, Value: float64(v), Time: now}, nil)
+	}
+
+	require.Len(t, ts, 3)
+	values := make(map[string]float64, len(ts))
+	for _, series := range ts {
+		values[series.Labels[0].Value] = series.Samples[0].Value
+	}
+	assert.Equal(t, float64(1000), values["http_req_duration_count"])
+	assert.Equal(t, float64(1000), values["http_req_duration_max"])
+	assert.InEpsilon(t, 990, values["http_req_duration_p99"], ddSketchRelativeAccuracy)
+}
@@ -0,0 +1,114 @@
+package remotewrite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// deadLetterMetaExt is the extension of the files describing the dead-lettered requests.
+const deadLetterMetaExt = ".meta.json"
+
+// deadLetterMeta describes a request that failed for good, in the file next to its body.
+type deadLetterMeta struct {
+	// Payload is the name of the file holding the body of the request, as it was sent.
+	Payload     string      `json:"payload"`
+	Time        time.Time   `json:"time"`
+	Error       string      `json:"error"`
+	ErrorClass  errorClass  `json:"errorClass"`
+	Protocol    protocol    `json:"protocol"`
+	Compression compression `json:"compression"`
+	Series      int         `json:"series"`
+	Samples     int         `json:"samples"`
+	// Route is the name of the tenant or metric route of the request, if any.
+	Route string `json:"route,omitempty"`
+
+	// file is the name of the metadata file, set when it's read
+	file string
+}
+
+// deadLetter keeps the requests that couldn't be delivered after all the retries,
+// so that they can be sent again with ReplayDeadLetters once the endpoint is fixed.
+// Each request is written as is, i.e. as the compressed body, with its metadata
+// in a .meta.json file. It is safe for concurrent use.
+type deadLetter struct {
+	dir string
+	seq uint64
+	now func() time.Time
+}
+
+func newDeadLetter(dir string) (*deadLetter, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create dead-letter directory: %w", err)
+	}
+	return &deadLetter{dir: dir, now: time.Now}, nil
+}
+
+// write stores the encoded request as <time>-<n><ext> and its metadata as
+// <time>-<n>.meta.json, written last so that only complete requests are replayed.
+func (d *deadLetter) write(encoded []byte, p protocol, c compression, meta deadLetterMeta, reqErr error) error {
+	now := d.now()
+	name := fmt.Sprintf("%020d-%06d", now.UnixNano(), atomic.AddUint64(&d.seq, 1))
+
+	meta.Payload = name + requestFileExt(p, c)
+	meta.Time = now
+	meta.Error = reqErr.Error()
+	meta.ErrorClass = classifyError(reqErr)
+	meta.Protocol = p
+	meta.Compression = c.resolve(p)
+	if err := os.WriteFile(filepath.Join(d.dir, meta.Payload), encoded, 0o600); err != nil {
+		return err
+	}
+
+	raw, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(d.dir, name+deadLetterMetaExt+".tmp")
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(d.dir, name+deadLetterMetaExt))
+}
+
+// readDeadLetters returns the metadata of the requests of the directory, oldest first.
+func readDeadLetters(dir string) ([]deadLetterMeta, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var metas []deadLetterMeta
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), deadLetterMetaExt) {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		meta := deadLetterMeta{file: e.Name()}
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, fmt.Errorf("invalid dead-letter metadata %s: %w", e.Name(), err)
+		}
+		metas = append(metas, meta)
+	}
+	// the names start with the time
+	sort.Slice(metas, func(i, j int) bool { return metas[i].Payload < metas[j].Payload })
+	return metas, nil
+}
+
+// ReplayDeadLetters sends the requests of the dead-letter directory again, oldest first,
+// to the endpoint of the config, i.e. its URL with its headers, TLS and authentication,
+// and removes them once sent. The requests of tenant and metric routes are sent
+// to the URL too. It stops at the first request that fails, which is kept with
+// the following ones, and returns the number of requests sent. It's Replay with
+// the timestamps of the samples kept as they were.
+func ReplayDeadLetters(ctx context.Context, dir string, config Config) (int, error) {
+	return Replay(ctx, dir, ReplayConfig{Config: config})
+}
@@ -0,0 +1,100 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestDeadLetterReplay(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		down     = true
+		received [][]byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+	config.RetryMaxAttempts = null.IntFrom(1)
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+	dir := t.TempDir()
+	dl, err := newDeadLetter(dir)
+	require.NoError(t, err)
+
+	o := &Output{
+		config:     config,
+		client:     client,
+		retry:      newRetryPolicy(config),
+		deadLetter: dl,
+		self:       newSelfMetrics(),
+		logger:     logrus.New(),
+	}
+
+	series := []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+		Samples: []prompb.Sample{{Value: 3, Timestamp: 1}, {Value: 4, Timestamp: 2}},
+	}}
+	require.Error(t, o.write(series))
+	require.Error(t, o.write(series))
+
+	metas, err := readDeadLetters(dir)
+	require.NoError(t, err)
+	require.Len(t, metas, 2)
+	assert.Equal(t, protocolV1, metas[0].Protocol)
+	assert.Equal(t, compressionSnappy, metas[0].Compression)
+	assert.Equal(t, errorClassServer, metas[0].ErrorClass)
+	assert.Equal(t, 1, metas[0].Series)
+	assert.Equal(t, 2, metas[0].Samples)
+	assert.Contains(t, metas[0].Error, "503")
+	assert.Regexp(t, `^\d{20}-000001\.pb\.snappy$`, metas[0].Payload)
+	sent, err := os.ReadFile(filepath.Join(dir, metas[0].Payload))
+	require.NoError(t, err)
+
+	// the endpoint is still down
+	n, err := ReplayDeadLetters(context.Background(), dir, config)
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+
+	mu.Lock()
+	down = false
+	mu.Unlock()
+
+	n, err = ReplayDeadLetters(context.Background(), dir, config)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, [][]byte{sent, sent}, received)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,117 @@
+package remotewrite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// debugServer serves the state of the output for diagnosing slow flushes during
+// a test: pprof on /debug/pprof/, the samples waiting in the buffer on /debug/queue,
+// the stats of the last flush on /debug/flush, the self-metrics on /debug/stats
+// and the effective config, with its secrets redacted, on /debug/config.
+type debugServer struct {
+	output *Output
+	// config is the redacted config, kept apart from that of the output as it's
+	// changed by reloads while flushing, and a slow flush must not block the listener
+	config atomic.Value
+
+	server   *http.Server
+	listener net.Listener
+}
+
+func newDebugServer(o *Output) *debugServer {
+	d := &debugServer{output: o}
+	d.setConfig(o.config)
+	return d
+}
+
+// setConfig redacts the config to serve it from now on.
+func (d *debugServer) setConfig(config Config) {
+	if d == nil {
+		return
+	}
+	d.config.Store(redactedConfig(config))
+}
+
+// handler returns the handler of the endpoints, not registered on the default
+// mux so that pprof isn't exposed by other listeners of the process.
+func (d *debugServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/queue", func(w http.ResponseWriter, _ *http.Request) {
+		writeDebugJSON(w, d.output.buffer.stats())
+	})
+	mux.HandleFunc("/debug/flush", func(w http.ResponseWriter, _ *http.Request) {
+		writeDebugJSON(w, d.output.self.lastFlush())
+	})
+	mux.HandleFunc("/debug/stats", func(w http.ResponseWriter, _ *http.Request) {
+		writeDebugJSON(w, d.output.self.fields())
+	})
+	mux.HandleFunc("/debug/config", func(w http.ResponseWriter, _ *http.Request) {
+		writeDebugJSON(w, d.config.Load())
+	})
+	return mux
+}
+
+func writeDebugJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// listen starts serving the endpoints at the address.
+func (d *debugServer) listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	d.listener = listener
+	d.server = &http.Server{Handler: d.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = d.server.Serve(listener)
+	}()
+	return nil
+}
+
+// close stops the server, waiting up to 5 seconds for the current requests
+// to complete, e.g. the profiles being taken, before closing their connections.
+func (d *debugServer) close() error {
+	if d == nil || d.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.server.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return d.server.Close()
+	}
+	return nil
+}
+
+// isLoopbackAddr reports whether the host of the address is localhost or a
+// loopback IP, as the debug listener must not be reachable from the network.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,87 @@
+package remotewrite
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestDebugServer(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.Password = null.StringFrom("hunter2")
+	o := &Output{
+		config: config,
+		buffer: newSampleBuffer(100, bufferDropNewest),
+		self:   newSelfMetrics(),
+		logger: logrus.New(),
+	}
+	metric := &metrics.Metric{Name: "vus", Type: metrics.Gauge}
+	o.buffer.add([]metrics.SampleContainer{metrics.Samples{{Metric: metric, Value: 1}, {Metric: metric, Value: 2}}})
+	o.self.observeFlush(42, 0)
+
+	d := newDebugServer(o)
+	require.NoError(t, d.listen("127.0.0.1:0"))
+	defer func() { require.NoError(t, d.close()) }()
+	base := "http://" + d.listener.Addr().String()
+
+	get := func(path string, v interface{}) {
+		resp, err := http.Get(base + path)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		require.Equal(t, http.StatusOK, resp.StatusCode, path)
+		if v == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			return
+		}
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+
+	var queue bufferStats
+	get("/debug/queue", &queue)
+	assert.Equal(t, bufferStats{Samples: 2, Capacity: 100, Policy: bufferDropNewest}, queue)
+
+	var flush flushStats
+	get("/debug/flush", &flush)
+	assert.Equal(t, 42, flush.Samples)
+	assert.Equal(t, uint64(1), flush.Flushes)
+
+	var served map[string]interface{}
+	get("/debug/config", &served)
+	assert.Equal(t, redacted, served["password"])
+
+	// the config reloaded is served from then on
+	config.Password = null.StringFrom("")
+	d.setConfig(config)
+	served = nil
+	get("/debug/config", &served)
+	assert.Empty(t, served["password"])
+
+	get("/debug/stats", nil)
+	get("/debug/pprof/", nil)
+}
+
+func TestIsLoopbackAddr(t *testing.T) {
+	t.Parallel()
+
+	for addr, loopback := range map[string]bool{
+		"localhost:6060": true,
+		"127.0.0.1:6060": true,
+		"[::1]:6060":     true,
+		":6060":          false,
+		"0.0.0.0:6060":   false,
+		"10.0.0.1:6060":  false,
+		"localhost":      false,
+	} {
+		assert.Equal(t, loopback, isLoopbackAddr(addr), addr)
+	}
+}
@@ -0,0 +1,67 @@
+package remotewrite
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// dryRunCompressionExts are the file extensions of the compressed request bodies.
+var dryRunCompressionExts = map[compression]string{
+	compressionSnappy: ".snappy",
+	compressionZstd:   ".zst",
+	compressionGzip:   ".gz",
+}
+
+// dryRun writes the requests to files instead of sending them, to see exactly
+// what would be sent: each request is written as is, i.e. as the compressed
+// protobuf body, and as JSON. It is safe for concurrent use.
+type dryRun struct {
+	dir string
+	seq uint64
+}
+
+func newDryRun(dir string) (*dryRun, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create dry-run directory: %w", err)
+	}
+	return &dryRun{dir: dir}, nil
+}
+
+// write stores the request as request-<n>.pb[.<compression>], or .jsonl for
+// the VictoriaMetrics import API, .lp for the InfluxDB line protocol, .txt for Graphite
+// and .series.json or .distributions.json for Datadog, and request-<n>.json.
+func (d *dryRun) write(req prompb.WriteRequest, encoded []byte, p protocol, c compression) error {
+	name := filepath.Join(d.dir, fmt.Sprintf("request-%06d", atomic.AddUint64(&d.seq, 1)))
+	if err := os.WriteFile(name+requestFileExt(p, c), encoded, 0o600); err != nil {
+		return err
+	}
+
+	readable, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name+".json", readable, 0o600)
+}
+
+// requestFileExt returns the extension of the files holding request bodies of the protocol compressed with c.
+func requestFileExt(p protocol, c compression) string {
+	ext := ".pb"
+	switch p {
+	case protocolVictoriaMetrics:
+		ext = ".jsonl"
+	case protocolInfluxDB:
+		ext = ".lp"
+	case protocolGraphite, protocolGraphiteTagged:
+		ext = ".txt"
+	case protocolDatadog:
+		ext = ".series.json"
+	case protocolDatadogDistributions:
+		ext = ".distributions.json"
+	}
+	return ext + dryRunCompressionExts[c.resolve(p)]
+}
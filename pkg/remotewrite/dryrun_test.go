@@ -0,0 +1,64 @@
+package remotewrite
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputDryRun(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "requests")
+	dr, err := newDryRun(dir)
+	require.NoError(t, err)
+
+	o := &Output{
+		config: NewConfig(),
+		dryRun: dr,
+		self:   newSelfMetrics(),
+		logger: logrus.New(),
+	}
+
+	series := []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+		Samples: []prompb.Sample{{Value: 3, Timestamp: 1}},
+	}}
+	require.NoError(t, o.write(series))
+	require.NoError(t, o.write(series))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{
+		"request-000001.json", "request-000001.pb.snappy",
+		"request-000002.json", "request-000002.pb.snappy",
+	}, names)
+
+	raw, err := os.ReadFile(filepath.Join(dir, "request-000001.pb.snappy"))
+	require.NoError(t, err)
+	decoded, err := snappy.Decode(nil, raw)
+	require.NoError(t, err)
+	var req prompb.WriteRequest
+	require.NoError(t, req.Unmarshal(decoded))
+	assert.Equal(t, series, req.Timeseries)
+
+	readable, err := os.ReadFile(filepath.Join(dir, "request-000001.json"))
+	require.NoError(t, err)
+	var fromJSON prompb.WriteRequest
+	require.NoError(t, json.Unmarshal(readable, &fromJSON))
+	assert.Equal(t, series, fromJSON.Timeseries)
+	assert.Contains(t, string(readable), `"k6_vus"`)
+
+	assert.Equal(t, uint64(2), o.self.fields()["series_sent"])
+}
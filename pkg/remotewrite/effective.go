@@ -0,0 +1,133 @@
+package remotewrite
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The sources of the options of the effective config, in the order they are applied.
+const (
+	sourceDefault    = "default"
+	sourcePreset     = "preset"
+	sourceConfigFile = "config file"
+	sourceJSONConfig = "JSON config"
+	sourceEnv        = "environment"
+	sourceArgument   = "argument"
+	// sourceResolved are the options completed once consolidated, e.g. the
+	// URL of a Grafana Cloud stack or the labels of the Kubernetes pod
+	sourceResolved = "resolved"
+)
+
+// configStage is the config as consolidated up to a source.
+type configStage struct {
+	source string
+	config Config
+}
+
+// configSources returns the source of the value of every option of the effective
+// config, by JSON name, consolidated as GetConsolidatedConfig does: it's the last
+// source that changed its value, so an option set to the same value by two
+// sources comes from the first one.
+func configSources(config Config, jsonRawConf json.RawMessage, env map[string]string, arg string) (map[string]string, error) {
+	base := NewConfig()
+	stages := []configStage{{sourceDefault, base}}
+
+	if config.Preset.String != "" {
+		p, err := parsePreset(config.Preset.String)
+		if err != nil {
+			return nil, err
+		}
+		base = base.Apply(p.options)
+		stages = append(stages, configStage{sourcePreset, base})
+	}
+
+	fileEnv := map[string]string{}
+	if path, ok := env["K6_PROMETHEUS_CONFIG"]; ok {
+		fileEnv["K6_PROMETHEUS_CONFIG"] = path
+	}
+	for _, layer := range []struct {
+		source string
+		json   json.RawMessage
+		env    map[string]string
+		arg    string
+	}{
+		{sourceConfigFile, nil, fileEnv, ""},
+		{sourceJSONConfig, jsonRawConf, fileEnv, ""},
+		{sourceEnv, jsonRawConf, env, ""},
+		{sourceArgument, jsonRawConf, env, arg},
+	} {
+		c, err := consolidateConfig(base, layer.json, layer.env, layer.arg)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, configStage{layer.source, c})
+	}
+	stages = append(stages, configStage{sourceResolved, config})
+
+	var previous map[string]json.RawMessage
+	sources := make(map[string]string)
+	for _, stage := range stages {
+		values, err := configValues(stage.config)
+		if err != nil {
+			return nil, err
+		}
+		for name, v := range values {
+			if previous == nil || string(previous[name]) != string(v) {
+				sources[name] = stage.source
+			}
+		}
+		previous = values
+	}
+	return sources, nil
+}
+
+// configValues returns the options of the config as they're encoded in JSON, by name.
+func configValues(config Config) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]json.RawMessage
+	return values, json.Unmarshal(raw, &values)
+}
+
+// logEffectiveConfig logs the options that aren't left to their default, with the
+// source of their value, and the whole config at the debug level. The secrets are
+// redacted, as in the debug listener.
+func logEffectiveConfig(
+	logger logrus.FieldLogger, config Config, jsonRawConf json.RawMessage, env map[string]string, arg string,
+) {
+	values, err := configValues(redactedConfig(config))
+	if err != nil {
+		logger.WithError(err).Debug("Prometheus: failed to log the effective config")
+		return
+	}
+	sources, err := configSources(config, jsonRawConf, env, arg)
+	if err != nil {
+		logger.WithError(err).Debug("Prometheus: failed to find the sources of the effective config")
+		return
+	}
+
+	set := logrus.Fields{}
+	all := logrus.Fields{}
+	for name, raw := range values {
+		v := formatConfigValue(raw)
+		all[name] = v
+		if source := sources[name]; source != sourceDefault {
+			set[name] = fmt.Sprintf("%s (%s)", v, source)
+		}
+	}
+	logger.WithFields(set).Info("Prometheus: effective config, options set and their source")
+	logger.WithFields(all).Debug("Prometheus: effective config")
+}
+
+// formatConfigValue returns the JSON of the value, strings without their quotes.
+func formatConfigValue(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
@@ -0,0 +1,86 @@
+package remotewrite
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigSources(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("flushPeriod: 10s\ntenantID: team-a\nmetricPrefix: file_\n"), 0o600))
+	jsonRawConf := json.RawMessage(`{"metricPrefix":"json_","mapping":"raw"}`)
+	env := map[string]string{
+		"K6_PROMETHEUS_CONFIG":     file,
+		"K6_PROMETHEUS_REMOTE_URL": "https://example.com/api/v1/write",
+		"K6_PROMETHEUS_MAPPING":    "raw",
+	}
+	arg := "flushPeriod=20s"
+
+	config, err := GetConsolidatedConfig(jsonRawConf, env, arg)
+	require.NoError(t, err)
+	sources, err := configSources(config, jsonRawConf, env, arg)
+	require.NoError(t, err)
+
+	assert.Equal(t, sourceConfigFile, sources["tenantID"])
+	assert.Equal(t, sourceJSONConfig, sources["metricPrefix"])
+	// set to the same value by the environment
+	assert.Equal(t, sourceJSONConfig, sources["mapping"])
+	assert.Equal(t, sourceEnv, sources["url"])
+	assert.Equal(t, sourceArgument, sources["flushPeriod"])
+	assert.Equal(t, sourceDefault, sources["bufferCapacity"])
+}
+
+func TestConfigSourcesPreset(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{"K6_PROMETHEUS_PRESET": "mimir", "K6_PROMETHEUS_REMOTE_URL": "http://mimir:9009"}
+	config, err := GetConsolidatedConfig(nil, env, "")
+	require.NoError(t, err)
+	sources, err := configSources(config, nil, env, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, sourceResolved, sources["url"])
+	assert.Contains(t, sources, "preset")
+	var fromPreset int
+	for _, source := range sources {
+		if source == sourcePreset {
+			fromPreset++
+		}
+	}
+	assert.NotZero(t, fromPreset)
+}
+
+func TestLogEffectiveConfig(t *testing.T) {
+	t.Parallel()
+
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	env := map[string]string{
+		"K6_PROMETHEUS_REMOTE_URL": "https://example.com/api/v1/write",
+		"K6_PROMETHEUS_PASSWORD":   "hunter2",
+	}
+	config, err := GetConsolidatedConfig(nil, env, "")
+	require.NoError(t, err)
+	logEffectiveConfig(logger, config, nil, env, "")
+
+	entries := hook.AllEntries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, logrus.InfoLevel, entries[0].Level)
+	assert.Equal(t, logrus.Fields{
+		"url":      "https://example.com/api/v1/write (environment)",
+		"password": "xxxxx (environment)",
+	}, entries[0].Data)
+
+	assert.Equal(t, logrus.DebugLevel, entries[1].Level)
+	assert.Equal(t, "xxxxx", entries[1].Data["password"])
+	assert.Equal(t, "1000000", entries[1].Data["bufferCapacity"])
+}
@@ -0,0 +1,146 @@
+package remotewrite
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// envAlias is another name of an environment variable of the output: a name of
+// the upstream extension, K6_PROMETHEUS_RW_*, or a deprecated name of this one.
+type envAlias struct {
+	name       string
+	canonical  string
+	deprecated bool
+	// convert returns the value of the canonical variable, false if the alias
+	// doesn't set it, e.g. a boolean switched off. The value is kept if it's nil.
+	convert func(string) (string, bool)
+}
+
+var envAliases = []envAlias{
+	{name: "K6_CA_CERT_FILE", canonical: "K6_PROMETHEUS_CA_CERT_FILE", deprecated: true},
+	{name: "K6_KEEP_TAGS", canonical: "K6_PROMETHEUS_KEEP_TAGS", deprecated: true},
+	{name: "K6_KEEP_NAME_TAG", canonical: "K6_PROMETHEUS_KEEP_NAME_TAG", deprecated: true},
+	{name: "K6_KEEP_URL_TAG", canonical: "K6_PROMETHEUS_KEEP_URL_TAG", deprecated: true},
+
+	{name: "K6_PROMETHEUS_RW_SERVER_URL", canonical: "K6_PROMETHEUS_REMOTE_URL"},
+	{name: "K6_PROMETHEUS_RW_USERNAME", canonical: "K6_PROMETHEUS_USER"},
+	{name: "K6_PROMETHEUS_RW_PASSWORD", canonical: "K6_PROMETHEUS_PASSWORD"},
+	{name: "K6_PROMETHEUS_RW_BEARER_TOKEN", canonical: "K6_PROMETHEUS_BEARER_TOKEN"},
+	{name: "K6_PROMETHEUS_RW_INSECURE_SKIP_TLS_VERIFY", canonical: "K6_PROMETHEUS_INSECURE_SKIP_TLS_VERIFY"},
+	{name: "K6_PROMETHEUS_RW_CLIENT_CERTIFICATE", canonical: "K6_PROMETHEUS_TLS_CERT_FILE"},
+	{name: "K6_PROMETHEUS_RW_CLIENT_CERTIFICATE_KEY", canonical: "K6_PROMETHEUS_TLS_KEY_FILE"},
+	{name: "K6_PROMETHEUS_RW_PUSH_INTERVAL", canonical: "K6_PROMETHEUS_FLUSH_PERIOD"},
+	{name: "K6_PROMETHEUS_RW_STALE_MARKERS", canonical: "K6_PROMETHEUS_STALE_MARKERS"},
+	{name: "K6_PROMETHEUS_RW_TREND_STATS", canonical: "K6_PROMETHEUS_TREND_STATS"},
+	{
+		name: "K6_PROMETHEUS_RW_TREND_AS_NATIVE_HISTOGRAM", canonical: "K6_PROMETHEUS_MAPPING",
+		convert: func(v string) (string, bool) {
+			// an invalid boolean is left to the mapping option, which rejects it
+			if b, err := strconv.ParseBool(v); err == nil && !b {
+				return "", false
+			}
+			return "native-histogram", true
+		},
+	},
+}
+
+// envPrefixAliases are the prefixes of the variables of the headers of the upstream extension.
+var envPrefixAliases = map[string]string{
+	"K6_PROMETHEUS_RW_HEADERS_": "K6_PROMETHEUS_HEADERS_",
+}
+
+// envHTTPHeadersAlias sets the headers as name:value pairs separated by commas in the upstream extension.
+const envHTTPHeadersAlias = "K6_PROMETHEUS_RW_HTTP_HEADERS"
+
+// envAliasUse is an alias set in the environment.
+type envAliasUse struct {
+	name       string
+	canonical  string
+	deprecated bool
+	// ignored is true if the canonical variable is set too, it takes precedence
+	ignored bool
+}
+
+// resolveEnvAliases returns env with the variables set by their aliases under their
+// canonical names, which take precedence when both are set, and the aliases set.
+func resolveEnvAliases(env map[string]string) (map[string]string, []envAliasUse) {
+	var (
+		resolved map[string]string
+		uses     []envAliasUse
+	)
+	set := func(alias, canonical, value string, deprecated bool) {
+		if resolved == nil {
+			resolved = make(map[string]string, len(env))
+			for k, v := range env {
+				resolved[k] = v
+			}
+		}
+		_, ignored := env[canonical]
+		if !ignored {
+			resolved[canonical] = value
+		}
+		uses = append(uses, envAliasUse{name: alias, canonical: canonical, deprecated: deprecated, ignored: ignored})
+	}
+
+	for _, a := range envAliases {
+		v, ok := env[a.name]
+		if !ok {
+			continue
+		}
+		if a.convert != nil {
+			if v, ok = a.convert(v); !ok {
+				continue
+			}
+		}
+		set(a.name, a.canonical, v, a.deprecated)
+	}
+
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	// for the uses to be logged in a stable order
+	sort.Strings(names)
+	for _, name := range names {
+		for prefix, canonical := range envPrefixAliases {
+			if strings.HasPrefix(name, prefix) {
+				set(name, canonical+strings.TrimPrefix(name, prefix), env[name], false)
+			}
+		}
+	}
+
+	if headers, ok := env[envHTTPHeadersAlias]; ok {
+		for _, header := range parseList(headers) {
+			name, value, found := strings.Cut(header, ":")
+			if !found {
+				continue
+			}
+			set(envHTTPHeadersAlias, "K6_PROMETHEUS_HEADERS_"+strings.TrimSpace(name), strings.TrimSpace(value), false)
+		}
+	}
+
+	if resolved == nil {
+		return env, nil
+	}
+	return resolved, uses
+}
+
+// logEnvAliases logs the aliases set in the environment: a warning for the
+// deprecated ones and for those ignored, the canonical name being set too.
+func logEnvAliases(logger logrus.FieldLogger, env map[string]string) {
+	_, uses := resolveEnvAliases(env)
+	for _, u := range uses {
+		switch {
+		case u.ignored:
+			logger.Warn(fmt.Sprintf("Prometheus: %s is ignored as %s is set too", u.name, u.canonical))
+		case u.deprecated:
+			logger.Warn(fmt.Sprintf("Prometheus: %s is deprecated, use %s instead", u.name, u.canonical))
+		default:
+			logger.Debug(fmt.Sprintf("Prometheus: %s is read as %s", u.name, u.canonical))
+		}
+	}
+}
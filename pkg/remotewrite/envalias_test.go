@@ -0,0 +1,66 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveEnvAliases(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{
+		"K6_PROMETHEUS_RW_SERVER_URL":                "http://upstream:9090/api/v1/write",
+		"K6_PROMETHEUS_RW_PUSH_INTERVAL":             "10s",
+		"K6_PROMETHEUS_RW_TREND_AS_NATIVE_HISTOGRAM": "true",
+		"K6_PROMETHEUS_RW_HEADERS_X-Scope-OrgID":     "team-a",
+		"K6_PROMETHEUS_RW_HTTP_HEADERS":              "X-Api-Key: secret,X-Team:payments",
+		"K6_PROMETHEUS_RW_USERNAME":                  "upstream",
+		"K6_PROMETHEUS_USER":                         "fork",
+		"K6_KEEP_URL_TAG":                            "false",
+	}
+	config, err := GetConsolidatedConfig(nil, env, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, "http://upstream:9090/api/v1/write", config.Url.String)
+	assert.Equal(t, 10*time.Second, time.Duration(config.FlushPeriod.Duration))
+	assert.Equal(t, "native-histogram", config.Mapping.String)
+	assert.Equal(t, map[string]string{"X-Scope-OrgID": "team-a", "X-Api-Key": "secret", "X-Team": "payments"}, config.Headers)
+	// the current name takes precedence
+	assert.Equal(t, "fork", config.User.String)
+	assert.False(t, config.KeepUrlTag.Bool)
+
+	// switched off, the mapping is left as it is
+	_, uses := resolveEnvAliases(map[string]string{"K6_PROMETHEUS_RW_TREND_AS_NATIVE_HISTOGRAM": "false"})
+	assert.Empty(t, uses)
+
+	// the environment is left as it is
+	assert.NotContains(t, env, "K6_PROMETHEUS_REMOTE_URL")
+}
+
+func TestLogEnvAliases(t *testing.T) {
+	t.Parallel()
+
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	logEnvAliases(logger, map[string]string{
+		"K6_KEEP_TAGS":                "false",
+		"K6_PROMETHEUS_RW_PASSWORD":   "a",
+		"K6_PROMETHEUS_PASSWORD":      "b",
+		"K6_PROMETHEUS_RW_SERVER_URL": "http://localhost:9090",
+	})
+
+	messages := make(map[string]logrus.Level)
+	for _, e := range hook.AllEntries() {
+		messages[e.Message] = e.Level
+	}
+	assert.Equal(t, map[string]logrus.Level{
+		"Prometheus: K6_KEEP_TAGS is deprecated, use K6_PROMETHEUS_KEEP_TAGS instead":           logrus.WarnLevel,
+		"Prometheus: K6_PROMETHEUS_RW_PASSWORD is ignored as K6_PROMETHEUS_PASSWORD is set too": logrus.WarnLevel,
+		"Prometheus: K6_PROMETHEUS_RW_SERVER_URL is read as K6_PROMETHEUS_REMOTE_URL":           logrus.DebugLevel,
+	}, messages)
+}
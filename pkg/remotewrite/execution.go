@@ -0,0 +1,102 @@
+package remotewrite
+
+import (
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// executionMetrics are the k6 metrics of the state of the execution, true for
+// counters: without samples for them in a flush, their latest values are sent
+// again so that the dashboards have no gaps, e.g. while no iteration ends.
+var executionMetrics = map[string]bool{
+	"vus":                false,
+	"vus_max":            false,
+	"iterations":         true,
+	"dropped_iterations": true,
+}
+
+// executionTracker keeps the latest value of each series of the execution metrics.
+type executionTracker struct {
+	// names maps the names of the series, with the prefix, to whether they are counters
+	names map[string]bool
+	// delta is set with delta temporality: the counters are then sent again as 0
+	delta  bool
+	latest map[string]*prompb.TimeSeries
+	// order of the series in latest, so that they are sent in a stable order
+	order []string
+	// seen holds the series with samples in the flush, until fill
+	seen map[string]struct{}
+}
+
+func newExecutionTracker(prefix string, delta bool) *executionTracker {
+	names := make(map[string]bool, 2*len(executionMetrics))
+	for name, counter := range executionMetrics {
+		names[prefix+name] = counter
+		// e.g. with mappings following the OpenMetrics naming
+		if counter {
+			names[prefix+name+"_total"] = true
+		}
+	}
+	return &executionTracker{
+		names:  names,
+		delta:  delta,
+		latest: make(map[string]*prompb.TimeSeries),
+		seen:   make(map[string]struct{}),
+	}
+}
+
+// observe records the latest values of the execution metrics in the series
+// of a flush that are sent in several parts, before fill is called with the last one.
+func (t *executionTracker) observe(series []prompb.TimeSeries) {
+	if t == nil {
+		return
+	}
+	for _, ts := range series {
+		i := labelIndex(ts.Labels, "__name__")
+		if i < 0 || len(ts.Samples) == 0 {
+			continue
+		}
+		if _, ok := t.names[ts.Labels[i].Value]; !ok {
+			continue
+		}
+
+		key := labelsKey(ts.Labels)
+		t.seen[key] = struct{}{}
+		latest, ok := t.latest[key]
+		if !ok {
+			latest = &prompb.TimeSeries{Labels: ts.Labels, Samples: make([]prompb.Sample, 1)}
+			t.latest[key] = latest
+			t.order = append(t.order, key)
+		}
+		latest.Samples[0] = ts.Samples[len(ts.Samples)-1]
+	}
+}
+
+// fill returns the series with those of the execution metrics that have no
+// samples in this flush, with their latest value at now, in milliseconds.
+func (t *executionTracker) fill(series []prompb.TimeSeries, now int64) []prompb.TimeSeries {
+	if t == nil {
+		return series
+	}
+	t.observe(series)
+	defer func() {
+		t.seen = make(map[string]struct{})
+	}()
+
+	for _, key := range t.order {
+		if _, ok := t.seen[key]; ok {
+			continue
+		}
+		latest := t.latest[key]
+		sample := latest.Samples[0]
+		if sample.Timestamp >= now {
+			continue
+		}
+		sample.Timestamp = now
+		if t.delta && t.names[latest.Labels[labelIndex(latest.Labels, "__name__")].Value] {
+			sample.Value = 0
+		}
+		latest.Samples[0] = sample
+		series = append(series, prompb.TimeSeries{Labels: latest.Labels, Samples: []prompb.Sample{sample}})
+	}
+	return series
+}
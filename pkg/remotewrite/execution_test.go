@@ -0,0 +1,44 @@
+package remotewrite
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutionTrackerFill(t *testing.T) {
+	t.Parallel()
+
+	series := func(name string, value float64, ts int64) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels:  []prompb.Label{{Name: "__name__", Value: name}},
+			Samples: []prompb.Sample{{Value: value, Timestamp: ts}},
+		}
+	}
+
+	tracker := newExecutionTracker("k6_", false)
+	first := []prompb.TimeSeries{
+		series("k6_vus", 10, 900),
+		series("k6_iterations", 5, 950),
+		series("k6_http_reqs", 7, 950),
+	}
+	assert.Equal(t, first, tracker.fill(first, 1000))
+
+	// the latest values are sent again without samples in the flush
+	assert.Equal(t, []prompb.TimeSeries{
+		series("k6_vus", 12, 1900),
+		series("k6_iterations", 5, 2000),
+	}, tracker.fill([]prompb.TimeSeries{series("k6_vus", 12, 1900)}, 2000))
+
+	// with delta temporality, the counters are sent again as 0
+	delta := newExecutionTracker("k6_", true)
+	delta.fill([]prompb.TimeSeries{series("k6_vus", 10, 900), series("k6_dropped_iterations_total", 2, 900)}, 1000)
+	assert.Equal(t, []prompb.TimeSeries{
+		series("k6_vus", 10, 2000),
+		series("k6_dropped_iterations_total", 0, 2000),
+	}, delta.fill(nil, 2000))
+
+	var disabled *executionTracker
+	assert.Empty(t, disabled.fill(nil, 1000))
+}
@@ -0,0 +1,29 @@
+package remotewrite
+
+import (
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"go.k6.io/k6/metrics"
+)
+
+// traceIDTag is the sample tag holding the ID of the trace of the request.
+const traceIDTag = "trace_id"
+
+// sampleExemplar returns an exemplar linking the sample to its trace,
+// or nil if the sample has no trace ID.
+func sampleExemplar(sample metrics.Sample) *prompb.Exemplar {
+	if sample.Tags == nil {
+		return nil
+	}
+
+	traceID, ok := sample.Tags.Get(traceIDTag)
+	if !ok || traceID == "" {
+		return nil
+	}
+
+	return &prompb.Exemplar{
+		Labels:    []prompb.Label{{Name: traceIDTag, Value: traceID}},
+		Value:     sample.Value,
+		Timestamp: timestamp.FromTime(sample.Time),
+	}
+}
@@ -0,0 +1,84 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestSampleExemplar(t *testing.T) {
+	t.Parallel()
+
+	metric := &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend}
+	now := time.Now()
+
+	e := sampleExemplar(metrics.Sample{
+		Metric: metric,
+		Tags:   metrics.NewSampleTags(map[string]string{"trace_id": "abc"}),
+		Time:   now,
+		Value:  42,
+	})
+	require.NotNil(t, e)
+	assert.Equal(t, prompb.Exemplar{
+		Labels:    []prompb.Label{{Name: "trace_id", Value: "abc"}},
+		Value:     42,
+		Timestamp: now.UnixMilli(),
+	}, *e)
+
+	assert.Nil(t, sampleExemplar(metrics.Sample{
+		Metric: metric,
+		Tags:   metrics.NewSampleTags(map[string]string{"status": "200"}),
+		Time:   now,
+	}))
+	assert.Nil(t, sampleExemplar(metrics.Sample{Metric: metric, Time: now}))
+}
+
+func TestConvertToTimeSeriesExemplars(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.Exemplars = null.BoolFrom(true)
+	o := &Output{
+		config:  config,
+		metrics: newMetricsStorage(),
+		mapping: NewMapping(config),
+		logger:  logrus.New(),
+	}
+
+	now := time.Now()
+	tags := metrics.NewSampleTags(map[string]string{"trace_id": "abc", "status": "200"})
+
+	ts := o.convertToTimeSeries([]metrics.SampleContainer{
+		metrics.Samples{
+			{Metric: &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend}, Tags: tags, Time: now, Value: 42},
+			{Metric: &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}, Tags: tags, Time: now, Value: 1},
+		},
+	})
+	require.NotEmpty(t, ts)
+
+	for _, series := range ts {
+		assert.False(t, hasLabel(series.Labels, "trace_id"))
+
+		if hasLabelValue(series.Labels, "__name__", "k6_http_reqs") {
+			assert.Empty(t, series.Exemplars)
+			continue
+		}
+		require.Len(t, series.Exemplars, 1)
+		assert.Equal(t, []prompb.Label{{Name: "trace_id", Value: "abc"}}, series.Exemplars[0].Labels)
+	}
+}
+
+func hasLabelValue(labels []prompb.Label, name, value string) bool {
+	for _, l := range labels {
+		if l.Name == name && l.Value == value {
+			return true
+		}
+	}
+	return false
+}
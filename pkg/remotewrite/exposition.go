@@ -0,0 +1,188 @@
+package remotewrite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// exposition holds the latest sample of every series to expose them over HTTP
+// in the OpenMetrics text format, for Prometheus to scrape them when it can't be
+// reached by the load generators. It is safe for concurrent use.
+type exposition struct {
+	mu     sync.Mutex
+	series map[string]*exposedSeries
+
+	server   *http.Server
+	listener net.Listener
+}
+
+type exposedSeries struct {
+	name   string
+	labels []prompb.Label
+	sample prompb.Sample
+}
+
+func newExposition() *exposition {
+	return &exposition{
+		series: make(map[string]*exposedSeries),
+	}
+}
+
+// update records the latest sample of the series. Series with a stale marker
+// are removed, and native histograms are not exposed as the text format
+// doesn't support them.
+func (e *exposition) update(series []prompb.TimeSeries) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, ts := range series {
+		if len(ts.Samples) == 0 {
+			continue
+		}
+		key := labelsKey(ts.Labels)
+		latest := ts.Samples[len(ts.Samples)-1]
+		if value.IsStaleNaN(latest.Value) {
+			delete(e.series, key)
+			continue
+		}
+
+		s, ok := e.series[key]
+		if !ok {
+			s = &exposedSeries{}
+			for _, l := range ts.Labels {
+				if l.Name == "__name__" {
+					s.name = l.Value
+					continue
+				}
+				s.labels = append(s.labels, l)
+			}
+			sort.Slice(s.labels, func(i, j int) bool {
+				return s.labels[i].Name < s.labels[j].Name
+			})
+			e.series[key] = s
+		}
+		if latest.Timestamp >= s.sample.Timestamp {
+			s.sample = latest
+		}
+	}
+}
+
+// writeTo writes the series in the OpenMetrics text format. The types of the
+// metrics are unknown as the mappings only give their series.
+func (e *exposition) writeTo(w io.Writer) error {
+	e.mu.Lock()
+	series := make([]*exposedSeries, 0, len(e.series))
+	for _, s := range e.series {
+		series = append(series, s)
+	}
+	e.mu.Unlock()
+
+	// the series of a metric must be grouped
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].name != series[j].name {
+			return series[i].name < series[j].name
+		}
+		return labelsKey(series[i].labels) < labelsKey(series[j].labels)
+	})
+
+	bw := bufio.NewWriter(w)
+	for i, s := range series {
+		if i == 0 || series[i-1].name != s.name {
+			fmt.Fprintf(bw, "# TYPE %s unknown\n", s.name)
+		}
+		bw.WriteString(s.name)
+		if len(s.labels) > 0 {
+			bw.WriteByte('{')
+			for j, l := range s.labels {
+				if j > 0 {
+					bw.WriteByte(',')
+				}
+				bw.WriteString(l.Name)
+				bw.WriteString(`="`)
+				bw.WriteString(escapeLabelValue(l.Value))
+				bw.WriteByte('"')
+			}
+			bw.WriteByte('}')
+		}
+		bw.WriteByte(' ')
+		bw.WriteString(formatFloat(s.sample.Value))
+		bw.WriteByte(' ')
+		bw.WriteString(strconv.FormatFloat(float64(s.sample.Timestamp)/1000, 'f', 3, 64))
+		bw.WriteByte('\n')
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+func (e *exposition) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", openMetricsContentType)
+	_ = e.writeTo(w)
+}
+
+// listen starts serving the series on /metrics at the address.
+func (e *exposition) listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	e.listener = listener
+	e.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = e.server.Serve(listener)
+	}()
+	return nil
+}
+
+// close stops the server, waiting for the current scrapes to complete.
+func (e *exposition) close() error {
+	if e == nil || e.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.server.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,73 @@
+package remotewrite
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExposition(t *testing.T) {
+	t.Parallel()
+
+	e := newExposition()
+	e.update([]prompb.TimeSeries{
+		{
+			Labels: []prompb.Label{
+				{Name: "status", Value: "200"}, {Name: "__name__", Value: "k6_http_reqs_total"}, {Name: "method", Value: "GET"},
+			},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}, {Value: 3, Timestamp: 2500}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_http_reqs_total"}, {Name: "url", Value: "/\"quoted\"\\"}},
+			Samples: []prompb.Sample{{Value: math.Inf(1), Timestamp: 2000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+			Samples: []prompb.Sample{{Value: 10, Timestamp: 2000}},
+		},
+		{
+			Labels:     []prompb.Label{{Name: "__name__", Value: "k6_http_req_duration"}},
+			Histograms: []prompb.Histogram{{Sum: 1, Timestamp: 2000}},
+		},
+	})
+
+	var b strings.Builder
+	require.NoError(t, e.writeTo(&b))
+	assert.Equal(t, `# TYPE k6_http_reqs_total unknown
+k6_http_reqs_total{method="GET",status="200"} 3 2.500
+k6_http_reqs_total{url="/\"quoted\"\\"} +Inf 2.000
+# TYPE k6_vus unknown
+k6_vus 10 2.000
+# EOF
+`, b.String())
+
+	// stale series are no longer exposed
+	e.update([]prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+		Samples: []prompb.Sample{{Value: math.Float64frombits(value.StaleNaN), Timestamp: 3000}},
+	}})
+	b.Reset()
+	require.NoError(t, e.writeTo(&b))
+	assert.NotContains(t, b.String(), "k6_vus")
+
+	require.NoError(t, e.listen("127.0.0.1:0"))
+	resp, err := http.Get("http://" + e.listener.Addr().String() + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, openMetricsContentType, resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), `k6_http_reqs_total{method="GET",status="200"} 3 2.500`)
+	require.NoError(t, e.close())
+
+	var disabled *exposition
+	disabled.update(nil)
+	assert.NoError(t, disabled.close())
+}
@@ -0,0 +1,123 @@
+package remotewrite
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/sirupsen/logrus"
+)
+
+// failoverClient sends requests to the first of its clients that is available:
+// after threshold consecutive recoverable errors from the active client, the
+// next one becomes active. While failed over, a request is sent to the primary
+// client every failbackInterval to check if it's available again.
+type failoverClient struct {
+	clients          []remote.WriteClient
+	threshold        int
+	failbackInterval time.Duration
+	logger           logrus.FieldLogger
+	now              func() time.Time
+
+	mu        sync.Mutex
+	active    int
+	failures  int
+	lastProbe time.Time
+}
+
+var _ remote.WriteClient = &failoverClient{}
+
+func newFailoverClient(
+	clients []remote.WriteClient, threshold int, failbackInterval time.Duration, logger logrus.FieldLogger,
+) *failoverClient {
+	return &failoverClient{
+		clients:          clients,
+		threshold:        threshold,
+		failbackInterval: failbackInterval,
+		logger:           logger,
+		now:              time.Now,
+	}
+}
+
+func (c *failoverClient) Name() string {
+	return c.clients[0].Name()
+}
+
+func (c *failoverClient) Endpoint() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clients[c.active].Endpoint()
+}
+
+// Close closes the clients of all the endpoints, not only the active one.
+func (c *failoverClient) Close() error {
+	return closeClients(c.clients)
+}
+
+func (c *failoverClient) Store(ctx context.Context, req []byte) error {
+	if c.shouldProbe() {
+		if err := c.clients[0].Store(ctx, req); err == nil {
+			c.failback()
+			return nil
+		}
+	}
+
+	c.mu.Lock()
+	active := c.active
+	c.mu.Unlock()
+
+	err := c.clients[active].Store(ctx, req)
+	c.observe(active, err)
+	return err
+}
+
+// shouldProbe returns true if the primary client has to be tried again.
+func (c *failoverClient) shouldProbe() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.active == 0 || c.now().Sub(c.lastProbe) < c.failbackInterval {
+		return false
+	}
+	c.lastProbe = c.now()
+	return true
+}
+
+func (c *failoverClient) failback() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.active != 0 {
+		c.logger.WithField("url", c.clients[0].Endpoint()).Info("Prometheus: primary endpoint available again, failing back")
+		c.active = 0
+		c.failures = 0
+	}
+}
+
+// observe counts the consecutive recoverable errors of the active client
+// and fails over to the next client when they reach the threshold.
+func (c *failoverClient) observe(active int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if active != c.active {
+		// another request already failed over
+		return
+	}
+	if err == nil || !isRecoverable(err) {
+		c.failures = 0
+		return
+	}
+
+	c.failures++
+	if c.failures < c.threshold || c.active == len(c.clients)-1 {
+		return
+	}
+
+	c.logger.WithError(err).WithField("url", c.clients[c.active+1].Endpoint()).
+		Warn("Prometheus: endpoint failed too many times, failing over")
+	c.active++
+	c.failures = 0
+	c.lastProbe = c.now()
+}
@@ -0,0 +1,85 @@
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeWriteClient struct {
+	mu    sync.Mutex
+	url   string
+	err   error
+	calls int
+}
+
+func (c *fakeWriteClient) Name() string     { return "fake" }
+func (c *fakeWriteClient) Endpoint() string { return c.url }
+
+func (c *fakeWriteClient) Store(context.Context, []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return c.err
+}
+
+func (c *fakeWriteClient) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func TestFailoverClient(t *testing.T) {
+	t.Parallel()
+
+	down := recoverableError{err: errors.New("503 Service Unavailable")}
+	primary := &fakeWriteClient{url: "primary", err: down}
+	secondary := &fakeWriteClient{url: "secondary"}
+
+	c := newFailoverClient([]remote.WriteClient{primary, secondary}, 2, time.Minute, logrus.New())
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	assert.Error(t, c.Store(ctx, nil))
+	assert.Equal(t, "primary", c.Endpoint())
+	assert.Error(t, c.Store(ctx, nil))
+	assert.Equal(t, "secondary", c.Endpoint())
+
+	require.NoError(t, c.Store(ctx, nil))
+	assert.Equal(t, 2, primary.calls)
+	assert.Equal(t, 1, secondary.calls)
+
+	// the primary is probed again only after the failback interval
+	now = now.Add(time.Minute)
+	require.NoError(t, c.Store(ctx, nil))
+	assert.Equal(t, 3, primary.calls)
+	assert.Equal(t, "secondary", c.Endpoint())
+
+	primary.setErr(nil)
+	require.NoError(t, c.Store(ctx, nil))
+	assert.Equal(t, 3, primary.calls)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, c.Store(ctx, nil))
+	assert.Equal(t, 4, primary.calls)
+	assert.Equal(t, "primary", c.Endpoint())
+}
+
+func TestFailoverClientNonRecoverable(t *testing.T) {
+	t.Parallel()
+
+	primary := &fakeWriteClient{url: "primary", err: errors.New("400 Bad Request")}
+	secondary := &fakeWriteClient{url: "secondary"}
+
+	c := newFailoverClient([]remote.WriteClient{primary, secondary}, 1, time.Minute, logrus.New())
+	assert.Error(t, c.Store(context.Background(), nil))
+	assert.Equal(t, "primary", c.Endpoint())
+}
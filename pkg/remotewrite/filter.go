@@ -0,0 +1,71 @@
+package remotewrite
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// metricFilter decides which k6 metrics are sent to the remote endpoint.
+type metricFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+
+	// decisions caches the result per metric name as the set of metrics is small
+	decisions map[string]bool
+}
+
+func newMetricFilter(include, exclude []string) (*metricFilter, error) {
+	f := &metricFilter{
+		decisions: make(map[string]bool),
+	}
+
+	var err error
+	if f.include, err = compileAnchored(include); err != nil {
+		return nil, fmt.Errorf("invalid metricsInclude: %w", err)
+	}
+	if f.exclude, err = compileAnchored(exclude); err != nil {
+		return nil, fmt.Errorf("invalid metricsExclude: %w", err)
+	}
+
+	return f, nil
+}
+
+// compileAnchored compiles the expressions so that they must match
+// the whole metric name, as Prometheus does in relabeling.
+func compileAnchored(exprs []string) ([]*regexp.Regexp, error) {
+	regexps := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, err
+		}
+		regexps = append(regexps, re)
+	}
+	return regexps, nil
+}
+
+// allow returns true if the metric must be sent: if there are include
+// expressions, the name must match at least one of them, and it must not
+// match any of the exclude expressions.
+func (f *metricFilter) allow(name string) bool {
+	if allowed, ok := f.decisions[name]; ok {
+		return allowed
+	}
+
+	allowed := len(f.include) == 0 || matchAny(f.include, name)
+	if allowed && matchAny(f.exclude, name) {
+		allowed = false
+	}
+
+	f.decisions[name] = allowed
+	return allowed
+}
+
+func matchAny(regexps []*regexp.Regexp, s string) bool {
+	for _, re := range regexps {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
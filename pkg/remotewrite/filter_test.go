@@ -0,0 +1,53 @@
+package remotewrite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricFilter(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		include, exclude []string
+		allowed          map[string]bool
+	}{
+		"no-filters": {
+			allowed: map[string]bool{"http_reqs": true, "vus": true},
+		},
+		"include": {
+			include: []string{"http_req_.*", "vus"},
+			allowed: map[string]bool{"http_req_duration": true, "vus": true, "vus_max": false, "http_reqs": false},
+		},
+		"exclude": {
+			exclude: []string{"data_.*", "vus_max"},
+			allowed: map[string]bool{"data_sent": false, "data_received": false, "vus_max": false, "vus": true},
+		},
+		"include-and-exclude": {
+			include: []string{"http_req_.*"},
+			exclude: []string{"http_req_(blocked|connecting)"},
+			allowed: map[string]bool{"http_req_duration": true, "http_req_blocked": false, "iterations": false},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := newMetricFilter(testCase.include, testCase.exclude)
+			require.NoError(t, err)
+
+			for metric, allowed := range testCase.allowed {
+				assert.Equal(t, allowed, f.allow(metric), metric)
+				// cached decision
+				assert.Equal(t, allowed, f.allow(metric), metric)
+			}
+		})
+	}
+
+	_, err := newMetricFilter([]string{"("}, nil)
+	assert.Contains(t, err.Error(), "invalid metricsInclude")
+}
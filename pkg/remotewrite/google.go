@@ -0,0 +1,56 @@
+package remotewrite
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// googleMonitoringScope allows writing to Google Cloud Managed Service for Prometheus.
+const googleMonitoringScope = "https://www.googleapis.com/auth/monitoring.write"
+
+// googleTokenSource gets the tokens of the Google application default credentials:
+// the file of GOOGLE_APPLICATION_CREDENTIALS, the credentials of gcloud or else the
+// service account of the instance, e.g. with the workload identity of GKE. They
+// are found on the first request and refreshed by the source of the credentials.
+type googleTokenSource struct {
+	client *http.Client
+
+	mu     sync.Mutex
+	source oauth2.TokenSource
+}
+
+func newGoogleTokenSource(client *http.Client) oauth2.TokenSource {
+	return &googleTokenSource{client: client}
+}
+
+func (s *googleTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.source == nil {
+		credentials, err := findGoogleCredentials(s.client)
+		if err != nil {
+			return nil, err
+		}
+		s.source = credentials.TokenSource
+	}
+	return s.source.Token()
+}
+
+// findGoogleCredentials returns the application default credentials, whose tokens
+// are fetched with the client.
+func findGoogleCredentials(client *http.Client) (*google.Credentials, error) {
+	ctx := context.Background()
+	if client != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+	}
+	credentials, err := google.FindDefaultCredentials(ctx, googleMonitoringScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the Google application default credentials: %w", err)
+	}
+	return credentials, nil
+}
@@ -0,0 +1,95 @@
+package remotewrite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+// grafanaCloudAPI is the API the stacks are looked up with, changed by the tests.
+var grafanaCloudAPI = "https://grafana.com/api"
+
+// grafanaCloudLookupTimeout bounds the lookup of the stack when the test starts.
+const grafanaCloudLookupTimeout = 10 * time.Second
+
+// grafanaCloudStack is the part of a Grafana Cloud stack describing its Prometheus instance.
+type grafanaCloudStack struct {
+	PromID  int64  `json:"hmInstancePromId"`
+	PromURL string `json:"hmInstancePromUrl"`
+}
+
+// resolveGrafanaCloud sets the options left unset from the Grafana Cloud stack of
+// GrafanaCloudStack: the push URL of its Prometheus instance, the ID of the instance
+// as the basic auth user and the API key as the password. The stack is looked up
+// with the API key, which needs the stacks:read scope for that.
+func resolveGrafanaCloud(ctx context.Context, config *Config) error {
+	slug := config.GrafanaCloudStack.String
+	if slug == "" || config.GrafanaCloudAPIKey.String == "" {
+		// a missing API key is reported by Validate
+		return nil
+	}
+	if config.Url.String == "" || !config.User.Valid {
+		stack, err := lookupGrafanaCloudStack(ctx, slug, config.GrafanaCloudAPIKey.String)
+		if err != nil {
+			return err
+		}
+		if config.Url.String == "" {
+			config.Url = null.StringFrom(presets["grafana-cloud"].withPath(stack.PromURL))
+		}
+		if !config.User.Valid {
+			config.User = null.StringFrom(strconv.FormatInt(stack.PromID, 10))
+		}
+	}
+	if !config.Password.Valid && !config.PasswordFile.Valid {
+		config.Password = config.GrafanaCloudAPIKey
+	}
+	return nil
+}
+
+func lookupGrafanaCloudStack(ctx context.Context, slug, apiKey string) (grafanaCloudStack, error) {
+	var stack grafanaCloudStack
+
+	ctx, cancel := context.WithTimeout(ctx, grafanaCloudLookupTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, grafanaCloudAPI+"/instances/"+url.PathEscape(slug), nil)
+	if err != nil {
+		return stack, err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return stack, fmt.Errorf("failed to look up the Grafana Cloud stack %q: %w", slug, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return stack, fmt.Errorf("failed to look up the Grafana Cloud stack %q: %w", slug, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return stack, fmt.Errorf("the API key can't look up the Grafana Cloud stack %q, "+
+			"it needs the stacks:read scope: %s", slug, resp.Status)
+	case resp.StatusCode == http.StatusNotFound:
+		return stack, fmt.Errorf("the Grafana Cloud stack %q doesn't exist, "+
+			"it's the first part of the URL of the stack, e.g. mystack for mystack.grafana.net", slug)
+	case resp.StatusCode/100 != 2:
+		return stack, fmt.Errorf("failed to look up the Grafana Cloud stack %q: %s", slug, resp.Status)
+	}
+
+	if err := json.Unmarshal(body, &stack); err != nil {
+		return stack, fmt.Errorf("invalid Grafana Cloud stack %q: %w", slug, err)
+	}
+	if stack.PromURL == "" || stack.PromID == 0 {
+		return stack, fmt.Errorf("the Grafana Cloud stack %q has no Prometheus instance", slug)
+	}
+	return stack, nil
+}
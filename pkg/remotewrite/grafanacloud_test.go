@@ -0,0 +1,64 @@
+package remotewrite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+// TestResolveGrafanaCloud can't run in parallel as it changes grafanaCloudAPI.
+func TestResolveGrafanaCloud(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer glc_key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/instances/mystack" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"slug":"mystack","hmInstancePromId":123456,` +
+			`"hmInstancePromUrl":"https://prometheus-prod-01-eu-west-0.grafana.net"}`))
+	}))
+	defer server.Close()
+
+	api := grafanaCloudAPI
+	grafanaCloudAPI = server.URL
+	defer func() { grafanaCloudAPI = api }()
+
+	env := map[string]string{
+		"K6_PROMETHEUS_GRAFANA_CLOUD_STACK":   "mystack",
+		"K6_PROMETHEUS_GRAFANA_CLOUD_API_KEY": "glc_key",
+	}
+	config, err := GetConsolidatedConfig(nil, env, "")
+	require.NoError(t, err)
+	assert.Equal(t, "grafana-cloud", config.Preset.String)
+	assert.Equal(t, null.IntFrom(2048), config.MaxLabelValueLength)
+
+	require.NoError(t, resolveGrafanaCloud(context.Background(), &config))
+	assert.Equal(t, "https://prometheus-prod-01-eu-west-0.grafana.net/api/prom/push", config.Url.String)
+	assert.Equal(t, null.StringFrom("123456"), config.User)
+	assert.Equal(t, null.StringFrom("glc_key"), config.Password)
+	assert.NoError(t, config.Validate())
+
+	// the options set explicitly are kept
+	config, err = GetConsolidatedConfig(nil, env, "url=https://proxy.example.com/push,user=admin")
+	require.NoError(t, err)
+	require.NoError(t, resolveGrafanaCloud(context.Background(), &config))
+	assert.Equal(t, "https://proxy.example.com/push", config.Url.String)
+	assert.Equal(t, null.StringFrom("admin"), config.User)
+
+	config.Url = null.NewString("", true)
+	config.GrafanaCloudStack = null.StringFrom("other")
+	assert.ErrorContains(t, resolveGrafanaCloud(context.Background(), &config),
+		`the Grafana Cloud stack "other" doesn't exist`)
+
+	config.GrafanaCloudStack = null.StringFrom("mystack")
+	config.GrafanaCloudAPIKey = null.StringFrom("glc_other")
+	assert.ErrorContains(t, resolveGrafanaCloud(context.Background(), &config), "it needs the stacks:read scope")
+}
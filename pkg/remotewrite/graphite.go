@@ -0,0 +1,176 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+)
+
+// isGraphiteURL returns true if the URL is the graphite://host:port address of a carbon plaintext listener.
+func isGraphiteURL(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "graphite://")
+}
+
+// graphitePathReplacer makes label values valid nodes of a dotted path.
+var graphitePathReplacer = strings.NewReplacer(".", "_", " ", "_", "/", "_", ";", "_")
+
+// graphiteTagReplacer makes label values valid tag values, which can't contain
+// a semicolon, nor a space as it separates the fields of a line.
+var graphiteTagReplacer = strings.NewReplacer(" ", "_", ";", "_")
+
+// marshalGraphite marshals the time series in the Graphite plaintext protocol
+// (https://graphite.readthedocs.io/en/latest/feeding-carbon.html), one line per
+// sample with a timestamp in seconds. The labels are sent as tags if tagged,
+// which needs Graphite 1.1 or go-carbon, or as nodes of the path otherwise:
+//
+//	k6_vus;scenario=default;test_run_id=... 10 1700000000
+//	k6_vus.scenario.default.test_run_id.... 10 1700000000
+//
+// Native histograms and exemplars are not supported by the protocol, and the
+// samples that are not finite, stale markers included, can't be represented.
+func marshalGraphite(series []prompb.TimeSeries, tagged bool) []byte {
+	var (
+		buf bytes.Buffer
+		num []byte
+	)
+	for _, ts := range series {
+		var (
+			name   string
+			labels = make([]prompb.Label, 0, len(ts.Labels))
+		)
+		for _, l := range ts.Labels {
+			switch {
+			case l.Name == "__name__":
+				name = l.Value
+			case l.Value != "":
+				labels = append(labels, l)
+			}
+		}
+		if name == "" {
+			continue
+		}
+		// the same labels always give the same path
+		sort.Slice(labels, func(i, j int) bool {
+			return labels[i].Name < labels[j].Name
+		})
+
+		var path strings.Builder
+		path.WriteString(name)
+		for _, l := range labels {
+			if tagged {
+				path.WriteByte(';')
+				path.WriteString(l.Name)
+				path.WriteByte('=')
+				path.WriteString(strings.TrimLeft(graphiteTagReplacer.Replace(l.Value), "~"))
+			} else {
+				path.WriteByte('.')
+				path.WriteString(l.Name)
+				path.WriteByte('.')
+				path.WriteString(graphitePathReplacer.Replace(l.Value))
+			}
+		}
+
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			buf.WriteString(path.String())
+			buf.WriteByte(' ')
+			num = strconv.AppendFloat(num[:0], s.Value, 'g', -1, 64)
+			buf.Write(num)
+			buf.WriteByte(' ')
+			num = strconv.AppendInt(num[:0], s.Timestamp/1000, 10)
+			buf.Write(num)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// graphiteClient writes the encoded requests to a carbon plaintext listener over TCP.
+// The connection is kept open between requests and established again after a failure.
+// It is safe for concurrent use.
+type graphiteClient struct {
+	name    string
+	addr    string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+var _ remote.WriteClient = &graphiteClient{}
+
+func newGraphiteClient(name string, conf *remote.ClientConfig) *graphiteClient {
+	return &graphiteClient{
+		name:    name,
+		addr:    conf.URL.Host,
+		timeout: time.Duration(conf.Timeout),
+	}
+}
+
+func (c *graphiteClient) Name() string {
+	return c.name
+}
+
+func (c *graphiteClient) Endpoint() string {
+	return "graphite://" + c.addr
+}
+
+// Store writes the encoded request. As the plaintext protocol has no response,
+// all the errors are network ones and are recoverable.
+func (c *graphiteClient) Store(ctx context.Context, req []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		dialer := net.Dialer{Timeout: c.timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+		if err != nil {
+			return recoverableError{err: err}
+		}
+		c.conn = conn
+	}
+
+	deadline := time.Time{}
+	if c.timeout > 0 {
+		deadline = time.Now().Add(c.timeout)
+	}
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return c.fail(err)
+	}
+	if _, err := c.conn.Write(req); err != nil {
+		return c.fail(err)
+	}
+	return nil
+}
+
+// fail closes the connection after an error. Part of the request may have been
+// written: the retry sends it again entirely and carbon keeps the last value of a point.
+func (c *graphiteClient) fail(err error) error {
+	_ = c.conn.Close()
+	c.conn = nil
+	return recoverableError{err: err}
+}
+
+// Close closes the connection to the listener.
+func (c *graphiteClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
@@ -0,0 +1,102 @@
+package remotewrite
+
+import (
+	"bufio"
+	"context"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestMarshalGraphite(t *testing.T) {
+	t.Parallel()
+
+	series := []prompb.TimeSeries{
+		{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: "k6_http_reqs"},
+				{Name: "url", Value: "https://test.k6.io/my page"},
+				{Name: "scenario", Value: "~default"},
+				{Name: "expected_response", Value: ""},
+			},
+			Samples: []prompb.Sample{{Value: 10, Timestamp: 1000}, {Value: 0.5, Timestamp: 2500}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_stale"}},
+			Samples: []prompb.Sample{{Value: math.Float64frombits(value.StaleNaN), Timestamp: 3000}},
+		},
+	}
+
+	assert.Equal(t,
+		"k6_http_reqs;scenario=default;url=https://test.k6.io/my_page 10 1\n"+
+			"k6_http_reqs;scenario=default;url=https://test.k6.io/my_page 0.5 2\n",
+		string(marshalGraphite(series, true)))
+	assert.Equal(t,
+		"k6_http_reqs.scenario.~default.url.https:__test_k6_io_my_page 10 1\n"+
+			"k6_http_reqs.scenario.~default.url.https:__test_k6_io_my_page 0.5 2\n",
+		string(marshalGraphite(series, false)))
+}
+
+func TestGraphiteClient(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	lines := make(chan string)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+
+	config := NewConfig()
+	config.Url = null.StringFrom("graphite://" + listener.Addr().String())
+	require.NoError(t, config.Validate())
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+
+	client, err := newClient("test", remoteConfig, protocolGraphiteTagged, config, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "graphite://"+listener.Addr().String(), client.Endpoint())
+
+	require.NoError(t, client.Store(context.Background(), []byte("k6_vus 1 1\n")))
+	assert.Equal(t, "k6_vus 1 1", <-lines)
+
+	// reconnects after the connection is closed
+	require.NoError(t, client.(*graphiteClient).Close())
+	require.NoError(t, client.Store(context.Background(), []byte("k6_vus 2 2\n")))
+	assert.Equal(t, "k6_vus 2 2", <-lines)
+
+	require.NoError(t, listener.Close())
+	require.NoError(t, client.(*graphiteClient).Close())
+	err = client.Store(context.Background(), []byte("k6_vus 3 3\n"))
+	assert.True(t, isRecoverable(err))
+
+	config.Compression = null.StringFrom("gzip")
+	config.Protocol = null.StringFrom("otlp")
+	var validationErr *ValidationError
+	require.ErrorAs(t, config.Validate(), &validationErr)
+	assert.Equal(t, []string{
+		"the protocol is set by graphite:// URLs, unset protocol and protocolVersion",
+		`compression "gzip" isn't supported by Graphite, unset it`,
+	}, validationErr.Problems)
+}
@@ -0,0 +1,219 @@
+package remotewrite
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	promConfig "github.com/prometheus/common/config"
+	"github.com/prometheus/prometheus/storage/remote"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// defaultGRPCMethod is the method of the Thanos Receive gRPC write API, whose
+// request has the time series in the same field as a remote write 1.0 request.
+const defaultGRPCMethod = "/thanos.WriteableStore/Write"
+
+// isGRPCURL returns true if the URL uses the grpc:// or grpcs:// (gRPC over TLS) scheme.
+func isGRPCURL(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "grpc://") || strings.HasPrefix(rawURL, "grpcs://")
+}
+
+// grpcClient sends remote write 1.0 requests as the request message of a unary
+// gRPC method, given by the path of the URL. The request isn't compressed by
+// the output: gRPC compresses the messages itself, with gzip if it's enabled.
+type grpcClient struct {
+	name             string
+	endpoint         string
+	method           string
+	conn             *grpc.ClientConn
+	timeout          time.Duration
+	headers          metadata.MD
+	auth             *promConfig.HTTPClientConfig
+	retryOnRateLimit bool
+}
+
+var _ remote.WriteClient = &grpcClient{}
+
+// newGRPCClient returns a client for the gRPC endpoint. The connection is established lazily.
+func newGRPCClient(name string, conf *remote.ClientConfig, c compression) (*grpcClient, error) {
+	u := conf.URL.URL
+
+	creds := insecure.NewCredentials()
+	if u.Scheme == "grpcs" {
+		tlsConfig, err := promConfig.NewTLSConfig(&conf.HTTPClientConfig.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	callOptions := []grpc.CallOption{grpc.ForceCodec(rawCodec{})}
+	if c == compressionGzip {
+		callOptions = append(callOptions, grpc.UseCompressor(gzip.Name))
+	}
+
+	conn, err := grpc.Dial(u.Host,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(callOptions...),
+		grpc.WithUserAgent(remote.UserAgent),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	method := u.Path
+	if method == "" || method == "/" {
+		method = defaultGRPCMethod
+	}
+
+	headers := metadata.MD{}
+	for k, v := range conf.Headers {
+		headers.Set(k, v)
+	}
+
+	return &grpcClient{
+		name:             name,
+		endpoint:         (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: method}).String(),
+		method:           method,
+		conn:             conn,
+		timeout:          time.Duration(conf.Timeout),
+		headers:          headers,
+		auth:             &conf.HTTPClientConfig,
+		retryOnRateLimit: conf.RetryOnRateLimit,
+	}, nil
+}
+
+func (c *grpcClient) Name() string {
+	return c.name
+}
+
+// Endpoint returns the URL of the endpoint without the credentials it may embed.
+func (c *grpcClient) Endpoint() string {
+	return c.endpoint
+}
+
+// Close closes the connection to the endpoint.
+func (c *grpcClient) Close() error {
+	return c.conn.Close()
+}
+
+// Store sends the encoded request. Like with HTTP, failures that may be temporary
+// and, if enabled, rate limiting are returned as recoverable errors.
+func (c *grpcClient) Store(ctx context.Context, req []byte) error {
+	headers := c.headers
+	authorization, err := c.authorization()
+	if err != nil {
+		return err
+	}
+	if authorization != "" {
+		headers = headers.Copy()
+		headers.Set("authorization", authorization)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, headers)
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var resp []byte
+	err = c.conn.Invoke(ctx, c.method, req, &resp)
+	if err == nil {
+		return nil
+	}
+
+	s := status.Convert(err)
+	err = &grpcStatusError{status: s}
+	switch s.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.Internal, codes.Unknown:
+		return recoverableError{err: err}
+	case codes.ResourceExhausted:
+		if c.retryOnRateLimit {
+			return recoverableError{err: err}
+		}
+	}
+	return err
+}
+
+// authorization returns the value of the authorization header for the configured
+// credentials, read again from their file for each request as they may be rotated.
+func (c *grpcClient) authorization() (string, error) {
+	switch {
+	case c.auth.Authorization != nil:
+		token := string(c.auth.Authorization.Credentials)
+		if c.auth.Authorization.CredentialsFile != "" {
+			b, err := os.ReadFile(c.auth.Authorization.CredentialsFile)
+			if err != nil {
+				return "", fmt.Errorf("unable to read authorization credentials file %s: %w",
+					c.auth.Authorization.CredentialsFile, err)
+			}
+			token = strings.TrimSpace(string(b))
+		}
+		return c.auth.Authorization.Type + " " + token, nil
+	case c.auth.BasicAuth != nil:
+		userPass := c.auth.BasicAuth.Username + ":" + string(c.auth.BasicAuth.Password)
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(userPass)), nil
+	default:
+		return "", nil
+	}
+}
+
+// grpcStatusError is returned when the endpoint responds with a gRPC status other than OK.
+type grpcStatusError struct {
+	status *status.Status
+}
+
+func (e *grpcStatusError) Error() string {
+	return fmt.Sprintf("server returned gRPC status %s: %s", e.status.Code(), e.status.Message())
+}
+
+// class returns the class of the error, as for the equivalent HTTP statuses.
+func (e *grpcStatusError) class() errorClass {
+	switch e.status.Code() {
+	case codes.ResourceExhausted:
+		return errorClassRateLimited
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return errorClassNetwork
+	case codes.Internal, codes.Unknown, codes.Aborted, codes.DataLoss:
+		return errorClassServer
+	default:
+		return errorClassClient
+	}
+}
+
+// rawCodec passes the already marshaled requests, and the responses, as they are.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+// Name is the content subtype of the messages, they are protobuf.
+func (rawCodec) Name() string {
+	return "proto"
+}
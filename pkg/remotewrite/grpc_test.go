@@ -0,0 +1,162 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/output"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestGRPCClientStore(t *testing.T) {
+	t.Parallel()
+
+	var (
+		method  string
+		body    []byte
+		headers metadata.MD
+		code    = codes.OK
+	)
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			method, _ = grpc.MethodFromServerStream(stream)
+			headers, _ = metadata.FromIncomingContext(stream.Context())
+			if err := stream.RecvMsg(&body); err != nil {
+				return err
+			}
+			if code != codes.OK {
+				return status.Error(code, "failed")
+			}
+			return stream.SendMsg([]byte{})
+		}),
+	)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	config := NewConfig()
+	config.Url = null.StringFrom("grpc://" + listener.Addr().String())
+	config.BearerToken = null.StringFrom("token")
+	config.TenantID = null.StringFrom("tenant")
+	require.NoError(t, config.Validate())
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newClient("test", remoteConfig, protocolV1, config, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "grpc://"+listener.Addr().String()+defaultGRPCMethod, client.Endpoint())
+
+	encoded, err := new(encodeBuffers).encode([]prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}, protocolV1, compressionNone)
+	require.NoError(t, err)
+
+	require.NoError(t, client.Store(context.Background(), encoded))
+	assert.Equal(t, defaultGRPCMethod, method)
+	assert.Equal(t, encoded, body)
+	assert.Equal(t, []string{"Bearer token"}, headers.Get("authorization"))
+	assert.Equal(t, []string{"tenant"}, headers.Get(tenantHeader))
+
+	testCases := map[codes.Code]struct {
+		recoverable bool
+		class       errorClass
+	}{
+		codes.InvalidArgument:   {false, errorClassClient},
+		codes.ResourceExhausted: {true, errorClassRateLimited},
+		codes.Internal:          {true, errorClassServer},
+		codes.Unavailable:       {true, errorClassNetwork},
+	}
+	for c, tc := range testCases {
+		code = c
+		err := client.Store(context.Background(), encoded)
+		require.Error(t, err)
+		assert.Equal(t, tc.recoverable, isRecoverable(err), c)
+		assert.Equal(t, tc.class, classifyError(err), c)
+	}
+}
+
+func TestOutputStopClosesGRPCEndpoints(t *testing.T) {
+	t.Parallel()
+
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			var body []byte
+			if err := stream.RecvMsg(&body); err != nil {
+				return err
+			}
+			return stream.SendMsg([]byte{})
+		}),
+	)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+	url := "grpc://" + listener.Addr().String()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	o, err := New(output.Params{
+		Logger: logger,
+		Environment: map[string]string{
+			"K6_PROMETHEUS_REMOTE_URL":    url,
+			"K6_PROMETHEUS_FAILOVER_URLS": url,
+			"K6_PROMETHEUS_MIRROR_URLS":   url,
+			"K6_PROMETHEUS_TEST_RUN_ID":   "",
+		},
+	})
+	require.NoError(t, err)
+
+	mirror, ok := o.client.(*mirrorClient)
+	require.True(t, ok)
+	failover, ok := mirror.clients[0].(*failoverClient)
+	require.True(t, ok)
+	conns := []*grpc.ClientConn{
+		failover.clients[0].(*grpcClient).conn,
+		failover.clients[1].(*grpcClient).conn,
+		mirror.clients[1].(*grpcClient).conn,
+	}
+
+	require.NoError(t, o.Start())
+	require.NoError(t, o.Stop())
+	for _, conn := range conns {
+		assert.Equal(t, connectivity.Shutdown, conn.GetState())
+	}
+}
+
+func TestValidateGRPC(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.Url = null.StringFrom("grpc://localhost:10901")
+	config.MirrorUrls = []string{"http://localhost:9090/api/v1/write"}
+	config.ProtocolVersion = null.StringFrom("2.0")
+	config.Compression = null.StringFrom("snappy")
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, config.Validate(), &validationErr)
+	assert.Equal(t, []string{
+		`"http://localhost:9090/api/v1/write" can't be used with url "grpc://localhost:10901": ` +
+			`all the endpoints must use gRPC`,
+		"only the remote write 1.0 protocol can be sent over gRPC, unset protocol and protocolVersion",
+		`compression "snappy" isn't supported over gRPC, it must be gzip or none`,
+	}, validationErr.Problems)
+}
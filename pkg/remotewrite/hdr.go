@@ -0,0 +1,141 @@
+package remotewrite
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	// hdrSubBucketBits is the number of bits of the sub-buckets: each power of
+	// two above 2^(hdrSubBucketBits+1) is divided into 128 buckets, so that the
+	// width of a bucket is less than 1% of its bounds.
+	hdrSubBucketBits = 7
+
+	// hdrHighestTrackable is the highest value counted in a bucket, the values
+	// above are counted only in the +Inf one.
+	hdrHighestTrackable = 1 << 30
+)
+
+// HDRHistogramMapping works as HistogramMapping except that the buckets of Trend
+// metrics are those of the HDR histograms of the k6 cloud output: the values are
+// rounded up to the next integer, counted as is up to 255 and then in 128 buckets
+// per power of two. Only the buckets with values are sent, so that the series are
+// comparable with those of Grafana Cloud k6 without sending thousands of buckets.
+type HDRHistogramMapping struct {
+	PrometheusMapping
+}
+
+func (hm *HDRHistogramMapping) MapTrend(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+	metric := ms.UpdateWithSink(sample, labels, func(metrics.MetricType) metrics.Sink {
+		return newHDRHistogramSink()
+	}, nil)
+
+	h := metric.Sink.(*hdrHistogramSink)
+	ts := ms.Timestamp(sample, labels)
+	name := sample.Metric.Name
+
+	indexes := make([]int, 0, len(h.buckets))
+	for i := range h.buckets {
+		indexes = append(indexes, int(i))
+	}
+	sort.Ints(indexes)
+
+	series := make([]prompb.TimeSeries, 0, len(indexes)+3)
+	var cumulative uint64
+	for _, i := range indexes {
+		cumulative += h.buckets[uint32(i)]
+		series = append(series, histogramBucket(labels, name, formatBound(hdrBucketUpperBound(uint32(i))), float64(cumulative), ts))
+	}
+	series = append(series,
+		histogramBucket(labels, name, "+Inf", float64(h.count), ts),
+		prompb.TimeSeries{
+			Labels: append(labels, prompb.Label{
+				Name:  "__name__",
+				Value: name + "_sum",
+			}),
+			Samples: []prompb.Sample{
+				{
+					Value:     h.sum,
+					Timestamp: ts,
+				},
+			},
+		},
+		prompb.TimeSeries{
+			Labels: append(labels, prompb.Label{
+				Name:  "__name__",
+				Value: name + "_count",
+			}),
+			Samples: []prompb.Sample{
+				{
+					Value:     float64(h.count),
+					Timestamp: ts,
+				},
+			},
+		},
+	)
+
+	return series
+}
+
+// hdrBucketIndex returns the index of the bucket of the value v, as the k6 cloud output
+// does: see https://github.com/openhistogram/libcircllhist for the reference implementation.
+func hdrBucketIndex(v float64) uint32 {
+	if v <= 0 {
+		return 0
+	}
+	// the values are rounded up so that the fractional ones fall in a bucket
+	upscaled := uint32(math.Ceil(v))
+	if upscaled < 1<<(hdrSubBucketBits+1) {
+		return upscaled
+	}
+
+	// n-k, where n is the position of the most significant bit and k hdrSubBucketBits
+	nkdiff := uint32(bits.Len32(upscaled>>hdrSubBucketBits) - 1)
+	return nkdiff<<hdrSubBucketBits + upscaled>>nkdiff
+}
+
+// hdrBucketUpperBound returns the highest value counted in bucket i.
+func hdrBucketUpperBound(i uint32) float64 {
+	if i < 1<<(hdrSubBucketBits+1) {
+		return float64(i)
+	}
+	nkdiff := i>>hdrSubBucketBits - 1
+	sub := i - nkdiff<<hdrSubBucketBits
+	return float64((uint64(sub)+1)<<nkdiff - 1)
+}
+
+// hdrHistogramSink is a metrics.Sink counting values in the buckets of hdrBucketIndex.
+type hdrHistogramSink struct {
+	buckets map[uint32]uint64
+	count   uint64
+	sum     float64
+}
+
+var _ metrics.Sink = &hdrHistogramSink{}
+
+func newHDRHistogramSink() *hdrHistogramSink {
+	return &hdrHistogramSink{buckets: make(map[uint32]uint64)}
+}
+
+func (h *hdrHistogramSink) Add(s metrics.Sample) {
+	if math.IsNaN(s.Value) {
+		return
+	}
+
+	h.count++
+	h.sum += s.Value
+	if s.Value <= hdrHighestTrackable {
+		h.buckets[hdrBucketIndex(s.Value)]++
+	}
+}
+
+func (h *hdrHistogramSink) Calc() {}
+
+func (h *hdrHistogramSink) Format(time.Duration) map[string]float64 {
+	return map[string]float64{"count": float64(h.count), "sum": h.sum}
+}
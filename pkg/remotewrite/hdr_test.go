@@ -0,0 +1,71 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestHDRBucketIndex(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		value float64
+		index uint32
+		upper float64
+	}{
+		{-1, 0, 0},
+		{0, 0, 0},
+		{0.3, 1, 1},
+		{255, 255, 255},
+		{256, 256, 257},
+		{257, 256, 257},
+		{258, 257, 259},
+		{511, 383, 511},
+		{512, 384, 515},
+		{1 << 20, 1792, 1<<20 + 1<<13 - 1},
+	} {
+		index := hdrBucketIndex(tc.value)
+		assert.Equal(t, tc.index, index, "index of %v", tc.value)
+		assert.Equal(t, tc.upper, hdrBucketUpperBound(index), "upper bound of %v", tc.value)
+	}
+}
+
+func TestHDRHistogramMappingTrend(t *testing.T) {
+	t.Parallel()
+
+	ms := newMetricsStorage()
+	mapping := NewMapping(Config{Mapping: null.StringFrom("hdr-histogram")})
+	metric := &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend}
+	now := time.Now()
+
+	var ts []prompb.TimeSeries
+	for _, v := range []float64{10.2, 11, 300, 2e9} {
+		ts = mapping.MapTrend(ms, metrics.Sample{Metric: metric, Value: v, Time: now}, nil)
+	}
+
+	expected := []struct {
+		name, le string
+		value    float64
+	}{
+		{"http_req_duration_bucket", "11", 2},
+		{"http_req_duration_bucket", "301", 3},
+		{"http_req_duration_bucket", "+Inf", 4},
+		{"http_req_duration_sum", "", 2e9 + 321.2},
+		{"http_req_duration_count", "", 4},
+	}
+
+	require.Len(t, ts, len(expected))
+	for i, e := range expected {
+		assert.Equal(t, e.name, ts[i].Labels[labelIndex(ts[i].Labels, "__name__")].Value)
+		if e.le != "" {
+			assert.Equal(t, e.le, ts[i].Labels[labelIndex(ts[i].Labels, "le")].Value)
+		}
+		assert.InDelta(t, e.value, ts[i].Samples[0].Value, 1e-6)
+	}
+}
@@ -0,0 +1,64 @@
+package remotewrite
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+const (
+	heartbeatMetric = "up"
+	instanceLabel   = "instance"
+	hostnameLabel   = "hostname"
+)
+
+// heartbeat is the series telling that a load generator is alive: alerting rules
+// can detect one that stops reporting in the middle of a distributed test with
+// absent_over_time(k6_up[1m]), while one that ended the test sends 0.
+type heartbeat struct {
+	instance string
+	hostname string
+}
+
+// newHeartbeat returns a heartbeat labeled with the instance, the hostname if empty.
+func newHeartbeat(instance string) (*heartbeat, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the hostname for the heartbeat: %w", err)
+	}
+	if instance == "" {
+		instance = hostname
+	}
+	return &heartbeat{instance: instance, hostname: hostname}, nil
+}
+
+// timeSeries returns the prefix+"up" series with the value, and the labels
+// of the heartbeat added to the given ones unless they are already set.
+func (h *heartbeat) timeSeries(now time.Time, value float64, labels []prompb.Label, prefix string) []prompb.TimeSeries {
+	if h == nil {
+		return nil
+	}
+	if !hasLabel(labels, instanceLabel) {
+		labels = append(labels, prompb.Label{Name: instanceLabel, Value: h.instance})
+	}
+	if !hasLabel(labels, hostnameLabel) {
+		labels = append(labels, prompb.Label{Name: hostnameLabel, Value: h.hostname})
+	}
+	return []prompb.TimeSeries{
+		{
+			Labels: append(labels, prompb.Label{
+				Name:  "__name__",
+				Value: prefix + heartbeatMetric,
+			}),
+			Samples: []prompb.Sample{
+				{
+					Value:     value,
+					Timestamp: timestamp.FromTime(now),
+				},
+			},
+		},
+	}
+}
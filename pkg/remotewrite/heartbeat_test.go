@@ -0,0 +1,45 @@
+package remotewrite
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeartbeatTimeSeries(t *testing.T) {
+	t.Parallel()
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	h, err := newHeartbeat("")
+	require.NoError(t, err)
+	now := time.UnixMilli(1000)
+	assert.Equal(t, []prompb.TimeSeries{{
+		Labels: []prompb.Label{
+			{Name: "test_run_id", Value: "1234"},
+			{Name: "instance", Value: hostname},
+			{Name: "hostname", Value: hostname},
+			{Name: "__name__", Value: "k6_up"},
+		},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+	}}, h.timeSeries(now, 1, []prompb.Label{{Name: "test_run_id", Value: "1234"}}, "k6_"))
+
+	// the instance can be set, as the static label of the same name
+	h, err = newHeartbeat("generator-1")
+	require.NoError(t, err)
+	ts := h.timeSeries(now, 0, nil, "k6_")
+	require.Len(t, ts, 1)
+	assert.Equal(t, "generator-1", ts[0].Labels[labelIndex(ts[0].Labels, "instance")].Value)
+	assert.Equal(t, float64(0), ts[0].Samples[0].Value)
+
+	ts = h.timeSeries(now, 1, []prompb.Label{{Name: "instance", Value: "static"}}, "k6_")
+	assert.Equal(t, "static", ts[0].Labels[labelIndex(ts[0].Labels, "instance")].Value)
+
+	var disabled *heartbeat
+	assert.Nil(t, disabled.timeSeries(now, 1, nil, "k6_"))
+}
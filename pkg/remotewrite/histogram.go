@@ -0,0 +1,157 @@
+package remotewrite
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"go.k6.io/k6/metrics"
+)
+
+// defaultTrendBuckets are used for Trend metrics without configured buckets.
+// Most of k6 builtin Trend metrics are durations in milliseconds.
+var defaultTrendBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// HistogramMapping works as PrometheusMapping except for Trend metrics:
+// those are mapped to classic Prometheus histograms, i.e. to cumulative
+// `_bucket`, `_sum` and `_count` series, so histogram_quantile() can be used.
+type HistogramMapping struct {
+	PrometheusMapping
+
+	buckets map[string][]float64
+}
+
+// NewHistogramMapping returns a HistogramMapping with the given
+// bucket boundaries per Trend metric name.
+func NewHistogramMapping(buckets map[string][]float64) *HistogramMapping {
+	hm := &HistogramMapping{
+		buckets: make(map[string][]float64, len(buckets)),
+	}
+	for name, b := range buckets {
+		bounds := make([]float64, 0, len(b))
+		for _, bound := range b {
+			// the +Inf bucket is always added
+			if !math.IsInf(bound, +1) {
+				bounds = append(bounds, bound)
+			}
+		}
+		sort.Float64s(bounds)
+		hm.buckets[name] = bounds
+	}
+	return hm
+}
+
+func (hm *HistogramMapping) MapTrend(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+	metric := ms.UpdateWithSink(sample, labels, func(metrics.MetricType) metrics.Sink {
+		bounds, ok := hm.buckets[sample.Metric.Name]
+		if !ok {
+			bounds = defaultTrendBuckets
+		}
+		return newHistogramSink(bounds)
+	}, nil)
+
+	h := metric.Sink.(*histogramSink)
+	ts := ms.Timestamp(sample, labels)
+	name := sample.Metric.Name
+
+	series := make([]prompb.TimeSeries, 0, len(h.bounds)+3)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		series = append(series, histogramBucket(labels, name, formatBound(bound), float64(cumulative), ts))
+	}
+	series = append(series,
+		histogramBucket(labels, name, "+Inf", float64(h.count), ts),
+		prompb.TimeSeries{
+			Labels: append(labels, prompb.Label{
+				Name:  "__name__",
+				Value: name + "_sum",
+			}),
+			Samples: []prompb.Sample{
+				{
+					Value:     h.sum,
+					Timestamp: ts,
+				},
+			},
+		},
+		prompb.TimeSeries{
+			Labels: append(labels, prompb.Label{
+				Name:  "__name__",
+				Value: name + "_count",
+			}),
+			Samples: []prompb.Sample{
+				{
+					Value:     float64(h.count),
+					Timestamp: ts,
+				},
+			},
+		},
+	)
+
+	return series
+}
+
+func histogramBucket(labels []prompb.Label, name, le string, value float64, ts int64) prompb.TimeSeries {
+	return prompb.TimeSeries{
+		Labels: append(labels,
+			prompb.Label{
+				Name:  "le",
+				Value: le,
+			},
+			prompb.Label{
+				Name:  "__name__",
+				Value: name + "_bucket",
+			},
+		),
+		Samples: []prompb.Sample{
+			{
+				Value:     value,
+				Timestamp: ts,
+			},
+		},
+	}
+}
+
+func formatBound(bound float64) string {
+	if math.IsInf(bound, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(bound, 'f', -1, 64)
+}
+
+// histogramSink is a metrics.Sink counting values in fixed buckets.
+// counts are not cumulative: counts[i] is the number of values
+// in (bounds[i-1], bounds[i]].
+type histogramSink struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+var _ metrics.Sink = &histogramSink{}
+
+func newHistogramSink(bounds []float64) *histogramSink {
+	return &histogramSink{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+}
+
+func (h *histogramSink) Add(s metrics.Sample) {
+	h.count++
+	h.sum += s.Value
+
+	i := sort.SearchFloat64s(h.bounds, s.Value)
+	if i < len(h.bounds) {
+		h.counts[i]++
+	}
+}
+
+func (h *histogramSink) Calc() {}
+
+func (h *histogramSink) Format(time.Duration) map[string]float64 {
+	return map[string]float64{"count": float64(h.count), "sum": h.sum}
+}
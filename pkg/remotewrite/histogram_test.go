@@ -0,0 +1,70 @@
+package remotewrite
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestHistogramMappingTrend(t *testing.T) {
+	t.Parallel()
+
+	ms := newMetricsStorage()
+	mapping := NewMapping(Config{
+		Mapping: null.StringFrom("histogram"),
+		TrendBuckets: map[string][]float64{
+			"http_req_duration": {250, 100, math.Inf(+1), 50},
+		},
+	})
+	metric := &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend}
+	labels := []prompb.Label{{Name: "method", Value: "GET"}}
+	now := time.Now()
+
+	var ts []prompb.TimeSeries
+	for _, v := range []float64{10, 50, 70, 300, 260} {
+		ts = mapping.MapTrend(ms, metrics.Sample{Metric: metric, Value: v, Time: now}, labels[:1:1])
+	}
+
+	expected := []struct {
+		name, le string
+		value    float64
+	}{
+		{"http_req_duration_bucket", "50", 2},
+		{"http_req_duration_bucket", "100", 3},
+		{"http_req_duration_bucket", "250", 3},
+		{"http_req_duration_bucket", "+Inf", 5},
+		{"http_req_duration_sum", "", 690},
+		{"http_req_duration_count", "", 5},
+	}
+
+	require.Len(t, ts, len(expected))
+	for i, e := range expected {
+		wantLabels := []prompb.Label{{Name: "method", Value: "GET"}}
+		if e.le != "" {
+			wantLabels = append(wantLabels, prompb.Label{Name: "le", Value: e.le})
+		}
+		wantLabels = append(wantLabels, prompb.Label{Name: "__name__", Value: e.name})
+
+		assert.Equal(t, wantLabels, ts[i].Labels)
+		require.Len(t, ts[i].Samples, 1)
+		assert.Equal(t, e.value, ts[i].Samples[0].Value)
+		assert.Equal(t, now.UnixMilli(), ts[i].Samples[0].Timestamp)
+	}
+}
+
+func TestHistogramMappingDefaultBuckets(t *testing.T) {
+	t.Parallel()
+
+	ms := newMetricsStorage()
+	mapping := NewHistogramMapping(nil)
+	metric := &metrics.Metric{Name: "iteration_duration", Type: metrics.Trend}
+
+	ts := mapping.MapTrend(ms, metrics.Sample{Metric: metric, Value: 1, Time: time.Now()}, nil)
+	assert.Len(t, ts, len(defaultTrendBuckets)+3)
+}
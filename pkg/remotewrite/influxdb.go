@@ -0,0 +1,81 @@
+package remotewrite
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// influxTokenScheme is the scheme of the Authorization header of the InfluxDB 2.x API.
+const influxTokenScheme = "Token"
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	influxTagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+)
+
+// marshalInfluxLineProtocol marshals the time series in the InfluxDB line protocol
+// (https://docs.influxdata.com/influxdb/v2/reference/syntax/line-protocol/),
+// one line per sample, with the metric name as measurement, the other labels as
+// tags and the value as the value field, timestamped in milliseconds:
+//
+//	k6_vus,test_run_id=... value=10 1700000000000
+//
+// Native histograms and exemplars are not supported by the format, and the
+// samples that are not finite, stale markers included, can't be represented.
+func marshalInfluxLineProtocol(series []prompb.TimeSeries) []byte {
+	var (
+		buf bytes.Buffer
+		num []byte
+	)
+	for _, ts := range series {
+		var (
+			measurement string
+			tags        = make([]prompb.Label, 0, len(ts.Labels))
+		)
+		for _, l := range ts.Labels {
+			switch {
+			case l.Name == "__name__":
+				measurement = l.Value
+			case l.Value != "":
+				// tags with an empty value are not allowed
+				tags = append(tags, l)
+			}
+		}
+		if measurement == "" {
+			continue
+		}
+		// sorted as InfluxDB recommends, it's faster to ingest
+		sort.Slice(tags, func(i, j int) bool {
+			return tags[i].Name < tags[j].Name
+		})
+
+		var prefix bytes.Buffer
+		prefix.WriteString(influxMeasurementEscaper.Replace(measurement))
+		for _, tag := range tags {
+			prefix.WriteByte(',')
+			prefix.WriteString(influxTagEscaper.Replace(tag.Name))
+			prefix.WriteByte('=')
+			prefix.WriteString(influxTagEscaper.Replace(tag.Value))
+		}
+		prefix.WriteString(" value=")
+
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			buf.Write(prefix.Bytes())
+			num = strconv.AppendFloat(num[:0], s.Value, 'g', -1, 64)
+			buf.Write(num)
+			buf.WriteByte(' ')
+			num = strconv.AppendInt(num[:0], s.Timestamp, 10)
+			buf.Write(num)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,96 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestMarshalInfluxLineProtocol(t *testing.T) {
+	t.Parallel()
+
+	buf := marshalInfluxLineProtocol([]prompb.TimeSeries{
+		{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: "k6_vus"},
+				{Name: "scenario", Value: "ramp up"},
+				{Name: "expected_response", Value: ""},
+				{Name: "group", Value: "a=b,c"},
+			},
+			Samples: []prompb.Sample{{Value: 10, Timestamp: 1000}, {Value: 0.5, Timestamp: 2000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_stale"}},
+			Samples: []prompb.Sample{{Value: math.Float64frombits(value.StaleNaN), Timestamp: 3000}},
+		},
+		{
+			Labels:     []prompb.Label{{Name: "__name__", Value: "k6_http_req_duration"}},
+			Histograms: []prompb.Histogram{{Sum: 1, Timestamp: 2000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_inf"}},
+			Samples: []prompb.Sample{{Value: math.Inf(1), Timestamp: 1000}, {Value: 1e21, Timestamp: 2000}},
+		},
+	})
+	assert.Equal(t,
+		`k6_vus,group=a\=b\,c,scenario=ramp\ up value=10 1000`+"\n"+
+			`k6_vus,group=a\=b\,c,scenario=ramp\ up value=0.5 2000`+"\n"+
+			`k6_inf value=1e+21 2000`+"\n",
+		string(buf))
+}
+
+func TestOutputInfluxDB(t *testing.T) {
+	t.Parallel()
+
+	var (
+		headers http.Header
+		query   string
+		body    []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		query = r.URL.RawQuery
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL + "/api/v2/write")
+	config.Protocol = null.StringFrom("influxdb")
+	config.InfluxOrg = null.StringFrom("perf")
+	config.InfluxBucket = null.StringFrom("k6")
+	config.InfluxToken = null.StringFrom("secret")
+	require.NoError(t, config.Validate())
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolInfluxDB, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	series := []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}
+	encoded, err := new(encodeBuffers).encode(series, protocolInfluxDB, compressionDefault)
+	require.NoError(t, err)
+	require.NoError(t, client.Store(context.Background(), encoded))
+
+	assert.Equal(t, "text/plain; charset=utf-8", headers.Get("Content-Type"))
+	assert.Equal(t, "gzip", headers.Get("Content-Encoding"))
+	assert.Equal(t, "Token secret", headers.Get("Authorization"))
+	assert.Equal(t, "bucket=k6&org=perf&precision=ms", query)
+	assert.Equal(t, "k6_vus value=1 1\n", string(decompress(t, "gzip", body)))
+
+	config.InfluxBucket = null.NewString("", false)
+	assert.Error(t, config.Validate())
+}
@@ -0,0 +1,51 @@
+package remotewrite
+
+import (
+	"fmt"
+	"os"
+)
+
+// addAutomaticLabels adds to the static labels those identifying the load generator,
+// so that the series of the runs distributed on many machines don't collide: the
+// Kubernetes metadata of the pod, the instance label, with Instance or the hostname,
+// the job label and the labels from the environment variables of LabelsFromEnv.
+// The labels set explicitly win over them.
+func addAutomaticLabels(config *Config, env map[string]string) error {
+	mode, err := parseKubernetesMode(config.Kubernetes.String)
+	if err != nil {
+		return err
+	}
+	labels, err := kubernetesLabels(mode, config.KubernetesMetadataDir.String, env)
+	if err != nil {
+		return err
+	}
+	if config.InstanceLabel.Bool {
+		instance := config.Instance.String
+		if instance == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return fmt.Errorf("failed to get the hostname for the instance label: %w", err)
+			}
+			instance = hostname
+		}
+		labels[instanceLabel] = instance
+	}
+	if config.JobLabel.Bool {
+		labels[jobLabel] = config.Job.String
+	}
+	for name, variable := range config.LabelsFromEnv {
+		// e.g. a pod scheduled without the downward API: the label is left out
+		if value := env[variable]; value != "" {
+			labels[name] = value
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+
+	for name, value := range config.Labels {
+		labels[name] = value
+	}
+	config.Labels = labels
+	return nil
+}
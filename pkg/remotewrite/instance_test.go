@@ -0,0 +1,65 @@
+package remotewrite
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestAddAutomaticLabels(t *testing.T) {
+	t.Parallel()
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"K6_PROMETHEUS_INSTANCE_LABEL":  "true",
+		"K6_PROMETHEUS_JOB_LABEL":       "true",
+		"K6_PROMETHEUS_JOB":             "load-test",
+		"K6_PROMETHEUS_LABELS_FROM_ENV": "pod=POD_NAME,node=NODE_NAME,namespace=POD_NAMESPACE",
+		"K6_PROMETHEUS_EXTRA_LABELS":    "node=static",
+		"POD_NAME":                      "k6-1-abcde",
+		"NODE_NAME":                     "node-1",
+	}
+	config, err := GetConsolidatedConfig(nil, env, "")
+	require.NoError(t, err)
+	require.NoError(t, config.Validate())
+	require.NoError(t, addAutomaticLabels(&config, env))
+	assert.Equal(t, map[string]string{
+		"instance": hostname,
+		"job":      "load-test",
+		"pod":      "k6-1-abcde",
+		// the static labels win, and the unset variables are left out
+		"node": "static",
+	}, config.Labels)
+
+	config = NewConfig()
+	config.InstanceLabel = null.BoolFrom(true)
+	config.Instance = null.StringFrom("generator-1")
+	require.NoError(t, addAutomaticLabels(&config, nil))
+	assert.Equal(t, map[string]string{"instance": "generator-1"}, config.Labels)
+
+	config = NewConfig()
+	config.JobLabel = null.BoolFrom(true)
+	require.NoError(t, addAutomaticLabels(&config, nil))
+	assert.Equal(t, map[string]string{"job": "k6"}, config.Labels)
+
+	config = NewConfig()
+	config.JobLabel = null.BoolFrom(true)
+	config.Job = null.StringFrom("checkout")
+	config.Labels = map[string]string{"job": "static"}
+	require.NoError(t, addAutomaticLabels(&config, nil))
+	assert.Equal(t, map[string]string{"job": "static"}, config.Labels)
+
+	config = NewConfig()
+	require.NoError(t, addAutomaticLabels(&config, env))
+	assert.Empty(t, config.Labels)
+
+	config.LabelsFromEnv = map[string]string{"pod-name": "POD_NAME", "node": ""}
+	var verr *ValidationError
+	require.ErrorAs(t, config.Validate(), &verr)
+	assert.Len(t, verr.Problems, 2)
+}
@@ -0,0 +1,115 @@
+package remotewrite
+
+import (
+	"sync"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// maxInternedStrings bounds the memory held by the interner: it's emptied when
+// full, so that labels with a high cardinality, like URLs, don't grow it forever.
+const maxInternedStrings = 1 << 16
+
+// stringInterner makes equal label names and values share the same memory, so that
+// the series kept across flushes, and those of million-sample flushes, don't hold
+// their own copy of the same metric names, scenarios or status codes.
+// It's not safe for concurrent use, samples are converted by one flush at a time.
+// Its methods are no-ops on a nil receiver.
+type stringInterner struct {
+	strings map[string]string
+	// buf is the buffer concat looks the strings up with
+	buf []byte
+}
+
+func newStringInterner() *stringInterner {
+	return &stringInterner{
+		strings: make(map[string]string),
+	}
+}
+
+// intern returns the interned string equal to s.
+func (i *stringInterner) intern(s string) string {
+	if i == nil {
+		return s
+	}
+	if interned, ok := i.strings[s]; ok {
+		return interned
+	}
+	if len(i.strings) >= maxInternedStrings {
+		i.strings = make(map[string]string)
+	}
+	i.strings[s] = s
+	return s
+}
+
+// concat returns the interned string equal to a+b, only building it if it's not
+// interned yet, e.g. the metric names with their prefix, for each sample.
+func (i *stringInterner) concat(a, b string) string {
+	if i == nil {
+		return a + b
+	}
+	i.buf = append(append(i.buf[:0], a...), b...)
+	if interned, ok := i.strings[string(i.buf)]; ok {
+		return interned
+	}
+	return i.intern(string(i.buf))
+}
+
+// labels interns the names and values of the labels in place.
+func (i *stringInterner) labels(labels []prompb.Label) {
+	if i == nil {
+		return
+	}
+	for j := range labels {
+		labels[j].Name = i.intern(labels[j].Name)
+		labels[j].Value = i.intern(labels[j].Value)
+	}
+}
+
+// timeSeriesPool holds the slices of converted series of previous flushes,
+// so that a flush doesn't grow a new one from scratch.
+var timeSeriesPool sync.Pool
+
+// getTimeSeries returns an empty slice of series from the pool, or nil if it's empty.
+func getTimeSeries() []prompb.TimeSeries {
+	if series, ok := timeSeriesPool.Get().(*[]prompb.TimeSeries); ok {
+		return *series
+	}
+	return nil
+}
+
+// putTimeSeries puts the slice back in the pool. The series must not be used anymore:
+// they are cleared so that the pool doesn't keep their labels and samples alive.
+func putTimeSeries(series []prompb.TimeSeries) {
+	if cap(series) == 0 {
+		return
+	}
+	series = series[:cap(series)]
+	for i := range series {
+		series[i] = prompb.TimeSeries{}
+	}
+	series = series[:0]
+	timeSeriesPool.Put(&series)
+}
+
+// labelsByName sorts labels by name. Its methods have a pointer receiver
+// so that sorting a pooled slice doesn't allocate.
+type labelsByName []prompb.Label
+
+func (l *labelsByName) Len() int           { return len(*l) }
+func (l *labelsByName) Less(i, j int) bool { return (*l)[i].Name < (*l)[j].Name }
+func (l *labelsByName) Swap(i, j int)      { (*l)[i], (*l)[j] = (*l)[j], (*l)[i] }
+
+// labelsKeyPool holds the scratch slices labelsKey sorts the labels in.
+var labelsKeyPool = sync.Pool{
+	New: func() interface{} {
+		return new(labelsByName)
+	},
+}
+
+// labelsKeyBufferPool holds the buffers labelsKey builds the keys in.
+var labelsKeyBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
@@ -0,0 +1,128 @@
+package remotewrite
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+)
+
+func TestStringInterner(t *testing.T) {
+	t.Parallel()
+
+	i := newStringInterner()
+	name := []byte("k6_http_reqs")
+	labels := []prompb.Label{
+		{Name: "__name__", Value: string(name)},
+		{Name: "__name__", Value: string(name)},
+	}
+	i.labels(labels)
+	assert.Equal(t, "k6_http_reqs", labels[1].Value)
+	assert.Len(t, i.strings, 2)
+
+	for n := 0; n < maxInternedStrings; n++ {
+		i.intern(fmt.Sprint(n))
+	}
+	// emptied when full
+	assert.Less(t, len(i.strings), 10)
+
+	var empty *stringInterner
+	assert.Equal(t, "a", empty.intern("a"))
+	empty.labels(labels)
+}
+
+func TestTimeSeriesPool(t *testing.T) {
+	t.Parallel()
+
+	series := make([]prompb.TimeSeries, 2, 4)
+	series[0].Labels = []prompb.Label{{Name: "__name__", Value: "k6_vus"}}
+	putTimeSeries(series)
+
+	// cleared before being pooled
+	assert.Nil(t, series[0].Labels)
+	assert.Empty(t, getTimeSeries())
+
+	assert.Equal(t, labelsKey([]prompb.Label{{Name: "b", Value: "2"}, {Name: "a", Value: "1"}}),
+		labelsKey([]prompb.Label{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}}))
+}
+
+func TestConvertToTimeSeriesScratch(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	o := &Output{
+		config:   config,
+		metrics:  newMetricsStorage(),
+		mapping:  NewMapping(config),
+		interner: newStringInterner(),
+		logger:   logrus.New(),
+	}
+	counter := &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}
+	gauge := &metrics.Metric{Name: "vus", Type: metrics.Gauge}
+	now := time.UnixMilli(1000)
+	sample := func(m *metrics.Metric, status string, i int) metrics.Sample {
+		return metrics.Sample{
+			Metric: m,
+			Tags:   metrics.NewSampleTags(map[string]string{"status": status}),
+			Time:   now.Add(time.Duration(i) * time.Second),
+			Value:  1,
+		}
+	}
+
+	// the series are written in the same buffers, one sample after the other
+	series := o.convertToTimeSeries([]metrics.SampleContainer{metrics.Samples{
+		sample(counter, "200", 0), sample(counter, "500", 0), sample(gauge, "200", 0),
+		sample(counter, "200", 1), sample(counter, "500", 1),
+	}})
+	require.Len(t, series, 3)
+	assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "k6_http_reqs"}, {Name: "status", Value: "200"}}, series[0].Labels)
+	assert.Equal(t, []prompb.Sample{{Value: 1, Timestamp: 1000}, {Value: 2, Timestamp: 2000}}, series[0].Samples)
+	assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "k6_http_reqs"}, {Name: "status", Value: "500"}}, series[1].Labels)
+	assert.Equal(t, []prompb.Sample{{Value: 1, Timestamp: 1000}, {Value: 2, Timestamp: 2000}}, series[1].Samples)
+	assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "k6_vus"}, {Name: "status", Value: "200"}}, series[2].Labels)
+	assert.Equal(t, []prompb.Sample{{Value: 1, Timestamp: 1000}}, series[2].Samples)
+}
+
+// benchmarkSamples returns n samples of an HTTP counter, spread over 5 series.
+func benchmarkSamples(n int) metrics.Samples {
+	metric := &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}
+	now := time.Now()
+	samples := make(metrics.Samples, n)
+	for i := range samples {
+		samples[i] = metrics.Sample{
+			Metric: metric,
+			Tags: metrics.NewSampleTags(map[string]string{
+				"scenario": "default",
+				"status":   fmt.Sprint(200 + i%5),
+			}),
+			Time:  now.Add(time.Duration(i) * time.Millisecond),
+			Value: 1,
+		}
+	}
+	return samples
+}
+
+func BenchmarkConvertToTimeSeries(b *testing.B) {
+	config := NewConfig()
+	o := &Output{
+		config:   config,
+		metrics:  newMetricsStorage(),
+		mapping:  NewMapping(config),
+		interner: newStringInterner(),
+		logger:   logrus.New(),
+	}
+	samples := benchmarkSamples(100000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		series := o.convertToTimeSeries([]metrics.SampleContainer{samples})
+		require.NotEmpty(b, series)
+		putTimeSeries(series)
+	}
+}
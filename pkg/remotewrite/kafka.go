@@ -0,0 +1,161 @@
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	promConfig "github.com/prometheus/common/config"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// maxKafkaBatchBytes lets the brokers decide which messages are too large,
+// according to the max.message.bytes of the topic.
+const maxKafkaBatchBytes = 1 << 30
+
+// kafkaClient publishes the encoded requests to a Kafka topic instead of sending
+// them to a remote write endpoint, one message per request, with the headers
+// of their protocol as message headers so that consumers can decode them.
+type kafkaClient struct {
+	name    string
+	brokers []string
+	writer  *kafka.Writer
+	headers []kafka.Header
+}
+
+var _ remote.WriteClient = &kafkaClient{}
+
+// newKafkaClient returns a client publishing to the brokers and topic of the config.
+// The TLS options of the remote endpoint are used if KafkaTLS is enabled.
+func newKafkaClient(name string, conf *remote.ClientConfig, p protocol, c compression, config Config) (*kafkaClient, error) {
+	// the compression and mechanism are validated by New
+	kafkaCompression, err := parseKafkaCompression(config.KafkaCompression.String)
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := parseKafkaSASL(config.KafkaSASLMechanism.String, config.KafkaUser.String, config.KafkaPassword.String)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &kafka.Transport{SASL: mechanism}
+	if config.KafkaTLS.Bool {
+		transport.TLS, err = promConfig.NewTLSConfig(&conf.HTTPClientConfig.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var headers []kafka.Header
+	for k, v := range p.headers(c) {
+		headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	for k, v := range conf.Headers {
+		headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+
+	return &kafkaClient{
+		name:    name,
+		brokers: config.KafkaBrokers,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(config.KafkaBrokers...),
+			Topic:        config.KafkaTopic.String,
+			Balancer:     &kafka.RoundRobin{},
+			Compression:  kafkaCompression,
+			RequiredAcks: kafka.RequireAll,
+			// each request is published on its own, right away
+			BatchSize:    1,
+			BatchBytes:   maxKafkaBatchBytes,
+			BatchTimeout: time.Millisecond,
+			WriteTimeout: time.Duration(conf.Timeout),
+			// retried by the output, as for the other endpoints
+			MaxAttempts: 1,
+			Transport:   transport,
+		},
+		headers: headers,
+	}, nil
+}
+
+func (c *kafkaClient) Name() string {
+	return c.name
+}
+
+// Endpoint returns the brokers and the topic, e.g. kafka://broker1:9092,broker2:9092/k6.
+func (c *kafkaClient) Endpoint() string {
+	return "kafka://" + strings.Join(c.brokers, ",") + "/" + c.writer.Topic
+}
+
+// Store publishes the encoded request. Errors are recoverable unless the brokers
+// reject the message for good, e.g. because it's too large or the authentication failed.
+func (c *kafkaClient) Store(ctx context.Context, req []byte) error {
+	err := c.writer.WriteMessages(ctx, kafka.Message{Value: req, Headers: c.headers})
+	if err == nil {
+		return nil
+	}
+	if kafkaRecoverable(err) {
+		return recoverableError{err: err}
+	}
+	return err
+}
+
+// Close closes the connections to the brokers.
+func (c *kafkaClient) Close() error {
+	return c.writer.Close()
+}
+
+func kafkaRecoverable(err error) bool {
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) {
+		for _, writeErr := range writeErrs {
+			if writeErr != nil && !kafkaRecoverable(writeErr) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		return kafkaErr.Temporary()
+	}
+	// network errors
+	return true
+}
+
+func parseKafkaCompression(name string) (kafka.Compression, error) {
+	switch name {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("invalid kafkaCompression %q, it must be none, gzip, snappy, lz4 or zstd", name)
+	}
+}
+
+func parseKafkaSASL(mechanism, user, password string) (sasl.Mechanism, error) {
+	switch mechanism {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: user, Password: password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, user, password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, user, password)
+	default:
+		return nil, fmt.Errorf("invalid kafkaSASLMechanism %q, it must be plain, scram-sha-256 or scram-sha-512", mechanism)
+	}
+}
@@ -0,0 +1,80 @@
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestConsolidatedConfigKafka(t *testing.T) {
+	t.Parallel()
+
+	config, err := GetConsolidatedConfig(nil, map[string]string{
+		"K6_PROMETHEUS_KAFKA_BROKERS":        "broker1:9092,broker2:9092",
+		"K6_PROMETHEUS_KAFKA_TOPIC":          "k6",
+		"K6_PROMETHEUS_KAFKA_SASL_MECHANISM": "scram-sha-512",
+		"K6_PROMETHEUS_KAFKA_USER":           "user",
+		"K6_PROMETHEUS_KAFKA_TLS":            "true",
+	}, "kafkaCompression=zstd")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"broker1:9092", "broker2:9092"}, config.KafkaBrokers)
+	assert.Equal(t, null.StringFrom("k6"), config.KafkaTopic)
+	assert.Equal(t, null.StringFrom("zstd"), config.KafkaCompression)
+	assert.Equal(t, null.StringFrom("scram-sha-512"), config.KafkaSASLMechanism)
+	assert.Equal(t, null.StringFrom("user"), config.KafkaUser)
+	assert.Equal(t, null.BoolFrom(true), config.KafkaTLS)
+	require.NoError(t, config.Validate())
+
+	config.KafkaTopic = null.StringFrom("")
+	config.KafkaCompression = null.StringFrom("brotli")
+	config.MirrorUrls = []string{"http://localhost:8428/api/v1/write"}
+	var validationErr *ValidationError
+	require.ErrorAs(t, config.Validate(), &validationErr)
+	assert.Equal(t, []string{
+		"kafkaTopic must be set with kafkaBrokers: set K6_PROMETHEUS_KAFKA_TOPIC",
+		"failoverUrls and mirrorUrls can't be used with kafkaBrokers, the requests are only published to Kafka",
+		`invalid kafkaCompression "brotli", it must be none, gzip, snappy, lz4 or zstd`,
+	}, validationErr.Problems)
+}
+
+func TestKafkaClient(t *testing.T) {
+	t.Parallel()
+
+	// nothing listens on the port once the listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	config := NewConfig()
+	config.KafkaBrokers = []string{addr}
+	config.KafkaTopic = null.StringFrom("k6")
+	config.Headers = map[string]string{"X-Custom": "custom"}
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+
+	client, err := newClient("test", remoteConfig, protocolV1, config, nil, nil)
+	require.NoError(t, err)
+	require.IsType(t, &kafkaClient{}, client)
+	assert.Equal(t, "kafka://"+addr+"/k6", client.Endpoint())
+	assert.Contains(t, client.(*kafkaClient).headers, kafka.Header{Key: "Content-Encoding", Value: []byte("snappy")})
+	assert.Contains(t, client.(*kafkaClient).headers, kafka.Header{Key: "X-Custom", Value: []byte("custom")})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = client.Store(ctx, []byte("payload"))
+	require.Error(t, err)
+	assert.True(t, isRecoverable(err))
+	assert.NoError(t, client.(*kafkaClient).Close())
+
+	assert.False(t, kafkaRecoverable(kafka.WriteErrors{nil, kafka.MessageSizeTooLarge}))
+	assert.True(t, kafkaRecoverable(kafka.WriteErrors{kafka.LeaderNotAvailable}))
+	assert.True(t, kafkaRecoverable(errors.New("connection refused")))
+}
@@ -0,0 +1,120 @@
+package remotewrite
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// kubernetesMode is how the Kubernetes metadata of the pod are found.
+type kubernetesMode string
+
+const (
+	kubernetesNone kubernetesMode = ""
+	// kubernetesDownwardAPI reads them from the env or the files set with the downward API
+	kubernetesDownwardAPI kubernetesMode = "downward-api"
+	// kubernetesK6Operator also falls back to what the runner pods of the k6-operator
+	// have without any downward API: their hostname and service account
+	kubernetesK6Operator kubernetesMode = "k6-operator"
+)
+
+func parseKubernetesMode(m string) (kubernetesMode, error) {
+	switch mm := kubernetesMode(m); mm {
+	case kubernetesNone, kubernetesDownwardAPI, kubernetesK6Operator:
+		return mm, nil
+	default:
+		return "", fmt.Errorf("invalid kubernetes %q, it must be downward-api or k6-operator", m)
+	}
+}
+
+// kubernetesMetadata are the labels read from the downward API, from the first
+// environment variable set or else from the file of the same name, lowercased,
+// in the directory of the downward API volume.
+var kubernetesMetadata = []struct {
+	label string
+	env   []string
+}{
+	{"pod", []string{"POD_NAME"}},
+	{"namespace", []string{"NAMESPACE", "POD_NAMESPACE"}},
+	{"node", []string{"NODE_NAME"}},
+}
+
+// serviceAccountNamespace is the file with the namespace of the pod, mounted
+// with the token of its service account.
+const serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// k6OperatorRunnerPod matches the names of the pods of the k6-operator runner
+// jobs, <test run>-<runner index>-<random suffix>.
+var k6OperatorRunnerPod = regexp.MustCompile(`^(.+)-(\d+)-[a-z0-9]{5}$`)
+
+// kubernetesLabels returns the labels with the metadata of the pod that are found.
+// With the k6-operator, the pod is its hostname and the runner label tells the
+// runners of the same test run apart by their index.
+func kubernetesLabels(mode kubernetesMode, dir string, env map[string]string) (map[string]string, error) {
+	labels := make(map[string]string)
+	if mode == kubernetesNone {
+		return labels, nil
+	}
+
+	for _, m := range kubernetesMetadata {
+		for _, name := range m.env {
+			if value := env[name]; value != "" {
+				labels[m.label] = value
+				break
+			}
+		}
+		if _, ok := labels[m.label]; ok || dir == "" {
+			continue
+		}
+		for _, name := range m.env {
+			value, err := readMetadataFile(filepath.Join(dir, strings.ToLower(name)))
+			if err != nil {
+				return nil, err
+			}
+			if value != "" {
+				labels[m.label] = value
+				break
+			}
+		}
+	}
+
+	if mode != kubernetesK6Operator {
+		return labels, nil
+	}
+	if labels["pod"] == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the hostname for the pod label: %w", err)
+		}
+		labels["pod"] = hostname
+	}
+	if labels["namespace"] == "" {
+		namespace, err := readMetadataFile(serviceAccountNamespace)
+		if err != nil {
+			return nil, err
+		}
+		if namespace != "" {
+			labels["namespace"] = namespace
+		}
+	}
+	if m := k6OperatorRunnerPod.FindStringSubmatch(labels["pod"]); m != nil {
+		labels["runner"] = m[2]
+	}
+	return labels, nil
+}
+
+// readMetadataFile returns the content of the file, empty if it doesn't exist.
+func readMetadataFile(name string) (string, error) {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the Kubernetes metadata: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,54 @@
+package remotewrite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKubernetesLabels(t *testing.T) {
+	t.Parallel()
+
+	labels, err := kubernetesLabels(kubernetesNone, "", map[string]string{"POD_NAME": "k6-1-abcde"})
+	require.NoError(t, err)
+	assert.Empty(t, labels)
+
+	// the env wins over the files of the downward API volume
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pod_name"), []byte("from-file\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "namespace"), []byte("load-tests\n"), 0o600))
+	labels, err = kubernetesLabels(kubernetesDownwardAPI, dir, map[string]string{
+		"POD_NAME":  "k6-sample-1-abcde",
+		"NODE_NAME": "node-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"pod":       "k6-sample-1-abcde",
+		"namespace": "load-tests",
+		"node":      "node-1",
+	}, labels)
+
+	labels, err = kubernetesLabels(kubernetesK6Operator, filepath.Join(dir, "missing"), map[string]string{
+		"POD_NAME":      "k6-sample-2-x7k2p",
+		"POD_NAMESPACE": "load-tests",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"pod":       "k6-sample-2-x7k2p",
+		"namespace": "load-tests",
+		"runner":    "2",
+	}, labels)
+
+	// the pod is the hostname of the runners of the k6-operator
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	labels, err = kubernetesLabels(kubernetesK6Operator, "", map[string]string{"NAMESPACE": "load-tests"})
+	require.NoError(t, err)
+	assert.Equal(t, hostname, labels["pod"])
+
+	_, err = parseKubernetesMode("operator")
+	assert.Error(t, err)
+}
@@ -1,38 +1,393 @@
 package remotewrite
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/prometheus/prometheus/prompb"
 	"go.k6.io/k6/metrics"
 )
 
-func tagsToLabels(tags *metrics.SampleTags, config Config) ([]prompb.Label, error) {
-	if !config.KeepTags.Bool {
-		return []prompb.Label{}, nil
-	}
+const (
+	testRunIDLabel = "test_run_id"
+	// jobLabel is set by Prometheus on the series it scrapes, as instanceLabel
+	jobLabel = "job"
+
+	// foldedTagsLabel holds the tags that are not sent as labels when FoldTags is enabled.
+	foldedTagsLabel = "k6_tags"
+
+	scenarioTag = "scenario"
+	groupTag    = "group"
+	// groupSeparator separates the names of the nested groups in the group tag
+	groupSeparator = "::"
 
+	// the phases of the test, setup() and teardown() run in groups of the same name
+	testPhaseSetup    = "setup"
+	testPhaseTeardown = "teardown"
+	testPhaseDefault  = "default"
+)
+
+func tagsToLabels(tags *metrics.SampleTags, config Config, urls *urlGrouper) ([]prompb.Label, error) {
 	tagsMap := tags.CloneTags()
-	labelPairs := make([]prompb.Label, 0, len(tagsMap))
+	labelPairs := make([]prompb.Label, 0, len(tagsMap)+len(config.Labels))
+	var folded []string
 
 	for name, value := range tagsMap {
 		if len(name) < 1 || len(value) < 1 {
 			continue
 		}
+		if urls.groupsTag(name) {
+			value = urls.group(value)
+		}
 
-		if !config.KeepNameTag.Bool && name == "name" {
-			continue
+		if include, ok := scenarioGroupTag(name, config); ok {
+			if !include {
+				continue
+			}
+		} else {
+			if !config.KeepTags.Bool {
+				continue
+			}
+
+			if !config.KeepNameTag.Bool && name == "name" {
+				continue
+			}
+
+			if !config.KeepUrlTag.Bool && name == "url" {
+				continue
+			}
+
+			// sent as exemplar, it would create a new series for each trace otherwise
+			if config.Exemplars.Bool && name == traceIDTag {
+				continue
+			}
+
+			if !tagAsLabel(name, config) {
+				if config.FoldTags.Bool {
+					folded = append(folded, name+"="+value)
+				}
+				continue
+			}
 		}
 
-		if !config.KeepUrlTag.Bool && name == "url" {
+		labelName, err := sanitizeLabelName(name, config.StrictNames.Bool)
+		if err != nil {
+			return nil, err
+		}
+		value = sanitizeLabelValue(value, int(config.MaxLabelValueLength.Int64))
+		// e.g. both "a-b" and "a_b" tags, the one with the valid name is kept
+		if i := labelIndex(labelPairs, labelName); i >= 0 {
+			if labelName == name {
+				labelPairs[i].Value = value
+			}
 			continue
 		}
 
 		labelPairs = append(labelPairs, prompb.Label{
-			Name:  name,
+			Name:  labelName,
 			Value: value,
 		})
 	}
 
+	if len(folded) > 0 {
+		// sorted so that the same tags always give the same series
+		sort.Strings(folded)
+		labelPairs = append(labelPairs, prompb.Label{
+			Name:  foldedTagsLabel,
+			Value: sanitizeLabelValue(strings.Join(folded, ","), int(config.MaxLabelValueLength.Int64)),
+		})
+	}
+
+	if config.PhaseLabel.Bool && !hasLabel(labelPairs, phaseLabel) {
+		labelPairs = append(labelPairs, prompb.Label{
+			Name:  phaseLabel,
+			Value: testPhase(tagsMap[groupTag]),
+		})
+	}
+
+	labelPairs = staticLabels(labelPairs, config)
+
 	// names of the metrics might be remote agent dependent so let Mapping set those
 
 	return labelPairs[:len(labelPairs):len(labelPairs)], nil
 }
+
+// labelValueHashLen is the length of the hash suffix of truncated label values.
+const labelValueHashLen = 16
+
+// sanitizeLabelValue replaces the invalid UTF-8 sequences of the value, which
+// are rejected by the endpoints, and truncates it to maxLen bytes if it's longer.
+// Truncated values end with a hash of the full value, so that values sharing a
+// long prefix, like URLs, still give different series.
+func sanitizeLabelValue(value string, maxLen int) string {
+	value = strings.ToValidUTF8(value, "\uFFFD")
+	if maxLen <= 0 || len(value) <= maxLen {
+		return value
+	}
+
+	cut := maxLen - labelValueHashLen - 1
+	suffix := ""
+	if cut > 0 {
+		sum := sha256.Sum256([]byte(value))
+		suffix = "~" + hex.EncodeToString(sum[:])[:labelValueHashLen]
+	} else {
+		// too short for the hash
+		cut = maxLen
+	}
+	// don't split a multi-byte character
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	return value[:cut] + suffix
+}
+
+// scenarioGroupTag reports whether the tag is the scenario or the group one and,
+// if so, whether it's sent as label. These are set by ScenarioLabel and GroupLabel
+// only, regardless of the other tag options, so that the results can always be
+// split by scenario and group unless disabled explicitly.
+func scenarioGroupTag(name string, config Config) (include bool, ok bool) {
+	switch name {
+	case scenarioTag:
+		return config.ScenarioLabel.Bool, true
+	case groupTag:
+		return config.GroupLabel.Bool, true
+	default:
+		return false, false
+	}
+}
+
+// testPhase returns the phase of the test of the samples of the group, e.g. ::setup
+// or ::setup::login for setup(). The samples without group tag are from the default
+// phase, e.g. those of the execution metrics, as k6 always tags the ones of setup()
+// and teardown() with the group unless the group system tag is disabled.
+func testPhase(group string) string {
+	for _, phase := range []string{testPhaseSetup, testPhaseTeardown} {
+		path := groupSeparator + phase
+		if group == path || strings.HasPrefix(group, path+groupSeparator) {
+			return phase
+		}
+	}
+	return testPhaseDefault
+}
+
+// tagAsLabel reports whether the tag is allowed as label by TagsAsLabels and TagsExclude.
+func tagAsLabel(name string, config Config) bool {
+	if len(config.TagsAsLabels) > 0 && !containsString(config.TagsAsLabels, name) {
+		return false
+	}
+	return !containsString(config.TagsExclude, name)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// staticLabels appends the labels configured for every series and returns the
+// labels sorted by name. Those already set from a sample tag with the same name
+// are resolved with LabelConflict: by default the tag is kept. Without HonorLabels,
+// the job and instance tags are kept renamed with the exported_ prefix instead.
+func staticLabels(labelPairs []prompb.Label, config Config) []prompb.Label {
+	if labelPairs == nil {
+		labelPairs = make([]prompb.Label, 0, len(config.Labels)+1)
+	}
+	// validated by New
+	policy := labelConflictPolicy(config.LabelConflict.String)
+	set := func(name string) bool {
+		i := labelIndex(labelPairs, name)
+		if i < 0 {
+			return false
+		}
+		if !config.HonorLabels.Bool && isReservedLabel(name) {
+			labelPairs[i].Name = exportedLabelPrefix + name
+			return false
+		}
+		return policy.keepsFirst()
+	}
+
+	if config.TestRunID.String != "" && !set(testRunIDLabel) {
+		labelPairs = append(labelPairs, prompb.Label{
+			Name:  testRunIDLabel,
+			Value: config.TestRunID.String,
+		})
+	}
+
+	for name, value := range config.Labels {
+		if len(name) < 1 || len(value) < 1 || set(name) {
+			continue
+		}
+
+		labelPairs = append(labelPairs, prompb.Label{
+			Name:  name,
+			Value: value,
+		})
+	}
+
+	labelPairs = resolveLabelConflicts(labelPairs, policy)
+	return labelPairs[:len(labelPairs):len(labelPairs)]
+}
+
+// isReservedLabel reports whether Prometheus sets the label on the series it scrapes,
+// renaming the scraped labels with the same name unless honor_labels is set.
+func isReservedLabel(name string) bool {
+	return name == jobLabel || name == instanceLabel
+}
+
+// labelConflictPolicy resolves the labels set more than once on a series,
+// e.g. a sample tag with the name of a static label, the tag being set first.
+type labelConflictPolicy string
+
+const (
+	labelConflictFirstWins labelConflictPolicy = "first-wins"
+	labelConflictLastWins  labelConflictPolicy = "last-wins"
+	// labelConflictPrefix keeps the last label and renames the others with
+	// exportedLabelPrefix, as Prometheus does for the scraped labels
+	// colliding with those of the target.
+	labelConflictPrefix labelConflictPolicy = "prefix"
+)
+
+const exportedLabelPrefix = "exported_"
+
+func parseLabelConflictPolicy(policy string) (labelConflictPolicy, error) {
+	switch p := labelConflictPolicy(policy); p {
+	case labelConflictFirstWins, labelConflictLastWins, labelConflictPrefix:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid labelConflict %q, it must be first-wins, last-wins or prefix", policy)
+	}
+}
+
+// keepsFirst reports whether the first label set is kept, the others being
+// dropped: the default, also for an empty policy.
+func (p labelConflictPolicy) keepsFirst() bool {
+	return p != labelConflictLastWins && p != labelConflictPrefix
+}
+
+// resolveLabelConflicts sorts the labels by name in place, the endpoints rejecting
+// series with unsorted labels, and resolves those set more than once with the policy.
+// The labels with the same name are expected in the order they were set.
+func resolveLabelConflicts(labels []prompb.Label, policy labelConflictPolicy) []prompb.Label {
+	sorted := labelsByName(labels)
+	sort.Stable(&sorted)
+	if labelsNormalized(labels) {
+		return labels
+	}
+
+	var (
+		resolved = labels[:0]
+		exported []prompb.Label
+	)
+	for i := 0; i < len(labels); {
+		j := i + 1
+		for j < len(labels) && labels[j].Name == labels[i].Name {
+			j++
+		}
+		switch {
+		case policy.keepsFirst():
+			resolved = append(resolved, labels[i])
+		case policy == labelConflictPrefix:
+			for _, l := range labels[i : j-1] {
+				exported = append(exported, prompb.Label{Name: exportedLabelPrefix + l.Name, Value: l.Value})
+			}
+			resolved = append(resolved, labels[j-1])
+		default:
+			resolved = append(resolved, labels[j-1])
+		}
+		i = j
+	}
+	if len(exported) == 0 {
+		return resolved
+	}
+	// the renamed labels can collide too, e.g. with an exported_job tag
+	return resolveLabelConflicts(append(resolved, exported...), policy)
+}
+
+// labelsNormalized reports whether the labels are sorted by name, without duplicates.
+func labelsNormalized(labels []prompb.Label) bool {
+	for i := 1; i < len(labels); i++ {
+		if labels[i-1].Name >= labels[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeSeriesLabels sorts the labels of the series by name and resolves those
+// set more than once with the policy, e.g. added by a mapping with the name of a
+// tag. The labels of a series are copied unless they're already sorted and unique,
+// as they may be shared with other series.
+func normalizeSeriesLabels(series []prompb.TimeSeries, policy labelConflictPolicy) {
+	for i := range series {
+		if labelsNormalized(series[i].Labels) {
+			continue
+		}
+		labels := append(make([]prompb.Label, 0, len(series[i].Labels)), series[i].Labels...)
+		series[i].Labels = resolveLabelConflicts(labels, policy)
+	}
+}
+
+// formatLabels returns the labels as written in PromQL, e.g. {__name__="k6_vus", scenario="default"}.
+func formatLabels(labels []prompb.Label) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(l.Name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(l.Value))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func hasLabel(labels []prompb.Label, name string) bool {
+	return labelIndex(labels, name) >= 0
+}
+
+func labelIndex(labels []prompb.Label, name string) int {
+	for i, l := range labels {
+		if l.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// prefixMetricName prepends prefix to the value of the __name__ label,
+// with the interner so that the name isn't built again for each sample.
+func prefixMetricName(labels []prompb.Label, prefix string, interner *stringInterner) {
+	if prefix == "" {
+		return
+	}
+
+	for i := range labels {
+		if labels[i].Name == "__name__" {
+			labels[i].Value = interner.concat(prefix, labels[i].Value)
+			return
+		}
+	}
+}
+
+// newTestRunID returns a random (version 4) UUID.
+func newTestRunID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
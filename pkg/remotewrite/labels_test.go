@@ -1,8 +1,12 @@
 package remotewrite
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/stretchr/testify/assert"
@@ -69,6 +73,154 @@ func TestTagsToLabels(t *testing.T) {
 				{Name: "url", Value: "uuu"},
 			},
 		},
+		"static-labels": {
+			tags: metrics.NewSampleTags(map[string]string{"foo": "bar"}),
+			config: Config{
+				KeepTags: null.BoolFrom(true),
+				Labels:   map[string]string{"env": "staging", "region": "eu-west-1"},
+			},
+			labels: []prompb.Label{
+				{Name: "foo", Value: "bar"},
+				{Name: "env", Value: "staging"},
+				{Name: "region", Value: "eu-west-1"},
+			},
+		},
+		"static-labels-tag-override": {
+			tags: metrics.NewSampleTags(map[string]string{"env": "prod"}),
+			config: Config{
+				KeepTags: null.BoolFrom(true),
+				Labels:   map[string]string{"env": "staging"},
+			},
+			labels: []prompb.Label{
+				{Name: "env", Value: "prod"},
+			},
+		},
+		"static-labels-conflict-last-wins": {
+			tags: metrics.NewSampleTags(map[string]string{"env": "prod"}),
+			config: Config{
+				KeepTags:      null.BoolFrom(true),
+				Labels:        map[string]string{"env": "staging"},
+				LabelConflict: null.StringFrom("last-wins"),
+			},
+			labels: []prompb.Label{
+				{Name: "env", Value: "staging"},
+			},
+		},
+		"static-labels-conflict-prefix": {
+			tags: metrics.NewSampleTags(map[string]string{"env": "prod", "exported_env": "dev"}),
+			config: Config{
+				KeepTags:      null.BoolFrom(true),
+				Labels:        map[string]string{"env": "staging"},
+				LabelConflict: null.StringFrom("prefix"),
+			},
+			labels: []prompb.Label{
+				{Name: "env", Value: "staging"},
+				{Name: "exported_env", Value: "prod"},
+				{Name: "exported_exported_env", Value: "dev"},
+			},
+		},
+		"honor-labels": {
+			tags: metrics.NewSampleTags(map[string]string{"job": "checkout"}),
+			config: Config{
+				KeepTags:    null.BoolFrom(true),
+				Labels:      map[string]string{"job": "k6"},
+				HonorLabels: null.BoolFrom(true),
+			},
+			labels: []prompb.Label{
+				{Name: "job", Value: "checkout"},
+			},
+		},
+		"honor-labels-disabled": {
+			tags: metrics.NewSampleTags(map[string]string{"job": "checkout", "team": "payments"}),
+			config: Config{
+				KeepTags:    null.BoolFrom(true),
+				Labels:      map[string]string{"job": "k6", "team": "static"},
+				HonorLabels: null.BoolFrom(false),
+			},
+			labels: []prompb.Label{
+				{Name: "exported_job", Value: "checkout"},
+				{Name: "job", Value: "k6"},
+				// the other tags are left to the conflict policy
+				{Name: "team", Value: "payments"},
+			},
+		},
+		"static-labels-discard-tags": {
+			tags: metrics.NewSampleTags(map[string]string{"foo": "bar"}),
+			config: Config{
+				KeepTags: null.BoolFrom(false),
+				Labels:   map[string]string{"env": "staging"},
+			},
+			labels: []prompb.Label{
+				{Name: "env", Value: "staging"},
+			},
+		},
+		"test-run-id": {
+			tags: metrics.NewSampleTags(map[string]string{"foo": "bar"}),
+			config: Config{
+				KeepTags:  null.BoolFrom(true),
+				TestRunID: null.StringFrom("42"),
+			},
+			labels: []prompb.Label{
+				{Name: "foo", Value: "bar"},
+				{Name: "test_run_id", Value: "42"},
+			},
+		},
+		"test-run-id-tag-override": {
+			tags: metrics.NewSampleTags(map[string]string{"test_run_id": "from-tag"}),
+			config: Config{
+				KeepTags:  null.BoolFrom(true),
+				TestRunID: null.StringFrom("42"),
+			},
+			labels: []prompb.Label{
+				{Name: "test_run_id", Value: "from-tag"},
+			},
+		},
+		"tags-as-labels": {
+			tags: metrics.NewSampleTags(map[string]string{"foo": "bar", "status": "200", "iter": "3"}),
+			config: Config{
+				KeepTags:     null.BoolFrom(true),
+				TagsAsLabels: []string{"status", "method"},
+			},
+			labels: []prompb.Label{
+				{Name: "status", Value: "200"},
+			},
+		},
+		"tags-exclude": {
+			tags: metrics.NewSampleTags(map[string]string{"foo": "bar", "status": "200", "iter": "3"}),
+			config: Config{
+				KeepTags:    null.BoolFrom(true),
+				TagsExclude: []string{"iter"},
+			},
+			labels: []prompb.Label{
+				{Name: "foo", Value: "bar"},
+				{Name: "status", Value: "200"},
+			},
+		},
+		"fold-tags": {
+			tags: metrics.NewSampleTags(map[string]string{"foo": "bar", "status": "200", "iter": "3", "vu": "1"}),
+			config: Config{
+				KeepTags:     null.BoolFrom(true),
+				TagsAsLabels: []string{"status", "iter"},
+				TagsExclude:  []string{"iter"},
+				FoldTags:     null.BoolFrom(true),
+			},
+			labels: []prompb.Label{
+				{Name: "status", Value: "200"},
+				{Name: "k6_tags", Value: "foo=bar,iter=3,vu=1"},
+			},
+		},
+		"sanitize-values": {
+			tags: metrics.NewSampleTags(map[string]string{"url": "/api/" + strings.Repeat("x", 100), "body": "a\xffb"}),
+			config: Config{
+				KeepTags:            null.BoolFrom(true),
+				KeepUrlTag:          null.BoolFrom(true),
+				MaxLabelValueLength: null.IntFrom(32),
+			},
+			labels: []prompb.Label{
+				{Name: "url", Value: "/api/xxxxxxxxxx~" + sha256Prefix("/api/"+strings.Repeat("x", 100))},
+				{Name: "body", Value: "a\uFFFDb"},
+			},
+		},
 		"discard-tags": {
 			tags: metrics.NewSampleTags(map[string]string{"foo": "bar", "name": "nnn"}),
 			config: Config{
@@ -76,20 +228,80 @@ func TestTagsToLabels(t *testing.T) {
 			},
 			labels: []prompb.Label{},
 		},
+		"scenario-group-discard-tags": {
+			tags: metrics.NewSampleTags(map[string]string{"foo": "bar", "scenario": "login", "group": "::auth"}),
+			config: Config{
+				KeepTags:      null.BoolFrom(false),
+				ScenarioLabel: null.BoolFrom(true),
+				GroupLabel:    null.BoolFrom(true),
+			},
+			labels: []prompb.Label{
+				{Name: "scenario", Value: "login"},
+				{Name: "group", Value: "::auth"},
+			},
+		},
+		"scenario-group-tag-options": {
+			tags: metrics.NewSampleTags(map[string]string{"foo": "bar", "scenario": "login", "group": "::auth"}),
+			config: Config{
+				KeepTags:      null.BoolFrom(true),
+				TagsAsLabels:  []string{"foo"},
+				TagsExclude:   []string{"scenario"},
+				FoldTags:      null.BoolFrom(true),
+				ScenarioLabel: null.BoolFrom(true),
+				GroupLabel:    null.BoolFrom(true),
+			},
+			labels: []prompb.Label{
+				{Name: "foo", Value: "bar"},
+				{Name: "scenario", Value: "login"},
+				{Name: "group", Value: "::auth"},
+			},
+		},
+		"scenario-group-exclude": {
+			tags: metrics.NewSampleTags(map[string]string{"foo": "bar", "scenario": "login", "group": "::auth"}),
+			config: Config{
+				KeepTags:      null.BoolFrom(true),
+				FoldTags:      null.BoolFrom(true),
+				ScenarioLabel: null.BoolFrom(true),
+				GroupLabel:    null.BoolFrom(false),
+			},
+			labels: []prompb.Label{
+				{Name: "foo", Value: "bar"},
+				{Name: "scenario", Value: "login"},
+			},
+		},
+		"phase-setup": {
+			tags: metrics.NewSampleTags(map[string]string{"group": "::setup::login"}),
+			config: Config{
+				GroupLabel: null.BoolFrom(false),
+				PhaseLabel: null.BoolFrom(true),
+			},
+			labels: []prompb.Label{
+				{Name: "phase", Value: "setup"},
+			},
+		},
+		"phase-default": {
+			tags: metrics.NewSampleTags(map[string]string{"scenario": "default", "group": "::teardowns"}),
+			config: Config{
+				PhaseLabel: null.BoolFrom(true),
+			},
+			labels: []prompb.Label{
+				{Name: "phase", Value: "default"},
+			},
+		},
 	}
 
 	for name, testCase := range testCases {
 		testCase := testCase
 		t.Run(name, func(t *testing.T) {
-			labels, err := tagsToLabels(testCase.tags, testCase.config)
+			labels, err := tagsToLabels(testCase.tags, testCase.config, nil)
 			require.NoError(t, err)
 
 			assert.Equal(t, len(testCase.labels), len(labels))
+			assert.True(t, labelsNormalized(labels), "sorted by name: %v", labels)
 
 			for i := range testCase.labels {
 				var found bool
 
-				// order is not guaranteed ATM
 				for j := range labels {
 					if labels[j].Name == testCase.labels[i].Name {
 						assert.Equal(t, testCase.labels[i].Value, labels[j].Value)
@@ -107,3 +319,102 @@ func TestTagsToLabels(t *testing.T) {
 		})
 	}
 }
+
+func sha256Prefix(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:labelValueHashLen]
+}
+
+func BenchmarkTagsToLabels(b *testing.B) {
+	config := NewConfig()
+	tags := metrics.NewSampleTags(map[string]string{
+		"scenario": "default",
+		"method":   "GET",
+		"status":   "200",
+		"url":      "https://test.k6.io/",
+		"name":     "https://test.k6.io/",
+		"proto":    "HTTP/1.1",
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		labels, err := tagsToLabels(tags, config, nil)
+		require.NoError(b, err)
+		require.NotEmpty(b, labels)
+	}
+}
+
+func TestSanitizeLabelValue(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "short", sanitizeLabelValue("short", 10))
+	assert.Equal(t, strings.Repeat("x", 100), sanitizeLabelValue(strings.Repeat("x", 100), 0))
+
+	long := sanitizeLabelValue(strings.Repeat("x", 100), 50)
+	assert.Len(t, long, 50)
+	assert.NotEqual(t, long, sanitizeLabelValue(strings.Repeat("x", 99)+"y", 50))
+
+	// multi-byte characters are not split
+	truncated := sanitizeLabelValue(strings.Repeat("é", 50), 40)
+	assert.True(t, utf8.ValidString(truncated))
+	assert.LessOrEqual(t, len(truncated), 40)
+
+	// no room for the hash
+	assert.Equal(t, "abcde", sanitizeLabelValue(strings.Repeat("abcdefgh", 10), 5))
+}
+
+func TestNewTestRunID(t *testing.T) {
+	t.Parallel()
+
+	id, err := newTestRunID()
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, id)
+
+	other, err := newTestRunID()
+	require.NoError(t, err)
+	assert.NotEqual(t, id, other)
+}
+
+func TestResolveLabelConflicts(t *testing.T) {
+	t.Parallel()
+
+	// in the order they were set
+	labels := func() []prompb.Label {
+		return []prompb.Label{
+			{Name: "scenario", Value: "default"},
+			{Name: "job", Value: "tag"},
+			{Name: "__name__", Value: "k6_vus"},
+			{Name: "job", Value: "static"},
+		}
+	}
+
+	testCases := map[labelConflictPolicy][]prompb.Label{
+		labelConflictFirstWins: {{Name: "__name__", Value: "k6_vus"}, {Name: "job", Value: "tag"}, {Name: "scenario", Value: "default"}},
+		labelConflictLastWins:  {{Name: "__name__", Value: "k6_vus"}, {Name: "job", Value: "static"}, {Name: "scenario", Value: "default"}},
+		labelConflictPrefix: {
+			{Name: "__name__", Value: "k6_vus"}, {Name: "exported_job", Value: "tag"},
+			{Name: "job", Value: "static"}, {Name: "scenario", Value: "default"},
+		},
+	}
+	for policy, expected := range testCases {
+		assert.Equal(t, expected, resolveLabelConflicts(labels(), policy), policy)
+	}
+
+	_, err := parseLabelConflictPolicy("tag-wins")
+	assert.Error(t, err)
+}
+
+func TestNormalizeSeriesLabels(t *testing.T) {
+	t.Parallel()
+
+	shared := []prompb.Label{{Name: "le", Value: "+Inf"}, {Name: "le", Value: "1"}, {Name: "__name__", Value: "k6_bucket"}}
+	sorted := []prompb.Label{{Name: "__name__", Value: "k6_vus"}, {Name: "scenario", Value: "default"}}
+	series := []prompb.TimeSeries{{Labels: shared}, {Labels: sorted}}
+
+	normalizeSeriesLabels(series, labelConflictFirstWins)
+	assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "k6_bucket"}, {Name: "le", Value: "+Inf"}}, series[0].Labels)
+	// copied, as the labels may be shared with other series
+	assert.Equal(t, "le", shared[0].Name)
+	assert.Same(t, &sorted[0], &series[1].Labels[0])
+}
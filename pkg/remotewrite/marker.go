@@ -0,0 +1,72 @@
+package remotewrite
+
+import (
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+const (
+	testInfoMetric = "test_info"
+	phaseLabel     = "phase"
+	scriptLabel    = "script"
+
+	testPhaseStart = "start"
+	testPhaseEnd   = "end"
+)
+
+// testMarker returns the prefix+"test_info" series marking the phase of the test,
+// e.g. so that Grafana annotations bracket the test with the samples of
+// k6_test_info{phase="start"} and k6_test_info{phase="end"}.
+func testMarker(now time.Time, phase, script string, labels []prompb.Label, prefix string) []prompb.TimeSeries {
+	labels = append(labels,
+		prompb.Label{Name: phaseLabel, Value: phase},
+		prompb.Label{Name: scriptLabel, Value: script},
+		prompb.Label{Name: "__name__", Value: prefix + testInfoMetric},
+	)
+	return []prompb.TimeSeries{
+		{
+			Labels: labels,
+			Samples: []prompb.Sample{
+				{
+					Value:     1,
+					Timestamp: timestamp.FromTime(now),
+				},
+			},
+		},
+	}
+}
+
+// scriptName returns the name of the file of a local script, the URL otherwise.
+func scriptName(u *url.URL) string {
+	switch {
+	case u == nil:
+		return ""
+	case u.Scheme == "file" || u.Scheme == "":
+		return path.Base(u.Path)
+	default:
+		return u.String()
+	}
+}
+
+// writeTestMarker sends the marker of the phase right away, without waiting for a flush.
+// With TestInfo only, the marker of the start is sent, as info series of the test run.
+func (o *Output) writeTestMarker(phase string) {
+	if !o.config.Push.Bool {
+		return
+	}
+	if !o.config.TestMarkers.Bool && (o.testInfo == nil || phase != testPhaseStart) {
+		return
+	}
+	labels := append(staticLabels(nil, o.config), o.testInfo...)
+	marker := testMarker(o.now(), phase, o.script, labels, o.config.MetricPrefix.String)
+	if o.config.StaleMarkers.Bool {
+		o.sent.track(marker)
+	}
+	if err := o.write(marker); err != nil {
+		o.logger.WithError(err).WithField(phaseLabel, phase).Error("Prometheus: failed to send the test marker")
+	}
+}
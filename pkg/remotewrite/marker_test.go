@@ -0,0 +1,34 @@
+package remotewrite
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestMarker(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []prompb.TimeSeries{{
+		Labels: []prompb.Label{
+			{Name: "test_run_id", Value: "1234"},
+			{Name: "phase", Value: "start"},
+			{Name: "script", Value: "script.js"},
+			{Name: "__name__", Value: "k6_test_info"},
+		},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+	}}, testMarker(time.UnixMilli(1000), testPhaseStart, "script.js",
+		[]prompb.Label{{Name: "test_run_id", Value: "1234"}}, "k6_"))
+}
+
+func TestScriptName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "", scriptName(nil))
+	assert.Equal(t, "script.js", scriptName(&url.URL{Scheme: "file", Path: "/home/k6/tests/script.js"}))
+	assert.Equal(t, "script.js", scriptName(&url.URL{Path: "tests/script.js"}))
+	assert.Equal(t, "https://example.com/script.js", scriptName(&url.URL{Scheme: "https", Host: "example.com", Path: "/script.js"}))
+}
@@ -0,0 +1,267 @@
+package remotewrite
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"go.k6.io/k6/metrics"
+)
+
+// MetadataMapping is implemented by the mappings that know the Prometheus type
+// of the metrics they create, so that it can be sent as metric metadata and
+// backends don't show every k6 metric with the unknown type.
+type MetadataMapping interface {
+	// Metadata returns the metadata of the metric families the k6 metric is
+	// mapped to, named without the configured metric prefix.
+	Metadata(metric *metrics.Metric) []prompb.MetricMetadata
+}
+
+var (
+	_ MetadataMapping = &PrometheusMapping{}
+	_ MetadataMapping = &HistogramMapping{}
+	_ MetadataMapping = &NativeHistogramMapping{}
+	_ MetadataMapping = &DDSketchMapping{}
+	_ MetadataMapping = &HDRHistogramMapping{}
+)
+
+// builtinMetricsHelp describes the builtin k6 metrics.
+var builtinMetricsHelp = map[string]string{
+	"vus":                      "Current number of active virtual users",
+	"vus_max":                  "Max possible number of virtual users",
+	"iterations":               "The aggregate number of times the VUs executed the default function",
+	"iteration_duration":       "The time it took to complete one full iteration of the default function",
+	"dropped_iterations":       "The number of iterations that could not be started",
+	"data_received":            "The amount of received data",
+	"data_sent":                "The amount of data sent",
+	"checks":                   "The rate of successful checks",
+	"group_duration":           "Time it took to execute a group",
+	"http_reqs":                "How many HTTP requests k6 generated",
+	"http_req_blocked":         "Time spent blocked (waiting for a free TCP connection slot) before initiating the request",
+	"http_req_connecting":      "Time spent establishing TCP connection to the remote host",
+	"http_req_tls_handshaking": "Time spent handshaking TLS session with remote host",
+	"http_req_sending":         "Time spent sending data to the remote host",
+	"http_req_waiting":         "Time spent waiting for response from remote host",
+	"http_req_receiving":       "Time spent receiving response data from the remote host",
+	"http_req_duration":        "Total time for the request, excluding the time spent blocked, connecting and handshaking",
+	"http_req_failed":          "The rate of failed requests",
+	"ws_connecting":            "Total duration for the WebSocket connection request",
+	"ws_session_duration":      "Duration of the WebSocket session",
+	"ws_sessions":              "Total number of started WebSocket sessions",
+	"ws_msgs_sent":             "Total number of messages sent",
+	"ws_msgs_received":         "Total number of received messages",
+	"ws_ping":                  "Duration between a ping request and its pong reception",
+	"grpc_req_duration":        "Time to receive response from remote host",
+}
+
+// metricHelp returns the description of the builtin metrics, a generic one for custom metrics.
+func metricHelp(metric *metrics.Metric) string {
+	if help, ok := builtinMetricsHelp[metric.Name]; ok {
+		return help
+	}
+	return fmt.Sprintf("k6 %s metric %s", metric.Type, metric.Name)
+}
+
+// metricUnit returns the unit of the values of the metric, empty if they have none.
+func metricUnit(metric *metrics.Metric) string {
+	switch metric.Contains {
+	case metrics.Time:
+		return "milliseconds"
+	case metrics.Data:
+		return "bytes"
+	default:
+		return ""
+	}
+}
+
+func newMetricMetadata(metric *metrics.Metric, name string, t prompb.MetricMetadata_MetricType) prompb.MetricMetadata {
+	return prompb.MetricMetadata{
+		Type:             t,
+		MetricFamilyName: name,
+		Help:             metricHelp(metric),
+		Unit:             metricUnit(metric),
+	}
+}
+
+func (pm *PrometheusMapping) Metadata(metric *metrics.Metric) []prompb.MetricMetadata {
+	switch metric.Type {
+	case metrics.Counter:
+		return []prompb.MetricMetadata{newMetricMetadata(metric, metric.Name, prompb.MetricMetadata_COUNTER)}
+	case metrics.Rate:
+		if !pm.rateCounters {
+			return []prompb.MetricMetadata{newMetricMetadata(metric, metric.Name, prompb.MetricMetadata_GAUGE)}
+		}
+		return []prompb.MetricMetadata{
+			newMetricMetadata(metric, metric.Name+"_total", prompb.MetricMetadata_COUNTER),
+			newMetricMetadata(metric, metric.Name+"_success_total", prompb.MetricMetadata_COUNTER),
+		}
+	case metrics.Trend:
+		stats := pm.trendStats
+		if len(stats) == 0 {
+			stats = defaultTrendStats
+		}
+		metadata := make([]prompb.MetricMetadata, 0, len(stats))
+		for _, stat := range stats {
+			metadata = append(metadata,
+				newMetricMetadata(metric, metric.Name+"_"+stat.suffix, prompb.MetricMetadata_GAUGE))
+		}
+		return metadata
+	default:
+		return []prompb.MetricMetadata{newMetricMetadata(metric, metric.Name, prompb.MetricMetadata_GAUGE)}
+	}
+}
+
+func (hm *HistogramMapping) Metadata(metric *metrics.Metric) []prompb.MetricMetadata {
+	if metric.Type != metrics.Trend {
+		return hm.PrometheusMapping.Metadata(metric)
+	}
+	return []prompb.MetricMetadata{newMetricMetadata(metric, metric.Name, prompb.MetricMetadata_HISTOGRAM)}
+}
+
+func (nm *NativeHistogramMapping) Metadata(metric *metrics.Metric) []prompb.MetricMetadata {
+	if metric.Type != metrics.Trend {
+		return nm.PrometheusMapping.Metadata(metric)
+	}
+	return []prompb.MetricMetadata{newMetricMetadata(metric, metric.Name, prompb.MetricMetadata_HISTOGRAM)}
+}
+
+func (hm *HDRHistogramMapping) Metadata(metric *metrics.Metric) []prompb.MetricMetadata {
+	if metric.Type != metrics.Trend {
+		return hm.PrometheusMapping.Metadata(metric)
+	}
+	return []prompb.MetricMetadata{newMetricMetadata(metric, metric.Name, prompb.MetricMetadata_HISTOGRAM)}
+}
+
+// metadataTracker collects the metadata of the metrics not sent yet.
+// It also keeps the metadata of all the metric families seen, which remote
+// write 2.0 sends with each series instead of in requests of their own.
+type metadataTracker struct {
+	mapping MetadataMapping
+	prefix  string
+	strict  bool
+	// delta is set with delta temporality, the counters are then sent as gauges.
+	delta bool
+	// created is the created timestamp of the cumulative series, in milliseconds:
+	// they all start counting when the output is created.
+	created int64
+
+	sent    map[string]struct{}
+	pending map[string]prompb.MetricMetadata
+
+	// known is read while encoding the requests, which may happen concurrently with add.
+	mu    sync.RWMutex
+	known map[string]prompb.MetricMetadata
+}
+
+// newMetadataTracker returns nil if the mapping doesn't provide metadata.
+func newMetadataTracker(mapping Mapping, config Config) *metadataTracker {
+	mm, ok := mapping.(MetadataMapping)
+	if !ok {
+		return nil
+	}
+	return &metadataTracker{
+		mapping: mm,
+		prefix:  config.MetricPrefix.String,
+		strict:  config.StrictNames.Bool,
+		delta:   temporality(config.Temporality.String) == temporalityDelta,
+		created: timestamp.FromTime(time.Now()),
+		sent:    make(map[string]struct{}),
+		pending: make(map[string]prompb.MetricMetadata),
+		known:   make(map[string]prompb.MetricMetadata),
+	}
+}
+
+// add records the metadata of the metrics of the samples, unless they were sent.
+// It's a no-op on a nil receiver.
+func (t *metadataTracker) add(samplesContainers []metrics.SampleContainer) {
+	if t == nil {
+		return
+	}
+	for _, container := range samplesContainers {
+		for _, sample := range container.GetSamples() {
+			if _, ok := t.sent[sample.Metric.Name]; ok {
+				continue
+			}
+			t.sent[sample.Metric.Name] = struct{}{}
+			for _, m := range t.mapping.Metadata(sample.Metric) {
+				m.MetricFamilyName = t.prefix + m.MetricFamilyName
+				if t.delta && m.Type == prompb.MetricMetadata_COUNTER {
+					m.Type = prompb.MetricMetadata_GAUGE
+				}
+				if !validName(m.MetricFamilyName, true) {
+					if t.strict {
+						continue
+					}
+					m.MetricFamilyName = sanitizeName(m.MetricFamilyName, true)
+				}
+				t.pending[m.MetricFamilyName] = m
+				t.mu.Lock()
+				t.known[m.MetricFamilyName] = m
+				t.mu.Unlock()
+			}
+		}
+	}
+}
+
+// lookup returns the metadata of the family of the series named name: the
+// series of the classic histograms have the suffixes of their buckets, sum and count.
+// It returns false on a nil receiver.
+func (t *metadataTracker) lookup(name string) (prompb.MetricMetadata, bool) {
+	if t == nil {
+		return prompb.MetricMetadata{}, false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if m, ok := t.known[name]; ok {
+		return m, true
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		if m, ok := t.known[strings.TrimSuffix(name, suffix)]; ok && m.Type == prompb.MetricMetadata_HISTOGRAM {
+			return m, true
+		}
+	}
+	return prompb.MetricMetadata{}, false
+}
+
+// createdTimestamp returns the created timestamp of the series of the family,
+// zero unless they're cumulative: counters and histograms without delta temporality.
+func (t *metadataTracker) createdTimestamp(m prompb.MetricMetadata) int64 {
+	if t.delta {
+		return 0
+	}
+	switch m.Type {
+	case prompb.MetricMetadata_COUNTER, prompb.MetricMetadata_HISTOGRAM:
+		return t.created
+	default:
+		return 0
+	}
+}
+
+// take returns the pending metadata, which is then expected to be sent.
+func (t *metadataTracker) take() []prompb.MetricMetadata {
+	if t == nil || len(t.pending) == 0 {
+		return nil
+	}
+	metadata := make([]prompb.MetricMetadata, 0, len(t.pending))
+	for _, m := range t.pending {
+		metadata = append(metadata, m)
+	}
+	t.pending = make(map[string]prompb.MetricMetadata)
+	return metadata
+}
+
+// putBack makes the metadata pending again, e.g. after a failed request.
+func (t *metadataTracker) putBack(metadata []prompb.MetricMetadata) {
+	for _, m := range metadata {
+		if _, ok := t.pending[m.MetricFamilyName]; !ok {
+			t.pending[m.MetricFamilyName] = m
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package remotewrite
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestMappingMetadata(t *testing.T) {
+	t.Parallel()
+
+	reqs := &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}
+	duration := &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend, Contains: metrics.Time}
+	custom := &metrics.Metric{Name: "cart_size", Type: metrics.Gauge, Contains: metrics.Data}
+
+	pm := &PrometheusMapping{}
+	assert.Equal(t, []prompb.MetricMetadata{{
+		Type:             prompb.MetricMetadata_COUNTER,
+		MetricFamilyName: "http_reqs",
+		Help:             "How many HTTP requests k6 generated",
+	}}, pm.Metadata(reqs))
+
+	assert.Equal(t, []prompb.MetricMetadata{{
+		Type:             prompb.MetricMetadata_GAUGE,
+		MetricFamilyName: "cart_size",
+		Help:             "k6 gauge metric cart_size",
+		Unit:             "bytes",
+	}}, pm.Metadata(custom))
+
+	trend := pm.Metadata(duration)
+	require.Len(t, trend, len(defaultTrendStats))
+	for _, m := range trend {
+		assert.Equal(t, prompb.MetricMetadata_GAUGE, m.Type)
+		assert.Equal(t, "milliseconds", m.Unit)
+	}
+	assert.Equal(t, "http_req_duration_min", trend[0].MetricFamilyName)
+
+	for _, mapping := range []MetadataMapping{&HistogramMapping{}, &NativeHistogramMapping{}} {
+		assert.Equal(t, []prompb.MetricMetadata{{
+			Type:             prompb.MetricMetadata_HISTOGRAM,
+			MetricFamilyName: "http_req_duration",
+			Help:             builtinMetricsHelp["http_req_duration"],
+			Unit:             "milliseconds",
+		}}, mapping.Metadata(duration))
+		assert.Equal(t, prompb.MetricMetadata_COUNTER, mapping.Metadata(reqs)[0].Type)
+	}
+
+	_, ok := Mapping(&RawMapping{}).(MetadataMapping)
+	assert.False(t, ok)
+}
+
+func TestMetadataTracker(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	assert.Nil(t, newMetadataTracker(&RawMapping{}, config))
+
+	tracker := newMetadataTracker(&PrometheusMapping{}, config)
+	reqs := &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}
+	vus := &metrics.Metric{Name: "vus", Type: metrics.Gauge}
+	samples := []metrics.SampleContainer{metrics.Samples{
+		{Metric: reqs, Value: 1},
+		{Metric: reqs, Value: 1},
+		{Metric: vus, Value: 3},
+	}}
+
+	tracker.add(samples)
+	metadata := tracker.take()
+	require.Len(t, metadata, 2)
+	names := []string{metadata[0].MetricFamilyName, metadata[1].MetricFamilyName}
+	assert.ElementsMatch(t, []string{"k6_http_reqs", "k6_vus"}, names)
+
+	// sent once only, unless put back after a failure
+	tracker.add(samples)
+	assert.Empty(t, tracker.take())
+	tracker.putBack(metadata)
+	assert.Len(t, tracker.take(), 2)
+
+	// nil-safe
+	var empty *metadataTracker
+	empty.add(samples)
+	assert.Nil(t, empty.take())
+}
+
+func TestOutputWriteMetadata(t *testing.T) {
+	t.Parallel()
+
+	var (
+		status = http.StatusInternalServerError
+		req    prompb.WriteRequest
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		decoded, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		req = prompb.WriteRequest{}
+		require.NoError(t, req.Unmarshal(decoded))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+	config.RetryMaxAttempts = null.IntFrom(1)
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	o := &Output{
+		config:   config,
+		client:   client,
+		retry:    newRetryPolicy(config),
+		metadata: newMetadataTracker(&PrometheusMapping{}, config),
+		logger:   logrus.New(),
+	}
+	o.metadata.add([]metrics.SampleContainer{metrics.Sample{
+		Metric: &metrics.Metric{Name: "vus", Type: metrics.Gauge},
+		Value:  1,
+	}})
+
+	require.Error(t, o.writeMetadata())
+	status = http.StatusNoContent
+	require.NoError(t, o.writeMetadata())
+	assert.Empty(t, req.Timeseries)
+	assert.Equal(t, []prompb.MetricMetadata{{
+		Type:             prompb.MetricMetadata_GAUGE,
+		MetricFamilyName: "k6_vus",
+		Help:             "Current number of active virtual users",
+	}}, req.Metadata)
+
+	// nothing left to send
+	req = prompb.WriteRequest{}
+	require.NoError(t, o.writeMetadata())
+	assert.Empty(t, req.Metadata)
+}
@@ -0,0 +1,91 @@
+package remotewrite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	promConfig "github.com/prometheus/common/config"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/sirupsen/logrus"
+)
+
+// MetricRoute sends the series whose name matches Match to their own endpoint,
+// with their own authentication and headers instead of those of the URL.
+type MetricRoute struct {
+	// Match is a regular expression matched against the whole name of the series,
+	// e.g. k6_http_req_duration_.* for the series of the durations of the requests.
+	Match       string            `json:"match"`
+	URL         string            `json:"url"`
+	TenantID    string            `json:"tenantID,omitempty"`
+	User        string            `json:"user,omitempty"`
+	Password    string            `json:"password,omitempty"`
+	BearerToken string            `json:"bearerToken,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+// clientConfig returns conf with the authentication and the headers of the route.
+// The TLS, proxy and timeout options are the same for all the endpoints.
+func (r MetricRoute) clientConfig(conf *remote.ClientConfig) *remote.ClientConfig {
+	routeConf := *conf
+
+	httpConfig := conf.HTTPClientConfig
+	httpConfig.BasicAuth = nil
+	httpConfig.BearerToken = ""
+	httpConfig.BearerTokenFile = ""
+	httpConfig.Authorization = nil
+	httpConfig.OAuth2 = nil
+	if r.User != "" {
+		httpConfig.BasicAuth = &promConfig.BasicAuth{
+			Username: r.User,
+			Password: promConfig.Secret(r.Password),
+		}
+	}
+	if r.BearerToken != "" {
+		httpConfig.Authorization = &promConfig.Authorization{
+			Type:        "Bearer",
+			Credentials: promConfig.Secret(r.BearerToken),
+		}
+	}
+	routeConf.HTTPClientConfig = httpConfig
+
+	routeConf.Headers = make(map[string]string, len(r.Headers)+1)
+	for k, v := range r.Headers {
+		routeConf.Headers[k] = v
+	}
+	if r.TenantID != "" {
+		routeConf.Headers[tenantHeader] = r.TenantID
+	}
+	return &routeConf
+}
+
+// metricRoute is a MetricRoute ready to match the series.
+type metricRoute struct {
+	match *regexp.Regexp
+	route *endpointRoute
+}
+
+// newMetricRoutes returns the routes in the order of the config, the first matching one is used.
+func newMetricRoutes(
+	conf *remote.ClientConfig, p protocol, config Config, logger logrus.FieldLogger, self *selfMetrics,
+) ([]metricRoute, error) {
+	routes := make([]metricRoute, 0, len(config.MetricRoutes))
+	for _, r := range config.MetricRoutes {
+		match, err := compileAnchored([]string{r.Match})
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric route match: %w", err)
+		}
+
+		// the WAL of a route is kept across runs as long as its match and URL don't change
+		sum := sha256.Sum256([]byte(r.Match + "\n" + r.URL))
+		walDir := filepath.Join("metrics", hex.EncodeToString(sum[:8]))
+		route, err := newEndpointRoute("metrics-"+r.Match, r.clientConfig(conf), r.URL, walDir, p, config, logger, self)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, metricRoute{match: match[0], route: route})
+	}
+	return routes, nil
+}
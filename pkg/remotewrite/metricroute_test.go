@@ -0,0 +1,120 @@
+package remotewrite
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestOutputMetricRoutes(t *testing.T) {
+	t.Parallel()
+
+	type request struct {
+		auth, tenant, custom string
+		names                []string
+	}
+	var (
+		mu       sync.Mutex
+		received = map[string]request{}
+	)
+	handler := func(server string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			decoded, err := snappy.Decode(nil, body)
+			require.NoError(t, err)
+			var req prompb.WriteRequest
+			require.NoError(t, req.Unmarshal(decoded))
+
+			names := make([]string, 0, len(req.Timeseries))
+			for _, ts := range req.Timeseries {
+				names = append(names, ts.Labels[0].Value)
+			}
+			sort.Strings(names)
+
+			mu.Lock()
+			defer mu.Unlock()
+			received[server] = request{
+				auth:   r.Header.Get("Authorization"),
+				tenant: r.Header.Get(tenantHeader),
+				custom: r.Header.Get("X-Custom"),
+				names:  names,
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+	primary := httptest.NewServer(handler("primary"))
+	defer primary.Close()
+	raw := httptest.NewServer(handler("raw"))
+	defer raw.Close()
+	summaries := httptest.NewServer(handler("summaries"))
+	defer summaries.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(primary.URL)
+	config.BearerToken = null.StringFrom("primary-token")
+	config.TenantID = null.StringFrom("shared")
+	config.TenantTag = null.StringFrom("team")
+	config.TenantRoutes = []TenantRoute{{Value: "checkout", TenantID: "team-checkout"}}
+	config.MetricRoutes = []MetricRoute{
+		{Match: "k6_http_req_duration_p.*", URL: summaries.URL, User: "cloud", Password: "secret", TenantID: "1234"},
+		{Match: "k6_http_.*", URL: raw.URL, Headers: map[string]string{"X-Custom": "vm"}},
+	}
+	require.NoError(t, config.Validate())
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+	tenants, err := newTenantRoutes(remoteConfig, protocolV1, config, logrus.New(), newSelfMetrics())
+	require.NoError(t, err)
+	metricRoutes, err := newMetricRoutes(remoteConfig, protocolV1, config, logrus.New(), newSelfMetrics())
+	require.NoError(t, err)
+
+	o := &Output{
+		config:       config,
+		client:       client,
+		tenants:      tenants,
+		metricRoutes: metricRoutes,
+		retry:        newRetryPolicy(config),
+		self:         newSelfMetrics(),
+		logger:       logrus.New(),
+	}
+
+	series := func(name string) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels:  []prompb.Label{{Name: "__name__", Value: name}, {Name: "team", Value: "checkout"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		}
+	}
+	require.NoError(t, o.write([]prompb.TimeSeries{
+		series("k6_http_req_duration_p99"),
+		series("k6_http_req_duration_bucket"),
+		series("k6_http_reqs_total"),
+		series("k6_vus"),
+	}))
+
+	assert.Equal(t, map[string]request{
+		"summaries": {auth: "Basic Y2xvdWQ6c2VjcmV0", tenant: "1234", names: []string{"k6_http_req_duration_p99"}},
+		"raw":       {custom: "vm", names: []string{"k6_http_req_duration_bucket", "k6_http_reqs_total"}},
+		"primary":   {auth: "Bearer primary-token", tenant: "team-checkout", names: []string{"k6_vus"}},
+	}, received)
+
+	config.MetricRoutes = []MetricRoute{{Match: "k6_(", URL: "grpc://localhost:10901", User: "u", BearerToken: "t"}}
+	var validationErr *ValidationError
+	require.ErrorAs(t, config.Validate(), &validationErr)
+	assert.Equal(t, []string{
+		`metric route match "k6_(" must be a regular expression matching the names of the series, e.g. k6_http_req_.*`,
+		`"grpc://localhost:10901" can't be used with url "` + primary.URL + `": all the endpoints must use HTTP`,
+		`metric route "k6_(" can use only one authentication method: keep either user/password or bearerToken`,
+	}, validationErr.Problems)
+}
@@ -2,8 +2,11 @@ package remotewrite
 
 import (
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
-	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/prompb"
 	"go.k6.io/k6/metrics"
 )
@@ -11,35 +14,58 @@ import (
 // Note: k6 Registry is not used here since Output is getting
 // samples only from k6 engine, hence we assume they are already vetted.
 
-// metricsStorage is an in-memory gather point for metrics
-type metricsStorage struct {
+// MetricsStorage is an in-memory gather point for metrics. Mappings use it to
+// accumulate the samples of each metric, as the series sent are cumulative.
+// The samples are accumulated per label set, so that e.g. the counter of each
+// scenario only counts the samples of that scenario.
+//
+// The values are cumulative since the start of the test and never reset while
+// it runs. Samples are expected in time order: those older than the latest
+// one of their label set are still accumulated, but Timestamp sends them with
+// the latest timestamp so that the values sent never go back in time.
+type MetricsStorage struct {
 	m map[string]*metrics.Metric
+	// last holds the latest timestamp used for each label set, in milliseconds,
+	// updated in place so that storing it doesn't copy the key.
+	last map[string]*int64
+	// windows holds the end of the aggregation window of the Trend sink of each label set.
+	windows map[string]int64
+
+	// key is the buffer the label sets are looked up with, the samples being
+	// converted by one flush at a time.
+	key []byte
+	// series, labels and samples are the buffers scratchSeries writes the series in.
+	series  []prompb.TimeSeries
+	labels  []prompb.Label
+	samples []prompb.Sample
 }
 
-func newMetricsStorage() *metricsStorage {
-	return &metricsStorage{
-		m: make(map[string]*metrics.Metric),
+func newMetricsStorage() *MetricsStorage {
+	return &MetricsStorage{
+		m:    make(map[string]*metrics.Metric),
+		last: make(map[string]*int64),
 	}
 }
 
-// update modifies metricsStorage and returns updated sample
-// so that the stored metric and the returned metric hold the same value
-func (ms *metricsStorage) update(sample metrics.Sample, add func(*metrics.Metric, metrics.Sample)) *metrics.Metric {
-	m, ok := ms.m[sample.Metric.Name]
+// Update modifies MetricsStorage and returns updated sample
+// so that the stored metric and the returned metric hold the same value.
+// If add is nil, the sample is added to the Sink of the metric type.
+func (ms *MetricsStorage) Update(
+	sample metrics.Sample, labels []prompb.Label, add func(*metrics.Metric, metrics.Sample),
+) *metrics.Metric {
+	return ms.UpdateWithSink(sample, labels, newSink, add)
+}
+
+// UpdateWithSink works as Update but lets the caller decide which Sink
+// is created the first time the label set of the metric is seen.
+func (ms *MetricsStorage) UpdateWithSink(
+	sample metrics.Sample, labels []prompb.Label,
+	newSink func(metrics.MetricType) metrics.Sink, add func(*metrics.Metric, metrics.Sample),
+) *metrics.Metric {
+	ms.key = appendStorageKey(ms.key[:0], sample, labels)
+	m, ok := ms.m[string(ms.key)]
 	if !ok {
-		var sink metrics.Sink
-		switch sample.Metric.Type {
-		case metrics.Counter:
-			sink = &metrics.CounterSink{}
-		case metrics.Gauge:
-			sink = &metrics.GaugeSink{}
-		case metrics.Trend:
-			sink = &metrics.TrendSink{}
-		case metrics.Rate:
-			sink = &metrics.RateSink{}
-		default:
-			panic("the Metric Type is not supported")
-		}
+		sink := newSink(sample.Metric.Type)
 
 		m = &metrics.Metric{
 			Name:     sample.Metric.Name,
@@ -48,7 +74,7 @@ func (ms *metricsStorage) update(sample metrics.Sample, add func(*metrics.Metric
 			Sink:     sink,
 		}
 
-		ms.m[m.Name] = m
+		ms.m[string(ms.key)] = m
 	}
 
 	// TODO: https://github.com/grafana/xk6-output-prometheus-remote/issues/11
@@ -71,8 +97,95 @@ func (ms *metricsStorage) update(sample metrics.Sample, add func(*metrics.Metric
 	return m
 }
 
+// Timestamp returns the timestamp, in milliseconds, to send the cumulative
+// series of the sample with: its own or, if it's older, the latest one used
+// for its label set. Otherwise a sample arriving late, e.g. in a following
+// flush, would give a value greater than the one already sent for a later
+// time and break rate() and increase().
+func (ms *MetricsStorage) Timestamp(sample metrics.Sample, labels []prompb.Label) int64 {
+	ts := timestamp.FromTime(sample.Time)
+	ms.key = appendStorageKey(ms.key[:0], sample, labels)
+	last, ok := ms.last[string(ms.key)]
+	if !ok {
+		last = new(int64)
+		ms.last[string(ms.key)] = last
+	} else if *last > ts {
+		return *last
+	}
+	*last = ts
+	return ts
+}
+
+// DistinctTimestamp returns the timestamp, in milliseconds, to send the sample with
+// so that it isn't dropped as a duplicate of another sample of its label set: its own
+// or, if it isn't later than the latest one used for its label set, step milliseconds
+// after that one. Samples are expected in time order, the following ones being offset
+// too, so that a label set with more samples than one per step would drift ahead of
+// their times: a timestamp more than maxOffset milliseconds after the time of the
+// sample isn't used, and false is returned for the sample to be dropped.
+func (ms *MetricsStorage) DistinctTimestamp(
+	sample metrics.Sample, labels []prompb.Label, step, maxOffset int64,
+) (int64, bool) {
+	ts := timestamp.FromTime(sample.Time)
+	ms.key = appendStorageKey(ms.key[:0], sample, labels)
+	last, ok := ms.last[string(ms.key)]
+	if !ok {
+		last = new(int64)
+		ms.last[string(ms.key)] = last
+	} else if *last >= ts {
+		if *last+step-ts > maxOffset {
+			return 0, false
+		}
+		ts = *last + step
+	}
+	*last = ts
+	return ts, true
+}
+
+// scratchSeries returns the series of labels, with name as __name__, and its sample
+// in buffers reused for each sample, so that mapping a sample doesn't allocate.
+// The series is only valid until the next call: seriesAggregator copies it.
+func (ms *MetricsStorage) scratchSeries(labels []prompb.Label, name string, s prompb.Sample) []prompb.TimeSeries {
+	ms.labels = append(append(ms.labels[:0], labels...), prompb.Label{Name: "__name__", Value: name})
+	ms.samples = append(ms.samples[:0], s)
+	ms.series = append(ms.series[:0], prompb.TimeSeries{Labels: ms.labels, Samples: ms.samples})
+	return ms.series
+}
+
+func storageKey(sample metrics.Sample, labels []prompb.Label) string {
+	return string(appendStorageKey(nil, sample, labels))
+}
+
+// appendStorageKey appends the key of storageKey to b, see appendLabelsKey.
+func appendStorageKey(b []byte, sample metrics.Sample, labels []prompb.Label) []byte {
+	b = append(b, sample.Metric.Name...)
+	b = append(b, '\xff')
+	return appendLabelsKey(b, labels)
+}
+
+func newSink(t metrics.MetricType) metrics.Sink {
+	switch t {
+	case metrics.Counter:
+		return &metrics.CounterSink{}
+	case metrics.Gauge:
+		return &metrics.GaugeSink{}
+	case metrics.Trend:
+		return &metrics.TrendSink{}
+	case metrics.Rate:
+		return &metrics.RateSink{}
+	default:
+		panic("the Metric Type is not supported")
+	}
+}
+
 // transform k6 sample into TimeSeries for remote-write
-func (ms *metricsStorage) transform(mapping Mapping, sample metrics.Sample, labels []prompb.Label) ([]prompb.TimeSeries, error) {
+func (ms *MetricsStorage) transform(mapping Mapping, sample metrics.Sample, labels []prompb.Label) ([]prompb.TimeSeries, error) {
+	if pm := prometheusMappingOf(mapping); pm != nil {
+		if newts, ok := pm.mapScratch(ms, sample, labels); ok {
+			return newts, nil
+		}
+	}
+
 	var newts []prompb.TimeSeries
 
 	switch sample.Metric.Type {
@@ -98,39 +211,125 @@ func (ms *metricsStorage) transform(mapping Mapping, sample metrics.Sample, labe
 // Mapping represents the specific way k6 metrics can be mapped to metrics of
 // remote agent. As each remote agent can use different ways to store metrics as well as
 // expect different values on remote write endpoint, they must have their own support.
+// Mappings set the __name__ label without the configured metric prefix: Output adds it.
+// The labels must not be modified in place as they are shared by all the returned series.
+//
+// Other extensions can provide their own mappings with RegisterMapping.
 type Mapping interface {
-	MapCounter(ms *metricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries
-	MapGauge(ms *metricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries
-	MapRate(ms *metricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries
-	MapTrend(ms *metricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries
+	MapCounter(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries
+	MapGauge(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries
+	MapRate(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries
+	MapTrend(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries
 
 	// AdjustLabels(labels []prompb.Label) []prompb.Label
 }
 
-func NewMapping(mapping string) Mapping {
-	switch mapping {
-	case "prometheus":
-		return &PrometheusMapping{}
-	default:
+// MappingFactory returns the Mapping for the configuration of the output.
+type MappingFactory func(config Config) Mapping
+
+var (
+	mappingsMu sync.RWMutex
+	mappings   = map[string]MappingFactory{
+		"prometheus": func(config Config) Mapping {
+			// invalid stats are rejected by New
+			trendStats, _ := parseTrendStats(config.TrendStats)
+			return &PrometheusMapping{trendStats: trendStats, rateCounters: config.RateCounters.Bool}
+		},
+		"native-histogram": func(config Config) Mapping {
+			return &NativeHistogramMapping{
+				PrometheusMapping: PrometheusMapping{rateCounters: config.RateCounters.Bool},
+			}
+		},
+		"hdr-histogram": func(config Config) Mapping {
+			return &HDRHistogramMapping{
+				PrometheusMapping: PrometheusMapping{rateCounters: config.RateCounters.Bool},
+			}
+		},
+		"histogram": func(config Config) Mapping {
+			hm := NewHistogramMapping(config.TrendBuckets)
+			hm.rateCounters = config.RateCounters.Bool
+			return hm
+		},
+		"ddsketch": func(config Config) Mapping {
+			trendStats, _ := parseTrendStats(config.TrendStats)
+			return &DDSketchMapping{
+				PrometheusMapping: PrometheusMapping{trendStats: trendStats, rateCounters: config.RateCounters.Bool},
+			}
+		},
+		"raw": func(Config) Mapping {
+			return &RawMapping{}
+		},
+		"raw-all": func(config Config) Mapping {
+			step := time.Duration(config.TimestampPrecision.Duration).Milliseconds()
+			if step < 1 {
+				step = 1
+			}
+			maxOffset := time.Duration(config.FlushPeriod.Duration).Milliseconds()
+			if maxOffset < step {
+				maxOffset = step
+			}
+			return &RawAllMapping{step: step, maxOffset: maxOffset}
+		},
+	}
+)
+
+// RegisterMapping makes a Mapping available under the name, to be selected
+// with the mapping option. It's meant to be called from the init function of
+// another extension or of a fork, and panics if the name is already registered.
+func RegisterMapping(name string, factory MappingFactory) {
+	mappingsMu.Lock()
+	defer mappingsMu.Unlock()
+
+	if factory == nil {
+		panic("remotewrite: RegisterMapping factory is nil")
+	}
+	if _, ok := mappings[name]; ok {
+		panic(fmt.Sprintf("remotewrite: mapping %q is already registered", name))
+	}
+	mappings[name] = factory
+}
+
+// mappingNames returns the names of the registered mappings, sorted.
+func mappingNames() []string {
+	mappingsMu.RLock()
+	defer mappingsMu.RUnlock()
+
+	names := make([]string, 0, len(mappings))
+	for name := range mappings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewMapping returns the Mapping registered with the configured name,
+// the raw mapping if there is none.
+func NewMapping(config Config) Mapping {
+	mappingsMu.RLock()
+	factory, ok := mappings[config.Mapping.String]
+	mappingsMu.RUnlock()
+
+	if !ok {
 		return &RawMapping{}
 	}
+	return factory(config)
 }
 
 type RawMapping struct{}
 
-func (rm *RawMapping) MapCounter(ms *metricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+func (rm *RawMapping) MapCounter(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
 	return rm.processSample(sample, labels)
 }
 
-func (rm *RawMapping) MapGauge(ms *metricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+func (rm *RawMapping) MapGauge(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
 	return rm.processSample(sample, labels)
 }
 
-func (rm *RawMapping) MapRate(ms *metricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+func (rm *RawMapping) MapRate(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
 	return rm.processSample(sample, labels)
 }
 
-func (rm *RawMapping) MapTrend(ms *metricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+func (rm *RawMapping) MapTrend(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
 	return rm.processSample(sample, labels)
 }
 
@@ -139,7 +338,7 @@ func (rm *RawMapping) processSample(sample metrics.Sample, labels []prompb.Label
 		{
 			Labels: append(labels, prompb.Label{
 				Name:  "__name__",
-				Value: fmt.Sprintf("%s%s", defaultMetricPrefix, sample.Metric.Name),
+				Value: sample.Metric.Name,
 			}),
 			Samples: []prompb.Sample{
 				{
@@ -150,3 +349,62 @@ func (rm *RawMapping) processSample(sample metrics.Sample, labels []prompb.Label
 		},
 	}
 }
+
+// RawAllMapping is the raw mapping keeping every sample. The samples are timed in
+// nanoseconds but sent in milliseconds, so that those of a series in the same
+// millisecond would be deduplicated: they're offset to the following milliseconds
+// instead, or to the following multiples of the timestamp precision. The offset is
+// at most a flush period, beyond which the endpoints could reject the samples as
+// too far in the future: the samples of a series with more samples than that are
+// dropped, and counted as crowded.
+type RawAllMapping struct {
+	step      int64
+	maxOffset int64
+	// crowded is the number of samples dropped since the last takeCrowded,
+	// the samples being converted by one flush at a time
+	crowded int
+}
+
+func (rm *RawAllMapping) MapCounter(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+	return rm.processSample(ms, sample, labels)
+}
+
+func (rm *RawAllMapping) MapGauge(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+	return rm.processSample(ms, sample, labels)
+}
+
+func (rm *RawAllMapping) MapRate(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+	return rm.processSample(ms, sample, labels)
+}
+
+func (rm *RawAllMapping) MapTrend(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+	return rm.processSample(ms, sample, labels)
+}
+
+func (rm *RawAllMapping) processSample(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+	ts, ok := ms.DistinctTimestamp(sample, labels, rm.step, rm.maxOffset)
+	if !ok {
+		rm.crowded++
+		return nil
+	}
+	series := (&RawMapping{}).processSample(sample, labels)
+	series[0].Samples[0].Timestamp = ts
+	return series
+}
+
+// takeCrowded returns the number of samples dropped since the last call.
+func (rm *RawAllMapping) takeCrowded() int {
+	crowded := rm.crowded
+	rm.crowded = 0
+	return crowded
+}
+
+// isRawMapping reports whether the mapping sends the samples as they are, without aggregating them.
+func isRawMapping(m Mapping) bool {
+	switch m.(type) {
+	case *RawMapping, *RawAllMapping:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,120 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+type counterOnlyMapping struct {
+	RawMapping
+}
+
+func (m *counterOnlyMapping) MapGauge(*MetricsStorage, metrics.Sample, []prompb.Label) []prompb.TimeSeries {
+	return nil
+}
+
+// unregisterMapping removes the mapping registered under the name.
+func unregisterMapping(name string) {
+	mappingsMu.Lock()
+	defer mappingsMu.Unlock()
+
+	delete(mappings, name)
+}
+
+func TestRegisterMapping(t *testing.T) {
+	t.Parallel()
+
+	RegisterMapping("test-counter-only", func(Config) Mapping {
+		return &counterOnlyMapping{}
+	})
+	// the registry is global, so that the test can be run again
+	t.Cleanup(func() { unregisterMapping("test-counter-only") })
+
+	config := NewConfig()
+	config.Mapping = null.StringFrom("test-counter-only")
+	assert.IsType(t, &counterOnlyMapping{}, NewMapping(config))
+
+	config.Mapping = null.StringFrom("unknown")
+	assert.IsType(t, &RawMapping{}, NewMapping(config))
+	config.Mapping = null.StringFrom("histogram")
+	assert.IsType(t, &HistogramMapping{}, NewMapping(config))
+
+	assert.Panics(t, func() {
+		RegisterMapping("prometheus", func(Config) Mapping { return &RawMapping{} })
+	})
+	assert.Panics(t, func() {
+		RegisterMapping("test-nil", nil)
+	})
+}
+
+func TestRawAllMapping(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.Mapping = null.StringFrom("raw-all")
+	mapping := NewMapping(config)
+	require.IsType(t, &RawAllMapping{}, mapping)
+	assert.True(t, isRawMapping(mapping))
+
+	ms := newMetricsStorage()
+	metric := &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend}
+	other := &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}
+	at := time.UnixMilli(1_700_000_001_000)
+
+	var timestamps []int64
+	for _, sample := range []metrics.Sample{
+		{Metric: metric, Time: at, Value: 1},
+		{Metric: metric, Time: at.Add(200 * time.Microsecond), Value: 2},
+		{Metric: metric, Time: at.Add(700 * time.Microsecond), Value: 3},
+		{Metric: metric, Time: at.Add(5 * time.Millisecond), Value: 4},
+		// another series isn't offset
+		{Metric: other, Time: at, Value: 1},
+	} {
+		series, err := ms.transform(mapping, sample, nil)
+		require.NoError(t, err)
+		require.Len(t, series, 1)
+		timestamps = append(timestamps, series[0].Samples[0].Timestamp)
+	}
+	assert.Equal(t, []int64{1_700_000_001_000, 1_700_000_001_001, 1_700_000_001_002, 1_700_000_001_005, 1_700_000_001_000}, timestamps)
+}
+
+func TestRawAllMappingMaxOffset(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.Mapping = null.StringFrom("raw-all")
+	mapping := NewMapping(config)
+	raw, ok := mapping.(*RawAllMapping)
+	require.True(t, ok)
+
+	ms := newMetricsStorage()
+	metric := &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend}
+	at := time.UnixMilli(1_700_000_001_000)
+
+	// more samples in the same millisecond than can be offset within a flush period
+	var kept int
+	for i := 0; i < 1500; i++ {
+		series, err := ms.transform(mapping, metrics.Sample{Metric: metric, Time: at, Value: float64(i)}, nil)
+		require.NoError(t, err)
+		if len(series) == 0 {
+			continue
+		}
+		kept++
+		assert.LessOrEqual(t, series[0].Samples[0].Timestamp, at.Add(time.Second).UnixMilli())
+	}
+	assert.Equal(t, 1001, kept)
+	assert.Equal(t, 499, raw.takeCrowded())
+	assert.Zero(t, raw.takeCrowded())
+
+	// the later samples get their own timestamps again
+	series, err := ms.transform(mapping, metrics.Sample{Metric: metric, Time: at.Add(2 * time.Second)}, nil)
+	require.NoError(t, err)
+	require.Len(t, series, 1)
+	assert.Equal(t, at.Add(2*time.Second).UnixMilli(), series[0].Samples[0].Timestamp)
+}
@@ -0,0 +1,71 @@
+package remotewrite
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/sirupsen/logrus"
+)
+
+// mirrorClient sends each request to all its clients concurrently: the first
+// one is the primary endpoint, the others are mirrors whose failures are
+// logged without failing the request.
+type mirrorClient struct {
+	clients []remote.WriteClient
+	logger  logrus.FieldLogger
+	self    *selfMetrics
+}
+
+var _ remote.WriteClient = &mirrorClient{}
+
+func (c *mirrorClient) Name() string {
+	return c.clients[0].Name()
+}
+
+func (c *mirrorClient) Endpoint() string {
+	return c.clients[0].Endpoint()
+}
+
+// Close closes the clients of all the endpoints.
+func (c *mirrorClient) Close() error {
+	return closeClients(c.clients)
+}
+
+// Store returns the error of the primary endpoint only. The output doesn't use
+// it but delivers the request to each endpoint on its own with storeEach, so
+// that only the endpoints that failed are retried.
+func (c *mirrorClient) Store(ctx context.Context, req []byte) error {
+	return c.storeEach(func(client remote.WriteClient) error {
+		return client.Store(ctx, req)
+	})
+}
+
+// storeEach calls store with the clients of all the endpoints concurrently,
+// logs the failures of the mirrors and returns the error of the primary endpoint.
+func (c *mirrorClient) storeEach(store func(remote.WriteClient) error) error {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(c.clients))
+	)
+	for i, client := range c.clients {
+		wg.Add(1)
+		go func(i int, client remote.WriteClient) {
+			defer wg.Done()
+			errs[i] = store(client)
+		}(i, client)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		c.self.addEndpointFailure(c.clients[i].Endpoint())
+		if i > 0 && c.logger != nil {
+			c.logger.WithError(err).WithField("url", c.clients[i].Endpoint()).
+				Warn("Prometheus: failed to send the request to the mirror endpoint, it was still sent to the others")
+		}
+	}
+	return errs[0]
+}
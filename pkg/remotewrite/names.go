@@ -0,0 +1,83 @@
+package remotewrite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// validName reports whether the name matches [a-zA-Z_:][a-zA-Z0-9_:]* for metric
+// names, and [a-zA-Z_][a-zA-Z0-9_]* for label names, i.e. without colons.
+func validName(name string, colons bool) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !validNameByte(name[i], i == 0, colons) {
+			return false
+		}
+	}
+	return true
+}
+
+func validNameByte(b byte, first, colons bool) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || b == '_' ||
+		(colons && b == ':') || (!first && b >= '0' && b <= '9')
+}
+
+// sanitizeName rewrites the name to follow the Prometheus rules, replacing
+// every invalid character with an underscore and prepending one to names that
+// start with a digit. Multi-byte characters are replaced with a single underscore.
+func sanitizeName(name string, colons bool) string {
+	if validName(name, colons) {
+		return name
+	}
+
+	var b strings.Builder
+	b.Grow(len(name) + 1)
+	for _, r := range name {
+		if r < 0x80 && validNameByte(byte(r), b.Len() == 0, colons) {
+			b.WriteRune(r)
+			continue
+		}
+		if b.Len() == 0 && r >= '0' && r <= '9' {
+			b.WriteByte('_')
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteByte('_')
+	}
+	return b.String()
+}
+
+// sanitizeLabelName returns the label name for the tag, rewritten if it's not
+// valid, or an error if strict is enabled.
+func sanitizeLabelName(name string, strict bool) (string, error) {
+	if validName(name, false) {
+		return name, nil
+	}
+	if strict {
+		return "", fmt.Errorf("invalid label name %q, it must match [a-zA-Z_][a-zA-Z0-9_]*", name)
+	}
+	return sanitizeName(name, false), nil
+}
+
+// sanitizeMetricName rewrites the value of the __name__ label if it's not a
+// valid metric name, or returns an error if strict is enabled.
+func sanitizeMetricName(labels []prompb.Label, strict bool) error {
+	for i := range labels {
+		if labels[i].Name != "__name__" {
+			continue
+		}
+		if validName(labels[i].Value, true) {
+			return nil
+		}
+		if strict {
+			return fmt.Errorf("invalid metric name %q, it must match [a-zA-Z_:][a-zA-Z0-9_:]*", labels[i].Value)
+		}
+		labels[i].Value = sanitizeName(labels[i].Value, true)
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestSanitizeName(t *testing.T) {
+	t.Parallel()
+
+	for name, expected := range map[string]string{
+		"http_reqs":      "http_reqs",
+		"my-metric.name": "my_metric_name",
+		"2xx_responses":  "_2xx_responses",
+		"latência":       "lat_ncia",
+		"ns:metric":      "ns:metric",
+	} {
+		assert.Equal(t, expected, sanitizeName(name, true), name)
+		assert.True(t, validName(sanitizeName(name, true), true), name)
+	}
+
+	assert.Equal(t, "ns_label", sanitizeName("ns:label", false))
+	assert.False(t, validName("", true))
+
+	name, err := sanitizeLabelName("content-type", false)
+	require.NoError(t, err)
+	assert.Equal(t, "content_type", name)
+	_, err = sanitizeLabelName("content-type", true)
+	assert.Error(t, err)
+}
+
+func TestConvertToTimeSeriesSanitizeNames(t *testing.T) {
+	t.Parallel()
+
+	metric := &metrics.Metric{Name: "my-app.logins", Type: metrics.Counter}
+	tags := metrics.NewSampleTags(map[string]string{"content-type": "json", "content_type": "xml"})
+	sample := metrics.Sample{Metric: metric, Tags: tags, Time: time.Now(), Value: 1}
+
+	config := NewConfig()
+	config.KeepTags = null.BoolFrom(true)
+	o := &Output{
+		config:  config,
+		metrics: newMetricsStorage(),
+		mapping: NewMapping(config),
+		logger:  logrus.New(),
+	}
+
+	ts := o.convertToTimeSeries([]metrics.SampleContainer{metrics.Samples{sample}})
+	require.Len(t, ts, 1)
+	assert.ElementsMatch(t, []prompb.Label{
+		{Name: "content_type", Value: "xml"},
+		{Name: "__name__", Value: "k6_my_app_logins"},
+	}, ts[0].Labels)
+
+	o.config.StrictNames = null.BoolFrom(true)
+	assert.Empty(t, o.convertToTimeSeries([]metrics.SampleContainer{metrics.Samples{sample}}))
+
+	sample.Tags = metrics.NewSampleTags(nil)
+	assert.Empty(t, o.convertToTimeSeries([]metrics.SampleContainer{metrics.Samples{sample}}))
+	assert.Len(t, o.loggedErrors, 2)
+}
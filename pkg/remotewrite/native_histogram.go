@@ -0,0 +1,158 @@
+package remotewrite
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	// nativeHistogramSchema defines the resolution of the exponential buckets:
+	// each power of two is divided into 2^schema buckets, so with 3 every
+	// bucket boundary is ~9% bigger than the previous one.
+	nativeHistogramSchema = 3
+
+	// nativeHistogramZeroThreshold is the width of the zero bucket.
+	nativeHistogramZeroThreshold = 1e-128
+)
+
+// NativeHistogramMapping works as PrometheusMapping except for Trend metrics:
+// those are mapped to Prometheus native histograms (a.k.a. sparse histograms)
+// so that any quantile can be computed server-side with histogram_quantile().
+//
+// Note that native histograms must be enabled in the remote-write agent,
+// e.g. with --enable-feature=native-histograms in Prometheus.
+type NativeHistogramMapping struct {
+	PrometheusMapping
+}
+
+func (nm *NativeHistogramMapping) MapTrend(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+	metric := ms.UpdateWithSink(sample, labels, func(metrics.MetricType) metrics.Sink {
+		return newNativeHistogramSink(nativeHistogramSchema)
+	}, nil)
+
+	h := metric.Sink.(*nativeHistogramSink)
+
+	return []prompb.TimeSeries{
+		{
+			Labels: append(labels, prompb.Label{
+				Name:  "__name__",
+				Value: sample.Metric.Name,
+			}),
+			Histograms: []prompb.Histogram{
+				h.histogram(ms.Timestamp(sample, labels)),
+			},
+		},
+	}
+}
+
+// nativeHistogramSink is a metrics.Sink that counts values in
+// exponential buckets as defined by Prometheus native histograms.
+type nativeHistogramSink struct {
+	schema    int32
+	count     uint64
+	sum       float64
+	zeroCount uint64
+	positive  map[int32]uint64
+	negative  map[int32]uint64
+}
+
+var _ metrics.Sink = &nativeHistogramSink{}
+
+func newNativeHistogramSink(schema int32) *nativeHistogramSink {
+	return &nativeHistogramSink{
+		schema:   schema,
+		positive: make(map[int32]uint64),
+		negative: make(map[int32]uint64),
+	}
+}
+
+func (h *nativeHistogramSink) Add(s metrics.Sample) {
+	v := s.Value
+	if math.IsNaN(v) {
+		return
+	}
+
+	h.count++
+	h.sum += v
+
+	switch {
+	case math.Abs(v) <= nativeHistogramZeroThreshold:
+		h.zeroCount++
+	case v > 0:
+		h.positive[h.bucketIndex(v)]++
+	default:
+		h.negative[h.bucketIndex(-v)]++
+	}
+}
+
+func (h *nativeHistogramSink) Calc() {}
+
+func (h *nativeHistogramSink) Format(time.Duration) map[string]float64 {
+	return map[string]float64{"count": float64(h.count), "sum": h.sum}
+}
+
+// bucketIndex returns the index of the bucket that holds the absolute value v:
+// bucket i spans (base^(i-1), base^i] where base is 2^(2^-schema).
+func (h *nativeHistogramSink) bucketIndex(v float64) int32 {
+	return int32(math.Ceil(math.Log2(v) * math.Exp2(float64(h.schema))))
+}
+
+// histogram converts the current state of the sink into its remote-write representation.
+func (h *nativeHistogramSink) histogram(ts int64) prompb.Histogram {
+	positiveSpans, positiveDeltas := encodeNativeBuckets(h.positive)
+	negativeSpans, negativeDeltas := encodeNativeBuckets(h.negative)
+
+	return prompb.Histogram{
+		Count:          &prompb.Histogram_CountInt{CountInt: h.count},
+		Sum:            h.sum,
+		Schema:         h.schema,
+		ZeroThreshold:  nativeHistogramZeroThreshold,
+		ZeroCount:      &prompb.Histogram_ZeroCountInt{ZeroCountInt: h.zeroCount},
+		PositiveSpans:  positiveSpans,
+		PositiveDeltas: positiveDeltas,
+		NegativeSpans:  negativeSpans,
+		NegativeDeltas: negativeDeltas,
+		Timestamp:      ts,
+	}
+}
+
+// encodeNativeBuckets converts sparse buckets into spans of consecutive buckets,
+// and bucket counts into deltas, each one relative to the previous bucket.
+func encodeNativeBuckets(buckets map[int32]uint64) ([]*prompb.BucketSpan, []int64) {
+	if len(buckets) == 0 {
+		return nil, nil
+	}
+
+	indexes := make([]int, 0, len(buckets))
+	for i := range buckets {
+		indexes = append(indexes, int(i))
+	}
+	sort.Ints(indexes)
+
+	var (
+		spans  []*prompb.BucketSpan
+		deltas = make([]int64, 0, len(indexes))
+		prev   int64
+	)
+	for n, i := range indexes {
+		switch {
+		case n == 0:
+			spans = append(spans, &prompb.BucketSpan{Offset: int32(i), Length: 1})
+		case i == indexes[n-1]+1:
+			spans[len(spans)-1].Length++
+		default:
+			// the offset of a span is relative to the end of the previous one
+			spans = append(spans, &prompb.BucketSpan{Offset: int32(i - indexes[n-1] - 1), Length: 1})
+		}
+
+		count := int64(buckets[int32(i)])
+		deltas = append(deltas, count-prev)
+		prev = count
+	}
+
+	return spans, deltas
+}
@@ -0,0 +1,72 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestNativeHistogramBucketIndex(t *testing.T) {
+	t.Parallel()
+
+	h := newNativeHistogramSink(3)
+
+	assert.Equal(t, int32(0), h.bucketIndex(1))
+	assert.Equal(t, int32(1), h.bucketIndex(1.05))
+	assert.Equal(t, int32(8), h.bucketIndex(2))
+	assert.Equal(t, int32(-8), h.bucketIndex(0.5))
+	assert.Equal(t, int32(80), h.bucketIndex(1024))
+}
+
+func TestEncodeNativeBuckets(t *testing.T) {
+	t.Parallel()
+
+	spans, deltas := encodeNativeBuckets(map[int32]uint64{
+		-2: 1,
+		-1: 3,
+		0:  2,
+		5:  4,
+		6:  4,
+	})
+
+	require.Len(t, spans, 2)
+	assert.Equal(t, prompb.BucketSpan{Offset: -2, Length: 3}, *spans[0])
+	assert.Equal(t, prompb.BucketSpan{Offset: 4, Length: 2}, *spans[1])
+	assert.Equal(t, []int64{1, 2, -1, 2, 0}, deltas)
+
+	spans, deltas = encodeNativeBuckets(map[int32]uint64{})
+	assert.Nil(t, spans)
+	assert.Nil(t, deltas)
+}
+
+func TestNativeHistogramMappingTrend(t *testing.T) {
+	t.Parallel()
+
+	ms := newMetricsStorage()
+	mapping := NewMapping(Config{Mapping: null.StringFrom("native-histogram")})
+	metric := &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend}
+	now := time.Now()
+
+	var ts []prompb.TimeSeries
+	for _, v := range []float64{0, 1, 2, 2, -1} {
+		ts = mapping.MapTrend(ms, metrics.Sample{Metric: metric, Value: v, Time: now}, nil)
+	}
+
+	require.Len(t, ts, 1)
+	assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "http_req_duration"}}, ts[0].Labels)
+	require.Len(t, ts[0].Histograms, 1)
+
+	h := ts[0].Histograms[0]
+	assert.Equal(t, uint64(5), h.GetCountInt())
+	assert.Equal(t, float64(4), h.Sum)
+	assert.Equal(t, uint64(1), h.GetZeroCountInt())
+	assert.Equal(t, int32(nativeHistogramSchema), h.Schema)
+	assert.Equal(t, []int64{1, 1}, h.PositiveDeltas)
+	assert.Equal(t, []int64{1}, h.NegativeDeltas)
+	assert.Equal(t, now.UnixMilli(), h.Timestamp)
+}
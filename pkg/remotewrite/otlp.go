@@ -0,0 +1,245 @@
+package remotewrite
+
+import (
+	"math"
+
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// otlpScopeName is the name of the instrumentation scope of all the metrics.
+const otlpScopeName = "xk6-output-prometheus-remote"
+
+// Field numbers of OTLP messages
+// (https://github.com/open-telemetry/opentelemetry-proto/tree/main/opentelemetry/proto).
+const (
+	otlpRequestResourceMetrics = 1
+
+	otlpResourceMetricsResource     = 1
+	otlpResourceMetricsScopeMetrics = 2
+
+	otlpResourceAttributes = 1
+
+	otlpScopeMetricsScope   = 1
+	otlpScopeMetricsMetrics = 2
+
+	otlpScopeNameField = 1
+
+	otlpKeyValueKey   = 1
+	otlpKeyValueValue = 2
+	otlpAnyValueStr   = 1
+
+	otlpMetricName                 = 1
+	otlpMetricGauge                = 5
+	otlpMetricExponentialHistogram = 10
+
+	otlpGaugeDataPoints = 1
+
+	otlpNumberDataPointTime       = 3
+	otlpNumberDataPointAsDouble   = 4
+	otlpNumberDataPointAttributes = 7
+	otlpNumberDataPointFlags      = 8
+
+	otlpExpHistogramDataPoints  = 1
+	otlpExpHistogramTemporality = 2
+
+	otlpExpDataPointAttributes    = 1
+	otlpExpDataPointTime          = 3
+	otlpExpDataPointCount         = 4
+	otlpExpDataPointSum           = 5
+	otlpExpDataPointScale         = 6
+	otlpExpDataPointZeroCount     = 7
+	otlpExpDataPointPositive      = 8
+	otlpExpDataPointNegative      = 9
+	otlpExpDataPointZeroThreshold = 14
+
+	otlpBucketsOffset = 1
+	otlpBucketsCounts = 2
+
+	// otlpTemporalityCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+	otlpTemporalityCumulative = 2
+
+	// otlpFlagNoRecordedValue is DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK,
+	// the OTLP equivalent of a Prometheus stale marker.
+	otlpFlagNoRecordedValue = 1
+)
+
+// marshalOTLPRequest marshals the time series as an OTLP ExportMetricsServiceRequest.
+// Each metric name becomes a metric whose data points are the samples of its
+// series, with the other labels as attributes: samples are sent as gauges and
+// native histograms as cumulative exponential histograms.
+func marshalOTLPRequest(series []prompb.TimeSeries) []byte {
+	var (
+		names   []string
+		metrics = make(map[string][]prompb.TimeSeries)
+	)
+	for _, ts := range series {
+		name := metricName(ts.Labels)
+		if _, ok := metrics[name]; !ok {
+			names = append(names, name)
+		}
+		metrics[name] = append(metrics[name], ts)
+	}
+
+	var scope []byte
+	scope = appendString(scope, otlpScopeNameField, otlpScopeName)
+
+	var scopeMetrics []byte
+	scopeMetrics = appendMessage(scopeMetrics, otlpScopeMetricsScope, scope)
+	for _, name := range names {
+		scopeMetrics = appendMessage(scopeMetrics, otlpScopeMetricsMetrics, marshalOTLPMetric(name, metrics[name]))
+	}
+
+	var resource []byte
+	resource = appendMessage(resource, otlpResourceAttributes, marshalOTLPKeyValue("service.name", "k6"))
+
+	var resourceMetrics []byte
+	resourceMetrics = appendMessage(resourceMetrics, otlpResourceMetricsResource, resource)
+	resourceMetrics = appendMessage(resourceMetrics, otlpResourceMetricsScopeMetrics, scopeMetrics)
+
+	return appendMessage(nil, otlpRequestResourceMetrics, resourceMetrics)
+}
+
+func marshalOTLPMetric(name string, series []prompb.TimeSeries) []byte {
+	var gauge, histogram []byte
+	for _, ts := range series {
+		attributes := marshalOTLPAttributes(ts.Labels)
+
+		for _, s := range ts.Samples {
+			var point []byte
+			point = appendFixed64(point, otlpNumberDataPointTime, uint64(s.Timestamp)*1e6)
+			if value.IsStaleNaN(s.Value) {
+				point = protowire.AppendTag(point, otlpNumberDataPointFlags, protowire.VarintType)
+				point = protowire.AppendVarint(point, otlpFlagNoRecordedValue)
+			} else {
+				// part of a oneof, so it's sent even when zero
+				point = protowire.AppendTag(point, otlpNumberDataPointAsDouble, protowire.Fixed64Type)
+				point = protowire.AppendFixed64(point, math.Float64bits(s.Value))
+			}
+			for _, attr := range attributes {
+				point = appendMessage(point, otlpNumberDataPointAttributes, attr)
+			}
+			gauge = appendMessage(gauge, otlpGaugeDataPoints, point)
+		}
+
+		for _, h := range ts.Histograms {
+			histogram = appendMessage(histogram, otlpExpHistogramDataPoints, marshalOTLPExpHistogramPoint(h, attributes))
+		}
+	}
+
+	var metric []byte
+	metric = appendString(metric, otlpMetricName, name)
+	if len(gauge) > 0 {
+		metric = appendMessage(metric, otlpMetricGauge, gauge)
+	}
+	if len(histogram) > 0 {
+		histogram = protowire.AppendTag(histogram, otlpExpHistogramTemporality, protowire.VarintType)
+		histogram = protowire.AppendVarint(histogram, otlpTemporalityCumulative)
+		metric = appendMessage(metric, otlpMetricExponentialHistogram, histogram)
+	}
+	return metric
+}
+
+func marshalOTLPExpHistogramPoint(h prompb.Histogram, attributes [][]byte) []byte {
+	var point []byte
+	for _, attr := range attributes {
+		point = appendMessage(point, otlpExpDataPointAttributes, attr)
+	}
+	point = appendFixed64(point, otlpExpDataPointTime, uint64(h.Timestamp)*1e6)
+	point = appendFixed64(point, otlpExpDataPointCount, h.GetCountInt())
+	point = protowire.AppendTag(point, otlpExpDataPointSum, protowire.Fixed64Type)
+	point = protowire.AppendFixed64(point, math.Float64bits(h.Sum))
+	point = protowire.AppendTag(point, otlpExpDataPointScale, protowire.VarintType)
+	point = protowire.AppendVarint(point, protowire.EncodeZigZag(int64(h.Schema)))
+	point = appendFixed64(point, otlpExpDataPointZeroCount, h.GetZeroCountInt())
+	if buckets := marshalOTLPBuckets(h.PositiveSpans, h.PositiveDeltas); buckets != nil {
+		point = appendMessage(point, otlpExpDataPointPositive, buckets)
+	}
+	if buckets := marshalOTLPBuckets(h.NegativeSpans, h.NegativeDeltas); buckets != nil {
+		point = appendMessage(point, otlpExpDataPointNegative, buckets)
+	}
+	return appendDouble(point, otlpExpDataPointZeroThreshold, h.ZeroThreshold)
+}
+
+// marshalOTLPBuckets converts the sparse buckets of a native histogram into dense
+// OTLP buckets. Bucket i of the former spans (base^(i-1), base^i] while in the latter
+// it spans (base^i, base^(i+1)], hence the offset is shifted by one.
+func marshalOTLPBuckets(spans []*prompb.BucketSpan, deltas []int64) []byte {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	var (
+		counts []uint64
+		count  int64
+		d      int
+	)
+	for n, span := range spans {
+		if n > 0 {
+			for i := int32(0); i < span.Offset; i++ {
+				counts = append(counts, 0)
+			}
+		}
+		for i := uint32(0); i < span.Length && d < len(deltas); i++ {
+			count += deltas[d]
+			d++
+			counts = append(counts, uint64(count))
+		}
+	}
+
+	var packed []byte
+	for _, c := range counts {
+		packed = protowire.AppendVarint(packed, c)
+	}
+
+	var buckets []byte
+	buckets = protowire.AppendTag(buckets, otlpBucketsOffset, protowire.VarintType)
+	buckets = protowire.AppendVarint(buckets, protowire.EncodeZigZag(int64(spans[0].Offset-1)))
+	return appendMessage(buckets, otlpBucketsCounts, packed)
+}
+
+// marshalOTLPAttributes returns a KeyValue for each label, except the metric name.
+func marshalOTLPAttributes(labels []prompb.Label) [][]byte {
+	attributes := make([][]byte, 0, len(labels))
+	for _, l := range labels {
+		if l.Name == "__name__" {
+			continue
+		}
+		attributes = append(attributes, marshalOTLPKeyValue(l.Name, l.Value))
+	}
+	return attributes
+}
+
+func marshalOTLPKeyValue(key, val string) []byte {
+	var anyValue []byte
+	anyValue = appendString(anyValue, otlpAnyValueStr, val)
+
+	var kv []byte
+	kv = appendString(kv, otlpKeyValueKey, key)
+	return appendMessage(kv, otlpKeyValueValue, anyValue)
+}
+
+func metricName(labels []prompb.Label) string {
+	for _, l := range labels {
+		if l.Name == "__name__" {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
@@ -0,0 +1,123 @@
+package remotewrite
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestMarshalOTLPRequest(t *testing.T) {
+	t.Parallel()
+
+	buf := marshalOTLPRequest([]prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}, {Name: "scenario", Value: "default"}},
+			Samples: []prompb.Sample{{Value: 0, Timestamp: 1000}, {Value: math.Float64frombits(value.StaleNaN), Timestamp: 2000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}, {Name: "scenario", Value: "other"}},
+			Samples: []prompb.Sample{{Value: 2, Timestamp: 1000}},
+		},
+		{
+			Labels:     []prompb.Label{{Name: "__name__", Value: "k6_http_req_duration"}},
+			Histograms: []prompb.Histogram{nativeHistogramOf(t, 1, 2, 2)},
+		},
+	})
+
+	var resourceMetrics, scopeMetrics []byte
+	forEachField(t, buf, func(num protowire.Number, v []byte) {
+		require.Equal(t, protowire.Number(otlpRequestResourceMetrics), num)
+		resourceMetrics = v
+	})
+	forEachField(t, resourceMetrics, func(num protowire.Number, v []byte) {
+		if num == otlpResourceMetricsScopeMetrics {
+			scopeMetrics = v
+		}
+	})
+
+	otlpMetrics := make(map[string][]byte)
+	forEachField(t, scopeMetrics, func(num protowire.Number, v []byte) {
+		if num != otlpScopeMetricsMetrics {
+			return
+		}
+		var name string
+		forEachField(t, v, func(num protowire.Number, v []byte) {
+			if num == otlpMetricName {
+				name = string(v)
+			}
+		})
+		otlpMetrics[name] = v
+	})
+	require.Len(t, otlpMetrics, 2)
+
+	// the gauge has the data points of both series, the stale marker without value
+	var points, flagged int
+	forEachField(t, otlpMetrics["k6_vus"], func(num protowire.Number, v []byte) {
+		if num != otlpMetricGauge {
+			return
+		}
+		forEachField(t, v, func(num protowire.Number, v []byte) {
+			points++
+			forEachField(t, v, func(num protowire.Number, v []byte) {
+				if num == otlpNumberDataPointFlags {
+					flagged++
+				}
+			})
+		})
+	})
+	assert.Equal(t, 3, points)
+	assert.Equal(t, 1, flagged)
+
+	var histogram bool
+	forEachField(t, otlpMetrics["k6_http_req_duration"], func(num protowire.Number, v []byte) {
+		histogram = histogram || num == otlpMetricExponentialHistogram
+	})
+	assert.True(t, histogram)
+}
+
+func TestMarshalOTLPBuckets(t *testing.T) {
+	t.Parallel()
+
+	buckets := marshalOTLPBuckets(
+		[]*prompb.BucketSpan{{Offset: -2, Length: 2}, {Offset: 1, Length: 1}},
+		[]int64{1, 2, -1},
+	)
+
+	var (
+		offset int64
+		counts []uint64
+	)
+	forEachField(t, buckets, func(num protowire.Number, v []byte) {
+		switch num {
+		case otlpBucketsOffset:
+			raw, _ := protowire.ConsumeVarint(v)
+			offset = protowire.DecodeZigZag(raw)
+		case otlpBucketsCounts:
+			for len(v) > 0 {
+				c, n := protowire.ConsumeVarint(v)
+				counts = append(counts, c)
+				v = v[n:]
+			}
+		}
+	})
+	assert.Equal(t, int64(-3), offset)
+	assert.Equal(t, []uint64{1, 3, 0, 2}, counts)
+
+	assert.Nil(t, marshalOTLPBuckets(nil, nil))
+}
+
+func nativeHistogramOf(t *testing.T, values ...float64) prompb.Histogram {
+	t.Helper()
+
+	h := newNativeHistogramSink(nativeHistogramSchema)
+	for _, v := range values {
+		h.Add(metrics.Sample{Value: v})
+	}
+	return h.histogram(1000)
+}
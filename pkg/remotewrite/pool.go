@@ -0,0 +1,148 @@
+package remotewrite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// maxPooledBufferSize is the capacity above which buffers are not kept for reuse,
+// so that a single huge request doesn't hold its memory for the rest of the test.
+const maxPooledBufferSize = 32 << 20
+
+// maxSnappyInputSize is the size of the largest input snappy can compress,
+// above which snappy.Encode panics. It's a variable for the tests.
+var maxSnappyInputSize uint64 = 0xffffffff
+
+// errTooLargeToCompress is returned for a request too large to be compressed,
+// which is then split in smaller ones.
+var errTooLargeToCompress = errors.New("request too large to be compressed")
+
+// encodeBuffers are the buffers a request is marshaled and compressed into.
+// They are reused across requests, instead of allocating new ones on every flush,
+// so the encoded request is only valid until the buffers are put back in the pool.
+type encodeBuffers struct {
+	marshaled  []byte
+	compressed []byte
+	gzip       *gzip.Writer
+}
+
+// encodeBuffersPool has no New function so that getEncodeBuffers can tell reused buffers apart.
+var encodeBuffersPool sync.Pool
+
+// getEncodeBuffers returns buffers from the pool, or new ones if it's empty,
+// and whether they have been reused.
+func getEncodeBuffers() (*encodeBuffers, bool) {
+	if b, ok := encodeBuffersPool.Get().(*encodeBuffers); ok {
+		return b, true
+	}
+	return &encodeBuffers{}, false
+}
+
+// putEncodeBuffers puts the buffers back in the pool, unless they grew too large.
+func putEncodeBuffers(b *encodeBuffers) {
+	if cap(b.marshaled) > maxPooledBufferSize || cap(b.compressed) > maxPooledBufferSize {
+		return
+	}
+	encodeBuffersPool.Put(b)
+}
+
+// grow returns buf resliced to n bytes, allocating a new slice only if its capacity is too small.
+func grow(buf []byte, n int) []byte {
+	if cap(buf) < n {
+		return make([]byte, n)
+	}
+	return buf[:n]
+}
+
+// encode marshals the time series in a request of the given protocol and compresses it with c.
+// Only remote write 1.0 requests are marshaled in the reused buffer, the other
+// protocols have their own encoders. A panic while encoding, e.g. on a malformed
+// histogram, is returned as an error so that a single flush can't crash the test.
+func (b *encodeBuffers) encode(series []prompb.TimeSeries, p protocol, c compression) ([]byte, error) {
+	return b.encodeWithMetadata(series, p, c, nil)
+}
+
+// encodeWithMetadata is encode with the metadata sent in the series of the 2.0 requests.
+func (b *encodeBuffers) encodeWithMetadata(
+	series []prompb.TimeSeries, p protocol, c compression, metadata *metadataTracker,
+) (encoded []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			encoded, err = nil, fmt.Errorf("failed to encode the request of %d series: %v", len(series), r)
+		}
+	}()
+
+	var buf []byte
+	switch p {
+	case protocolOTLP:
+		buf = marshalOTLPRequest(series)
+	case protocolVictoriaMetrics:
+		buf, err = marshalVictoriaMetricsImport(series)
+	case protocolInfluxDB:
+		buf = marshalInfluxLineProtocol(series)
+	case protocolGraphite, protocolGraphiteTagged:
+		buf = marshalGraphite(series, p == protocolGraphiteTagged)
+	case protocolDatadog:
+		buf, err = marshalDatadogSeries(series)
+	case protocolDatadogDistributions:
+		buf, err = marshalDatadogDistributions(series)
+	case protocolV2:
+		buf, err = marshalWriteRequestV2(series, metadata)
+	default:
+		buf, err = b.marshal(&prompb.WriteRequest{Timeseries: series})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return b.compress(c.resolve(p), buf)
+}
+
+// marshal marshals the remote write 1.0 request.
+func (b *encodeBuffers) marshal(req *prompb.WriteRequest) ([]byte, error) {
+	size := req.Size()
+	b.marshaled = grow(b.marshaled, size)
+	n, err := req.MarshalToSizedBuffer(b.marshaled)
+	if err != nil {
+		return nil, err
+	}
+	return b.marshaled[size-n:], nil
+}
+
+// compress compresses buf with c.
+func (b *encodeBuffers) compress(c compression, buf []byte) ([]byte, error) {
+	switch c {
+	case compressionNone:
+		return buf, nil
+	case compressionZstd:
+		b.compressed = zstdEncoder.EncodeAll(buf, b.compressed[:0])
+	case compressionGzip:
+		w := bytes.NewBuffer(b.compressed[:0])
+		if b.gzip == nil {
+			b.gzip = gzip.NewWriter(w)
+		} else {
+			b.gzip.Reset(w)
+		}
+		if _, err := b.gzip.Write(buf); err != nil {
+			return nil, err
+		}
+		if err := b.gzip.Close(); err != nil {
+			return nil, err
+		}
+		b.compressed = w.Bytes()
+	default:
+		n := snappy.MaxEncodedLen(len(buf))
+		if n < 0 || uint64(len(buf)) > maxSnappyInputSize {
+			return nil, fmt.Errorf("%w with snappy: %d bytes", errTooLargeToCompress, len(buf))
+		}
+		b.compressed = grow(b.compressed, n)
+		b.compressed = snappy.Encode(b.compressed, buf)
+	}
+	return b.compressed, nil
+}
@@ -0,0 +1,152 @@
+package remotewrite
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func benchmarkSeries(n int) []prompb.TimeSeries {
+	series := make([]prompb.TimeSeries, n)
+	for i := range series {
+		series[i] = prompb.TimeSeries{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: "k6_http_req_duration"},
+				{Name: "url", Value: fmt.Sprintf("https://test.k6.io/%d", i)},
+			},
+			Samples: []prompb.Sample{{Value: float64(i), Timestamp: int64(i)}},
+		}
+	}
+	return series
+}
+
+func TestEncodeBuffers(t *testing.T) {
+	t.Parallel()
+
+	expected, err := proto.Marshal(&prompb.WriteRequest{Timeseries: benchmarkSeries(10)})
+	require.NoError(t, err)
+
+	b := &encodeBuffers{}
+	for _, c := range []compression{compressionSnappy, compressionZstd, compressionGzip, compressionNone} {
+		// a larger request first, so that the next one is encoded in a buffer with leftovers
+		_, err := b.encode(benchmarkSeries(100), protocolV1, c)
+		require.NoError(t, err)
+
+		encoded, err := b.encode(benchmarkSeries(10), protocolV1, c)
+		require.NoError(t, err)
+		assert.Equal(t, expected, decompress(t, c.contentEncoding(), encoded), c)
+	}
+
+	b.marshaled = make([]byte, 0, maxPooledBufferSize+1)
+	putEncodeBuffers(b)
+	if reused, ok := encodeBuffersPool.Get().(*encodeBuffers); ok {
+		assert.NotSame(t, b, reused)
+	}
+}
+
+func TestOutputEncodeBuffersSelfMetrics(t *testing.T) {
+	t.Parallel()
+
+	o := &Output{self: newSelfMetrics()}
+	putEncodeBuffers(o.getEncodeBuffers())
+	o.getEncodeBuffers()
+
+	fields := o.self.fields()
+	// the pool may be emptied by the GC at any time
+	assert.Equal(t, uint64(2), fields["buffers_reused"].(uint64)+fields["buffers_allocated"].(uint64))
+}
+
+func BenchmarkEncodeWriteRequest(b *testing.B) {
+	series := benchmarkSeries(10000)
+	for _, c := range []compression{compressionSnappy, compressionZstd, compressionGzip} {
+		b.Run(fmt.Sprintf("%s/pooled", c), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buffers, _ := getEncodeBuffers()
+				if _, err := buffers.encode(series, protocolV1, c); err != nil {
+					b.Fatal(err)
+				}
+				putEncodeBuffers(buffers)
+			}
+		})
+		b.Run(fmt.Sprintf("%s/unpooled", c), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := new(encodeBuffers).encode(series, protocolV1, c); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeBuffersPanic(t *testing.T) {
+	t.Parallel()
+
+	series := benchmarkSeries(1)
+	series[0].Samples = nil
+	series[0].Histograms = []prompb.Histogram{{PositiveSpans: []*prompb.BucketSpan{nil}}}
+
+	b := &encodeBuffers{}
+	_, err := b.encode(series, protocolV1, compressionSnappy)
+	assert.ErrorContains(t, err, "failed to encode the request of 1 series")
+}
+
+// TestOutputWriteRequestTooLarge isn't parallel as it lowers the maximum size of snappy.
+func TestOutputWriteRequestTooLarge(t *testing.T) {
+	// at most 3 series fit in a request
+	marshaled, err := (&encodeBuffers{}).marshal(&prompb.WriteRequest{Timeseries: benchmarkSeries(10)[7:]})
+	require.NoError(t, err)
+	defer func(max uint64) { maxSnappyInputSize = max }(maxSnappyInputSize)
+	maxSnappyInputSize = uint64(len(marshaled))
+
+	config := NewConfig()
+	client := &fakeWriteClient{}
+	o := &Output{
+		config: config,
+		client: client,
+		retry:  newRetryPolicy(config),
+		self:   newSelfMetrics(),
+		logger: logrus.New(),
+	}
+
+	// split in halves until they're small enough: 10 -> 5, 5 -> 2, 3, 2, 3
+	require.NoError(t, o.writeRequest(nil, benchmarkSeries(10)))
+	assert.Equal(t, 4, client.calls)
+	assert.Equal(t, uint64(10), o.self.fields()["series_sent"])
+
+	// a single series too large is skipped
+	maxSnappyInputSize = 1
+	assert.ErrorIs(t, o.writeRequest(nil, benchmarkSeries(1)), errTooLargeToCompress)
+	assert.Equal(t, uint64(1), o.self.fields()["samples_failed"])
+}
+
+func TestOutputWriteRequestSkipsSeries(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	client := &fakeWriteClient{}
+	o := &Output{
+		config: config,
+		client: client,
+		retry:  newRetryPolicy(config),
+		self:   newSelfMetrics(),
+		logger: logrus.New(),
+	}
+
+	series := benchmarkSeries(4)
+	series[2].Samples = nil
+	series[2].Histograms = []prompb.Histogram{{PositiveSpans: []*prompb.BucketSpan{nil}}}
+
+	// 4 -> 2, 2 -> 1, 1: the series that fails to be encoded is isolated, the others are sent
+	err := o.writeRequest(nil, series)
+	assert.ErrorContains(t, err, `skipped the series {__name__="k6_http_req_duration", url="https://test.k6.io/2"}`)
+	assert.Equal(t, 2, client.calls)
+	assert.Equal(t, uint64(3), o.self.fields()["series_sent"])
+	assert.Equal(t, uint64(1), o.self.fields()["samples_failed"])
+}
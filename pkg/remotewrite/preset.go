@@ -0,0 +1,109 @@
+package remotewrite
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"go.k6.io/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+// preset holds the defaults for a kind of receiver: its options are applied
+// before the ones set explicitly, and its path is added to a URL without one.
+type preset struct {
+	path    string
+	options Config
+}
+
+// presets are the receivers with known quirks: the path they receive remote
+// write requests on, the size of the requests they are tuned for and how hard
+// to retry when they push back.
+var presets = map[string]preset{
+	"mimir": {
+		path: "/api/v1/push",
+		options: Config{
+			Url:                  null.StringFrom("http://localhost:8080/api/v1/push"),
+			MaxSamplesPerRequest: null.IntFrom(2000),
+			MaxLabelValueLength:  null.IntFrom(2048),
+			SendMetadata:         null.BoolFrom(true),
+			RetryMaxAttempts:     null.IntFrom(5),
+			RetryMaxBackoff:      types.NullDurationFrom(30 * time.Second),
+		},
+	},
+	"thanos": {
+		path: "/api/v1/receive",
+		options: Config{
+			Url:                  null.StringFrom("http://localhost:19291/api/v1/receive"),
+			MaxSamplesPerRequest: null.IntFrom(2000),
+			RetryMaxAttempts:     null.IntFrom(5),
+		},
+	},
+	"victoria": {
+		path: "/api/v1/write",
+		options: Config{
+			Url:                  null.StringFrom("http://localhost:8428/api/v1/write"),
+			MaxSamplesPerRequest: null.IntFrom(10000),
+			RetryMaxAttempts:     null.IntFrom(5),
+		},
+	},
+	"promagent": {
+		path: "/api/v1/write",
+		options: Config{
+			Url:                  null.StringFrom("http://localhost:9090/api/v1/write"),
+			MaxSamplesPerRequest: null.IntFrom(2000),
+			SendMetadata:         null.BoolFrom(true),
+		},
+	},
+	"grafana-cloud": {
+		path: "/api/prom/push",
+		options: Config{
+			// the URL of the stack has to be set
+			Url:                  null.NewString("", true),
+			MaxSamplesPerRequest: null.IntFrom(2000),
+			MaxLabelValueLength:  null.IntFrom(2048),
+			SendMetadata:         null.BoolFrom(true),
+			RetryMaxAttempts:     null.IntFrom(5),
+			RetryMaxBackoff:      types.NullDurationFrom(30 * time.Second),
+		},
+	},
+	"amp": {
+		// the path starts with the workspace, the whole URL has to be set
+		options: Config{
+			Url:                  null.NewString("", true),
+			MaxSamplesPerRequest: null.IntFrom(1000),
+			RetryMaxAttempts:     null.IntFrom(5),
+			RetryMaxBackoff:      types.NullDurationFrom(30 * time.Second),
+		},
+	},
+}
+
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func parsePreset(name string) (preset, error) {
+	p, ok := presets[name]
+	if !ok {
+		return preset{}, fmt.Errorf("invalid preset %q, it must be one of %s", name, strings.Join(presetNames(), ", "))
+	}
+	return p, nil
+}
+
+// withPath returns rawURL with the path of the preset if it has none.
+func (p preset) withPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || p.path == "" || (u.Path != "" && u.Path != "/") {
+		// invalid URLs are reported by Validate
+		return rawURL
+	}
+	u.Path = p.path
+	return u.String()
+}
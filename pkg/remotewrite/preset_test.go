@@ -0,0 +1,73 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestGetConsolidatedConfigPreset(t *testing.T) {
+	t.Parallel()
+
+	t.Run("defaults", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_PRESET": "mimir"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, "http://localhost:8080/api/v1/push", c.Url.String)
+		assert.Equal(t, null.IntFrom(2000), c.MaxSamplesPerRequest)
+		assert.Equal(t, null.IntFrom(2048), c.MaxLabelValueLength)
+		assert.Equal(t, types.NullDurationFrom(30*time.Second), c.RetryMaxBackoff)
+		assert.NoError(t, c.Validate())
+	})
+
+	t.Run("explicit options take precedence", func(t *testing.T) {
+		t.Parallel()
+
+		env := map[string]string{
+			"K6_PROMETHEUS_REMOTE_URL":              "https://mimir.example.com",
+			"K6_PROMETHEUS_MAX_SAMPLES_PER_REQUEST": "500",
+		}
+		c, err := GetConsolidatedConfig([]byte(`{"retryMaxAttempts":2}`), env, "preset=mimir")
+		require.NoError(t, err)
+		assert.Equal(t, "mimir", c.Preset.String)
+		assert.Equal(t, "https://mimir.example.com/api/v1/push", c.Url.String)
+		assert.Equal(t, null.IntFrom(500), c.MaxSamplesPerRequest)
+		assert.Equal(t, null.IntFrom(2), c.RetryMaxAttempts)
+		assert.Equal(t, null.IntFrom(2048), c.MaxLabelValueLength)
+	})
+
+	t.Run("url with a path", func(t *testing.T) {
+		t.Parallel()
+
+		env := map[string]string{
+			"K6_PROMETHEUS_PRESET":     "thanos",
+			"K6_PROMETHEUS_REMOTE_URL": "http://receive:10908/custom/receive",
+		}
+		c, err := GetConsolidatedConfig(nil, env, "")
+		require.NoError(t, err)
+		assert.Equal(t, "http://receive:10908/custom/receive", c.Url.String)
+	})
+
+	t.Run("url required", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_PRESET": "amp"}, "")
+		require.NoError(t, err)
+		var validationErr *ValidationError
+		require.ErrorAs(t, c.Validate(), &validationErr)
+		assert.Contains(t, validationErr.Problems, "the amp preset needs the url of the endpoint, e.g. K6_PROMETHEUS_REMOTE_URL")
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := GetConsolidatedConfig(nil, map[string]string{"K6_PROMETHEUS_PRESET": "cortex"}, "")
+		assert.EqualError(t, err,
+			`invalid preset "cortex", it must be one of amp, grafana-cloud, mimir, promagent, thanos, victoria`)
+	})
+}
@@ -4,40 +4,91 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"strconv"
+	"strings"
 
-	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/prompb"
 	"go.k6.io/k6/metrics"
 )
 
-type PrometheusMapping struct{}
+type PrometheusMapping struct {
+	// trendStats are the series sent for each Trend metric, defaultTrendStats if empty.
+	trendStats []trendStat
+	// rateCounters sends Rate metrics as the counters of all and non-zero samples.
+	rateCounters bool
+}
 
-func (pm *PrometheusMapping) MapCounter(ms *metricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
-	metric := ms.update(sample, nil)
-	aggr := metric.Sink.Format(0)
+// prometheusMappingOf returns the PrometheusMapping the built-in mappings send
+// the counters, gauges and rates with, nil for the other mappings.
+func prometheusMappingOf(mapping Mapping) *PrometheusMapping {
+	switch m := mapping.(type) {
+	case *PrometheusMapping:
+		return m
+	case *NativeHistogramMapping:
+		return &m.PrometheusMapping
+	case *HDRHistogramMapping:
+		return &m.PrometheusMapping
+	case *HistogramMapping:
+		return &m.PrometheusMapping
+	case *DDSketchMapping:
+		return &m.PrometheusMapping
+	default:
+		return nil
+	}
+}
+
+// mapScratch maps the samples as MapCounter, MapGauge and MapRate do, but in the
+// buffers of ms, reused for each sample, instead of new slices for each of them.
+// It returns false for the samples sent as more than one series, e.g. the trends.
+func (pm *PrometheusMapping) mapScratch(
+	ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label,
+) ([]prompb.TimeSeries, bool) {
+	var s prompb.Sample
+	switch sample.Metric.Type {
+	case metrics.Counter:
+		s.Value = ms.Update(sample, labels, counterAdd).Sink.(*metrics.CounterSink).Value
+		s.Timestamp = ms.Timestamp(sample, labels)
+	case metrics.Gauge:
+		s.Value = sample.Value
+		s.Timestamp = timestamp.FromTime(sample.Time)
+	case metrics.Rate:
+		if pm.rateCounters {
+			return nil, false
+		}
+		s.Value = rateValue(ms.Update(sample, labels, nil).Sink.(*metrics.RateSink))
+		s.Timestamp = ms.Timestamp(sample, labels)
+	default:
+		return nil, false
+	}
+	return ms.scratchSeries(labels, sample.Metric.Name, s), true
+}
+
+func (pm *PrometheusMapping) MapCounter(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+	metric := ms.Update(sample, labels, counterAdd)
 
 	return []prompb.TimeSeries{
 		{
 			Labels: append(labels, prompb.Label{
 				Name:  "__name__",
-				Value: fmt.Sprintf("%s%s", defaultMetricPrefix, sample.Metric.Name),
+				Value: sample.Metric.Name,
 			}),
 			Samples: []prompb.Sample{
 				{
-					Value:     aggr["count"],
-					Timestamp: timestamp.FromTime(sample.Time),
+					Value:     metric.Sink.(*metrics.CounterSink).Value,
+					Timestamp: ms.Timestamp(sample, labels),
 				},
 			},
 		},
 	}
 }
 
-func (pm *PrometheusMapping) MapGauge(ms *metricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+func (pm *PrometheusMapping) MapGauge(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
 	return []prompb.TimeSeries{
 		{
 			Labels: append(labels, prompb.Label{
 				Name:  "__name__",
-				Value: fmt.Sprintf("%s%s", defaultMetricPrefix, sample.Metric.Name),
+				Value: sample.Metric.Name,
 			}),
 			Samples: []prompb.Sample{
 				{
@@ -51,119 +102,193 @@ func (pm *PrometheusMapping) MapGauge(ms *metricsStorage, sample metrics.Sample,
 	}
 }
 
-func (pm *PrometheusMapping) MapRate(ms *metricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
-	metric := ms.update(sample, nil)
-	aggr := metric.Sink.Format(0)
-
+func (pm *PrometheusMapping) MapRate(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+	metric := ms.Update(sample, labels, nil)
+	if pm.rateCounters {
+		return rateCounters(metric.Sink.(*metrics.RateSink), sample.Metric.Name, labels, ms.Timestamp(sample, labels))
+	}
 	return []prompb.TimeSeries{
 		{
 			Labels: append(labels, prompb.Label{
 				Name:  "__name__",
-				Value: fmt.Sprintf("%s%s", defaultMetricPrefix, sample.Metric.Name),
+				Value: sample.Metric.Name,
 			}),
 			Samples: []prompb.Sample{
 				{
-					Value:     aggr["rate"],
-					Timestamp: timestamp.FromTime(sample.Time),
+					Value:     rateValue(metric.Sink.(*metrics.RateSink)),
+					Timestamp: ms.Timestamp(sample, labels),
 				},
 			},
 		},
 	}
 }
 
-func (pm *PrometheusMapping) MapTrend(ms *metricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
-	metric := ms.update(sample, trendAdd)
-
-	// Prometheus metric system does not support Trend so this mapping will store gauges
-	// to keep track of key values.
-	// TODO: when Prometheus implements support for sparse histograms, re-visit this implementation
-
-	s := metric.Sink.(*metrics.TrendSink)
-	aggr := map[string]float64{
-		"min":   s.Min,
-		"max":   s.Max,
-		"avg":   s.Avg,
-		"med":   s.Med,
-		"p(90)": p(s, 0.90),
-		"p(95)": p(s, 0.95),
-	}
-
+// rateCounters returns the <name>_total and <name>_success_total series of the
+// Rate, so that the ratio can be computed over any window with PromQL, e.g.
+// rate(name_success_total[5m]) / rate(name_total[5m]), instead of the ratio
+// since the start of the test. Success counts the non-zero samples.
+func rateCounters(s *metrics.RateSink, name string, labels []prompb.Label, ts int64) []prompb.TimeSeries {
 	return []prompb.TimeSeries{
 		{
 			Labels: append(labels, prompb.Label{
 				Name:  "__name__",
-				Value: fmt.Sprintf("%s%s_min", defaultMetricPrefix, sample.Metric.Name),
+				Value: name + "_total",
 			}),
 			Samples: []prompb.Sample{
 				{
-					Value:     aggr["min"],
-					Timestamp: timestamp.FromTime(sample.Time),
+					Value:     float64(s.Total),
+					Timestamp: ts,
 				},
 			},
 		},
 		{
 			Labels: append(labels, prompb.Label{
 				Name:  "__name__",
-				Value: fmt.Sprintf("%s%s_max", defaultMetricPrefix, sample.Metric.Name),
+				Value: name + "_success_total",
 			}),
 			Samples: []prompb.Sample{
 				{
-					Value:     aggr["max"],
-					Timestamp: timestamp.FromTime(sample.Time),
+					Value:     float64(s.Trues),
+					Timestamp: ts,
 				},
 			},
 		},
-		{
-			Labels: append(labels, prompb.Label{
-				Name:  "__name__",
-				Value: fmt.Sprintf("%s%s_avg", defaultMetricPrefix, sample.Metric.Name),
-			}),
-			Samples: []prompb.Sample{
-				{
-					Value:     aggr["avg"],
-					Timestamp: timestamp.FromTime(sample.Time),
-				},
-			},
-		},
-		{
-			Labels: append(labels, prompb.Label{
-				Name:  "__name__",
-				Value: fmt.Sprintf("%s%s_med", defaultMetricPrefix, sample.Metric.Name),
-			}),
-			Samples: []prompb.Sample{
-				{
-					Value:     aggr["med"],
-					Timestamp: timestamp.FromTime(sample.Time),
-				},
-			},
-		},
-		{
+	}
+}
+
+// rateValue is the rate of RateSink.Format, without building its map for each sample.
+func rateValue(s *metrics.RateSink) float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Trues) / float64(s.Total)
+}
+
+func (pm *PrometheusMapping) MapTrend(ms *MetricsStorage, sample metrics.Sample, labels []prompb.Label) []prompb.TimeSeries {
+	metric := ms.Update(sample, labels, trendAdd)
+	ts := ms.Timestamp(sample, labels)
+
+	// Prometheus metric system does not support Trend so this mapping will store gauges
+	// to keep track of key values.
+	// TODO: when Prometheus implements support for sparse histograms, re-visit this implementation
+
+	s := metric.Sink.(*metrics.TrendSink)
+
+	stats := pm.trendStats
+	if len(stats) == 0 {
+		stats = defaultTrendStats
+	}
+
+	series := make([]prompb.TimeSeries, 0, len(stats))
+	for _, stat := range stats {
+		series = append(series, prompb.TimeSeries{
 			Labels: append(labels, prompb.Label{
 				Name:  "__name__",
-				Value: fmt.Sprintf("%s%s_p90", defaultMetricPrefix, sample.Metric.Name),
+				Value: fmt.Sprintf("%s_%s", sample.Metric.Name, stat.suffix),
 			}),
 			Samples: []prompb.Sample{
 				{
-					Value:     aggr["p(90)"],
-					Timestamp: timestamp.FromTime(sample.Time),
+					Value:     stat.value(s),
+					Timestamp: ts,
 				},
 			},
+		})
+	}
+	return series
+}
+
+// trendStat is a value computed from the samples of a Trend metric,
+// sent as the series named after the metric with suffix appended.
+// sketch computes the same value from a DDSketch, for the ddsketch mapping.
+type trendStat struct {
+	suffix string
+	value  func(*metrics.TrendSink) float64
+	sketch func(*ddSketchSink) float64
+}
+
+// defaultTrendStats are min, max, avg, med, p(90) and p(95).
+var defaultTrendStats = []trendStat{
+	{
+		suffix: "min",
+		value:  func(s *metrics.TrendSink) float64 { return s.Min },
+		sketch: func(s *ddSketchSink) float64 { return s.min },
+	},
+	{
+		suffix: "max",
+		value:  func(s *metrics.TrendSink) float64 { return s.Max },
+		sketch: func(s *ddSketchSink) float64 { return s.max },
+	},
+	{
+		suffix: "avg",
+		value:  func(s *metrics.TrendSink) float64 { return s.Avg },
+		sketch: func(s *ddSketchSink) float64 { return s.avg() },
+	},
+	{
+		suffix: "med",
+		value:  func(s *metrics.TrendSink) float64 { return s.Med },
+		sketch: func(s *ddSketchSink) float64 { return s.quantile(0.5) },
+	},
+	percentileTrendStat(90),
+	percentileTrendStat(95),
+}
+
+func percentileTrendStat(pct float64) trendStat {
+	return trendStat{
+		// e.g. p99_9 for p(99.9)
+		suffix: "p" + strings.ReplaceAll(strconv.FormatFloat(pct, 'f', -1, 64), ".", "_"),
+		value: func(s *metrics.TrendSink) float64 {
+			return p(s, pct/100)
 		},
-		{
-			Labels: append(labels, prompb.Label{
-				Name:  "__name__",
-				Value: fmt.Sprintf("%s%s_p95", defaultMetricPrefix, sample.Metric.Name),
-			}),
-			Samples: []prompb.Sample{
-				{
-					Value:     aggr["p(95)"],
-					Timestamp: timestamp.FromTime(sample.Time),
-				},
-			},
+		sketch: func(s *ddSketchSink) float64 {
+			return s.quantile(pct / 100)
 		},
 	}
 }
 
+// parseTrendStats parses the stats as given to k6's summaryTrendStats:
+// avg, min, med, max, count or p(N) with 0 <= N <= 100.
+func parseTrendStats(names []string) ([]trendStat, error) {
+	stats := make([]trendStat, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "min":
+			stats = append(stats, defaultTrendStats[0])
+		case "max":
+			stats = append(stats, defaultTrendStats[1])
+		case "avg":
+			stats = append(stats, defaultTrendStats[2])
+		case "med":
+			stats = append(stats, defaultTrendStats[3])
+		case "count":
+			stats = append(stats, trendStat{
+				suffix: "count",
+				value:  func(s *metrics.TrendSink) float64 { return float64(s.Count) },
+				sketch: func(s *ddSketchSink) float64 { return float64(s.count) },
+			})
+		default:
+			if !strings.HasPrefix(name, "p(") || !strings.HasSuffix(name, ")") {
+				return nil, fmt.Errorf("invalid trendStats: unsupported stat %q", name)
+			}
+			pct, err := strconv.ParseFloat(name[2:len(name)-1], 64)
+			if err != nil || pct < 0 || pct > 100 {
+				return nil, fmt.Errorf("invalid trendStats: invalid percentile %q", name)
+			}
+			stats = append(stats, percentileTrendStat(pct))
+		}
+	}
+	return stats, nil
+}
+
+// counterAdd ignores negative values: the counters sent must be monotonic,
+// as a decrease is taken for a reset by rate() and increase().
+func counterAdd(current *metrics.Metric, s metrics.Sample) {
+	if s.Value < 0 {
+		return
+	}
+	current.Sink.Add(s)
+}
+
 // The following functions are an attempt to add ad-hoc optimization to TrendSink,
 // and are a partial copy-paste from k6/metrics.
 // TODO: re-write & refactor this once metrics refactoring progresses in k6.
@@ -1,11 +1,14 @@
 package remotewrite
 
 import (
+	"math"
 	"math/rand"
 	"testing"
 	"time"
 
+	"github.com/prometheus/prometheus/prompb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.k6.io/k6/metrics"
 )
 
@@ -108,3 +111,137 @@ func BenchmarkTrendAdd(b *testing.B) {
 		benchF[1](b, start)
 	})
 }
+
+func TestPrometheusMappingTrendStats(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.TrendStats = []string{"p(99)", "p(99.9)", "count", "max"}
+	mapping := NewMapping(config)
+
+	ms := newMetricsStorage()
+	metric := &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend}
+	var ts []prompb.TimeSeries
+	for i := 1; i <= 1000; i++ {
+		ts = mapping.MapTrend(ms, metrics.Sample{Metric: metric, Value: float64(i), Time: time.Now()}, nil)
+	}
+
+	values := make(map[string]float64, len(ts))
+	for _, series := range ts {
+		values[series.Labels[0].Value] = series.Samples[0].Value
+	}
+	assert.Equal(t, map[string]float64{
+		"http_req_duration_p99":   990.01,
+		"http_req_duration_p99_9": 999.001,
+		"http_req_duration_count": 1000,
+		"http_req_duration_max":   1000,
+	}, roundValues(values))
+
+	// the default stats
+	ts = (&PrometheusMapping{}).MapTrend(ms, metrics.Sample{Metric: metric, Value: 1, Time: time.Now()}, nil)
+	names := make([]string, 0, len(ts))
+	for _, series := range ts {
+		names = append(names, series.Labels[0].Value)
+	}
+	assert.Equal(t, []string{
+		"http_req_duration_min", "http_req_duration_max", "http_req_duration_avg",
+		"http_req_duration_med", "http_req_duration_p90", "http_req_duration_p95",
+	}, names)
+}
+
+func roundValues(values map[string]float64) map[string]float64 {
+	for k, v := range values {
+		values[k] = math.Round(v*1000) / 1000
+	}
+	return values
+}
+
+func TestParseTrendStats(t *testing.T) {
+	t.Parallel()
+
+	stats, err := parseTrendStats([]string{"avg", "min", "med", "max", "count", "p(0)", "p(100)", " p(95) "})
+	assert.NoError(t, err)
+	assert.Len(t, stats, 8)
+
+	for _, invalid := range []string{"sum", "p(101)", "p(-1)", "p(x)", "p90"} {
+		_, err := parseTrendStats([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPrometheusMappingCounter(t *testing.T) {
+	t.Parallel()
+
+	pm := &PrometheusMapping{}
+	ms := newMetricsStorage()
+	metric := &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}
+	login := []prompb.Label{{Name: "scenario", Value: "login"}}
+	browse := []prompb.Label{{Name: "scenario", Value: "browse"}}
+	start := time.Unix(1000, 0)
+
+	add := func(labels []prompb.Label, offset time.Duration, value float64) prompb.Sample {
+		series := pm.MapCounter(ms, metrics.Sample{Metric: metric, Time: start.Add(offset), Value: value}, labels)
+		return series[0].Samples[0]
+	}
+
+	// counted per label set
+	assert.Equal(t, prompb.Sample{Value: 1, Timestamp: 1000000}, add(login, 0, 1))
+	assert.Equal(t, prompb.Sample{Value: 2, Timestamp: 1001000}, add(login, time.Second, 1))
+	assert.Equal(t, prompb.Sample{Value: 5, Timestamp: 1000500}, add(browse, 500*time.Millisecond, 5))
+
+	// a late sample is counted but sent at the latest time
+	assert.Equal(t, prompb.Sample{Value: 3, Timestamp: 1001000}, add(login, 100*time.Millisecond, 1))
+
+	// negative values would look like a reset
+	assert.Equal(t, prompb.Sample{Value: 3, Timestamp: 1002000}, add(login, 2*time.Second, -2))
+}
+
+func TestSortSampleContainers(t *testing.T) {
+	t.Parallel()
+
+	metric := &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}
+	start := time.Unix(1000, 0)
+	sample := func(offset time.Duration) metrics.Sample {
+		return metrics.Sample{Metric: metric, Time: start.Add(offset), Value: 1}
+	}
+
+	containers := []metrics.SampleContainer{
+		metrics.Samples{sample(2 * time.Second)},
+		metrics.Samples{sample(3 * time.Second), sample(time.Second)},
+		sample(0),
+	}
+	sortSampleContainers(containers)
+	assert.Equal(t, sample(0), containers[0])
+	assert.Equal(t, metrics.Samples{sample(3 * time.Second), sample(time.Second)}, containers[1])
+	assert.Equal(t, metrics.Samples{sample(2 * time.Second)}, containers[2])
+}
+
+func TestPrometheusMappingRateCounters(t *testing.T) {
+	t.Parallel()
+
+	pm := &PrometheusMapping{rateCounters: true}
+	ms := newMetricsStorage()
+	metric := &metrics.Metric{Name: "http_req_failed", Type: metrics.Rate}
+	labels := []prompb.Label{{Name: "scenario", Value: "login"}}
+
+	var series []prompb.TimeSeries
+	for i, value := range []float64{1, 0, 0, 1, 0} {
+		sample := metrics.Sample{Metric: metric, Time: time.Unix(int64(i), 0), Value: value}
+		series = pm.MapRate(ms, sample, labels)
+	}
+
+	require.Len(t, series, 2)
+	assert.Equal(t, []prompb.Label{
+		{Name: "scenario", Value: "login"}, {Name: "__name__", Value: "http_req_failed_total"},
+	}, series[0].Labels)
+	assert.Equal(t, []prompb.Sample{{Value: 5, Timestamp: 4000}}, series[0].Samples)
+	assert.Equal(t, []prompb.Label{
+		{Name: "scenario", Value: "login"}, {Name: "__name__", Value: "http_req_failed_success_total"},
+	}, series[1].Labels)
+	assert.Equal(t, []prompb.Sample{{Value: 2, Timestamp: 4000}}, series[1].Samples)
+
+	metadata := pm.Metadata(metric)
+	require.Len(t, metadata, 2)
+	assert.Equal(t, prompb.MetricMetadata_COUNTER, metadata[0].Type)
+	assert.Equal(t, "http_req_failed_success_total", metadata[1].MetricFamilyName)
+}
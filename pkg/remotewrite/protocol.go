@@ -0,0 +1,238 @@
+package remotewrite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protocol is the format of the requests sent to the remote endpoint:
+// one of the remote write versions, OTLP, the VictoriaMetrics import API, the InfluxDB line protocol,
+// the Graphite plaintext protocol, with tags or dotted paths, or the Datadog API, with the
+// distribution points of the trends in requests of their own.
+type protocol string
+
+const (
+	protocolV1              protocol = "1.0"
+	protocolV2              protocol = "2.0"
+	protocolOTLP            protocol = "otlp"
+	protocolVictoriaMetrics protocol = "victoriametrics"
+	protocolInfluxDB        protocol = "influxdb"
+	protocolGraphite        protocol = "graphite"
+	protocolGraphiteTagged  protocol = "graphite-tagged"
+	protocolDatadog         protocol = "datadog"
+	// protocolDatadogDistributions is only used for the trends of the datadog protocol.
+	protocolDatadogDistributions protocol = "datadog-distributions"
+)
+
+// parseProtocol returns the protocol for the protocol mode (prometheus, otlp
+// or victoriametrics) and, for the first, the remote write version.
+func parseProtocol(mode, version string) (protocol, error) {
+	switch mode {
+	case "", "prometheus":
+	case "otlp":
+		return protocolOTLP, nil
+	case "victoriametrics":
+		return protocolVictoriaMetrics, nil
+	case "influxdb":
+		return protocolInfluxDB, nil
+	case "datadog":
+		return protocolDatadog, nil
+	default:
+		return "", fmt.Errorf("invalid protocol %q, it must be prometheus, otlp, victoriametrics, influxdb or datadog", mode)
+	}
+
+	switch p := protocol(version); p {
+	case protocolV1, protocolV2:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid protocolVersion %q, it must be 1.0 or 2.0", version)
+	}
+}
+
+// headers returns the headers describing a request body of the protocol compressed with c.
+func (p protocol) headers(c compression) map[string]string {
+	var headers map[string]string
+	switch p {
+	case protocolV2:
+		headers = map[string]string{
+			"Content-Type":                      "application/x-protobuf;proto=io.prometheus.write.v2.Request",
+			"X-Prometheus-Remote-Write-Version": "2.0.0",
+		}
+	case protocolOTLP:
+		headers = map[string]string{
+			"Content-Type": "application/x-protobuf",
+		}
+	case protocolVictoriaMetrics, protocolDatadog, protocolDatadogDistributions:
+		headers = map[string]string{
+			"Content-Type": "application/json",
+		}
+	case protocolInfluxDB:
+		headers = map[string]string{
+			"Content-Type": "text/plain; charset=utf-8",
+			"Accept":       "application/json",
+		}
+	default:
+		headers = map[string]string{
+			"Content-Type":                      "application/x-protobuf",
+			"X-Prometheus-Remote-Write-Version": "0.1.0",
+		}
+	}
+
+	if encoding := c.resolve(p).contentEncoding(); encoding != "" {
+		headers["Content-Encoding"] = encoding
+	}
+	return headers
+}
+
+// isUnsupportedProtocol returns true if the endpoint rejected the request
+// because it doesn't support its protocol, as remote write 1.0 receivers do with 2.0.
+func isUnsupportedProtocol(err error) bool {
+	var statusErr *statusError
+	return errors.As(err, &statusErr) && statusErr.code == http.StatusUnsupportedMediaType
+}
+
+// Field numbers of io.prometheus.write.v2 messages
+// (https://github.com/prometheus/prometheus/blob/main/prompb/io/prometheus/write/v2/types.proto).
+const (
+	v2RequestSymbols    = 4
+	v2RequestTimeseries = 5
+
+	v2SeriesLabelsRefs = 1
+	v2SeriesSamples    = 2
+	v2SeriesHistograms = 3
+	v2SeriesExemplars  = 4
+	v2SeriesMetadata   = 5
+	v2SeriesCreated    = 6
+
+	v2SampleValue     = 1
+	v2SampleTimestamp = 2
+
+	v2ExemplarLabelsRefs = 1
+	v2ExemplarValue      = 2
+	v2ExemplarTimestamp  = 3
+
+	v2MetadataType    = 1
+	v2MetadataHelpRef = 3
+	v2MetadataUnitRef = 4
+)
+
+// marshalWriteRequestV2 marshals the time series as an io.prometheus.write.v2.Request:
+// label names and values are sent once in the symbols table and referenced
+// by index from the series. The Histogram message is the same as in 1.0.
+// The series carry the type, description and unit of their metric known by
+// the metadata tracker, which may be nil, and the created timestamp of the
+// counters and histograms.
+func marshalWriteRequestV2(series []prompb.TimeSeries, metadata *metadataTracker) ([]byte, error) {
+	symbols := newSymbolTable()
+
+	var body []byte
+	for _, ts := range series {
+		var msg []byte
+		msg = appendLabelsRefs(msg, v2SeriesLabelsRefs, symbols.refs(ts.Labels))
+
+		for _, s := range ts.Samples {
+			var sample []byte
+			sample = appendDouble(sample, v2SampleValue, s.Value)
+			sample = appendInt64(sample, v2SampleTimestamp, s.Timestamp)
+			msg = appendMessage(msg, v2SeriesSamples, sample)
+		}
+
+		for i := range ts.Histograms {
+			h, err := ts.Histograms[i].Marshal()
+			if err != nil {
+				return nil, err
+			}
+			msg = appendMessage(msg, v2SeriesHistograms, h)
+		}
+
+		for _, e := range ts.Exemplars {
+			var exemplar []byte
+			exemplar = appendLabelsRefs(exemplar, v2ExemplarLabelsRefs, symbols.refs(e.Labels))
+			exemplar = appendDouble(exemplar, v2ExemplarValue, e.Value)
+			exemplar = appendInt64(exemplar, v2ExemplarTimestamp, e.Timestamp)
+			msg = appendMessage(msg, v2SeriesExemplars, exemplar)
+		}
+
+		if m, ok := metadata.lookup(metricName(ts.Labels)); ok {
+			var meta []byte
+			meta = appendInt64(meta, v2MetadataType, int64(m.Type))
+			meta = appendInt64(meta, v2MetadataHelpRef, int64(symbols.ref(m.Help)))
+			meta = appendInt64(meta, v2MetadataUnitRef, int64(symbols.ref(m.Unit)))
+			msg = appendMessage(msg, v2SeriesMetadata, meta)
+			msg = appendInt64(msg, v2SeriesCreated, metadata.createdTimestamp(m))
+		}
+
+		body = appendMessage(body, v2RequestTimeseries, msg)
+	}
+
+	var req []byte
+	for _, s := range symbols.symbols {
+		req = appendString(req, v2RequestSymbols, s)
+	}
+	return append(req, body...), nil
+}
+
+// symbolTable interns the strings of a 2.0 request. The first symbol is always the empty string.
+type symbolTable struct {
+	index   map[string]uint32
+	symbols []string
+}
+
+func newSymbolTable() *symbolTable {
+	return &symbolTable{
+		index:   map[string]uint32{"": 0},
+		symbols: []string{""},
+	}
+}
+
+func (t *symbolTable) ref(s string) uint32 {
+	if i, ok := t.index[s]; ok {
+		return i
+	}
+	i := uint32(len(t.symbols))
+	t.index[s] = i
+	t.symbols = append(t.symbols, s)
+	return i
+}
+
+// refs returns the references of the labels as name and value pairs.
+func (t *symbolTable) refs(labels []prompb.Label) []uint32 {
+	refs := make([]uint32, 0, 2*len(labels))
+	for _, l := range labels {
+		refs = append(refs, t.ref(l.Name), t.ref(l.Value))
+	}
+	return refs
+}
+
+func appendLabelsRefs(b []byte, num protowire.Number, refs []uint32) []byte {
+	if len(refs) == 0 {
+		return b
+	}
+	var packed []byte
+	for _, r := range refs {
+		packed = protowire.AppendVarint(packed, uint64(r))
+	}
+	return appendMessage(b, num, packed)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	bits := math.Float64bits(v)
+	if bits == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, bits)
+}
+
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
@@ -0,0 +1,266 @@
+package remotewrite
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"google.golang.org/protobuf/encoding/protowire"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestParseProtocol(t *testing.T) {
+	t.Parallel()
+
+	p, err := parseProtocol("prometheus", "2.0")
+	require.NoError(t, err)
+	assert.Equal(t, protocolV2, p)
+
+	p, err = parseProtocol("otlp", "1.0")
+	require.NoError(t, err)
+	assert.Equal(t, protocolOTLP, p)
+
+	p, err = parseProtocol("victoriametrics", "1.0")
+	require.NoError(t, err)
+	assert.Equal(t, protocolVictoriaMetrics, p)
+
+	_, err = parseProtocol("prometheus", "3")
+	assert.Error(t, err)
+
+	_, err = parseProtocol("influx", "1.0")
+	assert.Error(t, err)
+}
+
+func TestMarshalWriteRequestV2(t *testing.T) {
+	t.Parallel()
+
+	buf, err := marshalWriteRequestV2([]prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}, {Name: "scenario", Value: "default"}},
+			Samples: []prompb.Sample{{Value: 3, Timestamp: 1000}},
+		},
+		{
+			Labels:    []prompb.Label{{Name: "__name__", Value: "k6_http_reqs"}, {Name: "scenario", Value: "default"}},
+			Samples:   []prompb.Sample{{Value: 1, Timestamp: 1000}},
+			Exemplars: []prompb.Exemplar{{Labels: []prompb.Label{{Name: "trace_id", Value: "abc"}}, Value: 1, Timestamp: 1000}},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	var (
+		symbols []string
+		series  [][]byte
+	)
+	forEachField(t, buf, func(num protowire.Number, v []byte) {
+		switch num {
+		case v2RequestSymbols:
+			symbols = append(symbols, string(v))
+		case v2RequestTimeseries:
+			series = append(series, v)
+		}
+	})
+
+	assert.Equal(t, []string{"", "__name__", "k6_vus", "scenario", "default", "k6_http_reqs", "trace_id", "abc"}, symbols)
+	require.Len(t, series, 2)
+
+	var (
+		refs      []uint64
+		samples   int
+		exemplars int
+	)
+	forEachField(t, series[1], func(num protowire.Number, v []byte) {
+		switch num {
+		case v2SeriesLabelsRefs:
+			for len(v) > 0 {
+				ref, n := protowire.ConsumeVarint(v)
+				require.Positive(t, n)
+				refs = append(refs, ref)
+				v = v[n:]
+			}
+		case v2SeriesSamples:
+			samples++
+			forEachField(t, v, func(num protowire.Number, v []byte) {
+				if num == v2SampleValue {
+					value, _ := protowire.ConsumeFixed64(v)
+					assert.Equal(t, float64(1), math.Float64frombits(value))
+				}
+			})
+		case v2SeriesExemplars:
+			exemplars++
+		}
+	})
+	assert.Equal(t, []uint64{1, 5, 3, 4}, refs)
+	assert.Equal(t, 1, samples)
+	assert.Equal(t, 1, exemplars)
+}
+
+func TestMarshalWriteRequestV2Metadata(t *testing.T) {
+	t.Parallel()
+
+	tracker := newMetadataTracker(&HistogramMapping{}, NewConfig())
+	tracker.add([]metrics.SampleContainer{metrics.Samples{
+		{Metric: &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}, Value: 1},
+		{Metric: &metrics.Metric{Name: "vus", Type: metrics.Gauge}, Value: 3},
+		{Metric: &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend, Contains: metrics.Time}, Value: 10},
+	}})
+
+	buf, err := marshalWriteRequestV2([]prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_http_reqs"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+			Samples: []prompb.Sample{{Value: 3, Timestamp: 1000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_http_req_duration_bucket"}, {Name: "le", Value: "+Inf"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_unknown"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+		},
+	}, tracker)
+	require.NoError(t, err)
+
+	var (
+		symbols []string
+		series  [][]byte
+	)
+	forEachField(t, buf, func(num protowire.Number, v []byte) {
+		switch num {
+		case v2RequestSymbols:
+			symbols = append(symbols, string(v))
+		case v2RequestTimeseries:
+			series = append(series, v)
+		}
+	})
+	require.Len(t, series, 4)
+
+	type seriesMetadata struct {
+		typ, help, unit string
+		found           bool
+		created         int64
+	}
+	decode := func(s []byte) seriesMetadata {
+		var m seriesMetadata
+		forEachField(t, s, func(num protowire.Number, v []byte) {
+			switch num {
+			case v2SeriesMetadata:
+				m.found = true
+				forEachField(t, v, func(num protowire.Number, v []byte) {
+					value, _ := protowire.ConsumeVarint(v)
+					switch num {
+					case v2MetadataType:
+						m.typ = prompb.MetricMetadata_MetricType(value).String()
+					case v2MetadataHelpRef:
+						m.help = symbols[value]
+					case v2MetadataUnitRef:
+						m.unit = symbols[value]
+					}
+				})
+			case v2SeriesCreated:
+				value, _ := protowire.ConsumeVarint(v)
+				m.created = int64(value)
+			}
+		})
+		return m
+	}
+
+	assert.Equal(t, seriesMetadata{
+		typ: "COUNTER", help: "How many HTTP requests k6 generated", found: true, created: tracker.created,
+	}, decode(series[0]))
+	assert.Equal(t, seriesMetadata{
+		typ: "GAUGE", help: "Current number of active virtual users", found: true,
+	}, decode(series[1]))
+	assert.Equal(t, seriesMetadata{
+		typ:     "HISTOGRAM",
+		help:    "Total time for the request, excluding the time spent blocked, connecting and handshaking",
+		unit:    "milliseconds",
+		found:   true,
+		created: tracker.created,
+	}, decode(series[2]))
+	assert.Equal(t, seriesMetadata{}, decode(series[3]))
+	assert.Positive(t, tracker.created)
+}
+
+// forEachField calls fn with the number and the raw value of each field of a message.
+func forEachField(t *testing.T, b []byte, fn func(protowire.Number, []byte)) {
+	t.Helper()
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.Positive(t, n)
+		b = b[n:]
+
+		var v []byte
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			v = b[:n]
+		}
+		require.Positive(t, n)
+		fn(num, v)
+		b = b[n:]
+	}
+}
+
+func TestOutputProtocolFallback(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		versions []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		version := r.Header.Get("X-Prometheus-Remote-Write-Version")
+		versions = append(versions, version)
+		if version != "0.1.0" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+	clientV2, err := newWriteClient("test", remoteConfig, protocolV2, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	o := &Output{
+		config:   config,
+		client:   clientV2,
+		fallback: client,
+		protocol: protocolV2,
+		retry:    newRetryPolicy(config),
+		logger:   logrus.New(),
+	}
+
+	series := []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}
+	require.NoError(t, o.write(series))
+	require.NoError(t, o.write(series))
+
+	assert.Equal(t, []string{"2.0.0", "0.1.0", "0.1.0"}, versions)
+	assert.Equal(t, protocolV1, o.currentProtocol())
+}
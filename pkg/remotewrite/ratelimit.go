@@ -0,0 +1,64 @@
+package remotewrite
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimiter paces the requests with token buckets so that the ingestion
+// limits of the endpoint, e.g. Mimir's per-tenant ingestion rate, are not
+// exceeded and requests are not rejected with 429 Too Many Requests.
+type rateLimiter struct {
+	samples  *rate.Limiter
+	requests *rate.Limiter
+}
+
+// newRateLimiter returns a limiter of the samples and requests sent per second.
+// A limit of 0 disables the respective bucket; nil is returned if both are disabled.
+// The buckets start full and allow bursts of up to a second worth of tokens.
+func newRateLimiter(samplesPerSecond, requestsPerSecond int64) *rateLimiter {
+	if samplesPerSecond <= 0 && requestsPerSecond <= 0 {
+		return nil
+	}
+
+	l := &rateLimiter{}
+	if samplesPerSecond > 0 {
+		l.samples = rate.NewLimiter(rate.Limit(samplesPerSecond), int(samplesPerSecond))
+	}
+	if requestsPerSecond > 0 {
+		l.requests = rate.NewLimiter(rate.Limit(requestsPerSecond), int(requestsPerSecond))
+	}
+	return l
+}
+
+// waitSamples blocks until n samples can be sent. Requests with more samples
+// than the bucket holds wait for as many refills as needed.
+// It's a no-op on a nil receiver.
+func (l *rateLimiter) waitSamples(ctx context.Context, n int) error {
+	if l == nil || l.samples == nil {
+		return nil
+	}
+
+	burst := l.samples.Burst()
+	for n > 0 {
+		tokens := n
+		if tokens > burst {
+			tokens = burst
+		}
+		if err := l.samples.WaitN(ctx, tokens); err != nil {
+			return err
+		}
+		n -= tokens
+	}
+	return nil
+}
+
+// waitRequest blocks until a request can be sent.
+// It's a no-op on a nil receiver.
+func (l *rateLimiter) waitRequest(ctx context.Context) error {
+	if l == nil || l.requests == nil {
+		return nil
+	}
+	return l.requests.Wait(ctx)
+}
@@ -0,0 +1,48 @@
+package remotewrite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newRateLimiter(0, 0))
+
+	// nil-safe
+	var disabled *rateLimiter
+	require.NoError(t, disabled.waitSamples(context.Background(), 1000))
+	require.NoError(t, disabled.waitRequest(context.Background()))
+
+	l := newRateLimiter(100, 10)
+
+	// the buckets start full
+	start := time.Now()
+	require.NoError(t, l.waitSamples(context.Background(), 100))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	// 50 more samples wait for half a second worth of tokens
+	require.NoError(t, l.waitSamples(context.Background(), 50))
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	// more samples than the burst are waited for in several steps
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, l.waitSamples(ctx, 1000))
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, l.waitRequest(context.Background()))
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, l.waitRequest(ctx))
+
+	samplesOnly := newRateLimiter(10, 0)
+	assert.Nil(t, samplesOnly.requests)
+	require.NoError(t, samplesOnly.waitRequest(context.Background()))
+}
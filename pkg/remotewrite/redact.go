@@ -0,0 +1,94 @@
+package remotewrite
+
+import (
+	"net/url"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+// redacted replaces the secrets, as url.URL.Redacted does for passwords.
+const redacted = "xxxxx"
+
+// redactedConfig returns a copy of the config without its secrets: the passwords,
+// tokens and keys, the values of the headers and the passwords of the URLs are
+// replaced with xxxxx. The files of the secrets are kept, as they're only paths.
+func redactedConfig(c Config) Config {
+	for _, s := range []*null.String{
+		&c.Password, &c.BearerToken, &c.OAuth2ClientSecret, &c.AzureClientSecret,
+		&c.GrafanaCloudAPIKey, &c.InfluxToken, &c.DatadogAPIKey, &c.KafkaPassword,
+	} {
+		if s.String != "" {
+			*s = null.StringFrom(redacted)
+		}
+	}
+	for _, s := range []*null.String{&c.Url, &c.ProxyURL, &c.OAuth2TokenURL} {
+		if s.String != "" {
+			*s = null.StringFrom(redactURL(s.String))
+		}
+	}
+	c.Headers = redactHeaders(c.Headers)
+	c.FailoverUrls = redactURLs(c.FailoverUrls)
+	c.MirrorUrls = redactURLs(c.MirrorUrls)
+
+	if c.TenantRoutes != nil {
+		routes := make([]TenantRoute, len(c.TenantRoutes))
+		for i, r := range c.TenantRoutes {
+			r.URL = redactURL(r.URL)
+			routes[i] = r
+		}
+		c.TenantRoutes = routes
+	}
+	if c.MetricRoutes != nil {
+		routes := make([]MetricRoute, len(c.MetricRoutes))
+		for i, r := range c.MetricRoutes {
+			r.URL = redactURL(r.URL)
+			if r.Password != "" {
+				r.Password = redacted
+			}
+			if r.BearerToken != "" {
+				r.BearerToken = redacted
+			}
+			r.Headers = redactHeaders(r.Headers)
+			routes[i] = r
+		}
+		c.MetricRoutes = routes
+	}
+	return c
+}
+
+// redactHeaders returns the headers with their values redacted, as any of them
+// may be a credential, e.g. Authorization or X-Api-Key.
+func redactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	redactedHeaders := make(map[string]string, len(headers))
+	for name := range headers {
+		redactedHeaders[name] = redacted
+	}
+	return redactedHeaders
+}
+
+func redactURLs(urls []string) []string {
+	if urls == nil {
+		return nil
+	}
+	redactedURLs := make([]string, len(urls))
+	for i, u := range urls {
+		redactedURLs[i] = redactURL(u)
+	}
+	return redactedURLs
+}
+
+// redactURL returns the URL without the password it may embed, or redacted as
+// a whole if it can't be parsed, as the password can't be told apart then.
+func redactURL(rawURL string) string {
+	if rawURL == "" {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return redacted
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,105 @@
+package remotewrite
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// rejectionOther is the reason of the rejections whose message isn't known.
+const rejectionOther = "other"
+
+// rejection describes why the endpoint rejected the samples of a request,
+// parsed from the body of its response.
+type rejection struct {
+	// reason is a short identifier of the cause, e.g. label_name_too_long
+	reason string
+	// metric and label are set when the message names the offending ones
+	metric string
+	label  string
+}
+
+// rejectionReasons are matched, in order, against the messages of Prometheus,
+// Mimir, Cortex and VictoriaMetrics. The error IDs of Mimir, e.g.
+// (err-mimir-label-name-too-long), are used as reason when present.
+var rejectionReasons = []struct {
+	pattern *regexp.Regexp
+	reason  string
+}{
+	{regexp.MustCompile(`\(err-mimir-([a-z0-9-]+)\)`), ""},
+	{regexp.MustCompile(`(?i)label name (length exceeds the limit|too long)`), "label_name_too_long"},
+	{regexp.MustCompile(`(?i)label value (length exceeds the limit|too long)`), "label_value_too_long"},
+	{regexp.MustCompile(`(?i)(has \d+ label names|label names per series|too many labels)`), "max_label_names_per_series"},
+	{regexp.MustCompile(`(?i)duplicate label`), "duplicate_label_names"},
+	{regexp.MustCompile(`(?i)invalid (metric name|label)`), "invalid_name"},
+	{regexp.MustCompile(`(?i)out of order`), "sample_out_of_order"},
+	{regexp.MustCompile(`(?i)duplicate sample`), "duplicate_sample"},
+	{regexp.MustCompile(`(?i)(too old|out of bounds|too far in the past)`), "sample_too_old"},
+	{regexp.MustCompile(`(?i)too far in the future`), "sample_too_far_in_future"},
+	{regexp.MustCompile(`(?i)(series limit|max series|maxSeries)`), "max_series"},
+}
+
+var (
+	// e.g. series: 'k6_http_reqs{...}' for Mimir, metric "k6_http_reqs{...}" for Cortex
+	// or for 'k6_http_reqs{...}' in the label count message
+	rejectionMetricPattern = regexp.MustCompile(`(?:series:?|metric:?|for) ['"]([a-zA-Z_:][a-zA-Z0-9_:]*)`)
+	// e.g. label: 'url' for Mimir or label name too long: "url" for Cortex
+	rejectionLabelPattern = regexp.MustCompile(`(?:label:|label name too long:|label value too long:|label name) ['"]([a-zA-Z_][a-zA-Z0-9_]*)`)
+)
+
+// parseRejection returns the reason, metric and label found in the message of a rejection.
+func parseRejection(message string) rejection {
+	r := rejection{reason: rejectionOther}
+	for _, rr := range rejectionReasons {
+		m := rr.pattern.FindStringSubmatch(message)
+		if m == nil {
+			continue
+		}
+		r.reason = rr.reason
+		if r.reason == "" {
+			r.reason = strings.ReplaceAll(m[1], "-", "_")
+		}
+		break
+	}
+	if m := rejectionMetricPattern.FindStringSubmatch(message); m != nil {
+		r.metric = m[1]
+	}
+	if m := rejectionLabelPattern.FindStringSubmatch(message); m != nil {
+		r.label = m[1]
+	}
+	return r
+}
+
+// rejectionOf returns the rejection of the error, if the endpoint rejected the request
+// with a client error, i.e. a 4xx status other than 429 or an equivalent gRPC status.
+func rejectionOf(err error) (rejection, bool) {
+	if classifyError(err) != errorClassClient {
+		return rejection{}, false
+	}
+	var (
+		status     *statusError
+		grpcStatus *grpcStatusError
+	)
+	switch {
+	case errors.As(err, &status):
+		return parseRejection(status.body), true
+	case errors.As(err, &grpcStatus):
+		return parseRejection(grpcStatus.status.Message()), true
+	default:
+		return rejection{}, false
+	}
+}
+
+// fields returns the fields logged with the error of the rejection.
+func (r rejection) fields() logrus.Fields {
+	fields := logrus.Fields{"reason": r.reason}
+	if r.metric != "" {
+		fields["metric"] = r.metric
+	}
+	if r.label != "" {
+		fields["label"] = r.label
+	}
+	return fields
+}
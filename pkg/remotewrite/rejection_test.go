@@ -0,0 +1,92 @@
+package remotewrite
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestParseRejection(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		message  string
+		expected rejection
+	}{
+		{
+			message: `received a series whose label name length exceeds the limit, label: 'a_very_long_label' series: 'k6_http_reqs{a_very_long_label="1"}' (err-mimir-label-name-too-long)`,
+			expected: rejection{
+				reason: "label_name_too_long", metric: "k6_http_reqs", label: "a_very_long_label",
+			},
+		},
+		{
+			message: `received a series whose label value length exceeds the limit, label: 'url', value: 'http://example.com/...' (truncated) series: 'k6_http_req_duration_p99{url="http://exam' (err-mimir-label-value-too-long)`,
+			expected: rejection{
+				reason: "label_value_too_long", metric: "k6_http_req_duration_p99", label: "url",
+			},
+		},
+		{
+			message: `label name too long: "a_very_long_label" metric: "k6_vus{a_very_long_label=\"1\"}"`,
+			expected: rejection{
+				reason: "label_name_too_long", metric: "k6_vus", label: "a_very_long_label",
+			},
+		},
+		{
+			message:  `sample for 'k6_http_reqs{method="GET"}' has 31 label names; limit 30`,
+			expected: rejection{reason: "max_label_names_per_series", metric: "k6_http_reqs"},
+		},
+		{
+			message:  "out of order sample",
+			expected: rejection{reason: "sample_out_of_order"},
+		},
+		{
+			message:  "unexpected EOF",
+			expected: rejection{reason: rejectionOther},
+		},
+	} {
+		assert.Equal(t, tc.expected, parseRejection(tc.message), tc.message)
+	}
+}
+
+func TestOutputStoreRejection(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `received a series with duplicate label name, label: 'method' series: 'k6_http_reqs{method="GET", method="GET"}' (err-mimir-duplicate-label-names)`,
+			http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	o := &Output{
+		config: config,
+		client: client,
+		retry:  newRetryPolicy(config),
+		self:   newSelfMetrics(),
+		logger: logrus.New(),
+	}
+
+	err = o.store(nil, []byte("payload"), protocolV1)
+	require.Error(t, err)
+	r, ok := rejectionOf(err)
+	require.True(t, ok)
+	assert.Equal(t, rejection{reason: "duplicate_label_names", metric: "k6_http_reqs", label: "method"}, r)
+	assert.Equal(t, map[string]uint64{"duplicate_label_names": 1}, o.self.fields()["rejections"])
+
+	// other errors are not rejections
+	_, ok = rejectionOf(recoverableError{err: errors.New("connection refused")})
+	assert.False(t, ok)
+}
@@ -0,0 +1,62 @@
+package remotewrite
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/prompb"
+	"gopkg.in/yaml.v2"
+)
+
+// RelabelConfig is a Prometheus relabel_config
+// (https://prometheus.io/docs/prometheus/latest/configuration/configuration/#relabel_config)
+// applied to every series before sending it. The fields and their defaults are the same.
+type RelabelConfig struct {
+	SourceLabels []string `json:"source_labels,omitempty" yaml:"source_labels,omitempty"`
+	Separator    *string  `json:"separator,omitempty" yaml:"separator,omitempty"`
+	Regex        *string  `json:"regex,omitempty" yaml:"regex,omitempty"`
+	Modulus      uint64   `json:"modulus,omitempty" yaml:"modulus,omitempty"`
+	TargetLabel  string   `json:"target_label,omitempty" yaml:"target_label,omitempty"`
+	Replacement  *string  `json:"replacement,omitempty" yaml:"replacement,omitempty"`
+	Action       string   `json:"action,omitempty" yaml:"action,omitempty"`
+}
+
+// newRelabelConfigs validates the configs and converts them for relabel.Process.
+// They go through YAML so that Prometheus defaults and validation apply as they are.
+func newRelabelConfigs(configs []RelabelConfig) ([]*relabel.Config, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	b, err := yaml.Marshal(configs)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed []*relabel.Config
+	if err := yaml.Unmarshal(b, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid relabelConfigs: %w", err)
+	}
+	return parsed, nil
+}
+
+// relabelSeries applies the relabeling to the labels of a series.
+// It returns false if the series has to be dropped.
+func relabelSeries(promLabels []prompb.Label, configs []*relabel.Config) ([]prompb.Label, bool) {
+	lbls := make(labels.Labels, 0, len(promLabels))
+	for _, l := range promLabels {
+		lbls = append(lbls, labels.Label{Name: l.Name, Value: l.Value})
+	}
+
+	lbls = relabel.Process(labels.New(lbls...), configs...)
+	if lbls == nil {
+		return nil, false
+	}
+
+	relabeled := make([]prompb.Label, 0, len(lbls))
+	for _, l := range lbls {
+		relabeled = append(relabeled, prompb.Label{Name: l.Name, Value: l.Value})
+	}
+	return relabeled, true
+}
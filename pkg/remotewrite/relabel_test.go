@@ -0,0 +1,57 @@
+package remotewrite
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRelabelConfigs(t *testing.T) {
+	t.Parallel()
+
+	configs, err := newRelabelConfigs(nil)
+	require.NoError(t, err)
+	assert.Nil(t, configs)
+
+	configs, err = newRelabelConfigs([]RelabelConfig{{SourceLabels: []string{"status"}, TargetLabel: "code"}})
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	// Prometheus defaults
+	assert.Equal(t, ";", configs[0].Separator)
+	assert.Equal(t, "$1", configs[0].Replacement)
+	assert.EqualValues(t, "replace", configs[0].Action)
+
+	_, err = newRelabelConfigs([]RelabelConfig{{Action: "hashmod", TargetLabel: "shard"}})
+	assert.Error(t, err)
+
+	_, err = newRelabelConfigs([]RelabelConfig{{Action: "explode"}})
+	assert.Error(t, err)
+}
+
+func TestRelabelSeries(t *testing.T) {
+	t.Parallel()
+
+	str := func(s string) *string { return &s }
+
+	configs, err := newRelabelConfigs([]RelabelConfig{
+		{SourceLabels: []string{"__name__"}, Regex: str("k6_data_.*"), Action: "drop"},
+		{SourceLabels: []string{"status"}, Regex: str("(\\d)\\d\\d"), TargetLabel: "status_class", Replacement: str("${1}xx")},
+		{Regex: str("status"), Action: "labeldrop"},
+	})
+	require.NoError(t, err)
+
+	labels, keep := relabelSeries([]prompb.Label{
+		{Name: "status", Value: "404"},
+		{Name: "__name__", Value: "k6_http_reqs"},
+	}, configs)
+	assert.True(t, keep)
+	assert.Equal(t, []prompb.Label{
+		{Name: "__name__", Value: "k6_http_reqs"},
+		{Name: "status_class", Value: "4xx"},
+	}, labels)
+
+	_, keep = relabelSeries([]prompb.Label{{Name: "__name__", Value: "k6_data_sent"}}, configs)
+	assert.False(t, keep)
+}
@@ -0,0 +1,77 @@
+package remotewrite
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// errReloadWithoutConfigFile is returned by New when ReloadConfig is enabled without config file.
+var errReloadWithoutConfigFile = errors.New(
+	"reloadConfig requires a config file, set its path with K6_PROMETHEUS_CONFIG")
+
+// watchReload reloads the config on SIGHUP until the output is stopped.
+// SIGHUP would otherwise terminate k6, so it's handled only when enabled.
+func (o *Output) watchReload() {
+	o.reloadSignals = make(chan os.Signal, 1)
+	o.reloadDone = make(chan struct{})
+	signal.Notify(o.reloadSignals, syscall.SIGHUP)
+
+	go func() {
+		defer close(o.reloadDone)
+		for range o.reloadSignals {
+			if err := o.reload(); err != nil {
+				o.logger.WithError(err).Error("Prometheus: failed to reload the config, keeping the current one")
+				continue
+			}
+			o.logger.Info("Prometheus: config reloaded")
+		}
+	}()
+}
+
+// stopReload stops handling SIGHUP and waits for the reload in progress, if any,
+// so that the config isn't changed anymore while the output is stopping.
+func (o *Output) stopReload() {
+	if o.reloadSignals == nil {
+		return
+	}
+	signal.Stop(o.reloadSignals)
+	close(o.reloadSignals)
+	<-o.reloadDone
+}
+
+// reload loads the config again, with the config file as it is now, and applies its
+// metrics filters, relabeling rules and static labels from the next flush on. The
+// other options are kept as they were when the test started. Nothing is changed
+// if the new config is not valid.
+func (o *Output) reload() error {
+	config, err := o.loadConfig()
+	if err != nil {
+		return err
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	filter, err := newMetricFilter(config.MetricsInclude, config.MetricsExclude)
+	if err != nil {
+		return err
+	}
+	relabelConfigs, err := newRelabelConfigs(config.RelabelConfigs)
+	if err != nil {
+		return err
+	}
+
+	// the samples are converted with these options while flushing
+	o.flushMu.Lock()
+	defer o.flushMu.Unlock()
+
+	o.filter = filter
+	o.relabel = relabelConfigs
+	o.config.MetricsInclude = config.MetricsInclude
+	o.config.MetricsExclude = config.MetricsExclude
+	o.config.RelabelConfigs = config.RelabelConfigs
+	o.config.Labels = config.Labels
+	o.debug.setConfig(o.config)
+	return nil
+}
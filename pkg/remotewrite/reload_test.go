@@ -0,0 +1,143 @@
+package remotewrite
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"go.k6.io/k6/output"
+)
+
+func TestOutputReloadConfig(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "prometheus.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+metricsInclude: [http_reqs]
+labels:
+  team: payments
+`), 0o600))
+
+	env := map[string]string{"K6_PROMETHEUS_CONFIG": path, "K6_PROMETHEUS_TEST_RUN_ID": ""}
+	loadConfig := func() (Config, error) {
+		return GetConsolidatedConfig(nil, env, "")
+	}
+	config, err := loadConfig()
+	require.NoError(t, err)
+	filter, err := newMetricFilter(config.MetricsInclude, config.MetricsExclude)
+	require.NoError(t, err)
+
+	o := &Output{
+		config:     config,
+		metrics:    newMetricsStorage(),
+		checks:     newCheckCounters(),
+		mapping:    NewMapping(config),
+		filter:     filter,
+		loadConfig: loadConfig,
+		logger:     logrus.New(),
+	}
+
+	tags := metrics.NewSampleTags(map[string]string{})
+	samples := metrics.Samples{
+		{Metric: &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}, Tags: tags, Time: time.Now(), Value: 1},
+		{Metric: &metrics.Metric{Name: "vus", Type: metrics.Gauge}, Tags: tags, Time: time.Now(), Value: 1},
+	}
+	convert := func() []prompb.TimeSeries {
+		return o.convertToTimeSeries([]metrics.SampleContainer{samples})
+	}
+
+	series := convert()
+	require.Len(t, series, 1)
+	assert.Equal(t, []prompb.Label{
+		{Name: "__name__", Value: "k6_http_reqs"},
+		{Name: "team", Value: "payments"},
+	}, series[0].Labels)
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+metricsInclude: [vus]
+labels:
+  team: checkout
+relabelConfigs:
+  - target_label: env
+    replacement: staging
+`), 0o600))
+	require.NoError(t, o.reload())
+
+	series = convert()
+	require.Len(t, series, 1)
+	assert.Equal(t, []prompb.Label{
+		{Name: "__name__", Value: "k6_vus"},
+		{Name: "env", Value: "staging"},
+		{Name: "team", Value: "checkout"},
+	}, series[0].Labels)
+
+	// an invalid config is not applied
+	require.NoError(t, os.WriteFile(path, []byte("metricsInclude: [\"vus(\"]\n"), 0o600))
+	require.Error(t, o.reload())
+	assert.Len(t, convert(), 1)
+}
+
+// TestOutputReloadDuringStop is meant to be run with -race: the config must not
+// be reloaded anymore while Stop reads it to send the test marker and the heartbeat.
+// It's not parallel as the signals are sent to the whole process.
+func TestOutputReloadDuringStop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "prometheus.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("labels:\n  team: payments\n"), 0o600))
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	o, err := New(output.Params{
+		Logger: logger,
+		Environment: map[string]string{
+			"K6_PROMETHEUS_REMOTE_URL":    server.URL,
+			"K6_PROMETHEUS_CONFIG":        path,
+			"K6_PROMETHEUS_RELOAD_CONFIG": "true",
+			"K6_PROMETHEUS_TEST_MARKERS":  "true",
+			"K6_PROMETHEUS_HEARTBEAT":     "true",
+			"K6_PROMETHEUS_TEST_RUN_ID":   "",
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, o.Start())
+
+	// SIGHUP would terminate the test once the output stops handling it
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGHUP)
+	defer signal.Stop(guard)
+
+	stop := make(chan struct{})
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = syscall.Kill(os.Getpid(), syscall.SIGHUP)
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, o.Stop())
+	close(stop)
+	<-sent
+}
@@ -2,61 +2,371 @@ package remotewrite
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
 	"time"
 
-	//nolint:staticcheck
-	"github.com/golang/protobuf/proto"
-	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/prometheus/prometheus/storage/remote"
 	"github.com/sirupsen/logrus"
 	"go.k6.io/k6/metrics"
 	"go.k6.io/k6/output"
+	"gopkg.in/guregu/null.v3"
 )
 
 type Output struct {
 	config Config
 
-	client          remote.WriteClient
-	metrics         *metricsStorage
-	mapping         Mapping
-	periodicFlusher *output.PeriodicFlusher
-	output.SampleBuffer
+	client        remote.WriteClient
+	fallback      remote.WriteClient
+	tenants       map[string]*endpointRoute
+	metricRoutes  []metricRoute
+	distributions *distributionAggregator
+	// distributionsClient sends the trends of the datadog protocol
+	distributionsClient remote.WriteClient
+	protocol            protocol
+	compression         compression
+	protocolMu          sync.Mutex
+	metrics             *MetricsStorage
+	checks              *checkCounters
+	mapping             Mapping
+	filter              *metricFilter
+	relabel             []*relabel.Config
+	urls                *urlGrouper
+	execution           *executionTracker
+	heartbeat           *heartbeat
+	retry               retryPolicy
+	limiter             *rateLimiter
+	wal                 *wal
+	deadLetter          *deadLetter
+	dryRun              *dryRun
+	exposition          *exposition
+	debug               *debugServer
+	sent                *sentSeries
+	self                *selfMetrics
+	drainMu             sync.Mutex
+	flushMu             sync.Mutex
+	drainDeadline       time.Time
+	thresholds          *thresholdTracker
+	loggedErrors        map[string]struct{}
+	seriesLimit         *seriesLimiter
+	metadata            *metadataTracker
+	stopTest            func(error)
+	periodicFlusher     interface{ Stop() }
+	flushPeriod         *flushPeriod
+	buffer              *sampleBuffer
+	interner            *stringInterner
+	window              *windowAggregator
+	// failedFlushes counts the consecutive flushes that failed, for StopTestOnError
+	failedFlushes int64
+	testStopped   bool
+	// loadConfig loads the config again for ReloadConfig, it's nil otherwise
+	loadConfig    func() (Config, error)
+	reloadSignals chan os.Signal
+	// reloadDone is closed when the reloads stopped
+	reloadDone chan struct{}
 
 	logger logrus.FieldLogger
+	// stdout receives the summary of the output when the test ends
+	stdout io.Writer
+	// script is the name of the script of the test, for the test markers
+	script string
+	// testInfo are the labels describing the test run for TestInfo, nil otherwise
+	testInfo []prompb.Label
+	// clockOffset is how far the clock of the endpoint is ahead, with ClockSync
+	clockOffset time.Duration
+	// requests is the context of the requests, canceled by cancelRequests
+	// at the shutdown deadline, or once stopped, not to wedge the shutdown
+	requests       context.Context
+	cancelRequests context.CancelFunc
 }
 
-var _ output.Output = new(Output)
-
-// toggle to indicate whether we should stop dropping samples
-var flushTooLong bool
+var (
+	_ output.Output          = new(Output)
+	_ output.WithThresholds  = new(Output)
+	_ output.WithTestRunStop = new(Output)
+)
 
 func New(params output.Params) (*Output, error) {
 	config, err := GetConsolidatedConfig(params.JSONConfig, params.Environment, params.ConfigArgument)
 	if err != nil {
 		return nil, err
 	}
+	if err := resolveGrafanaCloud(context.Background(), &config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if err := addAutomaticLabels(&config, params.Environment); err != nil {
+		return nil, err
+	}
+	logEnvAliases(params.Logger, params.Environment)
+	logEffectiveConfig(params.Logger, config, params.JSONConfig, params.Environment, params.ConfigArgument)
+	if config.GoogleAuth.Bool {
+		// reported now rather than with the first request
+		if _, err := findGoogleCredentials(nil); err != nil {
+			return nil, err
+		}
+	}
 
 	remoteConfig, err := config.ConstructRemoteConfig()
 	if err != nil {
 		return nil, err
 	}
 
+	p, err := parseProtocol(config.Protocol.String, config.ProtocolVersion.String)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := parseCompression(config.Compression.String)
+	if err != nil {
+		return nil, err
+	}
+	grpcTransport := isGRPCURL(config.Url.String)
+	if grpcTransport {
+		// the messages are compressed by gRPC
+		c = compressionNone
+	}
+	if isGraphiteURL(config.Url.String) {
+		p = protocolGraphite
+		if config.GraphiteTags.Bool {
+			p = protocolGraphiteTagged
+		}
+	}
+
 	// name is used to differentiate clients in metrics
-	client, err := remote.NewWriteClient("xk6-prwo", remoteConfig)
+	self := newSelfMetrics()
+	client, err := newClient("xk6-prwo", remoteConfig, p, config, params.Logger, self)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1.0 is kept as fallback for endpoints that don't support 2.0
+	var fallback remote.WriteClient
+	if p == protocolV2 {
+		fallback, err = newClient("xk6-prwo-fallback", remoteConfig, protocolV1, config, params.Logger, self)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tenants, err := newTenantRoutes(remoteConfig, p, config, params.Logger, self)
+	if err != nil {
+		return nil, err
+	}
+	metricRoutes, err := newMetricRoutes(remoteConfig, p, config, params.Logger, self)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		distributions       *distributionAggregator
+		distributionsClient remote.WriteClient
+	)
+	if p == protocolDatadog {
+		distributions = newDistributionAggregator()
+		distributionsClient, err = newWriteClientForURL("xk6-prwo-distributions", remoteConfig,
+			protocolDatadogDistributions, c, config.transportConfig(), datadogDistributionsURL(remoteConfig.URL.URL).String())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !config.TestRunID.Valid {
+		id, err := newTestRunID()
+		if err != nil {
+			return nil, err
+		}
+		config.TestRunID = null.StringFrom(id)
+	}
+	if config.TestRunID.String != "" {
+		params.Logger.WithField(testRunIDLabel, config.TestRunID.String).Info("Prometheus: labeling series with the test run ID")
+	}
+
+	filter, err := newMetricFilter(config.MetricsInclude, config.MetricsExclude)
+	if err != nil {
+		return nil, err
+	}
+
+	relabelConfigs, err := newRelabelConfigs(config.RelabelConfigs)
+	if err != nil {
+		return nil, err
+	}
+
+	urls, err := newURLGrouper(config.URLGroups, config.GroupURLs.Bool)
 	if err != nil {
 		return nil, err
 	}
 
+	if _, err := parseTrendStats(config.TrendStats); err != nil {
+		return nil, err
+	}
+
+	seriesLimit, err := newSeriesLimiter(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := parseOldSampleAction(config.OldSampleAction.String); err != nil {
+		return nil, err
+	}
+
+	if _, err := parseTemporality(config.Temporality.String); err != nil {
+		return nil, err
+	}
+
+	bufferPolicy, err := parseBufferPolicy(config.BufferPolicy.String)
+	if err != nil {
+		return nil, err
+	}
+	buffer := newSampleBuffer(int(config.BufferCapacity.Int64), bufferPolicy)
+	if limit := config.BufferMemoryLimit.Int64; limit > 0 {
+		var spill *sampleSpill
+		if config.BufferSpillDir.String != "" {
+			spill, err = newSampleSpill(config.BufferSpillDir.String)
+			if err != nil {
+				return nil, err
+			}
+		}
+		buffer.limitMemory(int(limit), spill, self)
+	}
+
+	var fp *flushPeriod
+	if config.AdaptiveFlush.Bool {
+		fp, err = newFlushPeriod(time.Duration(config.FlushPeriod.Duration),
+			time.Duration(config.FlushPeriodMin.Duration), time.Duration(config.FlushPeriodMax.Duration))
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	params.Logger.Info(fmt.Sprintf("Prometheus: configuring remote-write with %s mapping", config.Mapping.String))
 
+	var w *wal
+	if config.WALDir.String != "" {
+		w, err = newWAL(config.WALDir.String, config.WALMaxSize.Int64, time.Duration(config.WALMaxAge.Duration))
+		if err != nil {
+			return nil, err
+		}
+		params.Logger.Info(fmt.Sprintf("Prometheus: buffering undelivered requests in %s", config.WALDir.String))
+	}
+
+	var dl *deadLetter
+	if config.DeadLetterDir.String != "" {
+		dl, err = newDeadLetter(config.DeadLetterDir.String)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var exposition *exposition
+	if config.ListenAddr.String != "" {
+		exposition = newExposition()
+	}
+
+	var dr *dryRun
+	if config.DryRun.Bool {
+		dr, err = newDryRun(config.DryRunDir.String)
+		if err != nil {
+			return nil, err
+		}
+		params.Logger.Warn(fmt.Sprintf("Prometheus: dry run, requests are written to %s instead of being sent", config.DryRunDir.String))
+	}
+
+	var loadConfig func() (Config, error)
+	if config.ReloadConfig.Bool {
+		if params.Environment["K6_PROMETHEUS_CONFIG"] == "" {
+			return nil, errReloadWithoutConfigFile
+		}
+		loadConfig = func() (Config, error) {
+			config, err := GetConsolidatedConfig(params.JSONConfig, params.Environment, params.ConfigArgument)
+			if err != nil {
+				return config, err
+			}
+			// the labels of the load generator are kept with the reloaded static labels
+			return config, addAutomaticLabels(&config, params.Environment)
+		}
+	}
+
+	var clockOffset time.Duration
+	if config.ClockSync.Bool {
+		clockOffset = syncClock(remoteConfig, config, params.Logger)
+	}
+
+	var hb *heartbeat
+	if config.Heartbeat.Bool {
+		hb, err = newHeartbeat(config.Instance.String)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var testInfo []prompb.Label
+	if config.TestInfo.Bool {
+		testInfo = testInfoLabels(params)
+	}
+
+	var execution *executionTracker
+	if config.ExecutionMetrics.Bool {
+		execution = newExecutionTracker(config.MetricPrefix.String, config.Temporality.String == string(temporalityDelta))
+	}
+
+	mapping := NewMapping(config)
+	var metadata *metadataTracker
+	// the field of the metadata in a remote write request has another use in the gRPC one
+	if config.SendMetadata.Bool && !grpcTransport {
+		metadata = newMetadataTracker(mapping, config)
+	}
+
+	requests, cancelRequests := context.WithCancel(context.Background())
 	return &Output{
-		client:  client,
-		config:  config,
-		metrics: newMetricsStorage(),
-		mapping: NewMapping(config.Mapping.String),
-		logger:  params.Logger,
+		client:              client,
+		fallback:            fallback,
+		protocol:            p,
+		tenants:             tenants,
+		metricRoutes:        metricRoutes,
+		distributions:       distributions,
+		distributionsClient: distributionsClient,
+		compression:         c,
+		config:              config,
+		metrics:             newMetricsStorage(),
+		checks:              newCheckCounters(),
+		mapping:             mapping,
+		filter:              filter,
+		relabel:             relabelConfigs,
+		urls:                urls,
+		execution:           execution,
+		heartbeat:           hb,
+		retry:               newRetryPolicy(config),
+		limiter:             newRateLimiter(config.RateLimitSamples.Int64, config.RateLimitRequests.Int64),
+		wal:                 w,
+		deadLetter:          dl,
+		dryRun:              dr,
+		exposition:          exposition,
+		sent:                newSentSeries(),
+		seriesLimit:         seriesLimit,
+		flushPeriod:         fp,
+		buffer:              buffer,
+		interner:            newStringInterner(),
+		window:              newWindowAggregator(time.Duration(config.AggregationWindow.Duration)),
+		loadConfig:          loadConfig,
+		metadata:            metadata,
+		self:                self,
+		logger:              params.Logger,
+		stdout:              params.StdOut,
+		script:              scriptName(params.ScriptPath),
+		testInfo:            testInfo,
+		clockOffset:         clockOffset,
+		requests:            requests,
+		cancelRequests:      cancelRequests,
 	}, nil
 }
 
@@ -64,101 +374,942 @@ func (*Output) Description() string {
 	return "Output k6 metrics to prometheus remote-write endpoint"
 }
 
+// SetThresholds receives the thresholds of the test before the output is started.
+func (o *Output) SetThresholds(thresholds map[string]metrics.Thresholds) {
+	if !o.config.ThresholdMetrics.Bool {
+		return
+	}
+
+	tracker, errs := newThresholdTracker(thresholds, time.Now())
+	for _, err := range errs {
+		o.logger.WithError(err).Warn("Prometheus: skipping threshold that can't be evaluated")
+	}
+	o.thresholds = tracker
+}
+
+// SetTestRunStopCallback receives the function that aborts the test, used when
+// the series limit is reached with the abort action.
+func (o *Output) SetTestRunStopCallback(stop func(error)) {
+	o.stopTest = stop
+}
+
+// AddMetricSamples buffers the samples until the next flush, dropping them or
+// blocking according to BufferPolicy if the buffer is full.
+func (o *Output) AddMetricSamples(samples []metrics.SampleContainer) {
+	if dropped := o.buffer.add(samples); dropped > 0 {
+		o.self.addSamplesDropped(dropped)
+	}
+}
+
 func (o *Output) Start() error {
-	if periodicFlusher, err := output.NewPeriodicFlusher(time.Duration(o.config.FlushPeriod.Duration), o.flush); err != nil {
+	if o.flushPeriod != nil {
+		o.periodicFlusher = newAdaptiveFlusher(o.flushPeriod, o.flush, o.logger)
+	} else if periodicFlusher, err := output.NewPeriodicFlusher(time.Duration(o.config.FlushPeriod.Duration), o.flush); err != nil {
 		return err
 	} else {
 		o.periodicFlusher = periodicFlusher
 	}
 	o.logger.Debug("Prometheus: starting remote-write")
 
+	if o.exposition != nil {
+		if err := o.exposition.listen(o.config.ListenAddr.String); err != nil {
+			return err
+		}
+		o.logger.Info(fmt.Sprintf("Prometheus: exposing metrics on http://%s/metrics", o.exposition.listener.Addr()))
+	}
+
+	if o.config.DebugAddr.String != "" {
+		o.debug = newDebugServer(o)
+		if err := o.debug.listen(o.config.DebugAddr.String); err != nil {
+			return err
+		}
+		o.logger.Info(fmt.Sprintf("Prometheus: serving debug endpoints on http://%s/debug/", o.debug.listener.Addr()))
+	}
+
+	if o.loadConfig != nil {
+		o.watchReload()
+	}
+
+	o.writeTestMarker(testPhaseStart)
 	return nil
 }
 
 func (o *Output) Stop() error {
 	o.logger.Debug("Prometheus: stopping remote-write")
+	o.stopReload()
+
+	// from now on, requests are retried until the deadline
+	if timeout := time.Duration(o.config.ShutdownTimeout.Duration); timeout > 0 {
+		o.drainMu.Lock()
+		o.drainDeadline = time.Now().Add(timeout)
+		o.drainMu.Unlock()
+		// the requests still running then are canceled, including those
+		// started before, e.g. by a flush that was running when the test ended
+		drainTimer := time.AfterFunc(timeout, o.stopRequests)
+		defer drainTimer.Stop()
+	}
+	defer o.stopRequests()
+
+	// the periodic flusher flushes one last time before returning,
+	// unless it was skipped: the remaining samples are then flushed here
 	o.periodicFlusher.Stop()
+	o.flushMu.Lock()
+	// the windows still open are sent too
+	o.window.close()
+	if !o.buffer.empty() || o.window.hasPending() {
+		o.flushLocked()
+	}
+	// a flush takes the spilled samples up to the memory limit
+	for !o.buffer.empty() {
+		o.flushLocked()
+	}
+	o.flushMu.Unlock()
+	if err := o.buffer.close(); err != nil {
+		o.logger.WithError(err).Warn("Prometheus: failed to remove the spill directory")
+	}
+
+	if err := o.exposition.close(); err != nil {
+		o.logger.WithError(err).Error("Prometheus: failed to stop the metrics listener")
+	}
+	if err := o.debug.close(); err != nil {
+		o.logger.WithError(err).Error("Prometheus: failed to stop the debug listener")
+	}
+
+	o.writeTestMarker(testPhaseEnd)
+
+	if o.heartbeat != nil && o.config.Push.Bool {
+		// the test ended, as opposed to a load generator that stops reporting
+		down := o.heartbeat.timeSeries(o.now(), 0, staticLabels(nil, o.config), o.config.MetricPrefix.String)
+		if o.config.StaleMarkers.Bool {
+			o.sent.track(down)
+		}
+		if err := o.write(down); err != nil {
+			o.logger.WithError(err).Error("Prometheus: failed to send the heartbeat")
+		}
+	}
+
+	if o.config.StaleMarkers.Bool && o.config.Push.Bool {
+		markers := o.sent.staleMarkers(o.now())
+		o.logger.WithField("nts", len(markers)).Debug("Prometheus: marking series as stale")
+		if err := o.write(markers); err != nil {
+			o.logger.WithError(err).Error("Failed to store stale markers.")
+		}
+	}
+
+	// the gRPC and Kafka clients keep connections open
+	clients := []remote.WriteClient{o.client, o.fallback, o.distributionsClient}
+	for _, route := range o.routes() {
+		clients = append(clients, route.client, route.fallback)
+	}
+	for _, client := range clients {
+		if closer, ok := client.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				o.logger.WithError(err).Warn("Prometheus: failed to close the connection to the endpoint")
+			}
+		}
+	}
+
+	o.logger.WithFields(o.self.fields()).Info("Prometheus: remote-write output stats")
+	if o.config.Summary.Bool && o.stdout != nil {
+		if err := o.self.writeSummary(o.stdout); err != nil {
+			o.logger.WithError(err).Warn("Prometheus: failed to write the summary")
+		}
+	}
+	if undelivered := o.self.samplesUndelivered(); undelivered > 0 {
+		o.logger.Warn(fmt.Sprintf("Prometheus: %d samples could not be delivered", undelivered))
+	}
+	if o.seriesLimit != nil && o.seriesLimit.rejected > 0 {
+		o.logger.WithField("top_labels", o.seriesLimit.topLabels()).
+			Warn(fmt.Sprintf("Prometheus: %d samples exceeded the series limit", o.seriesLimit.rejected))
+	}
 	return nil
 }
 
+// lifetime returns the context of the requests, canceled when they're stopped.
+func (o *Output) lifetime() context.Context {
+	if o.requests == nil {
+		return context.Background()
+	}
+	return o.requests
+}
+
+// stopRequests cancels the requests in flight and those to come.
+func (o *Output) stopRequests() {
+	if o.cancelRequests != nil {
+		o.cancelRequests()
+	}
+}
+
+// draining returns the deadline for delivering the pending requests once the output is stopping.
+func (o *Output) draining() (time.Time, bool) {
+	o.drainMu.Lock()
+	defer o.drainMu.Unlock()
+	return o.drainDeadline, !o.drainDeadline.IsZero()
+}
+
+// flush sends the buffered samples. Flushes never overlap: one started while
+// the previous one is still running is skipped, and counted in the self-metrics,
+// as the samples buffered meanwhile are sent by the next one anyway.
 func (o *Output) flush() {
+	if !o.flushMu.TryLock() {
+		o.self.addFlushSkipped()
+		o.logger.Warn("Prometheus: skipping flush, the previous one is still running")
+		return
+	}
+	defer o.flushMu.Unlock()
+
+	o.flushLocked()
+}
+
+// flushLocked does the flush, o.flushMu must be held.
+func (o *Output) flushLocked() {
 	var (
 		start = time.Now()
-		nts   int
+		// the series are sent with the time of the endpoint
+		now     = start.Add(o.clockOffset)
+		nts     int
+		samples int
 	)
 
 	defer func() {
 		d := time.Since(start)
-		if d > time.Duration(o.config.FlushPeriod.Duration) {
-			// There is no intermediary storage so warn if writing to remote write endpoint becomes too slow
+		o.self.observeFlush(samples, d)
+		period := time.Duration(o.config.FlushPeriod.Duration)
+		if o.flushPeriod != nil {
+			period = o.flushPeriod.current()
+		}
+		if d > period {
+			// samples are buffered meanwhile, up to BufferCapacity
 			o.logger.WithField("nts", nts).
 				Warn(fmt.Sprintf("Remote write took %s while flush period is %s. Some samples may be dropped.",
-					d.String(), o.config.FlushPeriod.String()))
-			flushTooLong = true
+					d.String(), period.String()))
 		} else {
 			o.logger.WithField("nts", nts).Debug(fmt.Sprintf("Remote write took %s.", d.String()))
-			flushTooLong = false
 		}
 	}()
 
-	samplesContainers := o.GetBufferedSamples()
+	samplesContainers, dropped, spillErr := o.buffer.take()
+	samples = countContainerSamples(samplesContainers)
+	if spillErr != nil {
+		o.logger.WithError(spillErr).WithField("dropped", dropped).
+			Warn("Prometheus: failed to spill the buffered samples to disk, samples were dropped")
+	} else if dropped > 0 {
+		o.logger.WithField("dropped", dropped).
+			Warn(fmt.Sprintf("Prometheus: the buffer of %d samples is full, samples were dropped (%s)",
+				o.buffer.capacity, o.config.BufferPolicy.String))
+	}
+	samplesContainers, droppedSamples, droppedContainers := truncateContainers(samplesContainers,
+		int(o.config.MaxSamplesPerFlush.Int64))
+	if droppedSamples > 0 || droppedContainers > 0 {
+		o.self.addSamplesDropped(droppedSamples)
+		o.logger.WithFields(logrus.Fields{"dropped": droppedSamples, "containers": droppedContainers}).
+			Warn(fmt.Sprintf("Prometheus: more than %d samples to flush, the newest samples were dropped",
+				o.config.MaxSamplesPerFlush.Int64))
+	}
+	o.thresholds.add(samplesContainers)
 
+	if o.config.Push.Bool {
+		// sent first, the series of a streamed flush being sent while converted
+		o.metadata.add(samplesContainers)
+		if err := o.writeMetadata(); err != nil {
+			o.logger.WithError(err).Warn("Prometheus: failed to send metric metadata, it will be sent again with the next flush")
+		}
+	}
+
+	var (
+		chunkSamples      int
+		expired, adjusted int
+		writeErr          error
+	)
+	if o.config.StreamFlush.Bool {
+		chunkSamples = int(o.config.MaxSamplesPerRequest.Int64)
+	}
 	// Remote write endpoint accepts TimeSeries structure defined in gRPC. It must:
 	// a) contain Labels array
 	// b) have a __name__ label: without it, metric might be unquerable or even rejected
 	// as a metric without a name. This behaviour depends on underlying storage used.
 	// c) not have duplicate timestamps within 1 timeseries, see https://github.com/prometheus/prometheus/issues/9210
+	//    (taken care of while grouping samples per series)
 	// Prometheus write handler processes only some fields as of now, so here we'll add only them.
-	promTimeSeries := o.convertToTimeSeries(samplesContainers)
-	nts = len(promTimeSeries)
+	o.convertInChunks(samplesContainers, now, chunkSamples, func(promTimeSeries []prompb.TimeSeries, last bool) {
+		defer func() {
+			// nothing holds on to the slice once sent, it's reused by the next chunk or flush
+			putTimeSeries(promTimeSeries)
+		}()
+		if !last {
+			o.execution.observe(promTimeSeries)
+		} else {
+			promTimeSeries = o.execution.fill(promTimeSeries, timestamp.FromTime(now))
+		}
+		// the action is validated by New
+		var chunkExpired, chunkAdjusted int
+		promTimeSeries, chunkExpired, chunkAdjusted = limitSampleAge(promTimeSeries, o.now(),
+			time.Duration(o.config.MaxSampleAge.Duration), oldSampleAction(o.config.OldSampleAction.String))
+		expired += chunkExpired
+		adjusted += chunkAdjusted
+		if o.window != nil {
+			promTimeSeries = o.window.aggregate(promTimeSeries, now)
+		}
+		nts += len(promTimeSeries)
+
+		if last {
+			if o.config.SelfMetrics.Bool {
+				// values of this flush are sent with the next one
+				promTimeSeries = append(promTimeSeries,
+					o.self.timeSeries(now, staticLabels(nil, o.config), o.config.MetricPrefix.String)...)
+			}
 
+			promTimeSeries = append(promTimeSeries,
+				o.thresholds.timeSeries(now, staticLabels(nil, o.config), o.config.MetricPrefix.String)...)
+			promTimeSeries = append(promTimeSeries,
+				o.heartbeat.timeSeries(now, 1, staticLabels(nil, o.config), o.config.MetricPrefix.String)...)
+		}
+		// validated by New
+		normalizeSeriesLabels(promTimeSeries, labelConflictPolicy(o.config.LabelConflict.String))
+
+		if o.config.StaleMarkers.Bool {
+			o.sent.track(promTimeSeries)
+		}
+
+		o.exposition.update(promTimeSeries)
+		if !o.config.Push.Bool {
+			return
+		}
+		if err := o.write(promTimeSeries); err != nil {
+			o.logWriteError(err)
+			if writeErr == nil {
+				writeErr = err
+			}
+		}
+	})
+	distributions := o.distributions.take()
+	if raw, ok := o.mapping.(*RawAllMapping); ok {
+		if crowded := raw.takeCrowded(); crowded > 0 {
+			o.self.addSamplesCrowded(crowded)
+			o.logger.WithField("dropped", crowded).
+				Warn("Prometheus: samples of series with too many samples to get distinct timestamps")
+		}
+	}
+	if expired > 0 || adjusted > 0 {
+		o.self.addSamplesExpired(expired, adjusted)
+		o.logger.WithFields(logrus.Fields{"dropped": expired, "adjusted": adjusted}).
+			Warn(fmt.Sprintf("Prometheus: samples older than %s", o.config.MaxSampleAge.String()))
+	}
 	o.logger.WithField("nts", nts).Debug("Converted samples to time series in preparation for sending.")
 
-	req := prompb.WriteRequest{
-		Timeseries: promTimeSeries,
+	if !o.config.Push.Bool {
+		return
+	}
+	if err := o.writeDistributions(distributions); err != nil {
+		o.logWriteError(err)
+		writeErr = err
+	}
+	o.flushDone(writeErr)
+}
+
+// logWriteError logs the failure to send the series, with the reason and
+// the offending metric and label when the endpoint rejected them.
+func (o *Output) logWriteError(err error) {
+	logger := o.logger.WithError(err)
+	if r, ok := rejectionOf(err); ok {
+		logger = logger.WithFields(r.fields())
 	}
+	class := classifyError(err)
+	if class == errorClassCircuitOpen {
+		// the endpoint being down was logged once when the circuit opened
+		logger.Debug(class.failureMessage())
+		return
+	}
+	logger.Error(class.failureMessage())
+}
 
-	if buf, err := proto.Marshal(&req); err != nil {
-		o.logger.WithError(err).Fatal("Failed to marshal timeseries.")
+// flushDone counts the consecutive flushes that failed to send the series and
+// aborts the test once StopTestOnError is reached, rather than running it blind.
+func (o *Output) flushDone(err error) {
+	if err == nil {
+		o.failedFlushes = 0
+		return
+	}
+	o.failedFlushes++
+	if o.config.StopTestOnError.Int64 <= 0 || o.failedFlushes < o.config.StopTestOnError.Int64 || o.testStopped {
+		return
+	}
+
+	o.testStopped = true
+	err = fmt.Errorf("Prometheus: %d flushes in a row failed to send the series: %w", o.failedFlushes, err)
+	o.logger.WithError(err).Error("Prometheus: aborting the test")
+	if o.stopTest != nil {
+		o.stopTest(err)
+	}
+}
+
+// writeMetadata sends the metadata of the metrics seen for the first time
+// in a request of its own, as Prometheus does. Remote write 2.0 requests carry
+// the metadata in each series instead, and the other protocols have none, so
+// nothing is sent with them.
+func (o *Output) writeMetadata() error {
+	if o.metadata == nil || o.currentProtocol() != protocolV1 {
+		return nil
+	}
+	metadata := o.metadata.take()
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	buffers := o.getEncodeBuffers()
+	defer putEncodeBuffers(buffers)
+
+	req := prompb.WriteRequest{Metadata: metadata}
+	buf, err := buffers.marshal(&req)
+	if err == nil {
+		buf, err = buffers.compress(o.compression.resolve(protocolV1), buf)
+	}
+	if err != nil {
+		return err
+	}
+
+	if o.dryRun != nil {
+		err = o.dryRun.write(req, buf, protocolV1, o.compression)
 	} else {
-		encoded := snappy.Encode(nil, buf) // this call can panic
-		if err = o.client.Store(context.Background(), encoded); err != nil {
-			o.logger.WithError(err).Error("Failed to store timeseries.")
+		err = o.send(nil, buf, protocolV1)
+		// every route gets the metadata, it's sent again to all of them after a failure
+		for _, route := range o.routes() {
+			if routeErr := o.send(route, buf, protocolV1); err == nil {
+				err = routeErr
+			}
+		}
+	}
+	if err != nil {
+		o.metadata.putBack(metadata)
+	}
+	return err
+}
+
+// write sends the time series, in separate requests per route with metric or tenant routes.
+func (o *Output) write(promTimeSeries []prompb.TimeSeries) error {
+	if len(o.tenants) == 0 && len(o.metricRoutes) == 0 {
+		return o.writeRoute(nil, promTimeSeries)
+	}
+
+	groups := groupByRoute(promTimeSeries, o.route)
+	var (
+		failed   int
+		firstErr error
+	)
+	for _, group := range groups {
+		if err := o.writeRoute(group.route, group.series); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("route %s: %w", group.route.routeName(), err)
+			}
+			failed++
+		}
+	}
+	if failed > 0 && len(groups) > 1 {
+		return fmt.Errorf("%d of %d routes failed: %w", failed, len(groups), firstErr)
+	}
+	return firstErr
+}
+
+// writeRoute sends the time series of a route, nil for the default one,
+// split in concurrent requests when sharding is enabled.
+func (o *Output) writeRoute(route *endpointRoute, promTimeSeries []prompb.TimeSeries) error {
+	shards := shardTimeSeries(promTimeSeries, int(o.config.Shards.Int64))
+	if len(shards) == 1 {
+		return o.writeShard(route, shards[0])
+	}
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(shards))
+	)
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard []prompb.TimeSeries) {
+			defer wg.Done()
+			errs[i] = o.writeShard(route, shard)
+		}(i, shard)
+	}
+	wg.Wait()
+
+	var (
+		failed   int
+		firstErr error
+	)
+	for _, err := range errs {
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d shards failed: %w", failed, len(shards), firstErr)
+	}
+	return nil
+}
+
+// writeShard sends the time series sequentially, in as many requests as needed
+// to stay within the configured request size limits.
+func (o *Output) writeShard(route *endpointRoute, promTimeSeries []prompb.TimeSeries) error {
+	chunks := chunkTimeSeries(promTimeSeries,
+		int(o.config.MaxSamplesPerRequest.Int64), int(o.config.MaxRequestBodyBytes.Int64))
+
+	var (
+		failed   int
+		firstErr error
+	)
+	for _, chunk := range chunks {
+		if err := o.writeRequest(route, chunk); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+	if failed > 0 && len(chunks) > 1 {
+		return fmt.Errorf("%d of %d requests failed: %w", failed, len(chunks), firstErr)
+	}
+	return firstErr
+}
+
+// writeRequest marshals and encodes the time series in a write request and sends it.
+// A 2.0 request rejected because the endpoint doesn't support it is sent again
+// as 1.0, which is then used for all the following requests.
+func (o *Output) writeRequest(route *endpointRoute, promTimeSeries []prompb.TimeSeries) error {
+	p := o.currentProtocol()
+
+	buffers := o.getEncodeBuffers()
+	defer putEncodeBuffers(buffers)
+
+	encoded, err := buffers.encodeWithMetadata(promTimeSeries, p, o.compression, o.metadata)
+	if err != nil && len(promTimeSeries) > 1 {
+		// the series are bisected until the request is small enough to be compressed,
+		// or the series that fails to be encoded is isolated and the others are sent.
+		// A huge marshaled request is released before encoding the halves.
+		buffers.marshaled = nil
+		return o.writeHalves(route, promTimeSeries, err)
+	}
+	if err != nil {
+		o.self.addSamplesFailed(countSamples(promTimeSeries))
+		if len(promTimeSeries) == 1 {
+			err = fmt.Errorf("skipped the series %s: %w", formatLabels(promTimeSeries[0].Labels), err)
+		}
+		return err
+	}
+
+	if o.dryRun == nil {
+		if err := o.limiter.waitSamples(o.lifetime(), countSamples(promTimeSeries)); err != nil {
+			return err
+		}
+	}
+
+	if o.dryRun != nil {
+		if err := o.dryRun.write(prompb.WriteRequest{Timeseries: promTimeSeries}, encoded, p, o.compression); err != nil {
+			return err
+		}
+		o.self.addSeriesSent(len(promTimeSeries))
+		return nil
+	}
+
+	err = o.send(route, encoded, p)
+	if p == protocolV2 && isUnsupportedProtocol(err) {
+		o.fallbackToV1(err)
+		return o.writeRequest(route, promTimeSeries)
+	}
+	if err != nil {
+		o.self.addSamplesFailed(countSamples(promTimeSeries))
+		o.writeDeadLetter(route, promTimeSeries, encoded, p, err)
+		return err
+	}
+	o.self.addSeriesSent(len(promTimeSeries))
+	return nil
+}
+
+// writeHalves sends the time series in two requests, as they failed to be encoded in one with err.
+func (o *Output) writeHalves(route *endpointRoute, promTimeSeries []prompb.TimeSeries, err error) error {
+	half := len(promTimeSeries) / 2
+	o.logger.WithError(err).WithField("series", len(promTimeSeries)).
+		Debug("Prometheus: failed to encode the request, splitting it in two")
+
+	errFirst := o.writeRequest(route, promTimeSeries[:half])
+	errSecond := o.writeRequest(route, promTimeSeries[half:])
+	if errFirst != nil {
+		return errFirst
+	}
+	return errSecond
+}
+
+// writeDeadLetter keeps the request that failed with err in the dead-letter directory, if enabled.
+func (o *Output) writeDeadLetter(route *endpointRoute, promTimeSeries []prompb.TimeSeries, encoded []byte, p protocol, err error) {
+	if o.deadLetter == nil {
+		return
+	}
+	meta := deadLetterMeta{Series: len(promTimeSeries), Samples: countSamples(promTimeSeries)}
+	if route != nil {
+		meta.Route = route.routeName()
+	}
+	if dlErr := o.deadLetter.write(encoded, p, o.compression, meta, err); dlErr != nil {
+		o.logger.WithError(dlErr).Error("Failed to write the request to the dead-letter directory.")
+	}
+}
+
+// getEncodeBuffers returns buffers from the pool and counts whether they have been reused.
+// The encoded request must not be used after they are put back.
+func (o *Output) getEncodeBuffers() *encodeBuffers {
+	buffers, reused := getEncodeBuffers()
+	o.self.addEncodeBuffers(reused)
+	return buffers
+}
+
+// currentProtocol returns the protocol used for new requests.
+func (o *Output) currentProtocol() protocol {
+	o.protocolMu.Lock()
+	defer o.protocolMu.Unlock()
+
+	if o.protocol == "" {
+		return protocolV1
+	}
+	return o.protocol
+}
+
+func (o *Output) fallbackToV1(err error) {
+	o.protocolMu.Lock()
+	defer o.protocolMu.Unlock()
+
+	if o.protocol == protocolV2 {
+		o.logger.WithError(err).Warn("Prometheus: remote write 2.0 is not supported by the endpoint, falling back to 1.0")
+		o.protocol = protocolV1
+	}
+}
+
+// send delivers the encoded request to the endpoint of the route, nil for the default one,
+// going through its WAL if it's enabled: pending requests are replayed first to keep
+// the order of samples and, if the endpoint is still unavailable, the request is appended to the WAL.
+func (o *Output) send(route *endpointRoute, encoded []byte, p protocol) error {
+	w := o.wal
+	if route != nil {
+		w = route.wal
+	}
+	if w == nil {
+		return o.store(route, encoded, p)
+	}
+
+	delivered, err := w.replay(func(encoded []byte, p protocol) error {
+		// only the primary endpoint failed to store the requests of the WAL, the mirrors got them already
+		return o.storeTo(primaryClient(o.endpointClient(route, p)), encoded)
+	})
+	if delivered > 0 {
+		o.logger.WithField("requests", delivered).Info("Replayed requests from the WAL.")
+	}
+	if err != nil && !isRecoverable(err) {
+		o.logger.WithError(err).Error("Failed to replay requests from the WAL.")
+		err = nil
+	}
+	if err == nil {
+		err = o.store(route, encoded, p)
+	}
+	if err == nil || !isRecoverable(err) {
+		return err
+	}
+
+	removed, walErr := w.append(encoded, p)
+	if walErr != nil {
+		o.logger.WithError(walErr).Error("Failed to append request to the WAL.")
+		return err
+	}
+	if removed > 0 {
+		o.logger.WithField("requests", removed).Warn("WAL retention limits reached, the oldest requests were dropped.")
+	}
+	logger := o.logger.WithError(err).WithField("pending", w.len())
+	if errors.Is(err, errCircuitOpen) {
+		logger.Debug("Circuit breaker is open, request kept in the WAL.")
+		return nil
+	}
+	logger.Warn("Failed to store timeseries, request kept in the WAL.")
+	return nil
+}
+
+// store sends the encoded request to the endpoint of the route and to its mirrors, if any,
+// each of them being retried on its own so that those that accepted it don't get it again.
+// Only the error of the primary endpoint is returned, the failures of the mirrors are logged.
+func (o *Output) store(route *endpointRoute, encoded []byte, p protocol) error {
+	client := o.endpointClient(route, p)
+	if mirror, ok := client.(*mirrorClient); ok {
+		return mirror.storeEach(func(client remote.WriteClient) error {
+			return o.storeTo(client, encoded)
+		})
+	}
+	return o.storeTo(client, encoded)
+}
+
+// endpointClient returns the client of the route for requests of the protocol.
+func (o *Output) endpointClient(route *endpointRoute, p protocol) remote.WriteClient {
+	client, fallback := o.client, o.fallback
+	if route != nil {
+		client, fallback = route.client, route.fallback
+	}
+	switch {
+	case p == protocolV1 && fallback != nil:
+		return fallback
+	case p == protocolDatadogDistributions:
+		return o.distributionsClient
+	default:
+		return client
+	}
+}
+
+// primaryClient returns the client of the primary endpoint of the mirrored ones.
+func primaryClient(client remote.WriteClient) remote.WriteClient {
+	if mirror, ok := client.(*mirrorClient); ok {
+		return mirror.clients[0]
+	}
+	return client
+}
+
+// storeTo sends the encoded request with the client, retrying recoverable
+// errors after the delay requested by the endpoint or with exponential backoff.
+// While the output is stopping, recoverable errors are retried until the
+// shutdown deadline instead of up to the maximum number of attempts, and the
+// request is canceled, even if it was sent before, when the deadline is reached.
+// Each attempt is bounded by the timeout of the client too.
+func (o *Output) storeTo(client remote.WriteClient, encoded []byte) error {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := o.lifetime(), context.CancelFunc(func() {})
+		deadline, draining := o.draining()
+		if draining {
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+		}
+		err := o.limiter.waitRequest(ctx)
+		if err == nil {
+			o.self.addRequest()
+			storeStart := time.Now()
+			err = client.Store(ctx, encoded)
+			o.flushPeriod.observe(time.Since(storeStart))
+		}
+		cancel()
+		if err == nil {
+			o.self.addBytesSent(len(encoded))
+			return nil
+		}
+
+		class := classifyError(err)
+		o.self.addRequestError(class)
+		if r, ok := rejectionOf(err); ok {
+			o.self.addRejection(r.reason)
+		}
+
+		delay := o.retry.delay(attempt, err)
+		// with the circuit open, the request would fail again right away
+		retry := o.retry.shouldRetry(attempt, err) && !errors.Is(err, errCircuitOpen)
+		if draining {
+			retry = isRecoverable(err) && time.Now().Add(delay).Before(deadline)
+		}
+		if !retry {
+			o.self.addRequestFailed()
+			return err
+		}
+
+		o.logger.WithError(err).WithField("attempt", attempt).Warn(class.retryMessage(delay))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-o.lifetime().Done():
+			timer.Stop()
+			o.self.addRequestFailed()
+			return err
 		}
 	}
 }
 
 func (o *Output) convertToTimeSeries(samplesContainers []metrics.SampleContainer) []prompb.TimeSeries {
-	promTimeSeries := make([]prompb.TimeSeries, 0)
+	return o.convertToTimeSeriesAt(samplesContainers, o.now())
+}
+
+// convertToTimeSeriesAt converts the samples of a flush happening at flushTime, see sampleTime.
+func (o *Output) convertToTimeSeriesAt(samplesContainers []metrics.SampleContainer, flushTime time.Time) []prompb.TimeSeries {
+	var converted []prompb.TimeSeries
+	o.convertInChunks(samplesContainers, flushTime, 0, func(series []prompb.TimeSeries, _ bool) {
+		converted = series
+	})
+	return converted
+}
+
+// convertInChunks converts the samples of a flush happening at flushTime and passes
+// the series to emit, in chunks of about maxSamples samples if it's positive, so that
+// they can be sent while the next ones are converted. A chunk is only ended before
+// samples later than all of its own, so that the same series doesn't get samples with
+// the same timestamp in different chunks. emit is called at least once, last being
+// true for the last chunk, and the series passed are its own.
+func (o *Output) convertInChunks(
+	samplesContainers []metrics.SampleContainer, flushTime time.Time, maxSamples int,
+	emit func(series []prompb.TimeSeries, last bool),
+) {
+	// Prometheus remote write treats each label array in TimeSeries as the same
+	// for all Samples in those TimeSeries (https://github.com/prometheus/prometheus/blob/03d084f8629477907cab39fc3d314b375eeac010/storage/remote/write_handler.go#L75).
+	// K6 metrics can have different tags per each Sample so samples are grouped
+	// by their full label set: each TimeSeries then holds all the samples of
+	// one series, ordered by time and without duplicate timestamps.
+	series := newSeriesAggregator()
+
+	// cumulative values are computed in the order of the samples,
+	// which have to be in time order to get monotonic counters
+	sortSampleContainers(samplesContainers)
+
+	// validated by New
+	t := temporality(o.config.Temporality.String)
+	if t == temporalityDelta {
+		o.metrics.resetDeltas()
+		o.checks.reset()
+	}
 
 	for _, samplesContainer := range samplesContainers {
 		samples := samplesContainer.GetSamples()
+		if maxSamples > 0 && series.samples >= maxSamples && o.samplesAfter(samples, flushTime, series.latest) {
+			emit(series.timeSeries(), false)
+			series = newSeriesAggregator()
+		}
 
 		for _, sample := range samples {
-			// Prometheus remote write treats each label array in TimeSeries as the same
-			// for all Samples in those TimeSeries (https://github.com/prometheus/prometheus/blob/03d084f8629477907cab39fc3d314b375eeac010/storage/remote/write_handler.go#L75).
-			// But K6 metrics can have different tags per each Sample so in order not to
-			// lose info in tags or assign tags wrongly, let's store each Sample in a different TimeSeries, for now.
-			// This approach also allows to avoid hard to replicate issues with duplicate timestamps.
+			if o.filter != nil && !o.filter.allow(sample.Metric.Name) {
+				continue
+			}
 
-			labels, err := tagsToLabels(sample.Tags, o.config)
+			labels, err := tagsToLabels(sample.Tags, o.config, o.urls)
 			if err != nil {
-				o.logger.Error(err)
+				o.logOnce(err)
+				continue
+			}
+			// the exemplars keep the time of the sample
+			exemplarSample := sample
+			sample.Time = o.sampleTime(sample, flushTime)
+
+			labels, keep, limitReached := o.seriesLimit.admit(sample.Metric.Name, labels)
+			if limitReached {
+				o.seriesLimitReached()
+			}
+			if !keep {
+				continue
+			}
+
+			if o.distributions != nil && sample.Metric.Type == metrics.Trend {
+				// Datadog aggregates the raw values itself
+				o.distributions.add(sample, labels, o.config.MetricPrefix.String)
+				continue
+			}
+
+			if o.window != nil && sample.Metric.Type == metrics.Trend {
+				o.metrics.startWindow(sample, labels, o.window.end(timestamp.FromTime(sample.Time)))
 			}
 
 			if newts, err := o.metrics.transform(o.mapping, sample, labels); err != nil {
 				o.logger.Error(err)
 			} else {
-				promTimeSeries = append(promTimeSeries, newts...)
+				if sample.Metric.Name == checksMetric {
+					newts = append(newts, o.checks.add(sample, labels)...)
+				}
+
+				var exemplar *prompb.Exemplar
+				if o.config.Exemplars.Bool && sample.Metric.Type == metrics.Trend {
+					exemplar = sampleExemplar(exemplarSample)
+				}
+
+				for _, ts := range newts {
+					prefixMetricName(ts.Labels, o.config.MetricPrefix.String, o.interner)
+					if err := sanitizeMetricName(ts.Labels, o.config.StrictNames.Bool); err != nil {
+						o.logOnce(err)
+						continue
+					}
+					if len(o.relabel) > 0 {
+						labels, keep := relabelSeries(ts.Labels, o.relabel)
+						if !keep {
+							continue
+						}
+						ts.Labels = labels
+					}
+					o.interner.labels(ts.Labels)
+					if exemplar != nil {
+						ts.Exemplars = append(ts.Exemplars, *exemplar)
+					}
+					if t.delta(sample.Metric.Type) {
+						series.addLatest(ts)
+					} else {
+						series.add(ts)
+					}
+				}
+			}
+		}
+	}
+
+	emit(series.timeSeries(), true)
+}
+
+// samplesAfter returns true if the samples are sent with timestamps after latest.
+func (o *Output) samplesAfter(samples []metrics.Sample, flushTime time.Time, latest int64) bool {
+	for _, sample := range samples {
+		if timestamp.FromTime(o.sampleTime(sample, flushTime)) <= latest {
+			return false
+		}
+	}
+	return true
+}
+
+// sortSampleContainers sorts the containers by the time of their earliest sample.
+// The samples of a container are usually at the same time, so that it's
+// enough to get the samples in time order.
+func sortSampleContainers(samplesContainers []metrics.SampleContainer) {
+	type timedContainer struct {
+		container metrics.SampleContainer
+		earliest  time.Time
+	}
+
+	timed := make([]timedContainer, len(samplesContainers))
+	for i, container := range samplesContainers {
+		timed[i].container = container
+		for _, sample := range container.GetSamples() {
+			if timed[i].earliest.IsZero() || sample.Time.Before(timed[i].earliest) {
+				timed[i].earliest = sample.Time
 			}
 		}
+	}
+	sort.SliceStable(timed, func(i, j int) bool {
+		return timed[i].earliest.Before(timed[j].earliest)
+	})
+	for i := range timed {
+		samplesContainers[i] = timed[i].container
+	}
+}
 
-		// Do not blow up if remote endpoint is overloaded and responds too slowly.
-		// TODO: consider other approaches
-		if flushTooLong && len(promTimeSeries) > 150000 {
-			break
+// seriesLimitReached reports, with the labels that have the most distinct values,
+// that the series limit has been reached and aborts the test if configured so.
+func (o *Output) seriesLimitReached() {
+	logger := o.logger.WithField("top_labels", o.seriesLimit.topLabels())
+	switch o.seriesLimit.action {
+	case seriesLimitAggregate:
+		logger.Warn(fmt.Sprintf("Prometheus: series limit of %d reached, new series are aggregated with %q tag values",
+			o.seriesLimit.max, overflowValue))
+	case seriesLimitAbort:
+		err := fmt.Errorf("Prometheus: series limit of %d reached", o.seriesLimit.max)
+		logger.WithError(err).Error("Prometheus: aborting the test")
+		if o.stopTest != nil {
+			o.stopTest(err)
 		}
+	default:
+		logger.Warn(fmt.Sprintf("Prometheus: series limit of %d reached, the samples of new series are dropped",
+			o.seriesLimit.max))
 	}
+}
 
-	return promTimeSeries
+// logOnce logs the error the first time it occurs, so that an error repeated
+// for every sample, like an invalid name, doesn't flood the logs.
+func (o *Output) logOnce(err error) {
+	if o.loggedErrors == nil {
+		o.loggedErrors = make(map[string]struct{})
+	}
+	msg := err.Error()
+	if _, ok := o.loggedErrors[msg]; ok {
+		return
+	}
+	o.loggedErrors[msg] = struct{}{}
+	o.logger.WithError(err).Error("Prometheus: dropping samples")
 }
@@ -0,0 +1,293 @@
+package remotewrite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+)
+
+// dryRunRequestFile matches the readable requests written by the dry run.
+var dryRunRequestFile = regexp.MustCompile(`^request-\d+\.json$`)
+
+// ReplayConfig configures Replay.
+type ReplayConfig struct {
+	// Config configures the endpoint the requests are sent to, as for the output,
+	// e.g. with GetConsolidatedConfig from the environment of the test.
+	Config Config
+	// TimeShift is added to the timestamps of the samples. They are sent as
+	// they were if it's 0 and StartAt is not set.
+	TimeShift time.Duration
+	// StartAt shifts the timestamps so that the oldest sample is at this time,
+	// e.g. now for an endpoint rejecting old samples. It takes precedence over TimeShift.
+	StartAt time.Time
+}
+
+// replayFile is a request written to disk by the dry run or to the dead-letter directory.
+type replayFile struct {
+	name string
+	// meta describes a dead-lettered request, it's nil for the dry run
+	meta *deadLetterMeta
+}
+
+// Replay sends the requests written to dir by the dry run or to the dead-letter directory
+// again, in order, to the endpoint of the config with its headers, TLS and authentication.
+// The dry-run requests are read from their request-<n>.json files and encoded with the
+// protocol and compression of the config, while the dead-lettered requests are sent with
+// theirs and removed once sent. Shifting the timestamps of the latter requires decoding
+// them, which is only supported for remote write 1.0 requests. It stops at the first
+// request that fails and returns the number of requests sent.
+func Replay(ctx context.Context, dir string, cfg ReplayConfig) (int, error) {
+	config := cfg.Config
+	if err := resolveGrafanaCloud(ctx, &config); err != nil {
+		return 0, err
+	}
+	if err := config.Validate(); err != nil {
+		return 0, err
+	}
+	remoteConfig, err := config.ConstructRemoteConfig()
+	if err != nil {
+		return 0, err
+	}
+	p, err := parseProtocol(config.Protocol.String, config.ProtocolVersion.String)
+	if err != nil {
+		return 0, err
+	}
+	c, err := parseCompression(config.Compression.String)
+	if err != nil {
+		return 0, err
+	}
+	files, err := listReplayFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	r := &replayer{
+		dir:          dir,
+		config:       config,
+		remoteConfig: remoteConfig,
+		protocol:     p,
+		compression:  c,
+		shift:        cfg.TimeShift,
+		clients:      make(map[string]remote.WriteClient),
+	}
+	defer r.close()
+
+	if !cfg.StartAt.IsZero() {
+		oldest, err := r.oldestTimestamp(files)
+		if err != nil {
+			return 0, err
+		}
+		r.shift = cfg.StartAt.Sub(time.UnixMilli(oldest))
+	}
+
+	for i, f := range files {
+		if err := r.send(ctx, f); err != nil {
+			return i, fmt.Errorf("failed to replay %s: %w", f.name, err)
+		}
+	}
+	return len(files), nil
+}
+
+// listReplayFiles returns the requests of the directory, ordered by name, which starts
+// with the time for the dead-lettered requests and the sequence number for the dry run.
+func listReplayFiles(dir string) ([]replayFile, error) {
+	metas, err := readDeadLetters(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]replayFile, 0, len(metas))
+	for i := range metas {
+		files = append(files, replayFile{name: metas[i].Payload, meta: &metas[i]})
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() && dryRunRequestFile.MatchString(e.Name()) {
+			files = append(files, replayFile{name: e.Name()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
+
+type replayer struct {
+	dir          string
+	config       Config
+	remoteConfig *remote.ClientConfig
+	protocol     protocol
+	compression  compression
+	// shift is added to the timestamps, in milliseconds once converted
+	shift time.Duration
+	// clients per protocol and compression, as they set the headers
+	clients map[string]remote.WriteClient
+}
+
+// send encodes the request of the file, shifting its timestamps, and sends it.
+func (r *replayer) send(ctx context.Context, f replayFile) error {
+	buffers, _ := getEncodeBuffers()
+	defer putEncodeBuffers(buffers)
+
+	p, c, encoded, err := r.encode(buffers, f)
+	if err != nil {
+		return err
+	}
+	if encoded != nil {
+		client, err := r.client(p, c)
+		if err != nil {
+			return err
+		}
+		if err := client.Store(ctx, encoded); err != nil {
+			return err
+		}
+	}
+
+	if f.meta == nil {
+		return nil
+	}
+	// the metadata first, so that the request isn't replayed again if removing the body fails
+	if err := os.Remove(filepath.Join(r.dir, f.meta.file)); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(r.dir, f.meta.Payload))
+}
+
+// encode returns the body of the request with its protocol and compression,
+// nil if there is nothing to send with the protocol, e.g. only metadata.
+func (r *replayer) encode(buffers *encodeBuffers, f replayFile) (protocol, compression, []byte, error) {
+	if f.meta != nil && r.shift == 0 {
+		encoded, err := os.ReadFile(filepath.Join(r.dir, f.meta.Payload))
+		return f.meta.Protocol, f.meta.Compression, encoded, err
+	}
+
+	req, err := r.load(f)
+	if err != nil {
+		return "", "", nil, err
+	}
+	shiftTimestamps(&req, r.shift)
+
+	p, c := r.protocol, r.compression.resolve(r.protocol)
+	if f.meta != nil {
+		p, c = f.meta.Protocol, f.meta.Compression
+	}
+	if p != protocolV1 {
+		if len(req.Timeseries) == 0 {
+			return p, c, nil, nil
+		}
+		encoded, err := buffers.encode(req.Timeseries, p, c)
+		return p, c, encoded, err
+	}
+	// the whole request is sent, with its metadata
+	encoded, err := buffers.marshal(&req)
+	if err == nil {
+		encoded, err = buffers.compress(c, encoded)
+	}
+	return p, c, encoded, err
+}
+
+// load decodes the request of the file.
+func (r *replayer) load(f replayFile) (prompb.WriteRequest, error) {
+	var req prompb.WriteRequest
+	if f.meta == nil {
+		raw, err := os.ReadFile(filepath.Join(r.dir, f.name))
+		if err != nil {
+			return req, err
+		}
+		return req, json.Unmarshal(raw, &req)
+	}
+
+	if f.meta.Protocol != protocolV1 {
+		return req, fmt.Errorf("the timestamps of %s requests can't be shifted, only those of remote write 1.0 requests", f.meta.Protocol)
+	}
+	encoded, err := os.ReadFile(filepath.Join(r.dir, f.meta.Payload))
+	if err != nil {
+		return req, err
+	}
+	decoded, err := decompressBody(f.meta.Compression, encoded)
+	if err != nil {
+		return req, err
+	}
+	return req, req.Unmarshal(decoded)
+}
+
+// oldestTimestamp returns the timestamp of the oldest sample of the files, in milliseconds.
+func (r *replayer) oldestTimestamp(files []replayFile) (int64, error) {
+	var (
+		oldest int64
+		found  bool
+	)
+	for _, f := range files {
+		req, err := r.load(f)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", f.name, err)
+		}
+		for _, ts := range req.Timeseries {
+			for _, s := range ts.Samples {
+				if !found || s.Timestamp < oldest {
+					oldest, found = s.Timestamp, true
+				}
+			}
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("no samples in %s to shift to the start time", r.dir)
+	}
+	return oldest, nil
+}
+
+func (r *replayer) client(p protocol, c compression) (remote.WriteClient, error) {
+	key := string(p) + "/" + string(c)
+	if client, ok := r.clients[key]; ok {
+		return client, nil
+	}
+	url := r.remoteConfig.URL.String()
+	if p == protocolDatadogDistributions {
+		url = datadogDistributionsURL(r.remoteConfig.URL.URL).String()
+	}
+	client, err := newWriteClientForURL("xk6-prwo-replay", r.remoteConfig, p, c, r.config.transportConfig(), url)
+	if err != nil {
+		return nil, err
+	}
+	r.clients[key] = client
+	return client, nil
+}
+
+// close closes the clients keeping connections open, e.g. over gRPC.
+func (r *replayer) close() {
+	for _, client := range r.clients {
+		if closer, ok := client.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+}
+
+// shiftTimestamps adds shift to the timestamps of the samples, exemplars and histograms.
+func shiftTimestamps(req *prompb.WriteRequest, shift time.Duration) {
+	ms := shift.Milliseconds()
+	if ms == 0 {
+		return
+	}
+	for i := range req.Timeseries {
+		ts := &req.Timeseries[i]
+		for j := range ts.Samples {
+			ts.Samples[j].Timestamp += ms
+		}
+		for j := range ts.Exemplars {
+			ts.Exemplars[j].Timestamp += ms
+		}
+		for j := range ts.Histograms {
+			ts.Histograms[j].Timestamp += ms
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+// newReplayServer returns a remote write endpoint recording the requests it receives.
+func newReplayServer(t *testing.T) (*httptest.Server, func() []prompb.WriteRequest) {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		received []prompb.WriteRequest
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		decoded, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		var req prompb.WriteRequest
+		require.NoError(t, req.Unmarshal(decoded))
+
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, req)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []prompb.WriteRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return received
+	}
+}
+
+func TestReplayDryRun(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	dr, err := newDryRun(dir)
+	require.NoError(t, err)
+	o := &Output{
+		config: NewConfig(),
+		dryRun: dr,
+		self:   newSelfMetrics(),
+		logger: logrus.New(),
+	}
+	for _, ts := range []int64{1000, 3000} {
+		require.NoError(t, o.write([]prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+			Samples: []prompb.Sample{{Value: 3, Timestamp: ts}},
+		}}))
+	}
+
+	server, received := newReplayServer(t)
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+
+	start := time.UnixMilli(1_700_000_000_000)
+	n, err := Replay(context.Background(), dir, ReplayConfig{Config: config, StartAt: start})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	reqs := received()
+	require.Len(t, reqs, 2)
+	assert.Equal(t, int64(1_700_000_000_000), reqs[0].Timeseries[0].Samples[0].Timestamp)
+	assert.Equal(t, int64(1_700_000_002_000), reqs[1].Timeseries[0].Samples[0].Timestamp)
+
+	// the requests of the dry run are kept
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 4)
+}
+
+func TestReplayDeadLetterTimeShift(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	dl, err := newDeadLetter(dir)
+	require.NoError(t, err)
+
+	buffers, _ := getEncodeBuffers()
+	defer putEncodeBuffers(buffers)
+	encoded, err := buffers.encode([]prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+		Samples: []prompb.Sample{{Value: 3, Timestamp: 1000}},
+	}}, protocolV1, compressionDefault)
+	require.NoError(t, err)
+	require.NoError(t, dl.write(encoded, protocolV1, compressionDefault, deadLetterMeta{}, errors.New("down")))
+
+	server, received := newReplayServer(t)
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+
+	n, err := Replay(context.Background(), dir, ReplayConfig{Config: config, TimeShift: time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	reqs := received()
+	require.Len(t, reqs, 1)
+	assert.Equal(t, 1000+time.Hour.Milliseconds(), reqs[0].Timeseries[0].Samples[0].Timestamp)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestReplayDeadLetterTimeShiftUnsupported(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	dl, err := newDeadLetter(dir)
+	require.NoError(t, err)
+	require.NoError(t, dl.write([]byte("k6_vus 3 1000\n"), protocolInfluxDB, compressionNone, deadLetterMeta{}, errors.New("down")))
+
+	config := NewConfig()
+	config.Url = null.StringFrom("http://localhost:8086/api/v2/write")
+
+	n, err := Replay(context.Background(), dir, ReplayConfig{Config: config, TimeShift: time.Hour})
+	assert.ErrorContains(t, err, "the timestamps of influxdb requests can't be shifted")
+	assert.Equal(t, 0, n)
+}
+
+func TestShiftTimestamps(t *testing.T) {
+	t.Parallel()
+
+	req := prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Samples:    []prompb.Sample{{Timestamp: 1000}, {Timestamp: 2000}},
+		Exemplars:  []prompb.Exemplar{{Timestamp: 1500}},
+		Histograms: []prompb.Histogram{{Timestamp: 1000}},
+	}}}
+	shiftTimestamps(&req, -time.Second)
+
+	ts := req.Timeseries[0]
+	assert.Equal(t, []prompb.Sample{{Timestamp: 0}, {Timestamp: 1000}}, ts.Samples)
+	assert.Equal(t, int64(500), ts.Exemplars[0].Timestamp)
+	assert.Equal(t, int64(0), ts.Histograms[0].Timestamp)
+}
@@ -0,0 +1,151 @@
+package remotewrite
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// retryPolicy describes how failed remote-write requests are retried.
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	// maxRetryAfter caps the delay requested by the endpoint: the retries hold
+	// the flush, so a longer one would stop the following flushes as well.
+	maxRetryAfter time.Duration
+	jitter        bool
+}
+
+func newRetryPolicy(conf Config) retryPolicy {
+	return retryPolicy{
+		maxAttempts:    int(conf.RetryMaxAttempts.Int64),
+		initialBackoff: time.Duration(conf.RetryInitialBackoff.Duration),
+		maxBackoff:     time.Duration(conf.RetryMaxBackoff.Duration),
+		maxRetryAfter:  time.Duration(conf.FlushPeriod.Duration),
+		jitter:         conf.RetryJitter.Bool,
+	}
+}
+
+// backoff returns the delay before the given retry, counting from 1.
+// The delay doubles with each retry and is capped by maxBackoff.
+// With jitter enabled, a random delay between half and the full value is used
+// so that several load generators don't hammer the endpoint in lockstep.
+func (p retryPolicy) backoff(retry int) time.Duration {
+	d := p.initialBackoff
+	for i := 1; i < retry && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+
+	if p.jitter && d > 1 {
+		half := d / 2
+		d = half + time.Duration(rand.Int63n(int64(d-half))) //nolint:gosec
+	}
+
+	return d
+}
+
+// delay returns how long to wait before the given retry, counting from 1:
+// the delay requested by the endpoint with Retry-After if any, up to the flush
+// period, the backoff otherwise.
+func (p retryPolicy) delay(retry int, err error) time.Duration {
+	var recoverable recoverableError
+	if errors.As(err, &recoverable) && recoverable.retryAfter > 0 {
+		if p.maxRetryAfter > 0 && recoverable.retryAfter > p.maxRetryAfter {
+			return p.maxRetryAfter
+		}
+		return recoverable.retryAfter
+	}
+	return p.backoff(retry)
+}
+
+// shouldRetry returns true if another attempt is allowed after a failed one.
+// Only errors that the remote client marks as recoverable (network errors,
+// 5xx responses and rate limiting) are worth retrying: for the others,
+// sending the same request again will fail in the same way.
+func (p retryPolicy) shouldRetry(attempt int, err error) bool {
+	if attempt >= p.maxAttempts {
+		return false
+	}
+
+	return isRecoverable(err)
+}
+
+// isRecoverable returns true if the request may succeed when sent again later.
+func isRecoverable(err error) bool {
+	var recoverable recoverableError
+	return errors.As(err, &recoverable)
+}
+
+// errorClass groups the errors of the requests by how the endpoint handled them,
+// as the remote write specification defines a different behavior for each.
+type errorClass string
+
+const (
+	errorClassRateLimited errorClass = "rate_limited"
+	errorClassServer      errorClass = "server_error"
+	errorClassClient      errorClass = "client_error"
+	errorClassNetwork     errorClass = "network"
+	errorClassCircuitOpen errorClass = "circuit_open"
+	errorClassOther       errorClass = "other"
+)
+
+func classifyError(err error) errorClass {
+	var (
+		status     *statusError
+		grpcStatus *grpcStatusError
+	)
+	switch {
+	case errors.Is(err, errCircuitOpen):
+		return errorClassCircuitOpen
+	case errors.As(err, &grpcStatus):
+		return grpcStatus.class()
+	case errors.As(err, &status) && status.code == http.StatusTooManyRequests:
+		return errorClassRateLimited
+	case errors.As(err, &status) && status.code/100 == 5:
+		return errorClassServer
+	case errors.As(err, &status) && status.code/100 == 4:
+		return errorClassClient
+	case isRecoverable(err):
+		return errorClassNetwork
+	default:
+		return errorClassOther
+	}
+}
+
+// retryMessage returns the message logged when a request is retried after the error.
+func (c errorClass) retryMessage(delay time.Duration) string {
+	switch c {
+	case errorClassRateLimited:
+		return fmt.Sprintf("Rate limited by the remote endpoint, retrying in %s.", delay)
+	case errorClassServer:
+		return fmt.Sprintf("Remote endpoint failed to store timeseries, retrying in %s.", delay)
+	case errorClassNetwork:
+		return fmt.Sprintf("Failed to reach the remote endpoint, retrying in %s.", delay)
+	default:
+		return fmt.Sprintf("Failed to store timeseries, retrying in %s.", delay)
+	}
+}
+
+// failureMessage returns the message logged when timeseries couldn't be stored because of the error.
+func (c errorClass) failureMessage() string {
+	switch c {
+	case errorClassRateLimited:
+		return "Remote endpoint kept rate limiting the requests, timeseries were not stored."
+	case errorClassServer:
+		return "Remote endpoint kept failing, timeseries were not stored."
+	case errorClassClient:
+		return "Remote endpoint rejected the request, timeseries were not stored and the request is not retried."
+	case errorClassNetwork:
+		return "Remote endpoint is unreachable, timeseries were not stored."
+	case errorClassCircuitOpen:
+		return "Circuit breaker is open, timeseries were not sent to the failing endpoint."
+	default:
+		return "Failed to store timeseries."
+	}
+}
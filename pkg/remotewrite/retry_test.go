@@ -0,0 +1,260 @@
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	t.Parallel()
+
+	p := retryPolicy{
+		maxAttempts:    5,
+		initialBackoff: 100 * time.Millisecond,
+		maxBackoff:     time.Second,
+	}
+
+	assert.Equal(t, 100*time.Millisecond, p.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, p.backoff(2))
+	assert.Equal(t, 400*time.Millisecond, p.backoff(3))
+	assert.Equal(t, 800*time.Millisecond, p.backoff(4))
+	assert.Equal(t, time.Second, p.backoff(5))
+	assert.Equal(t, time.Second, p.backoff(100))
+
+	p.jitter = true
+	for i := 1; i < 10; i++ {
+		d := p.backoff(i)
+		assert.GreaterOrEqual(t, int64(d), int64(p.backoff(i)/2))
+		assert.LessOrEqual(t, d, time.Second)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	t.Parallel()
+
+	p := retryPolicy{
+		maxAttempts:    5,
+		initialBackoff: 100 * time.Millisecond,
+		maxBackoff:     time.Second,
+		maxRetryAfter:  10 * time.Second,
+	}
+
+	assert.Equal(t, 200*time.Millisecond, p.delay(2, recoverableError{err: errors.New("503")}))
+	// Retry-After is honored even above the maximum backoff
+	assert.Equal(t, 5*time.Second, p.delay(2, recoverableError{err: errors.New("429"), retryAfter: 5 * time.Second}))
+	// but not beyond the flush period, which it would hold
+	assert.Equal(t, 10*time.Second, p.delay(2, recoverableError{err: errors.New("429"), retryAfter: time.Hour}))
+}
+
+func TestRetryShouldRetry(t *testing.T) {
+	t.Parallel()
+
+	p := retryPolicy{maxAttempts: 3}
+
+	assert.False(t, p.shouldRetry(1, errors.New("server returned HTTP status 400 Bad Request")))
+	assert.False(t, p.shouldRetry(3, errors.New("any")))
+}
+
+func TestOutputStoreRetries(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+	config.RetryMaxAttempts = null.IntFrom(3)
+	config.RetryInitialBackoff = types.NullDurationFrom(time.Millisecond)
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	o := &Output{
+		config: config,
+		client: client,
+		retry:  newRetryPolicy(config),
+		logger: logrus.New(),
+	}
+
+	require.NoError(t, o.store(nil, []byte("payload"), protocolV1))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, -10)
+	require.Error(t, o.store(nil, []byte("payload"), protocolV1))
+	assert.Equal(t, int32(-7), atomic.LoadInt32(&calls))
+}
+
+func TestOutputStoreDraining(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 5 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+	config.RetryMaxAttempts = null.IntFrom(1)
+	config.RetryInitialBackoff = types.NullDurationFrom(time.Millisecond)
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	o := &Output{
+		config: config,
+		client: client,
+		retry:  newRetryPolicy(config),
+		logger: logrus.New(),
+	}
+
+	// retried past the maximum attempts until the deadline
+	o.drainDeadline = time.Now().Add(10 * time.Second)
+	require.NoError(t, o.store(nil, []byte("payload"), protocolV1))
+	assert.Equal(t, int32(5), atomic.LoadInt32(&calls))
+
+	// given up once the deadline passed
+	atomic.StoreInt32(&calls, -100)
+	o.drainDeadline = time.Now().Add(50 * time.Millisecond)
+	require.Error(t, o.store(nil, []byte("payload"), protocolV1))
+	assert.Less(t, atomic.LoadInt32(&calls), int32(5))
+}
+
+func TestOutputStoreCanceled(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first request hangs, the following ones fail
+		if atomic.AddInt32(&calls, 1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	// the server doesn't always see the request canceled by the client
+	defer close(release)
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+	config.RetryMaxAttempts = null.IntFrom(10)
+	config.RetryInitialBackoff = types.NullDurationFrom(time.Hour)
+	config.RetryMaxBackoff = types.NullDurationFrom(time.Hour)
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	newOutput := func() *Output {
+		requests, cancelRequests := context.WithCancel(context.Background())
+		return &Output{
+			config:         config,
+			client:         client,
+			retry:          newRetryPolicy(config),
+			self:           newSelfMetrics(),
+			logger:         logrus.New(),
+			requests:       requests,
+			cancelRequests: cancelRequests,
+		}
+	}
+	stored := func(o *Output) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- o.store(nil, []byte("payload"), protocolV1)
+		}()
+		return done
+	}
+
+	// the request in flight is canceled
+	o := newOutput()
+	done := stored(o)
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second, time.Millisecond)
+	o.stopRequests()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request in flight was not canceled")
+	}
+
+	// so is the backoff before the next attempt
+	o = newOutput()
+	done = stored(o)
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 2 }, time.Second, time.Millisecond)
+	o.stopRequests()
+	select {
+	case err := <-done:
+		assert.ErrorContains(t, err, "503")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the backoff was not canceled")
+	}
+	assert.Equal(t, uint64(1), o.self.fields()["requests_failed"])
+}
+
+func TestOutputStopTestOnError(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.StopTestOnError = null.IntFrom(3)
+	require.NoError(t, config.Validate())
+
+	var stopped []error
+	o := &Output{
+		config:   config,
+		logger:   logrus.New(),
+		stopTest: func(err error) { stopped = append(stopped, err) },
+	}
+
+	errWrite := errors.New("server returned HTTP status 503 Service Unavailable")
+	o.flushDone(errWrite)
+	o.flushDone(errWrite)
+	// a successful flush starts the count again
+	o.flushDone(nil)
+	o.flushDone(errWrite)
+	o.flushDone(errWrite)
+	assert.Empty(t, stopped)
+
+	o.flushDone(errWrite)
+	require.Len(t, stopped, 1)
+	assert.ErrorIs(t, stopped[0], errWrite)
+	assert.Contains(t, stopped[0].Error(), "3 flushes in a row failed")
+
+	// the test is aborted only once
+	o.flushDone(errWrite)
+	assert.Len(t, stopped, 1)
+
+	config.StopTestOnError = null.IntFrom(-1)
+	assert.Error(t, config.Validate())
+}
@@ -0,0 +1,131 @@
+package remotewrite
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/sirupsen/logrus"
+)
+
+// endpointRoute holds the clients and the WAL of series routed away from the default
+// endpoint and tenant, which are sent with the clients and the WAL of the Output.
+type endpointRoute struct {
+	name     string
+	client   remote.WriteClient
+	fallback remote.WriteClient
+	wal      *wal
+}
+
+// newEndpointRoute returns a route sending with conf to rawURL or, if it's empty, to the
+// URL of conf with the failover and mirror URLs. Its WAL, if enabled, is in walDir under WALDir.
+func newEndpointRoute(
+	name string, conf *remote.ClientConfig, rawURL, walDir string,
+	p protocol, config Config, logger logrus.FieldLogger, self *selfMetrics,
+) (*endpointRoute, error) {
+	newRouteClient := func(clientName string, p protocol) (remote.WriteClient, error) {
+		if rawURL == "" {
+			return newClient(clientName, conf, p, config, logger, self)
+		}
+		// the compression is validated by New
+		return newWriteClientForURL(clientName, conf, p, compression(config.Compression.String), config.transportConfig(), rawURL)
+	}
+
+	clientName := "xk6-prwo-route-" + name
+	client, err := newRouteClient(clientName, p)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", name, err)
+	}
+	route := &endpointRoute{name: name, client: client}
+
+	if p == protocolV2 {
+		route.fallback, err = newRouteClient(clientName+"-fallback", protocolV1)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", name, err)
+		}
+	}
+
+	// each route has its own WAL so that an unavailable endpoint doesn't hold back the others
+	if config.WALDir.String != "" {
+		route.wal, err = newWAL(filepath.Join(config.WALDir.String, walDir),
+			config.WALMaxSize.Int64, time.Duration(config.WALMaxAge.Duration))
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", name, err)
+		}
+	}
+	return route, nil
+}
+
+// routeName returns the name of the route for logs and errors.
+func (r *endpointRoute) routeName() string {
+	if r == nil {
+		return "default"
+	}
+	return r.name
+}
+
+// routeGroup is the series of a route, nil for the default one.
+type routeGroup struct {
+	route  *endpointRoute
+	series []prompb.TimeSeries
+}
+
+// groupByRoute groups the series by their route, the default one
+// first and then the other routes ordered by name.
+func groupByRoute(series []prompb.TimeSeries, routeOf func(prompb.TimeSeries) *endpointRoute) []routeGroup {
+	byRoute := make(map[*endpointRoute][]prompb.TimeSeries)
+	for _, ts := range series {
+		route := routeOf(ts)
+		byRoute[route] = append(byRoute[route], ts)
+	}
+
+	groups := make([]routeGroup, 0, len(byRoute))
+	for route, series := range byRoute {
+		groups = append(groups, routeGroup{route: route, series: series})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].route == nil || groups[j].route == nil {
+			return groups[i].route == nil
+		}
+		return groups[i].route.name < groups[j].route.name
+	})
+	return groups
+}
+
+// route returns the route of the series: the first metric route matching its name
+// or else the tenant route of the value of its tenant label, nil for the default one.
+func (o *Output) route(ts prompb.TimeSeries) *endpointRoute {
+	if len(o.metricRoutes) > 0 {
+		if i := labelIndex(ts.Labels, "__name__"); i >= 0 {
+			for _, r := range o.metricRoutes {
+				if r.match.MatchString(ts.Labels[i].Value) {
+					return r.route
+				}
+			}
+		}
+	}
+	if len(o.tenants) > 0 {
+		if i := labelIndex(ts.Labels, o.config.TenantTag.String); i >= 0 {
+			return o.tenants[ts.Labels[i].Value]
+		}
+	}
+	return nil
+}
+
+// routes returns all the routes other than the default one.
+func (o *Output) routes() []*endpointRoute {
+	routes := make([]*endpointRoute, 0, len(o.metricRoutes)+len(o.tenants))
+	for _, r := range o.metricRoutes {
+		routes = append(routes, r.route)
+	}
+	for _, r := range o.tenants {
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].name < routes[j].name
+	})
+	return routes
+}
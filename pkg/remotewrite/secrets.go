@@ -0,0 +1,110 @@
+package remotewrite
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readSecretFile returns the content of the file of a secret, without the trailing
+// newline often left by editors or by kubectl create secret --from-file.
+func readSecretFile(option, name string) (string, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", option, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// fileHeaders returns the headers read from the files of HeaderFiles and TenantIDFile.
+func (conf Config) fileHeaders() (map[string]string, error) {
+	headers := make(map[string]string, len(conf.HeaderFiles)+1)
+	for name, file := range conf.HeaderFiles {
+		value, err := readSecretFile(fmt.Sprintf("the file of header %q", name), file)
+		if err != nil {
+			return nil, err
+		}
+		headers[name] = value
+	}
+	if conf.TenantIDFile.Valid {
+		tenantID, err := readSecretFile("tenantIDFile", conf.TenantIDFile.String)
+		if err != nil {
+			return nil, err
+		}
+		headers[tenantHeader] = tenantID
+	}
+	return headers, nil
+}
+
+// rotatedHeaders returns the function reading the headers set from files, nil if
+// there are none or if they are not read again during the test.
+func (conf Config) rotatedHeaders() func() (map[string]string, error) {
+	if conf.CredentialsRefresh.Duration <= 0 || (len(conf.HeaderFiles) == 0 && !conf.TenantIDFile.Valid) {
+		return nil
+	}
+	return conf.fileHeaders
+}
+
+// rotatingHeaders sets the headers read from files on the requests, and reads the
+// files again once the last read is older than the interval, so that the secrets
+// rotated during the test are used without restarting it.
+type rotatingHeaders struct {
+	next     http.RoundTripper
+	read     func() (map[string]string, error)
+	interval time.Duration
+
+	// initial are the values read when the test started, which are also set by the
+	// client: the headers with other values, e.g. the tenants of the tenant
+	// routes, are left as they are
+	initial map[string]string
+
+	mu      sync.Mutex
+	headers map[string]string
+	readAt  time.Time
+}
+
+func newRotatingHeaders(next http.RoundTripper, read func() (map[string]string, error), interval time.Duration) (*rotatingHeaders, error) {
+	headers, err := read()
+	if err != nil {
+		return nil, err
+	}
+	return &rotatingHeaders{
+		next:     next,
+		read:     read,
+		interval: interval,
+		initial:  headers,
+		headers:  headers,
+		readAt:   time.Now(),
+	}, nil
+}
+
+func (rt *rotatingHeaders) RoundTrip(req *http.Request) (*http.Response, error) {
+	headers := rt.current()
+	// the request must not be modified by round trippers
+	req = req.Clone(req.Context())
+	for name, value := range headers {
+		if req.Header.Get(name) == rt.initial[name] {
+			req.Header.Set(name, value)
+		}
+	}
+	return rt.next.RoundTrip(req)
+}
+
+// current returns the headers, read again from the files if they are too old. The
+// previous ones are kept if the files can't be read, e.g. while a secret is updated,
+// until the next interval.
+func (rt *rotatingHeaders) current() map[string]string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if time.Since(rt.readAt) < rt.interval {
+		return rt.headers
+	}
+	rt.readAt = time.Now()
+	if headers, err := rt.read(); err == nil {
+		rt.headers = headers
+	}
+	return rt.headers
+}
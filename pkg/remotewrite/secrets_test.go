@@ -0,0 +1,131 @@
+package remotewrite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestSecretFiles(t *testing.T) {
+	t.Parallel()
+
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	env := map[string]string{
+		"K6_PROMETHEUS_REMOTE_URL":             server.URL,
+		"K6_PROMETHEUS_USER":                   "k6",
+		"K6_PROMETHEUS_PASSWORD_FILE":          write("password", "secret\n"),
+		"K6_PROMETHEUS_TENANT_ID_FILE":         write("tenant", "team-a\n"),
+		"K6_PROMETHEUS_HEADER_FILES_X-Api-Key": write("api-key", "key"),
+		"K6_PROMETHEUS_HEADERS_X-Other-Header": "value",
+	}
+	config, err := GetConsolidatedConfig(nil, env, "")
+	require.NoError(t, err)
+	require.NoError(t, config.Validate())
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	require.NoError(t, client.Store(context.Background(), []byte("payload")))
+	// the password is read again with every request
+	write("password", "rotated\n")
+	require.NoError(t, client.Store(context.Background(), []byte("payload")))
+
+	require.Len(t, requests, 2)
+	for i, password := range []string{"secret", "rotated"} {
+		user, pass, ok := requests[i].BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "k6", user)
+		assert.Equal(t, password, pass)
+		assert.Equal(t, "team-a", requests[i].Header.Get("X-Scope-OrgID"))
+		assert.Equal(t, "key", requests[i].Header.Get("X-Api-Key"))
+		assert.Equal(t, "value", requests[i].Header.Get("X-Other-Header"))
+	}
+
+	config.TenantIDFile = null.StringFrom(filepath.Join(dir, "missing"))
+	_, err = config.ConstructRemoteConfig()
+	assert.ErrorContains(t, err, "failed to read tenantIDFile")
+
+	config.TenantID = null.StringFrom("team-b")
+	config.Password = null.StringFrom("secret")
+	var verr *ValidationError
+	require.ErrorAs(t, config.Validate(), &verr)
+	assert.Len(t, verr.Problems, 2)
+}
+
+func TestRotatingHeaders(t *testing.T) {
+	t.Parallel()
+
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	tenantFile := filepath.Join(t.TempDir(), "tenant")
+	require.NoError(t, os.WriteFile(tenantFile, []byte("team-a"), 0o600))
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+	config.TenantIDFile = null.StringFrom(tenantFile)
+	config.CredentialsRefresh = types.NullDurationFrom(time.Hour)
+	require.NoError(t, config.Validate())
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+	rotating, ok := client.client.Transport.(*rotatingHeaders)
+	require.True(t, ok)
+
+	// a tenant route sets its own tenant, which isn't replaced
+	routeConfig := *remoteConfig
+	routeConfig.Headers = map[string]string{tenantHeader: "team-b"}
+	routeClient, err := newWriteClient("route", &routeConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(tenantFile, []byte("team-c"), 0o600))
+	require.NoError(t, client.Store(context.Background(), []byte("payload")))
+	// read again once the interval elapsed
+	rotating.readAt = time.Now().Add(-time.Hour)
+	require.NoError(t, client.Store(context.Background(), []byte("payload")))
+	// the previous tenant is kept while the file can't be read
+	require.NoError(t, os.Remove(tenantFile))
+	rotating.readAt = time.Now().Add(-time.Hour)
+	require.NoError(t, client.Store(context.Background(), []byte("payload")))
+	require.NoError(t, routeClient.Store(context.Background(), []byte("payload")))
+
+	var tenants []string
+	for _, r := range requests {
+		tenants = append(tenants, r.Header.Get(tenantHeader))
+	}
+	assert.Equal(t, []string{"team-a", "team-c", "team-c", "team-b"}, tenants)
+
+	// without refresh, the headers are only read when the test starts
+	config.CredentialsRefresh = types.NullDurationFrom(0)
+	assert.Nil(t, config.transportConfig().fileHeaders)
+}
@@ -0,0 +1,416 @@
+package remotewrite
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+)
+
+// selfMetricsPrefix is prepended, after the metric prefix, to the names of the self-metrics.
+const selfMetricsPrefix = "output_prw_"
+
+// selfMetrics keeps track of the health of the output itself. It is safe for
+// concurrent use and its methods are no-ops on a nil receiver.
+type selfMetrics struct {
+	mu sync.Mutex
+
+	samplesBuffered  int
+	flushDuration    time.Duration
+	flushedAt        time.Time
+	flushes          uint64
+	flushesDuration  time.Duration
+	requests         uint64
+	seriesSent       uint64
+	bytesSent        uint64
+	requestsFailed   uint64
+	samplesFailed    uint64
+	samplesDropped   uint64
+	samplesSpilled   uint64
+	samplesCrowded   uint64
+	samplesExpired   uint64
+	samplesAdjusted  uint64
+	flushesSkipped   uint64
+	buffersReused    uint64
+	buffersAllocated uint64
+
+	// endpointFailures counts the failed requests per endpoint when mirroring.
+	endpointFailures map[string]uint64
+	// requestErrors counts the failed attempts, retries included, per error class.
+	requestErrors map[errorClass]uint64
+	// rejections counts the requests rejected by the endpoint per reason.
+	rejections map[string]uint64
+	// circuitStates is the state of the circuit breaker per client and
+	// circuitOpens counts how many times it opened.
+	circuitStates map[string]circuitState
+	circuitOpens  map[string]uint64
+}
+
+func newSelfMetrics() *selfMetrics {
+	return &selfMetrics{}
+}
+
+// observeFlush records the number of buffered samples handled by the last flush and its duration.
+func (m *selfMetrics) observeFlush(samples int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samplesBuffered = samples
+	m.flushDuration = d
+	m.flushedAt = time.Now()
+	m.flushes++
+	m.flushesDuration += d
+}
+
+// flushStats are the stats of the last flush, as served by the debug listener.
+type flushStats struct {
+	Time     time.Time `json:"time"`
+	Samples  int       `json:"samples"`
+	Duration string    `json:"duration"`
+	Flushes  uint64    `json:"flushes"`
+	Skipped  uint64    `json:"skipped"`
+}
+
+// lastFlush returns the stats of the last flush, with zero time if there was none.
+func (m *selfMetrics) lastFlush() flushStats {
+	if m == nil {
+		return flushStats{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return flushStats{
+		Time:     m.flushedAt,
+		Samples:  m.samplesBuffered,
+		Duration: m.flushDuration.String(),
+		Flushes:  m.flushes,
+		Skipped:  m.flushesSkipped,
+	}
+}
+
+// addRequest counts an attempt to send a request, retries included.
+func (m *selfMetrics) addRequest() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests++
+}
+
+// addSeriesSent counts the series of a request accepted by the endpoint or kept in the WAL.
+func (m *selfMetrics) addSeriesSent(n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seriesSent += uint64(n)
+}
+
+// addBytesSent counts the (compressed) bytes of a request accepted by the endpoint.
+func (m *selfMetrics) addBytesSent(n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytesSent += uint64(n)
+}
+
+// addRequestFailed counts a request that failed after all the retries.
+func (m *selfMetrics) addRequestFailed() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requestsFailed++
+}
+
+// addSamplesFailed counts the samples of a request that failed after all the retries.
+func (m *selfMetrics) addSamplesFailed(n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samplesFailed += uint64(n)
+}
+
+// addEndpointFailure counts a request that a mirrored endpoint failed to store.
+func (m *selfMetrics) addEndpointFailure(endpoint string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.endpointFailures == nil {
+		m.endpointFailures = make(map[string]uint64)
+	}
+	m.endpointFailures[endpoint]++
+}
+
+// addRequestError counts a failed attempt to send a request.
+func (m *selfMetrics) addRequestError(class errorClass) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.requestErrors == nil {
+		m.requestErrors = make(map[errorClass]uint64)
+	}
+	m.requestErrors[class]++
+}
+
+// addRejection counts a request rejected by the endpoint, see parseRejection for the reasons.
+func (m *selfMetrics) addRejection(reason string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rejections == nil {
+		m.rejections = make(map[string]uint64)
+	}
+	m.rejections[reason]++
+}
+
+// setCircuitState records the new state of the circuit breaker of the client.
+func (m *selfMetrics) setCircuitState(client string, state circuitState) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.circuitStates == nil {
+		m.circuitStates = make(map[string]circuitState)
+		m.circuitOpens = make(map[string]uint64)
+	}
+	m.circuitStates[client] = state
+	if state == circuitOpen {
+		m.circuitOpens[client]++
+	}
+}
+
+// addSamplesDropped counts samples discarded because the endpoint is too slow or beyond MaxSamplesPerFlush.
+func (m *selfMetrics) addSamplesDropped(n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samplesDropped += uint64(n)
+}
+
+// addSamplesSpilled counts the buffered samples written to disk beyond the memory limit.
+func (m *selfMetrics) addSamplesSpilled(n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samplesSpilled += uint64(n)
+}
+
+// addSamplesCrowded counts the samples dropped by the raw-all mapping, as their
+// series had too many samples to be offset to distinct timestamps.
+func (m *selfMetrics) addSamplesCrowded(n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samplesCrowded += uint64(n)
+}
+
+// addFlushSkipped counts a flush skipped because the previous one was still running.
+func (m *selfMetrics) addFlushSkipped() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flushesSkipped++
+}
+
+// addEncodeBuffers counts the buffers used to encode a request, reused from the pool or newly allocated.
+func (m *selfMetrics) addEncodeBuffers(reused bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if reused {
+		m.buffersReused++
+	} else {
+		m.buffersAllocated++
+	}
+}
+
+// addSamplesExpired counts samples dropped because they are older than MaxSampleAge
+// and samples sent with the current time instead of theirs.
+func (m *selfMetrics) addSamplesExpired(dropped, adjusted int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samplesExpired += uint64(dropped)
+	m.samplesAdjusted += uint64(adjusted)
+}
+
+// samplesUndelivered returns the number of samples that failed to be sent or were dropped.
+func (m *selfMetrics) samplesUndelivered() uint64 {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.samplesFailed + m.samplesDropped + m.samplesCrowded + m.samplesExpired
+}
+
+// fields returns the current values to be logged.
+func (m *selfMetrics) fields() logrus.Fields {
+	if m == nil {
+		return logrus.Fields{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fields := logrus.Fields{
+		"samples_buffered":  m.samplesBuffered,
+		"flush_duration":    m.flushDuration.String(),
+		"series_sent":       m.seriesSent,
+		"bytes_sent":        m.bytesSent,
+		"requests_failed":   m.requestsFailed,
+		"samples_failed":    m.samplesFailed,
+		"samples_dropped":   m.samplesDropped,
+		"samples_spilled":   m.samplesSpilled,
+		"samples_crowded":   m.samplesCrowded,
+		"samples_expired":   m.samplesExpired,
+		"samples_adjusted":  m.samplesAdjusted,
+		"flushes_skipped":   m.flushesSkipped,
+		"buffers_reused":    m.buffersReused,
+		"buffers_allocated": m.buffersAllocated,
+	}
+	if len(m.endpointFailures) > 0 {
+		failures := make(map[string]uint64, len(m.endpointFailures))
+		for endpoint, n := range m.endpointFailures {
+			failures[endpoint] = n
+		}
+		fields["endpoint_failures"] = failures
+	}
+	if len(m.requestErrors) > 0 {
+		errs := make(map[string]uint64, len(m.requestErrors))
+		for class, n := range m.requestErrors {
+			errs[string(class)] = n
+		}
+		fields["request_errors"] = errs
+	}
+	if len(m.rejections) > 0 {
+		rejections := make(map[string]uint64, len(m.rejections))
+		for reason, n := range m.rejections {
+			rejections[reason] = n
+		}
+		fields["rejections"] = rejections
+	}
+	if len(m.circuitStates) > 0 {
+		states := make(map[string]string, len(m.circuitStates))
+		for client, state := range m.circuitStates {
+			states[client] = state.String()
+		}
+		fields["circuit_breakers"] = states
+	}
+	return fields
+}
+
+type selfMetricValue struct {
+	name  string
+	value float64
+	label *prompb.Label
+}
+
+// timeSeries returns the current values as series named prefix+"output_prw_*",
+// each with the given labels. Failures per endpoint also have an endpoint label,
+// errors per class a class label and rejections per reason a reason label.
+// The circuit breakers have a client label, their state is 0 when closed,
+// 1 when half-open and 2 when open.
+func (m *selfMetrics) timeSeries(now time.Time, labels []prompb.Label, prefix string) []prompb.TimeSeries {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	values := []selfMetricValue{
+		{name: "samples_buffered", value: float64(m.samplesBuffered)},
+		{name: "flush_duration_seconds", value: m.flushDuration.Seconds()},
+		{name: "series_sent_total", value: float64(m.seriesSent)},
+		{name: "bytes_sent_total", value: float64(m.bytesSent)},
+		{name: "requests_failed_total", value: float64(m.requestsFailed)},
+		{name: "samples_failed_total", value: float64(m.samplesFailed)},
+		{name: "samples_dropped_total", value: float64(m.samplesDropped)},
+		{name: "samples_spilled_total", value: float64(m.samplesSpilled)},
+		{name: "samples_crowded_total", value: float64(m.samplesCrowded)},
+		{name: "samples_expired_total", value: float64(m.samplesExpired)},
+		{name: "samples_adjusted_total", value: float64(m.samplesAdjusted)},
+		{name: "flushes_skipped_total", value: float64(m.flushesSkipped)},
+		{name: "buffers_reused_total", value: float64(m.buffersReused)},
+		{name: "buffers_allocated_total", value: float64(m.buffersAllocated)},
+	}
+	for endpoint, n := range m.endpointFailures {
+		values = append(values, selfMetricValue{
+			name: "endpoint_failures_total", value: float64(n),
+			label: &prompb.Label{Name: "endpoint", Value: endpoint},
+		})
+	}
+	for class, n := range m.requestErrors {
+		values = append(values, selfMetricValue{
+			name: "request_errors_total", value: float64(n),
+			label: &prompb.Label{Name: "class", Value: string(class)},
+		})
+	}
+	for reason, n := range m.rejections {
+		values = append(values, selfMetricValue{
+			name: "rejections_total", value: float64(n),
+			label: &prompb.Label{Name: "reason", Value: reason},
+		})
+	}
+	for client, state := range m.circuitStates {
+		values = append(values,
+			selfMetricValue{
+				name: "circuit_breaker_state", value: float64(state),
+				label: &prompb.Label{Name: "client", Value: client},
+			},
+			selfMetricValue{
+				name: "circuit_breaker_opened_total", value: float64(m.circuitOpens[client]),
+				label: &prompb.Label{Name: "client", Value: client},
+			},
+		)
+	}
+	m.mu.Unlock()
+
+	ts := timestamp.FromTime(now)
+	series := make([]prompb.TimeSeries, 0, len(values))
+	for _, v := range values {
+		seriesLabels := labels
+		if v.label != nil {
+			seriesLabels = append(seriesLabels, *v.label)
+		}
+		series = append(series, prompb.TimeSeries{
+			Labels: append(seriesLabels, prompb.Label{
+				Name:  "__name__",
+				Value: prefix + selfMetricsPrefix + v.name,
+			}),
+			Samples: []prompb.Sample{
+				{
+					Value:     v.value,
+					Timestamp: ts,
+				},
+			},
+		})
+	}
+	return series
+}
@@ -0,0 +1,119 @@
+package remotewrite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestSelfMetricsTimeSeries(t *testing.T) {
+	t.Parallel()
+
+	m := newSelfMetrics()
+	m.observeFlush(10, 1500*time.Millisecond)
+	m.addSeriesSent(3)
+	m.addSeriesSent(2)
+	m.addBytesSent(100)
+	m.addRequestFailed()
+	m.addSamplesFailed(4)
+	m.addSamplesDropped(7)
+	m.addSamplesSpilled(6)
+	m.addSamplesCrowded(5)
+	m.addSamplesExpired(2, 3)
+	m.addFlushSkipped()
+	m.addEncodeBuffers(true)
+	m.addEncodeBuffers(true)
+	m.addEncodeBuffers(false)
+	m.addRequestError(errorClassRateLimited)
+	m.addRequestError(errorClassRateLimited)
+
+	now := time.Now()
+	series := m.timeSeries(now, []prompb.Label{{Name: "test_run_id", Value: "42"}}, "k6_")
+
+	values := make(map[string]float64, len(series))
+	for _, ts := range series {
+		if hasLabelValue(ts.Labels, "class", "rate_limited") {
+			assert.True(t, hasLabelValue(ts.Labels, "__name__", "k6_output_prw_request_errors_total"))
+			assert.Equal(t, 2.0, ts.Samples[0].Value)
+			continue
+		}
+		require.Len(t, ts.Labels, 2)
+		assert.Equal(t, prompb.Label{Name: "test_run_id", Value: "42"}, ts.Labels[0])
+		require.Len(t, ts.Samples, 1)
+		assert.Equal(t, now.UnixMilli(), ts.Samples[0].Timestamp)
+		values[ts.Labels[1].Value] = ts.Samples[0].Value
+	}
+	assert.Equal(t, map[string]float64{
+		"k6_output_prw_samples_buffered":        10,
+		"k6_output_prw_flush_duration_seconds":  1.5,
+		"k6_output_prw_series_sent_total":       5,
+		"k6_output_prw_bytes_sent_total":        100,
+		"k6_output_prw_requests_failed_total":   1,
+		"k6_output_prw_samples_failed_total":    4,
+		"k6_output_prw_samples_dropped_total":   7,
+		"k6_output_prw_samples_spilled_total":   6,
+		"k6_output_prw_samples_crowded_total":   5,
+		"k6_output_prw_samples_expired_total":   2,
+		"k6_output_prw_samples_adjusted_total":  3,
+		"k6_output_prw_flushes_skipped_total":   1,
+		"k6_output_prw_buffers_reused_total":    2,
+		"k6_output_prw_buffers_allocated_total": 1,
+	}, values)
+	assert.Equal(t, uint64(18), m.samplesUndelivered())
+
+	// nil-safe
+	var empty *selfMetrics
+	empty.addSeriesSent(1)
+	assert.Nil(t, empty.timeSeries(now, nil, "k6_"))
+}
+
+func TestOutputSelfMetrics(t *testing.T) {
+	t.Parallel()
+
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	o := &Output{
+		config: config,
+		client: client,
+		retry:  newRetryPolicy(config),
+		self:   newSelfMetrics(),
+		logger: logrus.New(),
+	}
+
+	series := []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}
+
+	assert.Error(t, o.write(series))
+	fail = false
+	require.NoError(t, o.write(series))
+
+	fields := o.self.fields()
+	assert.Equal(t, uint64(1), fields["requests_failed"])
+	assert.Equal(t, uint64(1), fields["series_sent"])
+	assert.NotZero(t, fields["bytes_sent"])
+}
@@ -0,0 +1,225 @@
+package remotewrite
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// seriesAggregator groups time series by their label set, so that all
+// samples of the same series are sent within a single prompb.TimeSeries
+// instead of repeating the labels for each one of them.
+type seriesAggregator struct {
+	index  map[string]int
+	series []prompb.TimeSeries
+	// key is the buffer the label sets are looked up with
+	key []byte
+	// samples is the number of samples added, histograms included,
+	// and latest the timestamp of the latest one
+	samples int
+	latest  int64
+}
+
+func newSeriesAggregator() *seriesAggregator {
+	return &seriesAggregator{
+		index:  make(map[string]int),
+		series: getTimeSeries(),
+		latest: math.MinInt64,
+	}
+}
+
+// add merges ts into the series with the same label set, if there is any.
+func (a *seriesAggregator) add(ts prompb.TimeSeries) {
+	a.count(ts)
+	a.key = appendLabelsKey(a.key[:0], ts.Labels)
+
+	i, ok := a.index[string(a.key)]
+	if !ok {
+		a.index[string(a.key)] = len(a.series)
+		// the series may be in the buffers of MetricsStorage, reused for the next sample
+		ts.Labels = append(make([]prompb.Label, 0, len(ts.Labels)), ts.Labels...)
+		// sorted once here rather than for every flush before sending, the
+		// labels with the same name keeping their order to be resolved then
+		sorted := labelsByName(ts.Labels)
+		sort.Stable(&sorted)
+		ts.Samples = append(make([]prompb.Sample, 0, len(ts.Samples)), ts.Samples...)
+		a.series = append(a.series, ts)
+		return
+	}
+
+	a.series[i].Samples = append(a.series[i].Samples, ts.Samples...)
+	a.series[i].Histograms = append(a.series[i].Histograms, ts.Histograms...)
+	a.series[i].Exemplars = append(a.series[i].Exemplars, ts.Exemplars...)
+}
+
+// count adds the samples of ts to the number of samples and the latest timestamp.
+func (a *seriesAggregator) count(ts prompb.TimeSeries) {
+	a.samples += len(ts.Samples) + len(ts.Histograms)
+	for _, s := range ts.Samples {
+		if s.Timestamp > a.latest {
+			a.latest = s.Timestamp
+		}
+	}
+	for _, h := range ts.Histograms {
+		if h.Timestamp > a.latest {
+			a.latest = h.Timestamp
+		}
+	}
+}
+
+// len returns the number of distinct series added so far.
+func (a *seriesAggregator) len() int {
+	return len(a.series)
+}
+
+// timeSeries returns the aggregated series with samples ordered by timestamp.
+// Remote-write endpoints reject duplicate timestamps within a series
+// (see https://github.com/prometheus/prometheus/issues/9210)
+// so only the last value added for a given timestamp is kept.
+func (a *seriesAggregator) timeSeries() []prompb.TimeSeries {
+	for i := range a.series {
+		a.series[i].Samples = dedupSamples(a.series[i].Samples)
+		a.series[i].Histograms = dedupHistograms(a.series[i].Histograms)
+		sort.SliceStable(a.series[i].Exemplars, func(j, k int) bool {
+			return a.series[i].Exemplars[j].Timestamp < a.series[i].Exemplars[k].Timestamp
+		})
+	}
+	return a.series
+}
+
+func dedupSamples(samples []prompb.Sample) []prompb.Sample {
+	if len(samples) < 2 {
+		return samples
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Timestamp < samples[j].Timestamp
+	})
+
+	deduped := samples[:0]
+	for i, s := range samples {
+		if i+1 < len(samples) && samples[i+1].Timestamp == s.Timestamp {
+			continue
+		}
+		deduped = append(deduped, s)
+	}
+	return deduped
+}
+
+func dedupHistograms(histograms []prompb.Histogram) []prompb.Histogram {
+	if len(histograms) < 2 {
+		return histograms
+	}
+
+	sort.SliceStable(histograms, func(i, j int) bool {
+		return histograms[i].Timestamp < histograms[j].Timestamp
+	})
+
+	deduped := histograms[:0]
+	for i, h := range histograms {
+		if i+1 < len(histograms) && histograms[i+1].Timestamp == h.Timestamp {
+			continue
+		}
+		deduped = append(deduped, h)
+	}
+	return deduped
+}
+
+// labelsKey returns a string identifying the label set regardless of the labels order.
+func labelsKey(labels []prompb.Label) string {
+	buf := labelsKeyBufferPool.Get().(*[]byte)
+	defer labelsKeyBufferPool.Put(buf)
+	*buf = appendLabelsKey((*buf)[:0], labels)
+	return string(*buf)
+}
+
+// appendLabelsKey appends the key of labelsKey to b. Maps can be looked up with it
+// without allocating, as in m[string(b)], the key being copied only when stored.
+func appendLabelsKey(b []byte, labels []prompb.Label) []byte {
+	sorted := labelsKeyPool.Get().(*labelsByName)
+	defer labelsKeyPool.Put(sorted)
+	*sorted = append((*sorted)[:0], labels...)
+	sort.Sort(sorted)
+
+	for _, l := range *sorted {
+		b = append(b, l.Name...)
+		b = append(b, '\xff')
+		b = append(b, l.Value...)
+		b = append(b, '\xff')
+	}
+	return b
+}
+
+// sentSeries keeps track of the series sent during the test run
+// and of the timestamp of their latest sample.
+type sentSeries struct {
+	series map[string]*sentSeriesEntry
+}
+
+type sentSeriesEntry struct {
+	labels []prompb.Label
+	latest int64
+}
+
+func newSentSeries() *sentSeries {
+	return &sentSeries{
+		series: make(map[string]*sentSeriesEntry),
+	}
+}
+
+func (s *sentSeries) track(series []prompb.TimeSeries) {
+	for _, ts := range series {
+		var latest int64 = math.MinInt64
+		for _, sample := range ts.Samples {
+			if sample.Timestamp > latest {
+				latest = sample.Timestamp
+			}
+		}
+		for _, h := range ts.Histograms {
+			if h.Timestamp > latest {
+				latest = h.Timestamp
+			}
+		}
+
+		key := labelsKey(ts.Labels)
+		entry, ok := s.series[key]
+		if !ok {
+			s.series[key] = &sentSeriesEntry{labels: ts.Labels, latest: latest}
+			continue
+		}
+		if latest > entry.latest {
+			entry.latest = latest
+		}
+	}
+}
+
+// staleMarkers returns a Prometheus stale marker for each tracked series so that
+// they stop being reported as active as soon as the test is over. A marker must be
+// the latest sample of its series, so its timestamp is never before the latest one sent.
+func (s *sentSeries) staleMarkers(now time.Time) []prompb.TimeSeries {
+	ts := timestamp.FromTime(now)
+
+	markers := make([]prompb.TimeSeries, 0, len(s.series))
+	for _, entry := range s.series {
+		markerTs := ts
+		if entry.latest >= markerTs {
+			markerTs = entry.latest + 1
+		}
+
+		markers = append(markers, prompb.TimeSeries{
+			Labels: entry.labels,
+			Samples: []prompb.Sample{
+				{
+					Value:     math.Float64frombits(value.StaleNaN),
+					Timestamp: markerTs,
+				},
+			},
+		})
+	}
+
+	return markers
+}
@@ -0,0 +1,141 @@
+package remotewrite
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestSeriesAggregator(t *testing.T) {
+	t.Parallel()
+
+	a := newSeriesAggregator()
+	a.add(prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}, {Name: "a", Value: "1"}},
+		Samples: []prompb.Sample{{Value: 3, Timestamp: 20}},
+	})
+	a.add(prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "a", Value: "1"}, {Name: "__name__", Value: "k6_vus"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 10}},
+	})
+	a.add(prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}, {Name: "a", Value: "2"}},
+		Samples: []prompb.Sample{{Value: 5, Timestamp: 10}},
+	})
+	a.add(prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}, {Name: "a", Value: "1"}},
+		Samples: []prompb.Sample{{Value: 4, Timestamp: 20}},
+	})
+
+	assert.Equal(t, 2, a.len())
+
+	ts := a.timeSeries()
+	require.Len(t, ts, 2)
+	assert.Equal(t, []prompb.Sample{{Value: 1, Timestamp: 10}, {Value: 4, Timestamp: 20}}, ts[0].Samples)
+	assert.Equal(t, []prompb.Sample{{Value: 5, Timestamp: 10}}, ts[1].Samples)
+}
+
+func TestConvertToTimeSeriesGroupsSamples(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.Mapping = null.StringFrom("raw")
+	o := &Output{
+		config:  config,
+		metrics: newMetricsStorage(),
+		mapping: NewMapping(config),
+		logger:  logrus.New(),
+	}
+
+	metric := &metrics.Metric{Name: "vus", Type: metrics.Gauge}
+	tags := metrics.NewSampleTags(map[string]string{"scenario": "default"})
+	now := time.Now()
+
+	ts := o.convertToTimeSeries([]metrics.SampleContainer{
+		metrics.Samples{
+			{Metric: metric, Tags: tags, Time: now, Value: 1},
+			{Metric: metric, Tags: tags, Time: now.Add(time.Second), Value: 2},
+		},
+		metrics.Samples{
+			{Metric: metric, Tags: tags, Time: now.Add(2 * time.Second), Value: 3},
+		},
+	})
+
+	require.Len(t, ts, 1)
+	assert.Len(t, ts[0].Samples, 3)
+	assert.Contains(t, ts[0].Labels, prompb.Label{Name: "__name__", Value: "k6_vus"})
+}
+
+func TestConvertToTimeSeriesMetricPrefix(t *testing.T) {
+	t.Parallel()
+
+	metric := &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}
+	sample := metrics.Sample{Metric: metric, Tags: metrics.NewSampleTags(nil), Time: time.Now(), Value: 1}
+
+	for prefix, name := range map[string]string{
+		"":          "http_reqs",
+		"loadtest_": "loadtest_http_reqs",
+	} {
+		config := NewConfig()
+		config.MetricPrefix = null.StringFrom(prefix)
+		o := &Output{
+			config:  config,
+			metrics: newMetricsStorage(),
+			mapping: NewMapping(config),
+			logger:  logrus.New(),
+		}
+
+		ts := o.convertToTimeSeries([]metrics.SampleContainer{metrics.Samples{sample}})
+		require.Len(t, ts, 1)
+		assert.Equal(t, []prompb.Label{{Name: "__name__", Value: name}}, ts[0].Labels)
+	}
+}
+
+func TestSentSeriesStaleMarkers(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	nowMs := now.UnixMilli()
+
+	s := newSentSeries()
+	s.track([]prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: nowMs - 2000}, {Value: 2, Timestamp: nowMs - 1000}},
+		},
+	})
+	s.track([]prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+			Samples: []prompb.Sample{{Value: 3, Timestamp: nowMs - 500}},
+		},
+		{
+			// sample in the future because of clock differences
+			Labels:     []prompb.Label{{Name: "__name__", Value: "k6_http_req_duration"}},
+			Histograms: []prompb.Histogram{{Timestamp: nowMs + 100}},
+		},
+	})
+
+	markers := s.staleMarkers(now)
+	require.Len(t, markers, 2)
+
+	timestamps := make(map[string]int64)
+	for _, m := range markers {
+		require.Len(t, m.Samples, 1)
+		assert.True(t, value.IsStaleNaN(m.Samples[0].Value))
+		assert.True(t, math.IsNaN(m.Samples[0].Value))
+		timestamps[m.Labels[0].Value] = m.Samples[0].Timestamp
+	}
+	assert.Equal(t, map[string]int64{
+		"k6_vus":               nowMs,
+		"k6_http_req_duration": nowMs + 101,
+	}, timestamps)
+}
@@ -0,0 +1,32 @@
+package remotewrite
+
+import (
+	"hash/fnv"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// shardTimeSeries partitions the series in n shards by the hash of their labels,
+// so that a series always ends up in the same shard and samples of one series are
+// never sent concurrently. Empty shards are omitted.
+func shardTimeSeries(series []prompb.TimeSeries, n int) [][]prompb.TimeSeries {
+	if n <= 1 || len(series) == 0 {
+		return [][]prompb.TimeSeries{series}
+	}
+
+	shards := make([][]prompb.TimeSeries, n)
+	for _, ts := range series {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(labelsKey(ts.Labels)))
+		i := h.Sum64() % uint64(n)
+		shards[i] = append(shards[i], ts)
+	}
+
+	nonEmpty := shards[:0]
+	for _, shard := range shards {
+		if len(shard) > 0 {
+			nonEmpty = append(nonEmpty, shard)
+		}
+	}
+	return nonEmpty
+}
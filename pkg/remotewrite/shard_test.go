@@ -0,0 +1,88 @@
+package remotewrite
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestShardTimeSeries(t *testing.T) {
+	t.Parallel()
+
+	series := make([]prompb.TimeSeries, 0, 100)
+	for i := 0; i < 100; i++ {
+		series = append(series, prompb.TimeSeries{
+			Labels: []prompb.Label{{Name: "__name__", Value: fmt.Sprintf("metric_%d", i)}},
+		})
+	}
+
+	assert.Equal(t, [][]prompb.TimeSeries{series}, shardTimeSeries(series, 1))
+	assert.Len(t, shardTimeSeries(nil, 4), 1)
+
+	shards := shardTimeSeries(series, 4)
+	assert.Len(t, shards, 4)
+
+	var total int
+	seen := make(map[string]int)
+	for i, shard := range shards {
+		total += len(shard)
+		for _, ts := range shard {
+			seen[ts.Labels[0].Value] = i
+		}
+	}
+	assert.Equal(t, 100, total)
+
+	// the same series is always assigned to the same shard
+	again := shardTimeSeries(series, 4)
+	for i, shard := range again {
+		for _, ts := range shard {
+			assert.Equal(t, seen[ts.Labels[0].Value], i)
+		}
+	}
+}
+
+func TestOutputWriteShards(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+	config.Shards = null.IntFrom(3)
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	o := &Output{
+		config: config,
+		client: client,
+		retry:  newRetryPolicy(config),
+		logger: logrus.New(),
+	}
+
+	series := make([]prompb.TimeSeries, 0, 30)
+	for i := 0; i < 30; i++ {
+		series = append(series, prompb.TimeSeries{
+			Labels:  []prompb.Label{{Name: "__name__", Value: fmt.Sprintf("metric_%d", i)}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		})
+	}
+
+	require.NoError(t, o.write(series))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
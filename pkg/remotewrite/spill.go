@@ -0,0 +1,145 @@
+package remotewrite
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// estimatedSampleSize is the memory a buffered sample is estimated to take, in bytes,
+// with its share of its container and tags, to keep the buffer within its memory limit.
+const estimatedSampleSize = 256
+
+// spilledSample is a buffered sample as written to a spill file. The metric is
+// looked up by name when it's read back, the tags are copied.
+type spilledSample struct {
+	Metric string
+	Tags   map[string]string
+	Time   int64
+	Value  float64
+}
+
+// spillFile is a file of spilled containers, with the number of their samples.
+type spillFile struct {
+	name    string
+	samples int
+}
+
+// sampleSpill writes the buffered samples beyond the memory limit to files in a
+// temporary directory, from which they are read back when the buffer is flushed.
+// Each file holds the containers spilled at once, gob-encoded. It is safe for concurrent use.
+type sampleSpill struct {
+	dir string
+
+	mu      sync.Mutex
+	seq     int
+	metrics map[string]*metrics.Metric
+}
+
+// newSampleSpill creates a temporary directory in dir for the spill files.
+func newSampleSpill(dir string) (*sampleSpill, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+	tmp, err := os.MkdirTemp(dir, "k6-prometheus-spill-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+	return &sampleSpill{dir: tmp, metrics: make(map[string]*metrics.Metric)}, nil
+}
+
+// write writes the containers to a new file. Nothing is left behind if it fails.
+func (s *sampleSpill) write(containers []metrics.SampleContainer) (spillFile, error) {
+	s.mu.Lock()
+	s.seq++
+	f := spillFile{name: filepath.Join(s.dir, fmt.Sprintf("%06d.gob", s.seq))}
+	for _, container := range containers {
+		for _, sample := range container.GetSamples() {
+			s.metrics[sample.Metric.Name] = sample.Metric
+		}
+	}
+	s.mu.Unlock()
+
+	file, err := os.OpenFile(f.name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return f, err
+	}
+	w := bufio.NewWriter(file)
+	enc := gob.NewEncoder(w)
+	for _, container := range containers {
+		samples := container.GetSamples()
+		spilled := make([]spilledSample, 0, len(samples))
+		for _, sample := range samples {
+			spilled = append(spilled, spilledSample{
+				Metric: sample.Metric.Name,
+				Tags:   sample.Tags.CloneTags(),
+				Time:   sample.Time.UnixNano(),
+				Value:  sample.Value,
+			})
+		}
+		if err = enc.Encode(spilled); err != nil {
+			break
+		}
+		f.samples += len(samples)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.name)
+		return f, err
+	}
+	return f, nil
+}
+
+// read returns the containers of the file and removes it.
+func (s *sampleSpill) read(f spillFile) ([]metrics.SampleContainer, error) {
+	defer func() { _ = os.Remove(f.name) }()
+
+	file, err := os.Open(f.name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var containers []metrics.SampleContainer
+	dec := gob.NewDecoder(bufio.NewReader(file))
+	for {
+		var spilled []spilledSample
+		if err := dec.Decode(&spilled); err != nil {
+			if errors.Is(err, io.EOF) {
+				return containers, nil
+			}
+			return containers, fmt.Errorf("invalid spill file %s: %w", f.name, err)
+		}
+		samples := make(metrics.Samples, 0, len(spilled))
+		for _, sp := range spilled {
+			samples = append(samples, metrics.Sample{
+				Metric: s.metrics[sp.Metric],
+				Tags:   metrics.IntoSampleTags(&sp.Tags),
+				Time:   time.Unix(0, sp.Time),
+				Value:  sp.Value,
+			})
+		}
+		containers = append(containers, samples)
+	}
+}
+
+// close removes the directory with the files left.
+func (s *sampleSpill) close() error {
+	return os.RemoveAll(s.dir)
+}
@@ -0,0 +1,69 @@
+package remotewrite
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// summaryNameWidth is the width of the names of the summary, padded with dots as k6 does.
+const summaryNameWidth = 24
+
+// writeSummary writes the stats of the output for the end of the test, in the
+// same layout as the k6 end-of-test summary: k6 v0.38 has no hook for outputs
+// to add their own stats to it, so it's written right after the test ends.
+func (m *selfMetrics) writeSummary(w io.Writer) error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	var errs uint64
+	for _, n := range m.requestErrors {
+		errs += n
+	}
+	// every failed attempt is retried, except the last one of the failed requests
+	var retries uint64
+	if errs > m.requestsFailed {
+		retries = errs - m.requestsFailed
+	}
+	var avgFlush time.Duration
+	if m.flushes > 0 {
+		avgFlush = m.flushesDuration / time.Duration(m.flushes)
+	}
+	rows := [][2]string{
+		{"series_sent", fmt.Sprint(m.seriesSent)},
+		{"bytes_sent", formatBytes(m.bytesSent)},
+		{"requests", fmt.Sprintf("%d retries=%d failed=%d", m.requests, retries, m.requestsFailed)},
+		{"samples_failed", fmt.Sprint(m.samplesFailed)},
+		{"samples_dropped", fmt.Sprint(m.samplesDropped + m.samplesExpired)},
+		{"flushes", fmt.Sprintf("%d avg=%s skipped=%d", m.flushes, avgFlush.Round(time.Microsecond), m.flushesSkipped)},
+	}
+	m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("\n     output-prometheus-remote\n\n")
+	for _, row := range rows {
+		dots := summaryNameWidth - len(row[0])
+		if dots < 1 {
+			dots = 1
+		}
+		fmt.Fprintf(&b, "     %s%s: %s\n", row[0], strings.Repeat(".", dots), row[1])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatBytes formats n with a decimal unit, as k6 does for data_sent.
+func formatBytes(n uint64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "kMGT"[exp])
+}
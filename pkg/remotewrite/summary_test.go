@@ -0,0 +1,50 @@
+package remotewrite
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfMetricsWriteSummary(t *testing.T) {
+	t.Parallel()
+
+	m := newSelfMetrics()
+	m.addSeriesSent(120)
+	m.addBytesSent(2500)
+	for i := 0; i < 4; i++ {
+		m.addRequest()
+	}
+	m.addRequestError(errorClassServer)
+	m.addRequestError(errorClassServer)
+	m.addRequestFailed()
+	m.addSamplesFailed(10)
+	m.addSamplesDropped(3)
+	m.observeFlush(100, 10*time.Millisecond)
+	m.observeFlush(100, 30*time.Millisecond)
+
+	var b bytes.Buffer
+	require.NoError(t, m.writeSummary(&b))
+	assert.Equal(t, `
+     output-prometheus-remote
+
+     series_sent.............: 120
+     bytes_sent..............: 2.5 kB
+     requests................: 4 retries=1 failed=1
+     samples_failed..........: 10
+     samples_dropped.........: 3
+     flushes.................: 2 avg=20ms skipped=0
+`, b.String())
+}
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "999 B", formatBytes(999))
+	assert.Equal(t, "1.0 kB", formatBytes(1000))
+	assert.Equal(t, "12.3 MB", formatBytes(12_345_678))
+	assert.Equal(t, "4.0 GB", formatBytes(4e9))
+}
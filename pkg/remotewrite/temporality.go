@@ -0,0 +1,57 @@
+package remotewrite
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/prompb"
+	"go.k6.io/k6/metrics"
+)
+
+// temporality is whether the Counter and Rate series are sent as running
+// totals since the start of the test or as the increments of each flush.
+type temporality string
+
+const (
+	temporalityCumulative temporality = "cumulative"
+	temporalityDelta      temporality = "delta"
+)
+
+func parseTemporality(t string) (temporality, error) {
+	switch tt := temporality(t); tt {
+	case temporalityCumulative, temporalityDelta:
+		return tt, nil
+	default:
+		return "", fmt.Errorf("invalid temporality %q, it must be cumulative or delta", t)
+	}
+}
+
+// delta reports whether the series of the metric type are sent as per-flush increments.
+func (t temporality) delta(metricType metrics.MetricType) bool {
+	return t == temporalityDelta && (metricType == metrics.Counter || metricType == metrics.Rate)
+}
+
+// resetDeltas starts the Counter and Rate metrics from zero again,
+// so that the next values are the increments since the previous flush.
+func (ms *MetricsStorage) resetDeltas() {
+	for key, m := range ms.m {
+		if m.Type == metrics.Counter || m.Type == metrics.Rate {
+			delete(ms.m, key)
+		}
+	}
+}
+
+// addLatest adds ts to the aggregated series, replacing the samples already
+// added for the same label set: with delta temporality only the value of the
+// whole flush, i.e. the latest one, is sent.
+func (a *seriesAggregator) addLatest(ts prompb.TimeSeries) {
+	a.key = appendLabelsKey(a.key[:0], ts.Labels)
+
+	i, ok := a.index[string(a.key)]
+	if !ok {
+		a.add(ts)
+		return
+	}
+	a.samples -= len(a.series[i].Samples)
+	a.count(ts)
+	a.series[i].Samples = append(a.series[i].Samples[:0], ts.Samples...)
+}
@@ -0,0 +1,86 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestParseTemporality(t *testing.T) {
+	t.Parallel()
+
+	for _, valid := range []string{"cumulative", "delta"} {
+		tt, err := parseTemporality(valid)
+		require.NoError(t, err)
+		assert.Equal(t, temporality(valid), tt)
+	}
+	_, err := parseTemporality("")
+	assert.Error(t, err)
+	_, err = parseTemporality("gauge")
+	assert.Error(t, err)
+}
+
+func TestConvertToTimeSeriesTemporality(t *testing.T) {
+	t.Parallel()
+
+	reqs := &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}
+	failed := &metrics.Metric{Name: "http_req_failed", Type: metrics.Rate}
+	vus := &metrics.Metric{Name: "vus", Type: metrics.Gauge}
+	start := time.Unix(1000, 0)
+	flush := func(offset time.Duration) []metrics.SampleContainer {
+		return []metrics.SampleContainer{metrics.Samples{
+			{Metric: reqs, Time: start.Add(offset), Value: 1},
+			{Metric: failed, Time: start.Add(offset), Value: 1},
+			{Metric: vus, Time: start.Add(offset), Value: 5},
+			{Metric: reqs, Time: start.Add(offset + time.Second), Value: 2},
+			{Metric: failed, Time: start.Add(offset + time.Second), Value: 0},
+			{Metric: vus, Time: start.Add(offset + time.Second), Value: 6},
+		}}
+	}
+
+	samples := func(ts []prompb.TimeSeries, name string) []prompb.Sample {
+		for _, s := range ts {
+			if hasLabelValue(s.Labels, "__name__", name) {
+				return s.Samples
+			}
+		}
+		return nil
+	}
+
+	for tt, expected := range map[temporality][][]prompb.Sample{
+		temporalityCumulative: {
+			{{Value: 1, Timestamp: 1000000}, {Value: 3, Timestamp: 1001000}},
+			{{Value: 4, Timestamp: 1002000}, {Value: 6, Timestamp: 1003000}},
+		},
+		temporalityDelta: {
+			{{Value: 3, Timestamp: 1001000}},
+			{{Value: 3, Timestamp: 1003000}},
+		},
+	} {
+		config := NewConfig()
+		config.Temporality = null.StringFrom(string(tt))
+		o := &Output{
+			config:  config,
+			metrics: newMetricsStorage(),
+			mapping: NewMapping(config),
+			logger:  logrus.New(),
+		}
+
+		first := o.convertToTimeSeries(flush(0))
+		second := o.convertToTimeSeries(flush(2 * time.Second))
+		assert.Equal(t, expected[0], samples(first, "k6_http_reqs"), tt)
+		assert.Equal(t, expected[1], samples(second, "k6_http_reqs"), tt)
+		// gauges are not affected
+		assert.Len(t, samples(second, "k6_vus"), 2, tt)
+
+		if tt == temporalityDelta {
+			assert.Equal(t, []prompb.Sample{{Value: 0.5, Timestamp: 1003000}}, samples(second, "k6_http_req_failed"))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package remotewrite
+
+import (
+	"net/url"
+	"path/filepath"
+
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/sirupsen/logrus"
+)
+
+// TenantRoute sends the series whose TenantTag label has the given value to
+// their own tenant, sent as X-Scope-OrgID, and optionally to their own endpoint.
+type TenantRoute struct {
+	Value    string `json:"value"`
+	TenantID string `json:"tenantID,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+// tagKeptAsLabel reports whether the tag is sent as label, as tagsToLabels does.
+func tagKeptAsLabel(name string, config Config) bool {
+	if include, ok := scenarioGroupTag(name, config); ok {
+		return include
+	}
+	return config.KeepTags.Bool && tagAsLabel(name, config)
+}
+
+// newTenantRoutes returns the routes by tag value. Without their own URL, the routes
+// use the failover and mirror URLs of the default tenant, with their tenant header.
+func newTenantRoutes(
+	conf *remote.ClientConfig, p protocol, config Config, logger logrus.FieldLogger, self *selfMetrics,
+) (map[string]*endpointRoute, error) {
+	if len(config.TenantRoutes) == 0 {
+		return nil, nil
+	}
+
+	routes := make(map[string]*endpointRoute, len(config.TenantRoutes))
+	for _, r := range config.TenantRoutes {
+		routeConf := *conf
+		if r.TenantID != "" {
+			routeConf.Headers = make(map[string]string, len(conf.Headers)+1)
+			for k, v := range conf.Headers {
+				routeConf.Headers[k] = v
+			}
+			routeConf.Headers[tenantHeader] = r.TenantID
+		}
+
+		name := "tenant-" + r.Value
+		walDir := filepath.Join("tenants", url.PathEscape(r.Value))
+		route, err := newEndpointRoute(name, &routeConf, r.URL, walDir, p, config, logger, self)
+		if err != nil {
+			return nil, err
+		}
+		routes[r.Value] = route
+	}
+	return routes, nil
+}
@@ -0,0 +1,120 @@
+package remotewrite
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestOutputTenantRoutes(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		received = map[string][]string{}
+	)
+	handler := func(server string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			decoded, err := snappy.Decode(nil, body)
+			require.NoError(t, err)
+			var req prompb.WriteRequest
+			require.NoError(t, req.Unmarshal(decoded))
+
+			mu.Lock()
+			defer mu.Unlock()
+			key := server + "/" + r.Header.Get(tenantHeader)
+			for _, ts := range req.Timeseries {
+				received[key] = append(received[key], ts.Labels[0].Value)
+			}
+			sort.Strings(received[key])
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+	primary := httptest.NewServer(handler("primary"))
+	defer primary.Close()
+	other := httptest.NewServer(handler("other"))
+	defer other.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(primary.URL)
+	config.TenantID = null.StringFrom("shared")
+	config.TenantTag = null.StringFrom("team")
+	config.TenantRoutes = []TenantRoute{
+		{Value: "checkout", TenantID: "team-checkout"},
+		{Value: "search", TenantID: "team-search", URL: other.URL},
+	}
+	config.WALDir = null.StringFrom(t.TempDir())
+	require.NoError(t, config.Validate())
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+	tenants, err := newTenantRoutes(remoteConfig, protocolV1, config, logrus.New(), newSelfMetrics())
+	require.NoError(t, err)
+	assert.DirExists(t, filepath.Join(config.WALDir.String, "tenants", "checkout"))
+
+	o := &Output{
+		config:  config,
+		client:  client,
+		tenants: tenants,
+		retry:   newRetryPolicy(config),
+		self:    newSelfMetrics(),
+		logger:  logrus.New(),
+	}
+
+	series := func(name, team string) prompb.TimeSeries {
+		labels := []prompb.Label{{Name: "__name__", Value: name}}
+		if team != "" {
+			labels = append(labels, prompb.Label{Name: "team", Value: team})
+		}
+		return prompb.TimeSeries{Labels: labels, Samples: []prompb.Sample{{Value: 1, Timestamp: 1}}}
+	}
+	require.NoError(t, o.write([]prompb.TimeSeries{
+		series("k6_a", "checkout"),
+		series("k6_b", "search"),
+		series("k6_c", "unknown"),
+		series("k6_d", ""),
+		series("k6_e", "checkout"),
+	}))
+
+	assert.Equal(t, map[string][]string{
+		"primary/team-checkout": {"k6_a", "k6_e"},
+		"other/team-search":     {"k6_b"},
+		"primary/shared":        {"k6_c", "k6_d"},
+	}, received)
+}
+
+func TestValidateTenantRoutes(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.TagsExclude = []string{"team"}
+	config.TenantTag = null.StringFrom("team")
+	config.TenantRoutes = []TenantRoute{
+		{Value: "checkout"},
+		{Value: "search", URL: "grpc://localhost:10901"},
+		{Value: "search", TenantID: "team-search"},
+	}
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, config.Validate(), &validationErr)
+	assert.Equal(t, []string{
+		`tenantTag "team" must be sent as a label to route the series: keep it in tagsAsLabels and out of tagsExclude`,
+		`tenant route "checkout" needs a tenantID, a url or both`,
+		`"grpc://localhost:10901" can't be used with url "http://localhost:9090/api/v1/write": all the endpoints must use HTTP`,
+		`tenant route "search" is set more than once`,
+	}, validationErr.Problems)
+}
@@ -0,0 +1,70 @@
+package remotewrite
+
+import (
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/consts"
+	"go.k6.io/k6/output"
+)
+
+// extensionModule is the module of the extension, whose version is read from the build info.
+const extensionModule = "github.com/grafana/xk6-output-prometheus-remote"
+
+// testInfoLabels returns the labels describing the test run added to the k6_test_info
+// series, so that the dashboards can join them with the test_run_id: the versions of
+// k6 and of the extension, the maximum number of VUs and the duration planned, and
+// the stages of the options, if any.
+func testInfoLabels(params output.Params) []prompb.Label {
+	labels := []prompb.Label{
+		{Name: "k6_version", Value: consts.Version},
+		{Name: "extension_version", Value: extensionVersion()},
+		{Name: "vus", Value: strconv.FormatUint(lib.GetMaxPlannedVUs(params.ExecutionPlan), 10)},
+	}
+	// the duration isn't known with the externally-controlled executor
+	if duration, final := lib.GetEndOffset(params.ExecutionPlan); final {
+		labels = append(labels, prompb.Label{Name: "duration", Value: duration.String()})
+	}
+	if stages := formatStages(params.ScriptOptions.Stages); stages != "" {
+		labels = append(labels, prompb.Label{Name: "stages", Value: stages})
+	}
+	return labels
+}
+
+// extensionVersion returns the version of the extension built into k6, (devel) when
+// it's built from a local checkout.
+func extensionVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(unknown)"
+	}
+	if info.Main.Path == extensionModule {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == extensionModule {
+			// e.g. replaced with a local checkout by xk6 build --with
+			if dep.Replace != nil {
+				if dep.Replace.Version == "" {
+					return "(devel)"
+				}
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "(unknown)"
+}
+
+// formatStages formats the stages as in the K6_STAGES env, e.g. 30s:10,1m0s:20.
+func formatStages(stages []lib.Stage) string {
+	parts := make([]string, 0, len(stages))
+	for _, s := range stages {
+		parts = append(parts, time.Duration(s.Duration.Duration).String()+":"+strconv.FormatInt(s.Target.Int64, 10))
+	}
+	return strings.Join(parts, ",")
+}
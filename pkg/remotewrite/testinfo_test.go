@@ -0,0 +1,39 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/output"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestTestInfoLabels(t *testing.T) {
+	t.Parallel()
+
+	labels := testInfoLabels(output.Params{
+		ScriptOptions: lib.Options{
+			Stages: []lib.Stage{
+				{Duration: types.NullDurationFrom(30 * time.Second), Target: null.IntFrom(10)},
+				{Duration: types.NullDurationFrom(time.Minute), Target: null.IntFrom(20)},
+			},
+		},
+		ExecutionPlan: []lib.ExecutionStep{
+			{TimeOffset: 0, PlannedVUs: 1},
+			{TimeOffset: 30 * time.Second, PlannedVUs: 20},
+			{TimeOffset: 90 * time.Second, PlannedVUs: 0},
+		},
+	})
+	assert.Equal(t, []prompb.Label{
+		{Name: "k6_version", Value: "0.38.0"},
+		{Name: "extension_version", Value: extensionVersion()},
+		{Name: "vus", Value: "20"},
+		{Name: "duration", Value: "1m30s"},
+		{Name: "stages", Value: "30s:10,1m0s:20"},
+	}, labels)
+	assert.NotEmpty(t, extensionVersion())
+}
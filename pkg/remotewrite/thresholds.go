@@ -0,0 +1,194 @@
+package remotewrite
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"go.k6.io/k6/metrics"
+)
+
+// thresholdTracker evaluates the thresholds of the test on the samples seen by
+// the output, as k6 doesn't share the results of its own evaluation with outputs.
+// It is safe for concurrent use and its methods are no-ops on a nil receiver.
+type thresholdTracker struct {
+	mu      sync.Mutex
+	started time.Time
+	entries []*thresholdEntry
+}
+
+// thresholdEntry holds the thresholds of a metric or submetric, e.g. http_req_duration{status:200}.
+type thresholdEntry struct {
+	name       string
+	metric     string
+	tags       map[string]string
+	thresholds metrics.Thresholds
+	sink       metrics.Sink
+}
+
+// newThresholdTracker returns a tracker for the thresholds as configured in the script.
+// The invalid ones are returned as errors, k6 itself refuses to start with them.
+func newThresholdTracker(thresholds map[string]metrics.Thresholds, started time.Time) (*thresholdTracker, []error) {
+	tracker := &thresholdTracker{started: started}
+
+	var errs []error
+	for name, ts := range thresholds {
+		metric, tagValues, err := metrics.ParseMetricName(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		tags := make(map[string]string, len(tagValues))
+		for _, tagValue := range tagValues {
+			kv := strings.SplitN(tagValue, ":", 2)
+			tags[strings.Trim(strings.TrimSpace(kv[0]), `"'`)] = strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+		}
+
+		// our own copies are evaluated, so the results of the engine aren't touched
+		sources := make([]string, 0, len(ts.Thresholds))
+		for _, t := range ts.Thresholds {
+			sources = append(sources, t.Source)
+		}
+		own := metrics.NewThresholds(sources)
+		if err := own.Parse(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		tracker.entries = append(tracker.entries, &thresholdEntry{
+			name:       name,
+			metric:     metric,
+			tags:       tags,
+			thresholds: own,
+		})
+	}
+
+	sort.Slice(tracker.entries, func(i, j int) bool {
+		return tracker.entries[i].name < tracker.entries[j].name
+	})
+
+	return tracker, errs
+}
+
+// add aggregates the samples of the metrics with thresholds.
+func (t *thresholdTracker) add(samplesContainers []metrics.SampleContainer) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, samplesContainer := range samplesContainers {
+		for _, sample := range samplesContainer.GetSamples() {
+			for _, entry := range t.entries {
+				if !entry.matches(sample) {
+					continue
+				}
+				if entry.sink == nil {
+					entry.sink = newSink(sample.Metric.Type)
+				}
+				entry.sink.Add(sample)
+			}
+		}
+	}
+}
+
+func (e *thresholdEntry) matches(sample metrics.Sample) bool {
+	if sample.Metric == nil || sample.Metric.Name != e.metric {
+		return false
+	}
+	for k, v := range e.tags {
+		if sample.Tags == nil {
+			return false
+		}
+		if value, ok := sample.Tags.Get(k); !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// timeSeries evaluates the thresholds and returns, for each of them, a
+// prefix+"threshold" series that is 1 if it passes and 0 if it fails, and a
+// prefix+"threshold_value" series with the value it's evaluated on. The series
+// are labeled with the threshold expression (name) and its metric.
+// Thresholds of metrics without samples yet are not evaluated.
+func (t *thresholdTracker) timeSeries(now time.Time, labels []prompb.Label, prefix string) []prompb.TimeSeries {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	elapsed := now.Sub(t.started)
+	ts := timestamp.FromTime(now)
+
+	var series []prompb.TimeSeries
+	for _, entry := range t.entries {
+		if entry.sink == nil {
+			continue
+		}
+
+		entry.sink.Calc()
+		// errors are from aggregation methods not supported by the metric, k6 rejects them
+		if _, err := entry.thresholds.Run(entry.sink, elapsed); err != nil {
+			continue
+		}
+
+		for _, threshold := range entry.thresholds.Thresholds {
+			passed := 1.0
+			if threshold.LastFailed {
+				passed = 0
+			}
+
+			thresholdLabels := append(labels[:len(labels):len(labels)],
+				prompb.Label{Name: "name", Value: threshold.Source},
+				prompb.Label{Name: "metric", Value: entry.name},
+			)
+			series = append(series,
+				thresholdSeries(thresholdLabels, prefix+"threshold", passed, ts),
+				thresholdSeries(thresholdLabels, prefix+"threshold_value",
+					thresholdValue(entry.sink, threshold.Source, elapsed), ts),
+			)
+		}
+	}
+	return series
+}
+
+func thresholdSeries(labels []prompb.Label, name string, value float64, ts int64) prompb.TimeSeries {
+	return prompb.TimeSeries{
+		Labels: append(labels[:len(labels):len(labels)], prompb.Label{
+			Name:  "__name__",
+			Value: name,
+		}),
+		Samples: []prompb.Sample{
+			{
+				Value:     value,
+				Timestamp: ts,
+			},
+		},
+	}
+}
+
+// thresholdValue returns the value of the aggregation method of the
+// threshold expression, e.g. p(95) for `p(95) < 500`.
+func thresholdValue(sink metrics.Sink, source string, elapsed time.Duration) float64 {
+	aggregation := source
+	if i := strings.IndexAny(source, "<>=!"); i >= 0 {
+		aggregation = source[:i]
+	}
+	aggregation = strings.ReplaceAll(aggregation, " ", "")
+
+	if trend, ok := sink.(*metrics.TrendSink); ok && strings.HasPrefix(aggregation, "p(") {
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(aggregation, "p("), ")"), 64)
+		if err == nil {
+			return trend.P(pct / 100)
+		}
+	}
+	return sink.Format(elapsed)[aggregation]
+}
@@ -0,0 +1,79 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+)
+
+func TestThresholdTracker(t *testing.T) {
+	t.Parallel()
+
+	started := time.Now()
+	tracker, errs := newThresholdTracker(map[string]metrics.Thresholds{
+		"http_req_duration":               metrics.NewThresholds([]string{"p(95)<300", "avg < 1000"}),
+		"http_req_duration{status:500}":   metrics.NewThresholds([]string{"count<1"}),
+		"http_req_failed":                 metrics.NewThresholds([]string{"rate<0.01"}),
+		"http_req_duration{malformed":     metrics.NewThresholds([]string{"max<1"}),
+		"iteration_duration":              metrics.NewThresholds([]string{"unknown(1)<1"}),
+		"data_received{scenario:default}": metrics.NewThresholds([]string{"count>0"}),
+	}, started)
+	assert.Len(t, errs, 2)
+
+	duration := &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend}
+	failed := &metrics.Metric{Name: "http_req_failed", Type: metrics.Rate}
+	ok := metrics.NewSampleTags(map[string]string{"status": "200"})
+	serverError := metrics.NewSampleTags(map[string]string{"status": "500"})
+
+	var samples metrics.Samples
+	for i := 1; i <= 100; i++ {
+		samples = append(samples, metrics.Sample{Metric: duration, Tags: ok, Value: float64(i * 10), Time: started})
+		samples = append(samples, metrics.Sample{Metric: failed, Tags: ok, Value: 0, Time: started})
+	}
+	samples = append(samples, metrics.Sample{Metric: failed, Tags: serverError, Value: 1, Time: started})
+	tracker.add([]metrics.SampleContainer{samples})
+
+	now := started.Add(time.Minute)
+	series := tracker.timeSeries(now, []prompb.Label{{Name: "test_run_id", Value: "abc"}}, "k6_")
+
+	value := func(name, threshold string) (float64, bool) {
+		for _, ts := range series {
+			if hasLabelValue(ts.Labels, "__name__", name) && hasLabelValue(ts.Labels, "name", threshold) {
+				require.True(t, hasLabelValue(ts.Labels, "test_run_id", "abc"))
+				require.Len(t, ts.Samples, 1)
+				assert.Equal(t, now.UnixMilli(), ts.Samples[0].Timestamp)
+				return ts.Samples[0].Value, true
+			}
+		}
+		return 0, false
+	}
+
+	// p(95) is 950
+	passed, found := value("k6_threshold", "p(95)<300")
+	assert.True(t, found)
+	assert.Equal(t, 0.0, passed)
+	v, _ := value("k6_threshold_value", "p(95)<300")
+	assert.InDelta(t, 950.5, v, 0.001)
+
+	passed, _ = value("k6_threshold", "avg < 1000")
+	assert.Equal(t, 1.0, passed)
+	v, _ = value("k6_threshold_value", "avg < 1000")
+	assert.Equal(t, 505.0, v)
+
+	passed, _ = value("k6_threshold", "rate<0.01")
+	assert.Equal(t, 1.0, passed)
+	v, _ = value("k6_threshold_value", "rate<0.01")
+	assert.InDelta(t, 1.0/101, v, 0.0001)
+
+	// thresholds of metrics without samples are not evaluated
+	_, found = value("k6_threshold", "count<1")
+	assert.False(t, found)
+	_, found = value("k6_threshold", "count>0")
+	assert.False(t, found)
+
+	assert.Nil(t, (*thresholdTracker)(nil).timeSeries(now, nil, "k6_"))
+}
@@ -0,0 +1,30 @@
+package remotewrite
+
+import (
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// sampleTime returns the time the sample is sent with: the time of the flush
+// for the mappings other than the raw ones with FlushTimestamps, its own time
+// corrected with the clock offset otherwise, aligned to TimestampPrecision. The
+// mappings other than the raw ones aggregate the samples, so that the samples
+// of a series in a flush then give a single one.
+func (o *Output) sampleTime(sample metrics.Sample, flushTime time.Time) time.Time {
+	t := sample.Time.Add(o.clockOffset)
+	if o.config.FlushTimestamps.Bool && !isRawMapping(o.mapping) {
+		t = flushTime
+	}
+	return alignTime(t, time.Duration(o.config.TimestampPrecision.Duration))
+}
+
+// alignTime truncates t to a multiple of precision since the Unix epoch,
+// it's returned as is if precision is not positive.
+func alignTime(t time.Time, precision time.Duration) time.Time {
+	if precision <= 0 {
+		return t
+	}
+	ns := t.UnixNano()
+	return time.Unix(0, ns-ns%int64(precision))
+}
@@ -0,0 +1,94 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestAlignTime(t *testing.T) {
+	t.Parallel()
+
+	at := time.UnixMilli(1_700_000_001_234)
+	testCases := map[time.Duration]int64{
+		0:                     1_700_000_001_234,
+		time.Millisecond:      1_700_000_001_234,
+		10 * time.Millisecond: 1_700_000_001_230,
+		time.Second:           1_700_000_001_000,
+		time.Minute:           1_699_999_980_000,
+	}
+	for precision, expected := range testCases {
+		assert.Equal(t, expected, timestamp.FromTime(alignTime(at, precision)), precision)
+	}
+}
+
+func TestConvertToTimeSeriesTimestamps(t *testing.T) {
+	t.Parallel()
+
+	metric := &metrics.Metric{Name: "vus", Type: metrics.Gauge}
+	tags := metrics.NewSampleTags(map[string]string{"scenario": "default"})
+	start := time.UnixMilli(1_700_000_001_200)
+	samples := []metrics.SampleContainer{metrics.Samples{
+		{Metric: metric, Tags: tags, Time: start, Value: 1},
+		{Metric: metric, Tags: tags, Time: start.Add(500 * time.Millisecond), Value: 2},
+		{Metric: metric, Tags: tags, Time: start.Add(900 * time.Millisecond), Value: 3},
+	}}
+	flushTime := start.Add(2 * time.Second)
+
+	testCases := map[string]struct {
+		mapping   string
+		precision time.Duration
+		flush     bool
+		expected  []prompb.Sample
+	}{
+		"precision": {
+			mapping:   "raw",
+			precision: time.Second,
+			expected:  []prompb.Sample{{Value: 2, Timestamp: 1_700_000_001_000}, {Value: 3, Timestamp: 1_700_000_002_000}},
+		},
+		"raw-all-precision": {
+			mapping:   "raw-all",
+			precision: time.Second,
+			expected: []prompb.Sample{
+				{Value: 1, Timestamp: 1_700_000_001_000},
+				{Value: 2, Timestamp: 1_700_000_002_000},
+				{Value: 3, Timestamp: 1_700_000_003_000},
+			},
+		},
+		"flush-time": {
+			mapping:  "prometheus",
+			flush:    true,
+			expected: []prompb.Sample{{Value: 3, Timestamp: 1_700_000_003_200}},
+		},
+		"flush-time-precision": {
+			mapping:   "prometheus",
+			precision: time.Second,
+			flush:     true,
+			expected:  []prompb.Sample{{Value: 3, Timestamp: 1_700_000_003_000}},
+		},
+	}
+	for name, tc := range testCases {
+		config := NewConfig()
+		config.Mapping = null.StringFrom(tc.mapping)
+		config.TimestampPrecision = types.NullDurationFrom(tc.precision)
+		config.FlushTimestamps = null.BoolFrom(tc.flush)
+		o := &Output{
+			config:  config,
+			metrics: newMetricsStorage(),
+			mapping: NewMapping(config),
+			logger:  logrus.New(),
+		}
+
+		ts := o.convertToTimeSeriesAt(samples, flushTime)
+		require.Len(t, ts, 1, name)
+		assert.Equal(t, tc.expected, ts[0].Samples, name)
+	}
+}
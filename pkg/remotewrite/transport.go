@@ -0,0 +1,179 @@
+package remotewrite
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	promConfig "github.com/prometheus/common/config"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/http2"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// transportConfig holds the connection settings of the clients that are not
+// part of the Prometheus HTTP client config.
+type transportConfig struct {
+	disableKeepAlives bool
+	// maxIdleConns is the maximum number of idle connections kept open, zero means no limit.
+	maxIdleConns    int
+	idleConnTimeout time.Duration
+	// tokenSource returns the source of the bearer tokens of the requests, those of
+	// Azure AD or Google, fetched with the client. It's nil with the other authentications.
+	tokenSource func(client *http.Client) oauth2.TokenSource
+	// fileHeaders reads the headers set from files again every refreshInterval, it's
+	// nil unless there are such headers and CredentialsRefresh is set.
+	fileHeaders     func() (map[string]string, error)
+	refreshInterval time.Duration
+}
+
+func (conf Config) transportConfig() transportConfig {
+	return transportConfig{
+		disableKeepAlives: !conf.KeepAlive.Bool,
+		maxIdleConns:      int(conf.MaxIdleConns.Int64),
+		idleConnTimeout:   time.Duration(conf.IdleConnTimeout.Duration),
+		tokenSource:       conf.tokenSource(),
+		fileHeaders:       conf.rotatedHeaders(),
+		refreshInterval:   time.Duration(conf.CredentialsRefresh.Duration),
+	}
+}
+
+// tokenSource returns the source of the tokens of the cloud providers, nil without them.
+func (conf Config) tokenSource() func(client *http.Client) oauth2.TokenSource {
+	if conf.GoogleAuth.Bool {
+		return newGoogleTokenSource
+	}
+	return conf.azureTokenSource()
+}
+
+// newHTTPClient returns a client for the HTTP config. It's built like the one
+// of prometheus/common, which doesn't allow to configure the connection pool.
+func newHTTPClient(cfg promConfig.HTTPClientConfig, tc transportConfig) (*http.Client, error) {
+	newRT := func(tlsConfig *tls.Config) (http.RoundTripper, error) {
+		maxIdleConnsPerHost := tc.maxIdleConns
+		if maxIdleConnsPerHost == 0 {
+			// the transport keeps only 2 idle connections per host otherwise
+			maxIdleConnsPerHost = 1000
+		}
+
+		transport := &http.Transport{
+			Proxy:                 proxyFunc(cfg.ProxyURL.URL),
+			MaxIdleConns:          tc.maxIdleConns,
+			MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+			DisableKeepAlives:     tc.disableKeepAlives,
+			TLSClientConfig:       tlsConfig,
+			DisableCompression:    true,
+			IdleConnTimeout:       tc.idleConnTimeout,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+		}
+		if cfg.EnableHTTP2 {
+			http2Transport, err := http2.ConfigureTransports(transport)
+			if err != nil {
+				return nil, err
+			}
+			// detect dead connections, see https://github.com/golang/go/issues/39337
+			http2Transport.ReadIdleTimeout = time.Minute
+		}
+
+		var rt http.RoundTripper = transport
+		switch {
+		case tc.tokenSource != nil:
+			rt = &oauth2.Transport{
+				Base:   rt,
+				Source: tc.tokenSource(&http.Client{Transport: transport}),
+			}
+		case cfg.Authorization != nil && cfg.Authorization.CredentialsFile != "":
+			rt = promConfig.NewAuthorizationCredentialsFileRoundTripper(
+				cfg.Authorization.Type, cfg.Authorization.CredentialsFile, rt)
+		case cfg.Authorization != nil:
+			rt = promConfig.NewAuthorizationCredentialsRoundTripper(cfg.Authorization.Type, cfg.Authorization.Credentials, rt)
+		case cfg.BasicAuth != nil:
+			rt = promConfig.NewBasicAuthRoundTripper(
+				cfg.BasicAuth.Username, cfg.BasicAuth.Password, cfg.BasicAuth.PasswordFile, rt)
+		case cfg.OAuth2 != nil:
+			// the token endpoint shares the TLS configuration of the remote endpoint,
+			// so tokens are fetched through the same transport
+			tokenClient := &http.Client{Transport: transport}
+			rt = &oauth2.Transport{
+				Base:   rt,
+				Source: oauth2TokenSource(cfg.OAuth2, tokenClient),
+			}
+		}
+		return rt, nil
+	}
+
+	tlsConfig, err := promConfig.NewTLSConfig(&cfg.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var rt http.RoundTripper
+	if cfg.TLSConfig.CAFile == "" {
+		rt, err = newRT(tlsConfig)
+	} else {
+		// reloads the CA file when it changes
+		rt, err = promConfig.NewTLSRoundTripper(tlsConfig, cfg.TLSConfig.CAFile, newRT)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if tc.fileHeaders != nil {
+		rt, err = newRotatingHeaders(rt, tc.fileHeaders, tc.refreshInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	client := &http.Client{Transport: rt}
+	if !cfg.FollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client, nil
+}
+
+// proxyFunc returns the proxy selection of the transport: the proxy is proxyURL,
+// if not nil, or else the one configured in the environment. Either way, the
+// hosts in NO_PROXY are reached directly. The transport authenticates to the
+// proxy with the credentials in its URL, if any.
+func proxyFunc(proxyURL *url.URL) func(*http.Request) (*url.URL, error) {
+	proxyConfig := httpproxy.FromEnvironment()
+	if proxyURL != nil {
+		proxyConfig.HTTPProxy = proxyURL.String()
+		proxyConfig.HTTPSProxy = proxyURL.String()
+	}
+
+	proxy := proxyConfig.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+// oauth2TokenSource returns the source of the tokens of the client credentials flow,
+// they are cached until they expire.
+func oauth2TokenSource(cfg *promConfig.OAuth2, client *http.Client) oauth2.TokenSource {
+	params := make(url.Values, len(cfg.EndpointParams))
+	for k, v := range cfg.EndpointParams {
+		params.Set(k, v)
+	}
+
+	ccConfig := &clientcredentials.Config{
+		ClientID:       cfg.ClientID,
+		ClientSecret:   string(cfg.ClientSecret),
+		TokenURL:       cfg.TokenURL,
+		Scopes:         cfg.Scopes,
+		EndpointParams: params,
+	}
+	return ccConfig.TokenSource(context.WithValue(context.Background(), oauth2.HTTPClient, client))
+}
@@ -0,0 +1,157 @@
+package remotewrite
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestHTTPClientKeepAlive(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu    sync.Mutex
+		conns = make(map[string]struct{})
+	)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns[conn.RemoteAddr().String()] = struct{}{}
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	connsFor := func(keepAlive bool) int {
+		mu.Lock()
+		conns = make(map[string]struct{})
+		mu.Unlock()
+
+		config := NewConfig()
+		config.Url = null.StringFrom(server.URL)
+		config.KeepAlive = null.BoolFrom(keepAlive)
+
+		remoteConfig, err := config.ConstructRemoteConfig()
+		require.NoError(t, err)
+		client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, client.Store(context.Background(), []byte("payload")))
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		return len(conns)
+	}
+
+	assert.Equal(t, 1, connsFor(true))
+	assert.Equal(t, 3, connsFor(false))
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	t.Parallel()
+
+	var (
+		target             string
+		proxyAuthorization string
+	)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target = r.URL.String()
+		proxyAuthorization = r.Header.Get("Proxy-Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	proxyURL.User = url.UserPassword("user", "pass")
+
+	config := NewConfig()
+	config.Url = null.StringFrom("http://remote.example.com/api/v1/write")
+	config.ProxyURL = null.StringFrom(proxyURL.String())
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	require.NoError(t, client.Store(context.Background(), []byte("payload")))
+	assert.Equal(t, "http://remote.example.com/api/v1/write", target)
+	assert.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("user:pass")), proxyAuthorization)
+}
+
+// TestProxyFuncEnvironment can't run in parallel as it sets environment variables.
+func TestProxyFuncEnvironment(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "http://env-proxy:3128")
+	t.Setenv("NO_PROXY", "internal.example.com")
+
+	proxyFor := func(proxyURL *url.URL, target string) *url.URL {
+		req, err := http.NewRequest(http.MethodPost, target, nil)
+		require.NoError(t, err)
+		proxy, err := proxyFunc(proxyURL)(req)
+		require.NoError(t, err)
+		return proxy
+	}
+
+	assert.Equal(t, "http://env-proxy:3128", proxyFor(nil, "https://remote.example.com").String())
+	assert.Nil(t, proxyFor(nil, "https://internal.example.com"))
+
+	configured := &url.URL{Scheme: "http", Host: "proxy:8080"}
+	assert.Equal(t, configured, proxyFor(configured, "https://remote.example.com"))
+	assert.Nil(t, proxyFor(configured, "https://internal.example.com"))
+}
+
+func TestHTTPClientOAuth2(t *testing.T) {
+	t.Parallel()
+
+	var tokenRequests int
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		user, password, _ := r.BasicAuth()
+		if user != "k6" || password != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+	config.OAuth2TokenURL = null.StringFrom(tokenServer.URL)
+	config.OAuth2ClientID = null.StringFrom("k6")
+	config.OAuth2ClientSecret = null.StringFrom("secret")
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	require.NoError(t, client.Store(context.Background(), []byte("payload")))
+	require.NoError(t, client.Store(context.Background(), []byte("payload")))
+	assert.Equal(t, "Bearer token", authorization)
+	// the token is cached until it expires
+	assert.Equal(t, 1, tokenRequests)
+}
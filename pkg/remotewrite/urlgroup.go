@@ -0,0 +1,152 @@
+package remotewrite
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxGroupedURLs bounds the cache of the grouped URLs, it's emptied once full.
+const maxGroupedURLs = 10000
+
+// URLGroup replaces the parts of the url and name tags matching Match with
+// Replacement, which can refer to the groups of Match, e.g. $1.
+type URLGroup struct {
+	Match       string `json:"match"`
+	Replacement string `json:"replacement"`
+}
+
+var (
+	uuidSegment = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hashSegment = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// urlGrouper rewrites the url and name tags so that the URLs of the same endpoint,
+// e.g. /users/123 and /users/456, give the same label value, e.g. /users/:id.
+type urlGrouper struct {
+	rules   []urlGroupRule
+	builtin bool
+	// grouped caches the rewritten values as the same URLs are seen again and again
+	grouped map[string]string
+}
+
+type urlGroupRule struct {
+	match       *regexp.Regexp
+	replacement string
+}
+
+// newURLGrouper returns nil when neither the builtin rules nor URLGroups are enabled.
+func newURLGrouper(groups []URLGroup, builtin bool) (*urlGrouper, error) {
+	if len(groups) == 0 && !builtin {
+		return nil, nil
+	}
+	g := &urlGrouper{
+		rules:   make([]urlGroupRule, 0, len(groups)),
+		builtin: builtin,
+		grouped: make(map[string]string),
+	}
+	for _, group := range groups {
+		match, err := regexp.Compile(group.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url group match %q: %w", group.Match, err)
+		}
+		g.rules = append(g.rules, urlGroupRule{match: match, replacement: group.Replacement})
+	}
+	return g, nil
+}
+
+// groupsTag reports whether the values of the tag are grouped.
+func (g *urlGrouper) groupsTag(name string) bool {
+	return g != nil && (name == "url" || name == "name")
+}
+
+// group applies the configured rules, in order, then the builtin ones.
+func (g *urlGrouper) group(value string) string {
+	if grouped, ok := g.grouped[value]; ok {
+		return grouped
+	}
+
+	grouped := value
+	for _, rule := range g.rules {
+		grouped = rule.match.ReplaceAllString(grouped, rule.replacement)
+	}
+	if g.builtin {
+		grouped = groupURL(grouped)
+	}
+
+	if len(g.grouped) >= maxGroupedURLs {
+		g.grouped = make(map[string]string)
+	}
+	g.grouped[value] = grouped
+	return grouped
+}
+
+// groupURL replaces the segments of the path that are numbers, UUIDs or hashes with
+// :id, :uuid and :hash, and the values of the query string with :value. The scheme
+// and the host are kept as they are.
+func groupURL(u string) string {
+	start := 0
+	if i := strings.Index(u, "://"); i >= 0 {
+		j := strings.IndexByte(u[i+3:], '/')
+		if j < 0 {
+			return u
+		}
+		start = i + 3 + j
+	}
+	end := len(u)
+	if i := strings.IndexAny(u[start:], "?#"); i >= 0 {
+		end = start + i
+	}
+
+	segments := strings.Split(u[start:end], "/")
+	for i, segment := range segments {
+		segments[i] = groupSegment(segment)
+	}
+
+	var b strings.Builder
+	b.Grow(len(u))
+	b.WriteString(u[:start])
+	b.WriteString(strings.Join(segments, "/"))
+	if end < len(u) && u[end] == '?' {
+		query := u[end+1:]
+		// the fragment is dropped, it's not sent by the client anyway
+		if i := strings.IndexByte(query, '#'); i >= 0 {
+			query = query[:i]
+		}
+		b.WriteByte('?')
+		for i, param := range strings.Split(query, "&") {
+			if i > 0 {
+				b.WriteByte('&')
+			}
+			if k := strings.IndexByte(param, '='); k >= 0 {
+				param = param[:k] + "=:value"
+			}
+			b.WriteString(param)
+		}
+	}
+	return b.String()
+}
+
+func groupSegment(segment string) string {
+	switch {
+	case segment == "":
+		return segment
+	case isDigits(segment):
+		return ":id"
+	case uuidSegment.MatchString(segment):
+		return ":uuid"
+	case hashSegment.MatchString(segment):
+		return ":hash"
+	default:
+		return segment
+	}
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
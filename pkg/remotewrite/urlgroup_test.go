@@ -0,0 +1,63 @@
+package remotewrite
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestGroupURL(t *testing.T) {
+	t.Parallel()
+
+	for url, expected := range map[string]string{
+		"https://example.com/users/123":                                   "https://example.com/users/:id",
+		"https://example.com/users/123/orders/456":                        "https://example.com/users/:id/orders/:id",
+		"https://example.com/items/0b7a5e4c-8f3e-4c1d-9a6b-2f1e3d4c5b6a/": "https://example.com/items/:uuid/",
+		"https://example.com/blobs/9f86d081884c7d659a2feaa0c55ad015?v=2":  "https://example.com/blobs/:hash?v=:value",
+		"https://example.com/search?q=k6&page=3#results":                  "https://example.com/search?q=:value&page=:value",
+		"https://example.com/v2/users":                                    "https://example.com/v2/users",
+		"https://10.0.0.1:8080":                                           "https://10.0.0.1:8080",
+		"/users/42":                                                       "/users/:id",
+	} {
+		assert.Equal(t, expected, groupURL(url), url)
+	}
+}
+
+func TestTagsToLabelsURLGroups(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.TestRunID = null.StringFrom("")
+	config.KeepUrlTag = null.BoolFrom(true)
+	config.KeepNameTag = null.BoolFrom(true)
+	config.GroupURLs = null.BoolFrom(true)
+	config.URLGroups = []URLGroup{{Match: `/accounts/([a-z]+)-[0-9]+`, Replacement: "/accounts/$1-:id"}}
+	require.NoError(t, config.Validate())
+
+	urls, err := newURLGrouper(config.URLGroups, config.GroupURLs.Bool)
+	require.NoError(t, err)
+
+	tags := metrics.NewSampleTags(map[string]string{
+		"url":    "https://example.com/accounts/acme-7/users/12",
+		"name":   "https://example.com/accounts/acme-7/users/12",
+		"status": "200",
+	})
+	labels, err := tagsToLabels(tags, config, urls)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []prompb.Label{
+		{Name: "url", Value: "https://example.com/accounts/acme-:id/users/:id"},
+		{Name: "name", Value: "https://example.com/accounts/acme-:id/users/:id"},
+		{Name: "status", Value: "200"},
+	}, labels)
+
+	grouper, err := newURLGrouper(nil, false)
+	require.NoError(t, err)
+	assert.Nil(t, grouper)
+
+	config.URLGroups = []URLGroup{{Match: "/users/(", Replacement: "/users/:id"}}
+	assert.Error(t, config.Validate())
+}
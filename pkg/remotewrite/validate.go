@@ -0,0 +1,360 @@
+package remotewrite
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ValidationError reports all the problems found in a Config at once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid Prometheus remote write config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the options of the output before anything is started, so that
+// a misconfiguration is reported with a hint about how to fix it instead of
+// as an error later on. All the problems are reported in a *ValidationError.
+func (conf Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if conf.Preset.String != "" {
+		if _, err := parsePreset(conf.Preset.String); err != nil {
+			check(err)
+		} else if conf.Url.String == "" {
+			add("the %s preset needs the url of the endpoint, e.g. K6_PROMETHEUS_REMOTE_URL", conf.Preset.String)
+		}
+	}
+	if conf.GrafanaCloudStack.String != "" && conf.GrafanaCloudAPIKey.String == "" {
+		add("grafanaCloudStack needs grafanaCloudAPIKey, an access policy token with the metrics:write and stacks:read scopes")
+	}
+	check(validateEndpointURL("url", conf.Url.String))
+	for _, u := range conf.FailoverUrls {
+		check(validateEndpointURL("failoverUrls", u))
+	}
+	for _, u := range conf.MirrorUrls {
+		check(validateEndpointURL("mirrorUrls", u))
+	}
+	transport := endpointTransport(conf.Url.String)
+	for _, u := range append(append([]string{}, conf.FailoverUrls...), conf.MirrorUrls...) {
+		if endpointTransport(u) != transport {
+			add("%q can't be used with url %q: all the endpoints must use %s", u, conf.Url.String, transport)
+		}
+	}
+	switch transport {
+	case "gRPC":
+		if p, err := parseProtocol(conf.Protocol.String, conf.ProtocolVersion.String); err == nil && p != protocolV1 {
+			add("only the remote write 1.0 protocol can be sent over gRPC, unset protocol and protocolVersion")
+		}
+		if c := compression(conf.Compression.String); c != compressionDefault && c != compressionGzip && c != compressionNone {
+			add("compression %q isn't supported over gRPC, it must be gzip or none", c)
+		}
+		if conf.OAuth2TokenURL.Valid || conf.OAuth2ClientID.Valid {
+			add("OAuth2 isn't supported over gRPC: use bearerToken or user/password instead")
+		}
+		if conf.AzureAuth.String != "" || conf.GoogleAuth.Bool {
+			add("azureAuth and googleAuth aren't supported over gRPC: use bearerToken or user/password instead")
+		}
+	case "Graphite":
+		if p, err := parseProtocol(conf.Protocol.String, conf.ProtocolVersion.String); err == nil && p != protocolV1 {
+			add("the protocol is set by graphite:// URLs, unset protocol and protocolVersion")
+		}
+		if c := compression(conf.Compression.String); c != compressionDefault && c != compressionNone {
+			add("compression %q isn't supported by Graphite, unset it", c)
+		}
+	}
+	if len(conf.KafkaBrokers) > 0 {
+		if conf.KafkaTopic.String == "" {
+			add("kafkaTopic must be set with kafkaBrokers: set K6_PROMETHEUS_KAFKA_TOPIC")
+		}
+		if len(conf.FailoverUrls) > 0 || len(conf.MirrorUrls) > 0 {
+			add("failoverUrls and mirrorUrls can't be used with kafkaBrokers, the requests are only published to Kafka")
+		}
+		if conf.KafkaSASLMechanism.String != "" && conf.KafkaUser.String == "" {
+			add("kafkaSASLMechanism is set without kafkaUser: set K6_PROMETHEUS_KAFKA_USER too")
+		}
+		_, err := parseKafkaCompression(conf.KafkaCompression.String)
+		check(err)
+		_, err = parseKafkaSASL(conf.KafkaSASLMechanism.String, conf.KafkaUser.String, conf.KafkaPassword.String)
+		check(err)
+	}
+	if len(conf.TenantRoutes) > 0 {
+		switch {
+		case conf.TenantTag.String == "":
+			add("tenantRoutes are set without tenantTag: set K6_PROMETHEUS_TENANT_TAG to the tag the routes match")
+		case !tagKeptAsLabel(conf.TenantTag.String, conf):
+			add("tenantTag %q must be sent as a label to route the series: keep it in tagsAsLabels and out of tagsExclude",
+				conf.TenantTag.String)
+		}
+		if len(conf.KafkaBrokers) > 0 || conf.Protocol.String == string(protocolDatadog) {
+			add("tenantRoutes can't be used with kafkaBrokers or the datadog protocol")
+		}
+		seen := make(map[string]bool, len(conf.TenantRoutes))
+		for _, r := range conf.TenantRoutes {
+			switch {
+			case r.Value == "":
+				add("every tenant route needs the value of the tenant tag it matches")
+			case seen[r.Value]:
+				add("tenant route %q is set more than once", r.Value)
+			case r.TenantID == "" && r.URL == "":
+				add("tenant route %q needs a tenantID, a url or both", r.Value)
+			}
+			seen[r.Value] = true
+			if r.URL == "" {
+				continue
+			}
+			check(validateEndpointURL(fmt.Sprintf("tenant route %q url", r.Value), r.URL))
+			if endpointTransport(r.URL) != transport {
+				add("%q can't be used with url %q: all the endpoints must use %s", r.URL, conf.Url.String, transport)
+			}
+		}
+	}
+	for name, variable := range conf.LabelsFromEnv {
+		if !validName(name, false) {
+			add("labelsFromEnv label %q must be a valid label name, e.g. pod", name)
+		}
+		if variable == "" {
+			add("labelsFromEnv label %q needs the name of an environment variable, e.g. %s=POD_NAME", name, name)
+		}
+	}
+	if conf.JobLabel.Bool && conf.Job.String == "" {
+		add("job must not be empty with jobLabel, e.g. k6")
+	}
+	for _, g := range conf.URLGroups {
+		if _, err := regexp.Compile(g.Match); err != nil || g.Match == "" {
+			add("url group match %q must be a regular expression matching a part of the URLs, e.g. /users/[0-9]+", g.Match)
+		}
+	}
+	if len(conf.MetricRoutes) > 0 && (len(conf.KafkaBrokers) > 0 || conf.Protocol.String == string(protocolDatadog)) {
+		add("metricRoutes can't be used with kafkaBrokers or the datadog protocol")
+	}
+	for _, r := range conf.MetricRoutes {
+		if _, err := regexp.Compile(r.Match); err != nil || r.Match == "" {
+			add("metric route match %q must be a regular expression matching the names of the series, e.g. k6_http_req_.*", r.Match)
+		}
+		if r.URL == "" {
+			add("metric route %q needs a url", r.Match)
+			continue
+		}
+		check(validateEndpointURL(fmt.Sprintf("metric route %q url", r.Match), r.URL))
+		if endpointTransport(r.URL) != transport {
+			add("%q can't be used with url %q: all the endpoints must use %s", r.URL, conf.Url.String, transport)
+		}
+		if r.Password != "" && r.User == "" {
+			add("metric route %q has a password without user", r.Match)
+		}
+		if r.User != "" && r.BearerToken != "" {
+			add("metric route %q can use only one authentication method: keep either user/password or bearerToken", r.Match)
+		}
+	}
+	if conf.ProxyURL.Valid {
+		if _, err := url.Parse(conf.ProxyURL.String); err != nil {
+			add("proxyURL %q is not a valid URL: %v", conf.ProxyURL.String, err)
+		}
+	}
+
+	if d := time.Duration(conf.FlushPeriod.Duration); d <= 0 {
+		add("flushPeriod must be positive, e.g. 1s, got %s", d)
+	}
+	if d := time.Duration(conf.Timeout.Duration); d <= 0 {
+		add("timeout must be positive, e.g. 1m, got %s", d)
+	}
+	if conf.AdaptiveFlush.Bool {
+		min, max := time.Duration(conf.FlushPeriodMin.Duration), time.Duration(conf.FlushPeriodMax.Duration)
+		if min <= 0 {
+			add("flushPeriodMin must be positive with adaptiveFlush, e.g. 1s, got %s", min)
+		}
+		if max < min {
+			add("flushPeriodMax (%s) must not be less than flushPeriodMin (%s)", max, min)
+		}
+	}
+	if d := time.Duration(conf.AggregationWindow.Duration); d < 0 {
+		add("aggregationWindow must not be negative, e.g. 10s, got %s", d)
+	} else if d > 0 && conf.Temporality.String == string(temporalityDelta) {
+		add("aggregationWindow can't be used with delta temporality, the counters are aggregated as running totals")
+	}
+	if d := time.Duration(conf.CredentialsRefresh.Duration); d < 0 {
+		add("credentialsRefresh must not be negative, e.g. 1m, got %s", d)
+	}
+	if d := time.Duration(conf.TimestampPrecision.Duration); d < 0 || d%time.Millisecond != 0 {
+		add("timestampPrecision must be a multiple of 1ms, e.g. 10ms or 1s, got %s", d)
+	}
+	if conf.FlushTimestamps.Bool && (conf.Mapping.String == "raw" || conf.Mapping.String == "raw-all") {
+		add("flushTimestamps can't be used with the %s mapping, which doesn't aggregate the samples", conf.Mapping.String)
+	}
+	if conf.ClockSync.Bool && (endpointTransport(conf.Url.String) != "HTTP" || len(conf.KafkaBrokers) > 0) {
+		add("clockSync needs an HTTP endpoint to measure the clock offset against")
+	}
+	if addr := conf.DebugAddr.String; addr != "" && !isLoopbackAddr(addr) {
+		add("debugAddr must be a loopback address, e.g. localhost:6060, got %q", addr)
+	}
+	if conf.BufferMemoryLimit.Int64 < 0 {
+		add("bufferMemoryLimit must not be negative, e.g. 268435456 for 256MiB, got %d", conf.BufferMemoryLimit.Int64)
+	}
+	if conf.BufferSpillDir.String != "" && conf.BufferMemoryLimit.Int64 <= 0 {
+		add("bufferSpillDir needs bufferMemoryLimit, the memory beyond which the samples are spilled")
+	}
+	if conf.MaxSamplesPerFlush.Int64 < 0 {
+		add("maxSamplesPerFlush must not be negative, e.g. 150000, got %d", conf.MaxSamplesPerFlush.Int64)
+	}
+	if conf.StreamFlush.Bool {
+		if conf.MaxSamplesPerRequest.Int64 <= 0 {
+			add("streamFlush needs maxSamplesPerRequest, the size of the chunks, e.g. 10000")
+		}
+		if time.Duration(conf.AggregationWindow.Duration) > 0 {
+			add("streamFlush can't be used with aggregationWindow, which needs all the samples of the flush")
+		}
+		if conf.Temporality.String == string(temporalityDelta) {
+			add("streamFlush can't be used with the delta temporality, which sends a single value per flush")
+		}
+	}
+	if conf.BreakerThreshold.Int64 < 0 {
+		add("breakerThreshold must not be negative, e.g. 5 failed requests in a row, got %d", conf.BreakerThreshold.Int64)
+	}
+	if d := time.Duration(conf.BreakerCooldown.Duration); conf.BreakerThreshold.Int64 > 0 && d <= 0 {
+		add("breakerCooldown must be positive with breakerThreshold, e.g. 30s, got %s", d)
+	}
+	if conf.StopTestOnError.Int64 < 0 {
+		add("stopTestOnError must not be negative, e.g. 3 failed flushes in a row, got %d", conf.StopTestOnError.Int64)
+	}
+	if conf.Shards.Int64 < 1 {
+		add("shards must be at least 1, got %d", conf.Shards.Int64)
+	}
+
+	influx := conf.Protocol.String == string(protocolInfluxDB)
+	if influx && (conf.InfluxOrg.String == "" || conf.InfluxBucket.String == "") {
+		add("the influxdb protocol needs both influxOrg and influxBucket: set K6_PROMETHEUS_INFLUX_ORG and K6_PROMETHEUS_INFLUX_BUCKET")
+	}
+
+	if conf.Protocol.String == string(protocolDatadog) {
+		if conf.DatadogAPIKey.String == "" {
+			add("the datadog protocol needs an API key: set K6_PROMETHEUS_DATADOG_API_KEY")
+		}
+		if len(conf.FailoverUrls) > 0 || len(conf.MirrorUrls) > 0 || len(conf.KafkaBrokers) > 0 {
+			add("failoverUrls, mirrorUrls and kafkaBrokers can't be used with the datadog protocol, " +
+				"the trends are sent to the same site as the series")
+		}
+	}
+
+	basicAuth := conf.User.Valid || conf.Password.Valid || conf.PasswordFile.Valid
+	bearer := conf.BearerToken.Valid || conf.BearerTokenFile.Valid || (influx && conf.InfluxToken.Valid)
+	oauth2 := conf.OAuth2TokenURL.Valid || conf.OAuth2ClientID.Valid || conf.OAuth2ClientSecret.Valid
+	azure := conf.AzureAuth.String != ""
+	google := conf.GoogleAuth.Bool
+	if (conf.Password.Valid || conf.PasswordFile.Valid) && !conf.User.Valid {
+		add("password is set without user: set K6_PROMETHEUS_USER too")
+	}
+	if conf.Password.Valid && conf.PasswordFile.Valid {
+		add("password and passwordFile are both set: keep only one of them")
+	}
+	if conf.TenantID.Valid && conf.TenantIDFile.Valid {
+		add("tenantID and tenantIDFile are both set: keep only one of them")
+	}
+	for name := range conf.HeaderFiles {
+		if _, ok := conf.Headers[name]; ok {
+			add("header %q is set both in headers and headerFiles: keep only one of them", name)
+		}
+	}
+	if conf.BearerToken.Valid && conf.BearerTokenFile.Valid {
+		add("bearerToken and bearerTokenFile are both set: keep only one of them")
+	}
+	if oauth2 && (!conf.OAuth2TokenURL.Valid || !conf.OAuth2ClientID.Valid) {
+		add("OAuth2 needs both oauth2TokenURL and oauth2ClientID: set K6_PROMETHEUS_OAUTH2_TOKEN_URL and K6_PROMETHEUS_OAUTH2_CLIENT_ID")
+	}
+	if mode, err := parseAzureAuthMode(conf.AzureAuth.String); err != nil {
+		check(err)
+	} else if mode == azureAuthClientSecret && (conf.AzureTenantID.String == "" || conf.AzureClientID.String == "" || conf.AzureClientSecret.String == "") {
+		add("azureAuth client-secret needs the app registration: set K6_PROMETHEUS_AZURE_TENANT_ID, " +
+			"K6_PROMETHEUS_AZURE_CLIENT_ID and K6_PROMETHEUS_AZURE_CLIENT_SECRET")
+	}
+	if n := countTrue(basicAuth, bearer, oauth2, azure, google); n > 1 {
+		add("only one authentication method can be used: keep either user/password, " +
+			"bearerToken/bearerTokenFile/influxToken, oauth2*, azureAuth or googleAuth")
+	}
+	if conf.TLSCertFile.Valid != conf.TLSKeyFile.Valid {
+		add("both tlsCertFile and tlsKeyFile must be configured for mutual TLS")
+	}
+
+	if names := mappingNames(); !containsString(names, conf.Mapping.String) {
+		add("mapping %q is unknown, it must be one of %s", conf.Mapping.String, strings.Join(names, ", "))
+	}
+
+	_, err := parseProtocol(conf.Protocol.String, conf.ProtocolVersion.String)
+	check(err)
+	_, err = parseCompression(conf.Compression.String)
+	check(err)
+	_, err = parseTrendStats(conf.TrendStats)
+	check(err)
+	if conf.MaxSeries.Int64 > 0 {
+		_, err = parseSeriesLimitAction(conf.MaxSeriesAction.String)
+		check(err)
+	}
+	_, err = parseOldSampleAction(conf.OldSampleAction.String)
+	check(err)
+	_, err = parseLabelConflictPolicy(conf.LabelConflict.String)
+	check(err)
+	_, err = parseTemporality(conf.Temporality.String)
+	check(err)
+	_, err = parseKubernetesMode(conf.Kubernetes.String)
+	check(err)
+	_, err = parseBufferPolicy(conf.BufferPolicy.String)
+	check(err)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// endpointTransport returns the transport the URL is sent over: HTTP, gRPC or Graphite.
+func endpointTransport(rawURL string) string {
+	switch {
+	case isGRPCURL(rawURL):
+		return "gRPC"
+	case isGraphiteURL(rawURL):
+		return "Graphite"
+	default:
+		return "HTTP"
+	}
+}
+
+// validateEndpointURL checks that the URL of an endpoint is absolute and uses HTTP(S), gRPC or Graphite.
+func validateEndpointURL(option, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%s %q is not a valid URL: %w", option, rawURL, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "grpc", "grpcs", "graphite":
+	default:
+		return fmt.Errorf("%s %q must start with http://, https://, grpc://, grpcs:// or graphite://, "+
+			"e.g. http://localhost:9090/api/v1/write", option, rawURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%s %q has no host, e.g. http://localhost:9090/api/v1/write", option, rawURL)
+	}
+	return nil
+}
+
+func countTrue(values ...bool) int {
+	var n int
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,155 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, NewConfig().Validate())
+
+	testCases := map[string]struct {
+		configure func(*Config)
+		problem   string
+	}{
+		"url-scheme": {
+			func(c *Config) { c.Url = null.StringFrom("localhost:9090/api/v1/write") },
+			`url "localhost:9090/api/v1/write" must start with http://, https://, grpc://, grpcs:// or graphite://, ` +
+				`e.g. http://localhost:9090/api/v1/write`,
+		},
+		"url-host": {
+			func(c *Config) { c.Url = null.StringFrom("http:///api/v1/write") },
+			"has no host",
+		},
+		"failover-url": {
+			func(c *Config) { c.FailoverUrls = []string{"ftp://backup"} },
+			`failoverUrls "ftp://backup" must start with http://`,
+		},
+		"flush-period": {
+			func(c *Config) { c.FlushPeriod = types.NullDurationFrom(0) },
+			"flushPeriod must be positive",
+		},
+		"timestamp-precision": {
+			func(c *Config) { c.TimestampPrecision = types.NullDurationFrom(1500 * time.Microsecond) },
+			"timestampPrecision must be a multiple of 1ms",
+		},
+		"flush-timestamps-raw": {
+			func(c *Config) {
+				c.Mapping = null.StringFrom("raw")
+				c.FlushTimestamps = null.BoolFrom(true)
+			},
+			"flushTimestamps can't be used with the raw mapping",
+		},
+		"job-label-empty": {
+			func(c *Config) {
+				c.JobLabel = null.BoolFrom(true)
+				c.Job = null.StringFrom("")
+			},
+			"job must not be empty",
+		},
+		"label-conflict": {
+			func(c *Config) { c.LabelConflict = null.StringFrom("tag-wins") },
+			"invalid labelConflict",
+		},
+		"flush-timestamps-raw-all": {
+			func(c *Config) {
+				c.Mapping = null.StringFrom("raw-all")
+				c.FlushTimestamps = null.BoolFrom(true)
+			},
+			"flushTimestamps can't be used with the raw-all mapping",
+		},
+		"stream-flush-chunks": {
+			func(c *Config) {
+				c.StreamFlush = null.BoolFrom(true)
+			},
+			"streamFlush needs maxSamplesPerRequest",
+		},
+		"stream-flush-delta": {
+			func(c *Config) {
+				c.StreamFlush = null.BoolFrom(true)
+				c.MaxSamplesPerRequest = null.IntFrom(10000)
+				c.Temporality = null.StringFrom("delta")
+			},
+			"streamFlush can't be used with the delta temporality",
+		},
+		"debug-addr-not-loopback": {
+			func(c *Config) {
+				c.DebugAddr = null.StringFrom(":6060")
+			},
+			"debugAddr must be a loopback address",
+		},
+		"spill-without-memory-limit": {
+			func(c *Config) {
+				c.BufferSpillDir = null.StringFrom("/tmp/spill")
+			},
+			"bufferSpillDir needs bufferMemoryLimit",
+		},
+		"adaptive-flush-bounds": {
+			func(c *Config) {
+				c.AdaptiveFlush = null.BoolFrom(true)
+				c.FlushPeriodMax = types.NullDurationFrom(1)
+			},
+			"flushPeriodMax (1ns) must not be less than flushPeriodMin (1s)",
+		},
+		"password-without-user": {
+			func(c *Config) { c.Password = null.StringFrom("secret") },
+			"password is set without user",
+		},
+		"basic-and-bearer": {
+			func(c *Config) {
+				c.User = null.StringFrom("user")
+				c.BearerToken = null.StringFrom("token")
+			},
+			"only one authentication method",
+		},
+		"oauth2-partial": {
+			func(c *Config) { c.OAuth2ClientID = null.StringFrom("k6") },
+			"OAuth2 needs both oauth2TokenURL and oauth2ClientID",
+		},
+		"tls-key-missing": {
+			func(c *Config) { c.TLSCertFile = null.StringFrom("client.crt") },
+			"both tlsCertFile and tlsKeyFile",
+		},
+		"mapping": {
+			func(c *Config) { c.Mapping = null.StringFrom("prom") },
+			`mapping "prom" is unknown, it must be one of ddsketch, hdr-histogram, histogram, native-histogram, prometheus, raw`,
+		},
+		"temporality": {
+			func(c *Config) { c.Temporality = null.StringFrom("deltas") },
+			`invalid temporality "deltas"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			config := NewConfig()
+			tc.configure(&config)
+			err := config.Validate()
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			require.Len(t, validationErr.Problems, 1, validationErr.Problems)
+			assert.Contains(t, validationErr.Problems[0], tc.problem)
+		})
+	}
+
+	// all problems at once
+	config := NewConfig()
+	config.Url = null.StringFrom("localhost")
+	config.Shards = null.IntFrom(0)
+	config.BufferPolicy = null.StringFrom("drop")
+	err := config.Validate()
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Len(t, validationErr.Problems, 3)
+	assert.Contains(t, err.Error(), "invalid Prometheus remote write config:\n  - url")
+}
@@ -0,0 +1,58 @@
+package remotewrite
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// marshalVictoriaMetricsImport marshals the time series in the JSON line format
+// of the VictoriaMetrics import API (https://docs.victoriametrics.com/#how-to-import-data-in-json-line-format),
+// one series per line:
+//
+//	{"metric":{"__name__":"k6_vus","test_run_id":"..."},"values":[10,12],"timestamps":[1700000000000,1700000001000]}
+//
+// Native histograms and exemplars are not supported by the format, and the
+// samples that are not finite, stale markers included, can't be represented in JSON.
+func marshalVictoriaMetricsImport(series []prompb.TimeSeries) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, ts := range series {
+		var values, timestamps []byte
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			if len(values) > 0 {
+				values = append(values, ',')
+				timestamps = append(timestamps, ',')
+			}
+			values = strconv.AppendFloat(values, s.Value, 'g', -1, 64)
+			timestamps = strconv.AppendInt(timestamps, s.Timestamp, 10)
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		metric := make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			metric[l.Name] = l.Value
+		}
+		// the keys of maps are sorted
+		encoded, err := json.Marshal(metric)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.WriteString(`{"metric":`)
+		buf.Write(encoded)
+		buf.WriteString(`,"values":[`)
+		buf.Write(values)
+		buf.WriteString(`],"timestamps":[`)
+		buf.Write(timestamps)
+		buf.WriteString("]}\n")
+	}
+	return buf.Bytes(), nil
+}
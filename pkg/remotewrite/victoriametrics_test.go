@@ -0,0 +1,86 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestMarshalVictoriaMetricsImport(t *testing.T) {
+	t.Parallel()
+
+	buf, err := marshalVictoriaMetricsImport([]prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}, {Name: "scenario", Value: "\"default\""}},
+			Samples: []prompb.Sample{{Value: 10, Timestamp: 1000}, {Value: 0.5, Timestamp: 2000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_stale"}},
+			Samples: []prompb.Sample{{Value: math.Float64frombits(value.StaleNaN), Timestamp: 3000}},
+		},
+		{
+			Labels:     []prompb.Label{{Name: "__name__", Value: "k6_http_req_duration"}},
+			Histograms: []prompb.Histogram{{Sum: 1, Timestamp: 2000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "k6_inf"}},
+			Samples: []prompb.Sample{{Value: math.Inf(1), Timestamp: 1000}, {Value: 1, Timestamp: 2000}},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t,
+		`{"metric":{"__name__":"k6_vus","scenario":"\"default\""},"values":[10,0.5],"timestamps":[1000,2000]}`+"\n"+
+			`{"metric":{"__name__":"k6_inf"},"values":[1],"timestamps":[2000]}`+"\n",
+		string(buf))
+}
+
+func TestOutputVictoriaMetrics(t *testing.T) {
+	t.Parallel()
+
+	var (
+		headers http.Header
+		query   string
+		body    []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		query = r.URL.RawQuery
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL + "/api/v1/import")
+	config.Protocol = null.StringFrom("victoriametrics")
+	config.ImportQueryArgs = null.StringFrom("extra_label=env=staging&extra_label=team=perf")
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolVictoriaMetrics, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+
+	series := []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "k6_vus"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}
+	encoded, err := new(encodeBuffers).encode(series, protocolVictoriaMetrics, compressionDefault)
+	require.NoError(t, err)
+	require.NoError(t, client.Store(context.Background(), encoded))
+
+	assert.Equal(t, "application/json", headers.Get("Content-Type"))
+	assert.Equal(t, "gzip", headers.Get("Content-Encoding"))
+	assert.Empty(t, headers.Get("X-Prometheus-Remote-Write-Version"))
+	assert.Equal(t, "extra_label=env%3Dstaging&extra_label=team%3Dperf", query)
+	assert.Equal(t, `{"metric":{"__name__":"k6_vus"},"values":[1],"timestamps":[1]}`+"\n",
+		string(decompress(t, "gzip", body)))
+}
@@ -0,0 +1,237 @@
+package remotewrite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const walSegmentExt = ".seg"
+
+// walProtocolExts mark the segments holding requests of a protocol other than remote write 1.0.
+var walProtocolExts = map[protocol]string{
+	protocolV2:                   ".v2",
+	protocolOTLP:                 ".otlp",
+	protocolVictoriaMetrics:      ".vm",
+	protocolInfluxDB:             ".influx",
+	protocolGraphite:             ".graphite",
+	protocolGraphiteTagged:       ".graphitetags",
+	protocolDatadog:              ".dd",
+	protocolDatadogDistributions: ".dddist",
+}
+
+// wal is an on-disk write-ahead log of encoded write requests that could not
+// be delivered because the remote endpoint was unavailable. Each request is
+// kept in its own segment file and replayed, oldest first, once the endpoint
+// is reachable again. It is safe for concurrent use.
+type wal struct {
+	mu sync.Mutex
+	// replayMu serializes the replays, which send the segments without holding mu
+	// so that appending and counting them isn't blocked by the requests
+	replayMu sync.Mutex
+	dir      string
+	maxSize  int64
+	maxAge   time.Duration
+	// seq numbers the segments, so that those appended in the same clock
+	// tick, e.g. by concurrent shards on a coarse clock, get distinct names
+	seq uint64
+
+	now func() time.Time
+}
+
+type walSegment struct {
+	path     string
+	size     int64
+	created  time.Time
+	seq      uint64
+	protocol protocol
+}
+
+func newWAL(dir string, maxSize int64, maxAge time.Duration) (*wal, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %w", err)
+	}
+
+	return &wal{
+		dir:     dir,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		now:     time.Now,
+	}, nil
+}
+
+// append stores the encoded request as a new segment and applies retention limits.
+// It returns the number of segments removed by the latter.
+func (w *wal) append(encoded []byte, p protocol) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.seq++
+	name := fmt.Sprintf("%020d-%06d%s%s", w.now().UnixNano(), w.seq, walProtocolExts[p], walSegmentExt)
+
+	// write to a temporary file first so that a crash can't leave a partial segment behind
+	tmp := filepath.Join(w.dir, name+".tmp")
+	if err := os.WriteFile(tmp, encoded, 0o600); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, filepath.Join(w.dir, name)); err != nil {
+		return 0, err
+	}
+
+	return w.truncate()
+}
+
+// segments returns the segments currently on disk, oldest first.
+func (w *wal) segments() ([]walSegment, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]walSegment, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), walSegmentExt) {
+			continue
+		}
+
+		base := strings.TrimSuffix(entry.Name(), walSegmentExt)
+		p := protocolV1
+		for segmentProtocol, ext := range walProtocolExts {
+			if strings.HasSuffix(base, ext) {
+				base = strings.TrimSuffix(base, ext)
+				p = segmentProtocol
+			}
+		}
+
+		var (
+			nanos int64
+			seq   uint64
+		)
+		if n, _ := fmt.Sscanf(base, "%d-%d", &nanos, &seq); n != 2 {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, walSegment{
+			path:     filepath.Join(w.dir, entry.Name()),
+			size:     info.Size(),
+			created:  time.Unix(0, nanos),
+			seq:      seq,
+			protocol: p,
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].created.Equal(segments[j].created) {
+			return segments[i].seq < segments[j].seq
+		}
+		return segments[i].created.Before(segments[j].created)
+	})
+
+	return segments, nil
+}
+
+// len returns the number of pending segments.
+func (w *wal) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	segments, err := w.segments()
+	if err != nil {
+		return 0
+	}
+	return len(segments)
+}
+
+// replay sends the pending segments oldest first and removes the delivered ones.
+// It stops at the first segment that fails with a recoverable error so that
+// the order of requests is preserved; segments rejected with a non-recoverable
+// error are dropped as they would never be accepted. It returns the number of
+// delivered segments. The segments appended during the replay are left for the next one.
+func (w *wal) replay(store func([]byte, protocol) error) (int, error) {
+	w.replayMu.Lock()
+	defer w.replayMu.Unlock()
+
+	w.mu.Lock()
+	segments, err := w.segments()
+	w.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	var delivered int
+	for _, segment := range segments {
+		encoded, err := os.ReadFile(segment.path)
+		if os.IsNotExist(err) {
+			// removed by the retention limits in the meantime
+			continue
+		}
+		if err != nil {
+			return delivered, err
+		}
+
+		if err := store(encoded, segment.protocol); err != nil {
+			if isRecoverable(err) {
+				return delivered, err
+			}
+		} else {
+			delivered++
+		}
+
+		if err := w.remove(segment.path); err != nil {
+			return delivered, err
+		}
+	}
+
+	return delivered, nil
+}
+
+// remove removes the segment, unless the retention limits already did.
+func (w *wal) remove(path string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// truncate removes the segments older than maxAge and then the oldest ones
+// until the total size is within maxSize. It returns the number of removed segments.
+func (w *wal) truncate() (int, error) {
+	segments, err := w.segments()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, segment := range segments {
+		total += segment.size
+	}
+
+	var removed int
+	for _, segment := range segments {
+		expired := w.maxAge > 0 && w.now().Sub(segment.created) > w.maxAge
+		oversized := w.maxSize > 0 && total > w.maxSize
+		if !expired && !oversized {
+			break
+		}
+
+		if err := os.Remove(segment.path); err != nil {
+			return removed, err
+		}
+		total -= segment.size
+		removed++
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,199 @@
+package remotewrite
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestWALAppendReplay(t *testing.T) {
+	t.Parallel()
+
+	w, err := newWAL(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+
+	for _, payload := range []string{"first", "second", "third"} {
+		_, err := w.append([]byte(payload), protocolV1)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, w.len())
+
+	var replayed []string
+	delivered, err := w.replay(func(encoded []byte, _ protocol) error {
+		replayed = append(replayed, string(encoded))
+		if string(encoded) == "second" {
+			return errors.New("400 Bad Request")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, []string{"first", "second", "third"}, replayed)
+	assert.Equal(t, 0, w.len())
+}
+
+func TestWALProtocolVersion(t *testing.T) {
+	t.Parallel()
+
+	w, err := newWAL(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+
+	now := time.Now()
+	w.now = func() time.Time { return now }
+	_, err = w.append([]byte("first"), protocolV2)
+	require.NoError(t, err)
+	w.now = func() time.Time { return now.Add(time.Millisecond) }
+	_, err = w.append([]byte("second"), protocolV1)
+	require.NoError(t, err)
+
+	var versions []protocol
+	_, err = w.replay(func(_ []byte, version protocol) error {
+		versions = append(versions, version)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []protocol{protocolV2, protocolV1}, versions)
+}
+
+func TestWALAppendSameTime(t *testing.T) {
+	t.Parallel()
+
+	w, err := newWAL(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+
+	// e.g. concurrent shards on a coarse clock
+	now := time.Now()
+	w.now = func() time.Time { return now }
+	_, err = w.append([]byte("first"), protocolV1)
+	require.NoError(t, err)
+	_, err = w.append([]byte("second"), protocolV1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, w.len())
+
+	var replayed []string
+	_, err = w.replay(func(encoded []byte, _ protocol) error {
+		replayed = append(replayed, string(encoded))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, replayed)
+}
+
+func TestWALReplayUnlocked(t *testing.T) {
+	t.Parallel()
+
+	w, err := newWAL(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+
+	_, err = w.append([]byte("first"), protocolV1)
+	require.NoError(t, err)
+
+	// the segments are sent without holding the lock, e.g. while shards append theirs
+	delivered, err := w.replay(func(_ []byte, _ protocol) error {
+		assert.Equal(t, 1, w.len())
+		_, err := w.append([]byte("second"), protocolV1)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+
+	var replayed []string
+	_, err = w.replay(func(encoded []byte, _ protocol) error {
+		replayed = append(replayed, string(encoded))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"second"}, replayed)
+}
+
+func TestWALTruncate(t *testing.T) {
+	t.Parallel()
+
+	w, err := newWAL(t.TempDir(), 10, time.Minute)
+	require.NoError(t, err)
+
+	now := time.Now()
+	steps := []struct {
+		at      time.Duration
+		payload string
+		removed int
+	}{
+		{-2 * time.Minute, "old", 0},
+		{0, "1234", 1}, // the old segment expired
+		{time.Millisecond, "5678", 0},
+		{2 * time.Millisecond, "abcd", 1}, // the oldest segment is removed to stay within the size limit
+	}
+	for _, step := range steps {
+		at := now.Add(step.at)
+		w.now = func() time.Time { return at }
+		removed, err := w.append([]byte(step.payload), protocolV1)
+		require.NoError(t, err)
+		assert.Equal(t, step.removed, removed, step.payload)
+	}
+
+	segments, err := w.segments()
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+}
+
+func TestOutputSendWithWAL(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		down     = true
+		received []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		buf := make([]byte, r.ContentLength)
+		_, _ = r.Body.Read(buf)
+		received = append(received, string(buf))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.Url = null.StringFrom(server.URL)
+	config.RetryMaxAttempts = null.IntFrom(1)
+
+	remoteConfig, err := config.ConstructRemoteConfig()
+	require.NoError(t, err)
+	client, err := newWriteClient("test", remoteConfig, protocolV1, compressionDefault, config.transportConfig())
+	require.NoError(t, err)
+	w, err := newWAL(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+
+	o := &Output{
+		config: config,
+		client: client,
+		retry:  newRetryPolicy(config),
+		wal:    w,
+		logger: logrus.New(),
+	}
+
+	require.NoError(t, o.send(nil, []byte("first"), protocolV1))
+	require.NoError(t, o.send(nil, []byte("second"), protocolV1))
+	assert.Equal(t, 2, w.len())
+
+	mu.Lock()
+	down = false
+	mu.Unlock()
+
+	require.NoError(t, o.send(nil, []byte("third"), protocolV1))
+	assert.Equal(t, 0, w.len())
+	assert.Equal(t, []string{"first", "second", "third"}, received)
+}
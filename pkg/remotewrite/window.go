@@ -0,0 +1,185 @@
+package remotewrite
+
+import (
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"go.k6.io/k6/metrics"
+)
+
+// windowAggregator pre-aggregates the series in windows of a fixed resolution: only
+// the latest value of each label set within a window is sent, with the end of the
+// window as timestamp, once the window is over. As the values of the mappings are
+// cumulative, the latest one is the aggregate of the window: the sum of the counters
+// and the last value of the gauges, while the stats of the trends are computed over
+// the window only, see MetricsStorage.startWindow.
+type windowAggregator struct {
+	// resolution of the windows, in milliseconds
+	resolution int64
+	pending    map[string]*windowSeries
+	// order of the label sets in pending, so that the series are sent in a stable order
+	order []string
+	// sent holds the end of the latest window sent for each label set
+	sent    map[string]int64
+	closing bool
+}
+
+// windowSeries holds the values of the windows of a label set that are not sent yet,
+// with the end of their window as timestamp.
+type windowSeries struct {
+	labels     []prompb.Label
+	samples    []prompb.Sample
+	histograms []prompb.Histogram
+	exemplars  []prompb.Exemplar
+}
+
+func newWindowAggregator(resolution time.Duration) *windowAggregator {
+	if resolution <= 0 {
+		return nil
+	}
+	return &windowAggregator{
+		resolution: resolution.Milliseconds(),
+		pending:    make(map[string]*windowSeries),
+		sent:       make(map[string]int64),
+	}
+}
+
+// end returns the end of the window of the time t, in milliseconds.
+func (a *windowAggregator) end(t int64) int64 {
+	return (t/a.resolution + 1) * a.resolution
+}
+
+// aggregate adds the samples of the series to their windows and returns the series
+// with the values of the windows over at now, or of all of them once closing.
+func (a *windowAggregator) aggregate(series []prompb.TimeSeries, now time.Time) []prompb.TimeSeries {
+	for _, ts := range series {
+		key := labelsKey(ts.Labels)
+		ws, ok := a.pending[key]
+		if !ok {
+			ws = &windowSeries{labels: ts.Labels}
+			a.pending[key] = ws
+			a.order = append(a.order, key)
+		}
+
+		// late samples go to the first window not sent yet, the values never go back in time
+		first := a.sent[key] + a.resolution
+		for _, s := range ts.Samples {
+			end := maxInt64(a.end(s.Timestamp), first)
+			if n := len(ws.samples); n > 0 && ws.samples[n-1].Timestamp >= end {
+				ws.samples[n-1].Value = s.Value
+				continue
+			}
+			ws.samples = append(ws.samples, prompb.Sample{Value: s.Value, Timestamp: end})
+		}
+		for _, h := range ts.Histograms {
+			end := maxInt64(a.end(h.Timestamp), first)
+			if n := len(ws.histograms); n > 0 && ws.histograms[n-1].Timestamp >= end {
+				h.Timestamp = ws.histograms[n-1].Timestamp
+				ws.histograms[n-1] = h
+				continue
+			}
+			h.Timestamp = end
+			ws.histograms = append(ws.histograms, h)
+		}
+		ws.exemplars = append(ws.exemplars, ts.Exemplars...)
+	}
+
+	nowMs := timestamp.FromTime(now)
+	out := getTimeSeries()
+	order := a.order[:0]
+	for _, key := range a.order {
+		ws := a.pending[key]
+		ts := prompb.TimeSeries{Labels: ws.labels}
+		ts.Samples, ws.samples = a.over(ws.samples, nowMs)
+		ts.Histograms, ws.histograms = a.overHistograms(ws.histograms, nowMs)
+
+		if len(ts.Samples) > 0 || len(ts.Histograms) > 0 {
+			ts.Exemplars, ws.exemplars = ws.exemplars, nil
+			out = append(out, ts)
+			a.sent[key] = a.latest(ts)
+		}
+		if len(ws.samples) == 0 && len(ws.histograms) == 0 {
+			delete(a.pending, key)
+			continue
+		}
+		order = append(order, key)
+	}
+	a.order = order
+	return out
+}
+
+// over splits the samples between those of the windows over at now and the others.
+// Once closing, all the windows are over and those still open are sent at now.
+func (a *windowAggregator) over(samples []prompb.Sample, now int64) ([]prompb.Sample, []prompb.Sample) {
+	i := 0
+	for i < len(samples) && (a.closing || samples[i].Timestamp <= now) {
+		if samples[i].Timestamp > now {
+			samples[i].Timestamp = maxInt64(now, samples[i].Timestamp-a.resolution+1)
+		}
+		i++
+	}
+	return samples[:i:i], samples[i:]
+}
+
+func (a *windowAggregator) overHistograms(histograms []prompb.Histogram, now int64) ([]prompb.Histogram, []prompb.Histogram) {
+	i := 0
+	for i < len(histograms) && (a.closing || histograms[i].Timestamp <= now) {
+		if histograms[i].Timestamp > now {
+			histograms[i].Timestamp = maxInt64(now, histograms[i].Timestamp-a.resolution+1)
+		}
+		i++
+	}
+	return histograms[:i:i], histograms[i:]
+}
+
+// latest returns the end of the latest window of the series.
+func (a *windowAggregator) latest(ts prompb.TimeSeries) int64 {
+	var latest int64
+	if n := len(ts.Samples); n > 0 {
+		latest = ts.Samples[n-1].Timestamp
+	}
+	if n := len(ts.Histograms); n > 0 {
+		latest = maxInt64(latest, ts.Histograms[n-1].Timestamp)
+	}
+	return latest
+}
+
+// close makes the next aggregate send the windows that are still open, when the test ends.
+func (a *windowAggregator) close() {
+	if a != nil {
+		a.closing = true
+	}
+}
+
+// hasPending reports whether some windows are not sent yet.
+func (a *windowAggregator) hasPending() bool {
+	return a != nil && len(a.pending) > 0
+}
+
+// startWindow starts the Trend sink, or sketch, of the sample label set from scratch
+// when the sample is in a window after the one of the values in the sink, so that the
+// stats are computed over each window. Other sinks, e.g. native histograms, are cumulative.
+func (ms *MetricsStorage) startWindow(sample metrics.Sample, labels []prompb.Label, window int64) {
+	if ms.windows == nil {
+		ms.windows = make(map[string]int64)
+	}
+	key := storageKey(sample, labels)
+	if window <= ms.windows[key] {
+		return
+	}
+	ms.windows[key] = window
+	if m, ok := ms.m[key]; ok {
+		switch m.Sink.(type) {
+		case *metrics.TrendSink, *ddSketchSink:
+			delete(ms.m, key)
+		}
+	}
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
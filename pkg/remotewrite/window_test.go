@@ -0,0 +1,100 @@
+package remotewrite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestWindowAggregator(t *testing.T) {
+	t.Parallel()
+
+	a := newWindowAggregator(10 * time.Second)
+	labels := []prompb.Label{{Name: "__name__", Value: "k6_http_reqs_total"}}
+	series := func(samples ...prompb.Sample) []prompb.TimeSeries {
+		return []prompb.TimeSeries{{Labels: labels, Samples: samples}}
+	}
+
+	// only the windows over are sent, with the latest value of each
+	out := a.aggregate(series(
+		prompb.Sample{Value: 1, Timestamp: 1000},
+		prompb.Sample{Value: 2, Timestamp: 5000},
+		prompb.Sample{Value: 3, Timestamp: 12000},
+	), time.UnixMilli(11000))
+	assert.Equal(t, series(prompb.Sample{Value: 2, Timestamp: 10000}), out)
+	assert.True(t, a.hasPending())
+
+	// a late sample goes to the first window not sent yet
+	out = a.aggregate(series(prompb.Sample{Value: 4, Timestamp: 8000}), time.UnixMilli(15000))
+	assert.Empty(t, out)
+
+	// once closing, the open windows are sent at the latest with the current time
+	a.close()
+	out = a.aggregate(nil, time.UnixMilli(15000))
+	assert.Equal(t, series(prompb.Sample{Value: 4, Timestamp: 15000}), out)
+	assert.False(t, a.hasPending())
+
+	assert.Nil(t, newWindowAggregator(0))
+}
+
+func TestOutputAggregationWindow(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.AggregationWindow = types.NullDurationFrom(10 * time.Second)
+	config.TrendStats = []string{"max", "count"}
+	require.NoError(t, config.Validate())
+
+	o := &Output{
+		config:  config,
+		metrics: newMetricsStorage(),
+		checks:  newCheckCounters(),
+		mapping: NewMapping(config),
+		window:  newWindowAggregator(10 * time.Second),
+		logger:  logrus.New(),
+	}
+
+	duration := &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend}
+	reqs := &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}
+	tags := metrics.NewSampleTags(map[string]string{})
+	start := time.UnixMilli(0)
+	flush := func(now time.Duration, samples ...metrics.Sample) map[string][]prompb.Sample {
+		series := o.window.aggregate(o.convertToTimeSeries([]metrics.SampleContainer{metrics.Samples(samples)}), start.Add(now))
+		values := make(map[string][]prompb.Sample)
+		for _, ts := range series {
+			values[ts.Labels[labelIndex(ts.Labels, "__name__")].Value] = ts.Samples
+		}
+		return values
+	}
+	sample := func(m *metrics.Metric, at time.Duration, v float64) metrics.Sample {
+		return metrics.Sample{Metric: m, Tags: tags, Time: start.Add(at), Value: v}
+	}
+
+	assert.Empty(t, flush(5*time.Second,
+		sample(duration, time.Second, 300), sample(reqs, time.Second, 1),
+		sample(duration, 2*time.Second, 100), sample(reqs, 2*time.Second, 1),
+	))
+	assert.Equal(t, map[string][]prompb.Sample{
+		"k6_http_req_duration_max":   {{Value: 300, Timestamp: 10000}},
+		"k6_http_req_duration_count": {{Value: 2, Timestamp: 10000}},
+		"k6_http_reqs":               {{Value: 2, Timestamp: 10000}},
+	}, flush(11*time.Second, sample(duration, 11*time.Second, 50), sample(reqs, 11*time.Second, 1)))
+
+	// the stats of the trends are over the window, the counters keep running
+	o.window.close()
+	assert.Equal(t, map[string][]prompb.Sample{
+		"k6_http_req_duration_max":   {{Value: 50, Timestamp: 12000}},
+		"k6_http_req_duration_count": {{Value: 1, Timestamp: 12000}},
+		"k6_http_reqs":               {{Value: 3, Timestamp: 12000}},
+	}, flush(12*time.Second))
+
+	config.Temporality = null.StringFrom(string(temporalityDelta))
+	assert.Error(t, config.Validate())
+}